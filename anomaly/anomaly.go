@@ -0,0 +1,328 @@
+package anomaly
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/mailer"
+	"urlshort.ru/m/models"
+	"urlshort.ru/m/stats"
+	"urlshort.ru/m/webhooks"
+)
+
+const LOGGER_HANDLER = "anomaly"
+
+// Actions applied to a link when a spike is detected, set with ANOMALY_ACTION.
+const (
+	ACTION_NONE     = "none"
+	ACTION_THROTTLE = "throttle"
+	ACTION_PAUSE    = "pause"
+)
+
+// Spike is an hour in which a link received more clicks than its baseline allows.
+type Spike struct {
+	URL       models.URL
+	Bucket    time.Time
+	Clicks    int64
+	Baseline  float64
+	Threshold float64
+}
+
+// Threshold returns the number of clicks in an hour above which the hour is a spike.
+//
+// The baseline is the mean of the hourly clicks of the history. An hour is a spike when it
+// exceeds the mean by ANOMALY_SIGMA standard deviations and by ANOMALY_FACTOR times, and
+// has at least ANOMALY_MIN_CLICKS clicks. The factor keeps links with a flat history, whose
+// deviation is close to zero, from alerting on small changes.
+//
+// Parameters:
+// - history: the clicks of the previous hours, hours without clicks included as zero.
+//
+// Returns:
+// - float64: the baseline.
+// - float64: the threshold.
+func Threshold(history []int64) (float64, float64) {
+	var mean, variance float64
+	if len(history) > 0 {
+		for _, clicks := range history {
+			mean += float64(clicks)
+		}
+		mean /= float64(len(history))
+		for _, clicks := range history {
+			variance += (float64(clicks) - mean) * (float64(clicks) - mean)
+		}
+		variance /= float64(len(history))
+	}
+	threshold := math.Max(float64(config.ConfigAll.ANOMALY_MIN_CLICKS), mean*config.ConfigAll.ANOMALY_FACTOR)
+	threshold = math.Max(threshold, mean+config.ConfigAll.ANOMALY_SIGMA*math.Sqrt(variance))
+	return mean, threshold
+}
+
+// hourly sums the total dimension rollups of all traffic classes per link and hour.
+func hourly(rows []models.ClickRollup) map[uint]map[time.Time]int64 {
+	result := map[uint]map[time.Time]int64{}
+	for _, row := range rows {
+		if result[row.URLID] == nil {
+			result[row.URLID] = map[time.Time]int64{}
+		}
+		result[row.URLID][row.Bucket.UTC()] += row.Clicks
+	}
+	return result
+}
+
+// Detect finds the links whose clicks in the current or the previous hour exceed the
+// threshold computed from the ANOMALY_BASELINE_HOURS hours before. The previous hour is
+// checked as well, so a spike starting just before the hour ends is not missed.
+//
+// All traffic counts, bots included, since a flood of automated requests is what the
+// detection protects against. Links younger than an hour have no baseline and are skipped;
+// younger than ANOMALY_BASELINE_HOURS, only the hours since their creation form the baseline.
+//
+// Parameters:
+// - db: the database holding the rollups.
+// - now: the current time.
+//
+// Returns:
+// - []Spike: the spikes, at most one per link and hour.
+// - error: a database error.
+func Detect(db *gorm.DB, now time.Time) ([]Spike, error) {
+	current := stats.HourBucket(now).UTC()
+	previous := current.Add(-time.Hour)
+
+	var recent []models.ClickRollup
+	err := db.Where("dimension = ? AND bucket >= ? AND bucket <= ?", stats.DIMENSION_TOTAL, previous, current).Find(&recent).Error
+	if err != nil {
+		return nil, err
+	}
+	candidates := map[uint]map[time.Time]int64{}
+	for urlID, buckets := range hourly(recent) {
+		for bucket, clicks := range buckets {
+			if clicks < config.ConfigAll.ANOMALY_MIN_CLICKS {
+				continue
+			}
+			if candidates[urlID] == nil {
+				candidates[urlID] = map[time.Time]int64{}
+			}
+			candidates[urlID][bucket] = clicks
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	urlIDs := make([]uint, 0, len(candidates))
+	for urlID := range candidates {
+		urlIDs = append(urlIDs, urlID)
+	}
+	var urls []models.URL
+	if err := db.Where("id IN ?", urlIDs).Find(&urls).Error; err != nil {
+		return nil, err
+	}
+
+	hours := config.ConfigAll.ANOMALY_BASELINE_HOURS
+	var history []models.ClickRollup
+	err = db.Where("url_id IN ? AND dimension = ? AND bucket >= ? AND bucket < ?", urlIDs, stats.DIMENSION_TOTAL, previous.Add(-time.Duration(hours)*time.Hour), current).
+		Find(&history).Error
+	if err != nil {
+		return nil, err
+	}
+	past := hourly(history)
+
+	var spikes []Spike
+	for _, url := range urls {
+		created := stats.HourBucket(url.CreatedAt).UTC()
+		for bucket, clicks := range candidates[url.ID] {
+			window := hours
+			if age := int(bucket.Sub(created) / time.Hour); age < window {
+				window = age
+			}
+			if window < 1 {
+				continue
+			}
+			counts := make([]int64, window)
+			for i := range counts {
+				counts[i] = past[url.ID][bucket.Add(-time.Duration(i+1)*time.Hour)]
+			}
+			baseline, threshold := Threshold(counts)
+			if float64(clicks) > threshold {
+				spikes = append(spikes, Spike{URL: url, Bucket: bucket, Clicks: clicks, Baseline: baseline, Threshold: threshold})
+			}
+		}
+	}
+	return spikes, nil
+}
+
+// apply protects a link with the given action.
+func apply(db *gorm.DB, url models.URL, action string, now time.Time) error {
+	switch action {
+	case ACTION_THROTTLE:
+		until := now.Add(config.ConfigAll.ANOMALY_THROTTLE_DURATION)
+		return db.Model(&models.URL{}).Where("id = ?", url.ID).Update("throttled_until", until).Error
+	case ACTION_PAUSE:
+		return db.Model(&models.URL{}).Where("id = ?", url.ID).Update("paused", true).Error
+	}
+	return nil
+}
+
+// notify sends a new alert to the webhooks of the link owner subscribed to link.spike and
+// mails it to the owner and to ANOMALY_ALERT_EMAIL. Errors are logged, the alert is already stored.
+func notify(db *gorm.DB, url models.URL, data webhooks.SpikeData) {
+	if _, err := webhooks.Enqueue(db, url.UserID, webhooks.EVENT_LINK_SPIKE, data); err != nil {
+		slog.Error(LOGGER_HANDLER, err)
+	}
+
+	var recipients []string
+	if url.UserID != nil {
+		var owner models.User
+		if err := db.Select("email").First(&owner, *url.UserID).Error; err != nil {
+			slog.Error(LOGGER_HANDLER, err)
+		} else {
+			recipients = append(recipients, owner.Email)
+		}
+	}
+	if config.ConfigAll.ANOMALY_ALERT_EMAIL != "" {
+		recipients = append(recipients, config.ConfigAll.ANOMALY_ALERT_EMAIL)
+	}
+	for _, recipient := range recipients {
+		if err := mailer.Send(recipient, mailer.TEMPLATE_SPIKE_ALERT, data); err != nil {
+			slog.Error(LOGGER_HANDLER, err)
+		}
+	}
+}
+
+// Check detects spikes and raises an alert for each link and hour once.
+//
+// A new alert applies ANOMALY_ACTION to the link, is logged and sent with notify. A spike
+// already alerted only updates the click count of its alert.
+//
+// Parameters:
+// - db: the database.
+// - now: the current time.
+//
+// Returns:
+// - []models.Alert: the new alerts.
+// - error: a database error.
+func Check(db *gorm.DB, now time.Time) ([]models.Alert, error) {
+	spikes, err := Detect(db, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var alerts []models.Alert
+	for _, spike := range spikes {
+		alert := models.Alert{
+			URLID:     spike.URL.ID,
+			Bucket:    spike.Bucket,
+			Clicks:    spike.Clicks,
+			Baseline:  spike.Baseline,
+			Threshold: spike.Threshold,
+			Action:    config.ConfigAll.ANOMALY_ACTION,
+		}
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&alert)
+		if result.Error != nil {
+			return alerts, result.Error
+		}
+		if result.RowsAffected == 0 {
+			err := db.Model(&models.Alert{}).Where("url_id = ? AND bucket = ?", alert.URLID, alert.Bucket).
+				Update("clicks", alert.Clicks).Error
+			if err != nil {
+				return alerts, err
+			}
+			continue
+		}
+
+		if err := apply(db, spike.URL, alert.Action, now); err != nil {
+			return alerts, err
+		}
+		slog.Warn(LOGGER_HANDLER, "spike", spike.URL.ShortURL, "clicks", spike.Clicks, "baseline", spike.Baseline, "action", alert.Action)
+		notify(db, spike.URL, webhooks.SpikeData{
+			ShortURL:  spike.URL.ShortURL,
+			Bucket:    alert.Bucket,
+			Clicks:    alert.Clicks,
+			Baseline:  alert.Baseline,
+			Threshold: alert.Threshold,
+			Action:    alert.Action,
+		})
+		alerts = append(alerts, alert)
+	}
+	return alerts, nil
+}
+
+// Resolve marks an alert handled and lifts the pause or throttle it applied to its link.
+//
+// Parameters:
+// - db: the database.
+// - alert: the alert.
+//
+// Returns:
+// - models.Alert: the resolved alert.
+// - error: a database error.
+func Resolve(db *gorm.DB, alert models.Alert) (models.Alert, error) {
+	now := time.Now()
+	alert.ResolvedAt = &now
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&alert).Update("resolved_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.URL{}).Where("id = ?", alert.URLID).
+			Updates(map[string]any{"paused": false, "throttled_until": nil}).Error
+	})
+	return alert, err
+}
+
+// window counts the redirects of a throttled link in one second.
+type window struct {
+	second int64
+	count  int
+}
+
+var (
+	limiterMu sync.Mutex
+	limiter   = map[uint]window{}
+)
+
+// Allow reports whether a redirect of a link may be served now. Until ThrottledUntil a link
+// serves at most ANOMALY_THROTTLE_RATE redirects per second in each process.
+//
+// Parameters:
+// - url: the link.
+// - now: the current time.
+//
+// Returns:
+// - bool: true if the redirect is allowed.
+func Allow(url models.URL, now time.Time) bool {
+	limiterMu.Lock()
+	defer limiterMu.Unlock()
+	if url.ThrottledUntil == nil || !now.Before(*url.ThrottledUntil) {
+		delete(limiter, url.ID)
+		return true
+	}
+	current := limiter[url.ID]
+	if current.second != now.Unix() {
+		current = window{second: now.Unix()}
+	}
+	current.count++
+	limiter[url.ID] = current
+	return current.count <= config.ConfigAll.ANOMALY_THROTTLE_RATE
+}
+
+// Start runs Check every ANOMALY_INTERVAL in the background.
+// With prefork it runs in the master process only, so every alert is raised once.
+//
+// Parameters:
+// - db: the database.
+func Start(db *gorm.DB) {
+	go func() {
+		for {
+			if _, err := Check(db, time.Now()); err != nil {
+				slog.Error(LOGGER_HANDLER, err)
+			}
+			time.Sleep(config.ConfigAll.ANOMALY_INTERVAL)
+		}
+	}()
+}
@@ -0,0 +1,182 @@
+package anomaly_test
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"urlshort.ru/m/anomaly"
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/mailer"
+	"urlshort.ru/m/models"
+	"urlshort.ru/m/stats"
+)
+
+// createURL creates a link two days old with the given clicks per hour, followed by the
+// given clicks in the current hour.
+func createURL(t *testing.T, shortURL string, hourly int64, current int64, now time.Time) models.URL {
+	db := models.DATABASE
+	var old models.URL
+	if db.Unscoped().Where("short_url = ?", shortURL).First(&old).Error == nil {
+		db.Unscoped().Where("url_id = ?", old.ID).Delete(&models.ClickRollup{})
+		db.Unscoped().Where("url_id = ?", old.ID).Delete(&models.Alert{})
+		db.Unscoped().Delete(&old)
+	}
+
+	url := models.URL{OriginalURL: "https://example.com/" + shortURL, ShortURL: shortURL, CreatedAt: now.Add(-48 * time.Hour)}
+	if err := db.Create(&url).Error; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	bucket := stats.HourBucket(now).UTC()
+	rows := []models.ClickRollup{{URLID: url.ID, Bucket: bucket, Dimension: stats.DIMENSION_TOTAL, Traffic: models.TRAFFIC_HUMAN, Clicks: current}}
+	for i := 1; i <= 24; i++ {
+		rows = append(rows, models.ClickRollup{URLID: url.ID, Bucket: bucket.Add(-time.Duration(i) * time.Hour), Dimension: stats.DIMENSION_TOTAL, Traffic: models.TRAFFIC_HUMAN, Clicks: hourly})
+	}
+	if err := db.Create(&rows).Error; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return url
+}
+
+// setConfig sets the detection settings used by the tests.
+func setConfig(action string) {
+	config.ConfigAll.ANOMALY_BASELINE_HOURS = 24
+	config.ConfigAll.ANOMALY_MIN_CLICKS = 100
+	config.ConfigAll.ANOMALY_FACTOR = 10
+	config.ConfigAll.ANOMALY_SIGMA = 6
+	config.ConfigAll.ANOMALY_ACTION = action
+	config.ConfigAll.ANOMALY_THROTTLE_RATE = 2
+	config.ConfigAll.ANOMALY_THROTTLE_DURATION = time.Hour
+}
+
+// alertsOf returns the alerts of a link among the given alerts.
+func alertsOf(alerts []models.Alert, url models.URL) []models.Alert {
+	var result []models.Alert
+	for _, alert := range alerts {
+		if alert.URLID == url.ID {
+			result = append(result, alert)
+		}
+	}
+	return result
+}
+
+// TestThreshold tests the baseline and threshold of flat and varying histories.
+func TestThreshold(t *testing.T) {
+	setConfig(anomaly.ACTION_NONE)
+	tests := []struct {
+		history   []int64
+		baseline  float64
+		threshold float64
+	}{
+		{[]int64{}, 0, 100},
+		{[]int64{10, 10, 10, 10}, 10, 100},
+		{[]int64{50, 50, 50, 50}, 50, 500},
+		{[]int64{0, 200, 0, 200}, 100, 1000},
+		{[]int64{0, 0, 0, 4000}, 1000, 1000 + 6*math.Sqrt(3000000)},
+	}
+	for _, test := range tests {
+		baseline, threshold := anomaly.Threshold(test.history)
+		if baseline != test.baseline || threshold != test.threshold {
+			t.Errorf("Threshold(%v) = %v, %v, expected %v, %v", test.history, baseline, threshold, test.baseline, test.threshold)
+		}
+	}
+}
+
+// TestCheck tests that a spike raises one alert, mails it, pauses its link and is resolved.
+func TestCheck(t *testing.T) {
+	db := models.DATABASE
+	setConfig(anomaly.ACTION_PAUSE)
+	now := time.Now()
+	spiking := createURL(t, "spike-test", 10, 10000, now)
+	steady := createURL(t, "spike-steady", 200, 250, now)
+
+	owner := models.User{Email: "spike-owner@example.com", Password: "-"}
+	db.Unscoped().Where("email = ?", owner.Email).Delete(&models.User{})
+	if err := db.Create(&owner).Error; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	db.Model(&spiking).Update("user_id", owner.ID)
+
+	outbox := t.TempDir()
+	original := mailer.Default
+	mailer.Default = &mailer.FileMailer{Dir: outbox}
+	defer func() { mailer.Default = original }()
+	config.ConfigAll.MAIL_FROM = "no-reply@example.com"
+	config.ConfigAll.ANOMALY_ALERT_EMAIL = "ops@example.com"
+	defer func() { config.ConfigAll.ANOMALY_ALERT_EMAIL = "" }()
+
+	alerts, err := anomaly.Check(db, now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(alertsOf(alerts, steady)) != 0 {
+		t.Errorf("Expected no alert for steady traffic, got %+v", alertsOf(alerts, steady))
+	}
+	raised := alertsOf(alerts, spiking)
+	if len(raised) != 1 || raised[0].Clicks != 10000 || raised[0].Baseline != 10 || raised[0].Action != anomaly.ACTION_PAUSE {
+		t.Fatalf("Expected one alert for the spike, got %+v", raised)
+	}
+
+	var url models.URL
+	db.First(&url, spiking.ID)
+	if !url.Paused {
+		t.Errorf("Expected the link to be paused")
+	}
+
+	alerts, err = anomaly.Check(db, now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(alertsOf(alerts, spiking)) != 0 {
+		t.Errorf("Expected the spike to be alerted once, got %+v", alerts)
+	}
+	mails, _ := filepath.Glob(filepath.Join(outbox, "*.eml"))
+	if len(mails) != 2 {
+		t.Fatalf("Expected the alert to be mailed to the owner and the alert address, got %v", mails)
+	}
+	for _, file := range mails {
+		data, _ := os.ReadFile(file)
+		if !strings.Contains(string(data), "/spike-test received 10000 clicks") {
+			t.Errorf("Unexpected mail: %s", data)
+		}
+	}
+
+	if _, err := anomaly.Resolve(db, raised[0]); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	db.First(&url, spiking.ID)
+	if url.Paused {
+		t.Errorf("Expected the link to be resumed")
+	}
+}
+
+// TestAllow tests the redirect limit of throttled links.
+func TestAllow(t *testing.T) {
+	setConfig(anomaly.ACTION_THROTTLE)
+	now := time.Now()
+	until := now.Add(time.Minute)
+	throttled := models.URL{ShortURL: "throttled", ThrottledUntil: &until}
+	throttled.ID = 9100
+
+	for i, want := range []bool{true, true, false} {
+		if got := anomaly.Allow(throttled, now); got != want {
+			t.Errorf("Redirect %d: expected %v, got %v", i+1, want, got)
+		}
+	}
+	if !anomaly.Allow(throttled, now.Add(time.Second)) {
+		t.Errorf("Expected the limit to reset after a second")
+	}
+	if !anomaly.Allow(throttled, until) {
+		t.Errorf("Expected no limit after the throttle ended")
+	}
+	free := models.URL{ShortURL: "free"}
+	free.ID = 9101
+	for i := 0; i < 5; i++ {
+		if !anomaly.Allow(free, now) {
+			t.Fatalf("Expected links without throttle to be allowed")
+		}
+	}
+}
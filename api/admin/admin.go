@@ -0,0 +1,34 @@
+package admin
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"urlshort.ru/m/models"
+)
+
+// Register registers the admin API routes with the provided fiber.Router.
+//
+// api: The fiber.Router instance to register.
+//
+// Every route requires an access token of a user with the admin role.
+//
+// Return type: None.
+func Register(api fiber.Router) {
+	apiAdmin := api.Group("/admin")
+	localDb = models.DATABASE
+
+	apiAdmin.Get("/screening/rules", getScreeningRules)
+	apiAdmin.Post("/screening/rules", createScreeningRule)
+	apiAdmin.Delete("/screening/rules/:id", deleteScreeningRule)
+	apiAdmin.Post("/screening/threats", importThreatList)
+	apiAdmin.Delete("/screening/threats/:source", deleteThreatList)
+	apiAdmin.Post("/screening/rescan", rescanURLs)
+	apiAdmin.Get("/clicks/ingest", getClickIngestStats)
+	apiAdmin.Get("/alerts", getAlerts)
+	apiAdmin.Post("/alerts/:id/resolve", resolveAlert)
+	apiAdmin.Put("/users/:id/role", setUserRole)
+	apiAdmin.Get("/lockouts", getLockouts)
+	apiAdmin.Post("/lockouts/unlock", unlockLogin)
+	apiAdmin.Get("/audit", getAuditEntries)
+	apiAdmin.Get("/two-factor", getTwoFactorPolicies)
+	apiAdmin.Put("/two-factor/:role", setTwoFactorPolicy)
+}
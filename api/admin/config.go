@@ -0,0 +1,10 @@
+package admin
+
+import "gorm.io/gorm"
+
+var localDb *gorm.DB
+
+const LOGGER_HANDLER string = "api.admin"
+
+// ALERTS_LIMIT is the default and maximum number of alerts returned by the alerts endpoint.
+const ALERTS_LIMIT = 100
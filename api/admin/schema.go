@@ -0,0 +1,90 @@
+package admin
+
+import (
+	"time"
+
+	"urlshort.ru/m/clicks"
+)
+
+type ScreeningRuleBody struct {
+	List    string `json:"list"`
+	Match   string `json:"match"`
+	Pattern string `json:"pattern"`
+}
+
+type ScreeningRuleResponse struct {
+	ID      uint   `json:"id"`
+	List    string `json:"list"`
+	Match   string `json:"match"`
+	Pattern string `json:"pattern"`
+}
+
+type ThreatImportResponse struct {
+	Source   string `json:"source"`
+	Format   string `json:"format"`
+	Imported int    `json:"imported"`
+}
+
+type ClickIngestResponse struct {
+	PID     int                  `json:"pid"`
+	Running bool                 `json:"running"`
+	Stats   clicks.PipelineStats `json:"stats"`
+}
+
+type AlertResponse struct {
+	ID         uint       `json:"id"`
+	ShortURL   string     `json:"short_url"`
+	Bucket     time.Time  `json:"bucket"`
+	Clicks     int64      `json:"clicks"`
+	Baseline   float64    `json:"baseline"`
+	Threshold  float64    `json:"threshold"`
+	Action     string     `json:"action"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+type RoleBody struct {
+	Role string `json:"role"`
+}
+
+type UserResponse struct {
+	ID        uint   `json:"id"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	TwoFactor bool   `json:"two_factor"`
+}
+
+type LockoutResponse struct {
+	Subject       string    `json:"subject"`
+	Failures      int       `json:"failures"`
+	LastFailureAt time.Time `json:"last_failure_at"`
+	LockedUntil   time.Time `json:"locked_until"`
+}
+
+type UnlockBody struct {
+	Email string `json:"email"`
+	IP    string `json:"ip"`
+}
+
+type UnlockResponse struct {
+	Unlocked int64 `json:"unlocked"`
+}
+
+type AuditEntryResponse struct {
+	ID        uint      `json:"id"`
+	Action    string    `json:"action"`
+	Subject   string    `json:"subject"`
+	ActorID   *uint     `json:"actor_id,omitempty"`
+	IP        string    `json:"ip"`
+	Detail    string    `json:"detail"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type TwoFactorPolicyBody struct {
+	Required bool `json:"required"`
+}
+
+type TwoFactorPolicyResponse struct {
+	Role     string `json:"role"`
+	Required bool   `json:"required"`
+}
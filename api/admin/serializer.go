@@ -0,0 +1,118 @@
+package admin
+
+import (
+	"os"
+
+	"urlshort.ru/m/api/jwt"
+	"urlshort.ru/m/clicks"
+	"urlshort.ru/m/models"
+	"urlshort.ru/m/schema"
+)
+
+// GetScreeningRuleResponse returns a ScreeningRuleResponse based on the provided rule.
+//
+// It takes a parameter "rule" of type models.ScreeningRule and returns a ScreeningRuleResponse struct.
+func GetScreeningRuleResponse(rule models.ScreeningRule) ScreeningRuleResponse {
+	return ScreeningRuleResponse{
+		ID:      rule.ID,
+		List:    rule.List,
+		Match:   rule.Match,
+		Pattern: rule.Pattern,
+	}
+}
+
+// GetThreatImportResponse returns a ThreatImportResponse for an imported threat list.
+//
+// Parameters:
+// - source: the name of the list.
+// - format: the list format.
+// - imported: the number of imported entries.
+func GetThreatImportResponse(source string, format string, imported int) ThreatImportResponse {
+	return ThreatImportResponse{
+		Source:   source,
+		Format:   format,
+		Imported: imported,
+	}
+}
+
+// GetClickIngestResponse returns the metrics of the click pipeline of the current process.
+//
+// Under prefork every child has its own pipeline, so the response carries the process ID.
+func GetClickIngestResponse(pipeline *clicks.Pipeline) ClickIngestResponse {
+	response := ClickIngestResponse{PID: os.Getpid()}
+	if pipeline != nil {
+		response.Running = true
+		response.Stats = pipeline.Stats()
+	}
+	return response
+}
+
+// GetAlertResponse returns an AlertResponse for a click spike alert with its link preloaded.
+func GetAlertResponse(alert models.Alert) AlertResponse {
+	return AlertResponse{
+		ID:         alert.ID,
+		ShortURL:   alert.URL.ShortURL,
+		Bucket:     alert.Bucket,
+		Clicks:     alert.Clicks,
+		Baseline:   alert.Baseline,
+		Threshold:  alert.Threshold,
+		Action:     alert.Action,
+		CreatedAt:  alert.CreatedAt,
+		ResolvedAt: alert.ResolvedAt,
+	}
+}
+
+// GetUserResponse returns a UserResponse for a user.
+func GetUserResponse(user models.User) UserResponse {
+	return UserResponse{
+		ID:        user.ID,
+		Email:     user.Email,
+		Role:      user.Role,
+		TwoFactor: user.TOTPEnabledAt != nil,
+	}
+}
+
+// GetLockoutResponse returns a LockoutResponse for a locked out login subject.
+func GetLockoutResponse(throttle models.LoginThrottle) LockoutResponse {
+	response := LockoutResponse{
+		Subject:       throttle.Subject,
+		Failures:      throttle.Failures,
+		LastFailureAt: throttle.LastFailureAt,
+	}
+	if throttle.LockedUntil != nil {
+		response.LockedUntil = *throttle.LockedUntil
+	}
+	return response
+}
+
+// GetAuditEntryResponse returns an AuditEntryResponse for an audit entry.
+func GetAuditEntryResponse(entry models.AuditEntry) AuditEntryResponse {
+	return AuditEntryResponse{
+		ID:        entry.ID,
+		Action:    entry.Action,
+		Subject:   entry.Subject,
+		ActorID:   entry.ActorID,
+		IP:        entry.IP,
+		Detail:    entry.Detail,
+		CreatedAt: entry.CreatedAt,
+	}
+}
+
+// GetTwoFactorPolicyResponse returns a TwoFactorPolicyResponse for a two-factor policy.
+func GetTwoFactorPolicyResponse(policy models.TwoFactorPolicy) TwoFactorPolicyResponse {
+	return TwoFactorPolicyResponse{
+		Role:     policy.Role,
+		Required: policy.Required,
+	}
+}
+
+// GetErrorAdminResponse maps an error of jwt.GetPayloadHandlerAdmin to a status code and response.
+//
+// Parameters:
+// - err: the error returned by jwt.GetPayloadHandlerAdmin.
+// Return:
+// - int: the HTTP status code.
+// - schema.Response: the error response.
+func GetErrorAdminResponse(err error) (int, schema.Response) {
+	return jwt.GetErrorAdminResponse(err)
+}
@@ -0,0 +1,656 @@
+package admin
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
+	"urlshort.ru/m/anomaly"
+	"urlshort.ru/m/api/jwt"
+	"urlshort.ru/m/audit"
+	"urlshort.ru/m/clicks"
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/models"
+	"urlshort.ru/m/schema"
+	"urlshort.ru/m/screening"
+	"urlshort.ru/m/utils"
+)
+
+// @Summary List screening rules
+// @Description Returns the domain deny and allow rules managed through the API
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {array} ScreeningRuleResponse
+// @Failure 401 {object} schema.Response
+// @Failure 403 {object} schema.Response
+// @Router /api/admin/screening/rules [get]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func getScreeningRules(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	if _, err := jwt.GetPayloadHandlerAdmin(c); err != nil {
+		status, response := GetErrorAdminResponse(err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, status)
+		return c.Status(status).JSON(response)
+	}
+
+	var rules []models.ScreeningRule
+	if err := localDb.Order("id").Find(&rules).Error; err != nil {
+		slog.Error(LOGGER_HANDLER, err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+		return c.Status(500).JSON(schema.GetError500Response())
+	}
+
+	response := make([]ScreeningRuleResponse, 0, len(rules))
+	for _, rule := range rules {
+		response = append(response, GetScreeningRuleResponse(rule))
+	}
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.JSON(response)
+}
+
+// @Summary Create screening rule
+// @Description Adds a domain to the deny or allow list and rescans existing links
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param requestBody body ScreeningRuleBody true "Rule: list is deny or allow, match is exact, suffix or regex"
+// @Success 200 {object} ScreeningRuleResponse
+// @Failure 400 {object} schema.Response
+// @Failure 401 {object} schema.Response
+// @Failure 403 {object} schema.Response
+// @Router /api/admin/screening/rules [post]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func createScreeningRule(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	c.AcceptsCharsets("UTF-8", "UTF-16")
+	if _, err := jwt.GetPayloadHandlerAdmin(c); err != nil {
+		status, response := GetErrorAdminResponse(err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, status)
+		return c.Status(status).JSON(response)
+	}
+
+	body := new(ScreeningRuleBody)
+	if err := c.BodyParser(body); err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
+
+	compiled, err := screening.NewRule(body.List, body.Match, body.Pattern)
+	if err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
+
+	rule := models.ScreeningRule{
+		List:    compiled.List,
+		Match:   compiled.Match,
+		Pattern: compiled.Pattern,
+	}
+	if err := localDb.Create(&rule).Error; err != nil {
+		slog.Debug(LOGGER_HANDLER, err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
+
+	screening.RescanAsync(localDb)
+
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.JSON(GetScreeningRuleResponse(rule))
+}
+
+// @Summary Delete screening rule
+// @Description Removes a deny or allow rule and rescans existing links
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "Rule ID"
+// @Success 200 {object} schema.Response
+// @Failure 401 {object} schema.Response
+// @Failure 403 {object} schema.Response
+// @Failure 404 {object} schema.Response
+// @Router /api/admin/screening/rules/{id} [delete]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func deleteScreeningRule(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	if _, err := jwt.GetPayloadHandlerAdmin(c); err != nil {
+		status, response := GetErrorAdminResponse(err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, status)
+		return c.Status(status).JSON(response)
+	}
+
+	result := localDb.Unscoped().Delete(&models.ScreeningRule{}, "id = ?", c.Params("id"))
+	if result.Error != nil {
+		slog.Error(LOGGER_HANDLER, result.Error)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+		return c.Status(500).JSON(schema.GetError500Response())
+	}
+	if result.RowsAffected == 0 {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 404)
+		return c.Status(404).JSON(schema.GetError404Response())
+	}
+
+	screening.RescanAsync(localDb)
+
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.JSON(schema.GetSuccess200Response())
+}
+
+// @Summary Import threat list
+// @Description Replaces an offline threat list with the request body and rescans existing links.
+// @Description The body is a plain text file: one domain per line (format=domain, hosts files are accepted)
+// @Description or one hex SHA-256 prefix of "host/" per line (format=hash_prefix).
+// @Tags Admin
+// @Accept plain
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param source query string true "List name"
+// @Param format query string false "domain or hash_prefix"
+// @Param requestBody body string true "List contents"
+// @Success 200 {object} ThreatImportResponse
+// @Failure 400 {object} schema.Response
+// @Failure 401 {object} schema.Response
+// @Failure 403 {object} schema.Response
+// @Router /api/admin/screening/threats [post]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func importThreatList(c *fiber.Ctx) error {
+	if _, err := jwt.GetPayloadHandlerAdmin(c); err != nil {
+		status, response := GetErrorAdminResponse(err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, status)
+		return c.Status(status).JSON(response)
+	}
+
+	source := c.Query("source")
+	format := c.Query("format", config.ConfigAll.THREAT_LIST_FORMAT)
+
+	imported, err := screening.ImportThreats(localDb, source, format, bytes.NewReader(c.Body()))
+	if err != nil {
+		slog.Debug(LOGGER_HANDLER, err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
+
+	screening.RescanAsync(localDb)
+
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.JSON(GetThreatImportResponse(source, format, imported))
+}
+
+// @Summary Delete threat list
+// @Description Removes every entry of an imported threat list and rescans existing links
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param source path string true "List name"
+// @Success 200 {object} schema.Response
+// @Failure 401 {object} schema.Response
+// @Failure 403 {object} schema.Response
+// @Failure 404 {object} schema.Response
+// @Router /api/admin/screening/threats/{source} [delete]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func deleteThreatList(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	if _, err := jwt.GetPayloadHandlerAdmin(c); err != nil {
+		status, response := GetErrorAdminResponse(err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, status)
+		return c.Status(status).JSON(response)
+	}
+
+	result := localDb.Where("source = ?", c.Params("source")).Delete(&models.ThreatEntry{})
+	if result.Error != nil {
+		slog.Error(LOGGER_HANDLER, result.Error)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+		return c.Status(500).JSON(schema.GetError500Response())
+	}
+	if result.RowsAffected == 0 {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 404)
+		return c.Status(404).JSON(schema.GetError404Response())
+	}
+
+	screening.RescanAsync(localDb)
+
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.JSON(schema.GetSuccess200Response())
+}
+
+// @Summary Rescan links
+// @Description Screens every stored link again in the background
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {object} schema.Response
+// @Failure 401 {object} schema.Response
+// @Failure 403 {object} schema.Response
+// @Router /api/admin/screening/rescan [post]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func rescanURLs(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	if _, err := jwt.GetPayloadHandlerAdmin(c); err != nil {
+		status, response := GetErrorAdminResponse(err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, status)
+		return c.Status(status).JSON(response)
+	}
+
+	screening.RescanAsync(localDb)
+
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.JSON(schema.GetSuccess200Response())
+}
+
+// @Summary Click ingestion metrics
+// @Description Returns the queue depth and counters of the click pipeline of the process that served the request
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {object} ClickIngestResponse
+// @Failure 401 {object} schema.Response
+// @Failure 403 {object} schema.Response
+// @Router /api/admin/clicks/ingest [get]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func getClickIngestStats(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	if _, err := jwt.GetPayloadHandlerAdmin(c); err != nil {
+		status, response := GetErrorAdminResponse(err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, status)
+		return c.Status(status).JSON(response)
+	}
+
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.JSON(GetClickIngestResponse(clicks.Default))
+}
+
+// @Summary List click spike alerts
+// @Description Returns the newest alerts raised for links whose hourly clicks exceeded their baseline
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param status query string false "open (default), resolved or all"
+// @Param limit query int false "Maximum number of alerts, 100 at most"
+// @Success 200 {array} AlertResponse
+// @Failure 400 {object} schema.Response
+// @Failure 401 {object} schema.Response
+// @Failure 403 {object} schema.Response
+// @Router /api/admin/alerts [get]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func getAlerts(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	if _, err := jwt.GetPayloadHandlerAdmin(c); err != nil {
+		status, response := GetErrorAdminResponse(err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, status)
+		return c.Status(status).JSON(response)
+	}
+
+	limit := c.QueryInt("limit", ALERTS_LIMIT)
+	if limit < 1 || limit > ALERTS_LIMIT {
+		limit = ALERTS_LIMIT
+	}
+	query := localDb.Preload("URL").Order("id DESC").Limit(limit)
+	switch c.Query("status", "open") {
+	case "open":
+		query = query.Where("resolved_at IS NULL")
+	case "resolved":
+		query = query.Where("resolved_at IS NOT NULL")
+	case "all":
+	default:
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
+
+	var alerts []models.Alert
+	if err := query.Find(&alerts).Error; err != nil {
+		slog.Error(LOGGER_HANDLER, err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+		return c.Status(500).JSON(schema.GetError500Response())
+	}
+
+	response := make([]AlertResponse, 0, len(alerts))
+	for _, alert := range alerts {
+		response = append(response, GetAlertResponse(alert))
+	}
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.JSON(response)
+}
+
+// @Summary Resolve click spike alert
+// @Description Marks an alert handled and lifts the pause or throttle applied to its link
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "Alert ID"
+// @Success 200 {object} AlertResponse
+// @Failure 401 {object} schema.Response
+// @Failure 403 {object} schema.Response
+// @Failure 404 {object} schema.Response
+// @Router /api/admin/alerts/{id}/resolve [post]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func resolveAlert(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	if _, err := jwt.GetPayloadHandlerAdmin(c); err != nil {
+		status, response := GetErrorAdminResponse(err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, status)
+		return c.Status(status).JSON(response)
+	}
+
+	var alert models.Alert
+	if err := localDb.Preload("URL").First(&alert, "id = ?", c.Params("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.LoggerRequestUser(c, LOGGER_HANDLER, 404)
+			return c.Status(404).JSON(schema.GetError404Response())
+		}
+		slog.Error(LOGGER_HANDLER, err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+		return c.Status(500).JSON(schema.GetError500Response())
+	}
+
+	alert, err := anomaly.Resolve(localDb, alert)
+	if err != nil {
+		slog.Error(LOGGER_HANDLER, err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+		return c.Status(500).JSON(schema.GetError500Response())
+	}
+
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.JSON(GetAlertResponse(alert))
+}
+
+// @Summary Change user role
+// @Description Sets the role of a user. Access tokens issued with the old role are revoked, the user's sessions stay active
+// @Description and the next refresh returns tokens with the new role.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "User ID"
+// @Param requestBody body RoleBody true "Role: user or admin"
+// @Success 200 {object} UserResponse
+// @Failure 400 {object} schema.Response
+// @Failure 401 {object} schema.Response
+// @Failure 403 {object} schema.Response
+// @Failure 404 {object} schema.Response
+// @Router /api/admin/users/{id}/role [put]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func setUserRole(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	c.AcceptsCharsets("UTF-8", "UTF-16")
+	if _, err := jwt.GetPayloadHandlerAdmin(c); err != nil {
+		status, response := GetErrorAdminResponse(err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, status)
+		return c.Status(status).JSON(response)
+	}
+
+	id, err := c.ParamsInt("id")
+	body := new(RoleBody)
+	if err != nil || id <= 0 || c.BodyParser(body) != nil || (body.Role != models.ROLE_USER && body.Role != models.ROLE_ADMIN) {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
+
+	user, err := jwt.ChangeRole(localDb, uint(id), body.Role)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.LoggerRequestUser(c, LOGGER_HANDLER, 404)
+			return c.Status(404).JSON(schema.GetError404Response())
+		}
+		slog.Error(LOGGER_HANDLER, err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+		return c.Status(500).JSON(schema.GetError500Response())
+	}
+
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.JSON(GetUserResponse(user))
+}
+
+// @Summary List login lockouts
+// @Description Returns the emails and IPs locked out after too many failed logins
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {array} LockoutResponse
+// @Failure 401 {object} schema.Response
+// @Failure 403 {object} schema.Response
+// @Router /api/admin/lockouts [get]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func getLockouts(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	if _, err := jwt.GetPayloadHandlerAdmin(c); err != nil {
+		status, response := GetErrorAdminResponse(err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, status)
+		return c.Status(status).JSON(response)
+	}
+
+	throttles, err := jwt.LockedOut(localDb, time.Now())
+	if err != nil {
+		slog.Error(LOGGER_HANDLER, err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+		return c.Status(500).JSON(schema.GetError500Response())
+	}
+
+	response := make([]LockoutResponse, 0, len(throttles))
+	for _, throttle := range throttles {
+		response = append(response, GetLockoutResponse(throttle))
+	}
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.JSON(response)
+}
+
+// @Summary Unlock login
+// @Description Clears the failed logins and lockout of an email, an IP or both. Every unlock is audited.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param requestBody body UnlockBody true "Email and/or IP to unlock"
+// @Success 200 {object} UnlockResponse
+// @Failure 400 {object} schema.Response
+// @Failure 401 {object} schema.Response
+// @Failure 403 {object} schema.Response
+// @Router /api/admin/lockouts/unlock [post]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func unlockLogin(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	c.AcceptsCharsets("UTF-8", "UTF-16")
+	payload, err := jwt.GetPayloadHandlerAdmin(c)
+	if err != nil {
+		status, response := GetErrorAdminResponse(err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, status)
+		return c.Status(status).JSON(response)
+	}
+
+	body := new(UnlockBody)
+	if err := c.BodyParser(body); err != nil || (body.Email == "" && body.IP == "") {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
+	var subjects []string
+	if body.Email != "" {
+		subjects = append(subjects, jwt.EmailSubject(body.Email))
+	}
+	if body.IP != "" {
+		subjects = append(subjects, jwt.IPSubject(body.IP))
+	}
+
+	unlocked, err := jwt.UnlockLogin(localDb, subjects, uint(payload.UserID), c.IP())
+	if err != nil {
+		slog.Error(LOGGER_HANDLER, err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+		return c.Status(500).JSON(schema.GetError500Response())
+	}
+
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.JSON(UnlockResponse{Unlocked: unlocked})
+}
+
+// @Summary List audit entries
+// @Description Returns the latest audit entries, newest first
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param action query string false "Action, for example login.lockout or login.unlock"
+// @Param limit query int false "Number of entries, at most 100"
+// @Success 200 {array} AuditEntryResponse
+// @Failure 401 {object} schema.Response
+// @Failure 403 {object} schema.Response
+// @Router /api/admin/audit [get]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func getAuditEntries(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	if _, err := jwt.GetPayloadHandlerAdmin(c); err != nil {
+		status, response := GetErrorAdminResponse(err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, status)
+		return c.Status(status).JSON(response)
+	}
+
+	entries, err := audit.List(localDb, c.Query("action"), c.QueryInt("limit", audit.LIST_LIMIT))
+	if err != nil {
+		slog.Error(LOGGER_HANDLER, err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+		return c.Status(500).JSON(schema.GetError500Response())
+	}
+
+	response := make([]AuditEntryResponse, 0, len(entries))
+	for _, entry := range entries {
+		response = append(response, GetAuditEntryResponse(entry))
+	}
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.JSON(response)
+}
+
+// @Summary List two-factor policies
+// @Description Returns the roles with a two-factor policy and whether two-factor authentication is required for them
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {array} TwoFactorPolicyResponse
+// @Failure 401 {object} schema.Response
+// @Failure 403 {object} schema.Response
+// @Router /api/admin/two-factor [get]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func getTwoFactorPolicies(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	if _, err := jwt.GetPayloadHandlerAdmin(c); err != nil {
+		status, response := GetErrorAdminResponse(err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, status)
+		return c.Status(status).JSON(response)
+	}
+
+	policies, err := jwt.TwoFactorPolicies(localDb)
+	if err != nil {
+		slog.Error(LOGGER_HANDLER, err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+		return c.Status(500).JSON(schema.GetError500Response())
+	}
+
+	response := make([]TwoFactorPolicyResponse, 0, len(policies))
+	for _, policy := range policies {
+		response = append(response, GetTwoFactorPolicyResponse(policy))
+	}
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.JSON(response)
+}
+
+// @Summary Set two-factor policy
+// @Description Requires or stops requiring two-factor authentication for a role. Users of the role without it get a challenge
+// @Description with enroll set on login and enroll before the second step. Admins without it are rejected by the admin API
+// @Description with error two_factor_required, so an admin must enable it before requiring it for admins. The change is audited.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param role path string true "Role: user or admin"
+// @Param requestBody body TwoFactorPolicyBody true "Whether two-factor authentication is required"
+// @Success 200 {object} TwoFactorPolicyResponse
+// @Failure 400 {object} schema.Response
+// @Failure 401 {object} schema.Response
+// @Failure 403 {object} schema.Response
+// @Failure 409 {object} schema.Response "error: two_factor_not_enabled"
+// @Router /api/admin/two-factor/{role} [put]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func setTwoFactorPolicy(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	c.AcceptsCharsets("UTF-8", "UTF-16")
+	payload, err := jwt.GetPayloadHandlerAdmin(c)
+	if err != nil {
+		status, response := GetErrorAdminResponse(err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, status)
+		return c.Status(status).JSON(response)
+	}
+
+	role := c.Params("role")
+	body := new(TwoFactorPolicyBody)
+	if c.BodyParser(body) != nil || (role != models.ROLE_USER && role != models.ROLE_ADMIN) {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
+
+	var actor models.User
+	if err := localDb.First(&actor, "id = ?", payload.UserID).Error; err != nil {
+		slog.Error(LOGGER_HANDLER, err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+		return c.Status(500).JSON(schema.GetError500Response())
+	}
+
+	policy, err := jwt.SetTwoFactorRequired(localDb, role, body.Required, actor, c.IP())
+	if err != nil {
+		if errors.Is(err, jwt.ErrTwoFactorNotEnabled) {
+			response := schema.GetError409Response()
+			response.Error = jwt.ERROR_TWO_FACTOR_NOT_ENABLED
+			utils.LoggerRequestUser(c, LOGGER_HANDLER, 409)
+			return c.Status(409).JSON(response)
+		}
+		slog.Error(LOGGER_HANDLER, err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+		return c.Status(500).JSON(schema.GetError500Response())
+	}
+
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.JSON(GetTwoFactorPolicyResponse(policy))
+}
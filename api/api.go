@@ -2,8 +2,13 @@ package api
 
 import (
 	"github.com/gofiber/fiber/v2"
+	"urlshort.ru/m/api/admin"
+	"urlshort.ru/m/api/conversions"
+	"urlshort.ru/m/api/exports"
 	"urlshort.ru/m/api/jwt"
+	"urlshort.ru/m/api/redirect"
 	"urlshort.ru/m/api/urls"
+	"urlshort.ru/m/api/webhooks"
 )
 
 // Register registers the API routes for the given Fiber app and Gorm DB.
@@ -14,4 +19,10 @@ func Register(app *fiber.App) {
 	api := app.Group("/api")
 	urls.Register(api)
 	jwt.Register(api)
+	admin.Register(api)
+	exports.Register(api)
+	conversions.Register(api)
+	webhooks.Register(api)
+	jwt.RegisterWellKnown(app)
+	redirect.Register(app)
 }
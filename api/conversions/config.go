@@ -0,0 +1,9 @@
+package conversions
+
+import "gorm.io/gorm"
+
+var localDb *gorm.DB
+
+const LOGGER_HANDLER string = "api.conversions"
+
+const MAX_NAME_LENGTH = 64
@@ -0,0 +1,17 @@
+package conversions
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"urlshort.ru/m/models"
+)
+
+// Register registers the conversion routes with the provided fiber.Router.
+//
+// api: The fiber.Router instance to register.
+//
+// Return type: None.
+func Register(api fiber.Router) {
+	apiConversions := api.Group("/conversions")
+	localDb = models.DATABASE
+	apiConversions.Post("/", createConversion)
+}
@@ -0,0 +1,20 @@
+package conversions
+
+import "time"
+
+type ConversionBody struct {
+	ClickID  string  `json:"click_id"`
+	Name     string  `json:"name"`
+	Value    float64 `json:"value,omitempty"`
+	Currency string  `json:"currency,omitempty"`
+}
+
+type ConversionResponse struct {
+	ID        uint      `json:"id"`
+	ClickID   string    `json:"click_id"`
+	ShortURL  string    `json:"short_url"`
+	Name      string    `json:"name"`
+	Value     float64   `json:"value"`
+	Currency  string    `json:"currency,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
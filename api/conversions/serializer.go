@@ -0,0 +1,22 @@
+package conversions
+
+import "urlshort.ru/m/models"
+
+// GetConversionResponse returns the response of a recorded conversion.
+//
+// Parameters:
+// - conversion: the stored conversion.
+// - url: the link the converted click belongs to.
+// Return:
+// - ConversionResponse: the conversion with the short URL of its link.
+func GetConversionResponse(conversion models.Conversion, url models.URL) ConversionResponse {
+	return ConversionResponse{
+		ID:        conversion.ID,
+		ClickID:   conversion.ClickID,
+		ShortURL:  url.ShortURL,
+		Name:      conversion.Name,
+		Value:     conversion.Value,
+		Currency:  conversion.Currency,
+		CreatedAt: conversion.CreatedAt,
+	}
+}
@@ -0,0 +1,132 @@
+package conversions
+
+import (
+	"errors"
+	"math"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"urlshort.ru/m/api/jwt"
+	"urlshort.ru/m/models"
+	"urlshort.ru/m/schema"
+	"urlshort.ru/m/stats"
+	"urlshort.ru/m/utils"
+)
+
+// createConversion записывает конверсию по идентификатору перехода.
+//
+// @Summary Записать конверсию
+// @Description Сохраняет событие конверсии (название, сумма, валюта) для перехода с указанным click_id.
+// @Description Идентификатор перехода добавляется к адресу назначения при переходе по короткой ссылке.
+// @Description Записывать конверсии могут владелец ссылки и администраторы. Переходы сохраняются пакетами,
+// @Description поэтому для только что совершенного перехода может вернуться 404 до ближайшей записи пакета.
+// @Description Для перехода сохраняется одна конверсия с каждым названием: повторный запрос возвращает 200
+// @Description и уже сохраненную конверсию, поэтому запрос можно безопасно повторять.
+// @Tags Конверсии
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param bodyJson body ConversionBody true "Конверсия"
+// @Success 200 {object} ConversionResponse
+// @Success 201 {object} ConversionResponse
+// @Failure 400 {object} schema.Response
+// @Failure 401 {object} schema.Response
+// @Failure 403 {object} schema.Response
+// @Failure 404 {object} schema.Response
+// @Failure 500 {object} schema.Response
+// @Router /api/conversions [post]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст HTTP-запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func createConversion(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+
+	user, err := jwt.GetUserHandler(c)
+	if err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 401)
+		return c.Status(401).JSON(jwt.GetErrorTokenResponse(err))
+	}
+
+	body := new(ConversionBody)
+	if err := c.BodyParser(body); err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	body.Currency = strings.ToUpper(strings.TrimSpace(body.Currency))
+	if !validBody(*body) {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
+
+	var click models.Click
+	result := localDb.Preload("URL").First(&click, "click_id = ?", body.ClickID)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			utils.LoggerRequestUser(c, LOGGER_HANDLER, 404)
+			return c.Status(404).JSON(schema.GetError404Response())
+		}
+		slog.Error(LOGGER_HANDLER, result.Error)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+		return c.Status(500).JSON(schema.GetError500Response())
+	}
+	if !stats.CanManage(click.URL, &user) {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 403)
+		return c.Status(403).JSON(schema.GetError403Response())
+	}
+
+	conversion := models.Conversion{
+		URLID:     click.URLID,
+		ClickID:   click.ClickID,
+		Name:      body.Name,
+		Value:     body.Value,
+		Currency:  body.Currency,
+		ClickedAt: click.CreatedAt,
+	}
+	result = localDb.Clauses(clause.OnConflict{DoNothing: true}).Create(&conversion)
+	if result.Error != nil {
+		slog.Error(LOGGER_HANDLER, result.Error)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+		return c.Status(500).JSON(schema.GetError500Response())
+	}
+	// A retried request returns the conversion stored by the first one.
+	if result.RowsAffected == 0 {
+		if err := localDb.First(&conversion, "click_id = ? AND name = ?", click.ClickID, body.Name).Error; err != nil {
+			slog.Error(LOGGER_HANDLER, err)
+			utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+			return c.Status(500).JSON(schema.GetError500Response())
+		}
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+		return c.JSON(GetConversionResponse(conversion, click.URL))
+	}
+
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 201)
+	return c.Status(201).JSON(GetConversionResponse(conversion, click.URL))
+}
+
+// validBody reports whether a conversion body can be stored.
+// A non-zero value needs a three letter currency code, so revenue is never summed across currencies.
+func validBody(body ConversionBody) bool {
+	if body.ClickID == "" || body.Name == "" || len(body.Name) > MAX_NAME_LENGTH {
+		return false
+	}
+	if math.IsNaN(body.Value) || math.IsInf(body.Value, 0) || body.Value < 0 {
+		return false
+	}
+	if body.Currency == "" {
+		return body.Value == 0
+	}
+	if len(body.Currency) != 3 {
+		return false
+	}
+	for _, r := range body.Currency {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
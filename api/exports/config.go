@@ -0,0 +1,7 @@
+package exports
+
+import "gorm.io/gorm"
+
+var localDb *gorm.DB
+
+const LOGGER_HANDLER string = "api.exports"
@@ -0,0 +1,17 @@
+package exports
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"urlshort.ru/m/models"
+)
+
+// Register registers the click export routes with the provided fiber.Router.
+//
+// api: The fiber.Router instance to register.
+//
+// Return type: None.
+func Register(api fiber.Router) {
+	apiClicks := api.Group("/clicks")
+	localDb = models.DATABASE
+	apiClicks.Get("/export", exportClicks)
+}
@@ -0,0 +1,10 @@
+package exports
+
+type ExportQuery struct {
+	Format   string `query:"format"`
+	ShortURL string `query:"short_url"`
+	UserID   uint   `query:"user_id"`
+	Tag      string `query:"tag"`
+	From     string `query:"from"`
+	To       string `query:"to"`
+}
@@ -0,0 +1,121 @@
+package exports
+
+import (
+	"bufio"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/exp/slog"
+	"urlshort.ru/m/api/jwt"
+	"urlshort.ru/m/export"
+	"urlshort.ru/m/models"
+	"urlshort.ru/m/schema"
+	"urlshort.ru/m/stats"
+	"urlshort.ru/m/tags"
+	"urlshort.ru/m/utils"
+)
+
+// exportClicks выгружает переходы в формате CSV, NDJSON или Parquet.
+//
+// @Summary Выгрузить переходы
+// @Description Потоково выгружает переходы по ссылке, по ссылкам с меткой или по всем ссылкам пользователя за период.
+// @Description Пользователи выгружают только свои ссылки, администраторы — любые.
+// @Tags Выгрузка
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Produce application/vnd.apache.parquet
+// @Param Authorization header string true "Bearer token"
+// @Param format query string false "csv, ndjson или parquet" default(csv)
+// @Param short_url query string false "Короткий URL"
+// @Param user_id query int false "ID владельца ссылок (только для администраторов)"
+// @Param tag query string false "Метка ссылок"
+// @Param from query string false "Начало периода: RFC3339 или YYYY-MM-DD"
+// @Param to query string false "Конец периода (не включительно): RFC3339 или YYYY-MM-DD"
+// @Success 200 {file} file
+// @Failure 400 {object} schema.Response
+// @Failure 401 {object} schema.Response
+// @Failure 403 {object} schema.Response
+// @Failure 404 {object} schema.Response
+// @Router /api/clicks/export [get]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст HTTP-запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func exportClicks(c *fiber.Ctx) error {
+	query := new(ExportQuery)
+	if err := c.QueryParser(query); err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
+	if query.Format == "" {
+		query.Format = export.FORMAT_CSV
+	}
+	if !export.IsFormat(query.Format) {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
+
+	from, err := stats.ParseTime(query.From, time.Time{})
+	if err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
+	to, err := stats.ParseTime(query.To, time.Time{})
+	if err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
+
+	user, err := jwt.GetUserHandler(c)
+	if err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 401)
+		return c.Status(401).JSON(jwt.GetErrorTokenResponse(err))
+	}
+
+	filter := export.Filter{UserID: query.UserID, From: from, To: to}
+	if query.Tag != "" {
+		if filter.Tag, err = tags.NormalizeTag(query.Tag); err != nil {
+			utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+			return c.Status(400).JSON(schema.GetError400Response())
+		}
+	}
+	if user.Role != models.ROLE_ADMIN {
+		if query.UserID != 0 && query.UserID != user.ID {
+			utils.LoggerRequestUser(c, LOGGER_HANDLER, 403)
+			return c.Status(403).JSON(schema.GetError403Response())
+		}
+		filter.UserID = user.ID
+	}
+
+	if query.ShortURL != "" {
+		var url models.URL
+		if err := localDb.First(&url, "short_url = ?", query.ShortURL).Error; err != nil {
+			utils.LoggerRequestUser(c, LOGGER_HANDLER, 404)
+			return c.Status(404).JSON(schema.GetError404Response())
+		}
+		if !stats.CanManage(url, &user) {
+			utils.LoggerRequestUser(c, LOGGER_HANDLER, 403)
+			return c.Status(403).JSON(schema.GetError403Response())
+		}
+		filter.URLID = url.ID
+	}
+
+	c.Set(fiber.HeaderContentType, export.ContentType(query.Format))
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="clicks-%s.%s"`, time.Now().Format("20060102-150405"), query.Format))
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+
+	// The body is written after the handler returns, errors can only be logged.
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		count, err := export.Write(localDb, w, query.Format, filter)
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			slog.Error(LOGGER_HANDLER, err)
+			return
+		}
+		slog.Debug(LOGGER_HANDLER, "exported", count)
+	})
+	return nil
+}
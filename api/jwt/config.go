@@ -1,6 +1,7 @@
 package jwt
 
 import (
+	"errors"
 	"time"
 
 	"gorm.io/gorm"
@@ -10,12 +11,78 @@ import (
 
 const LOGGER_HANDLER = "api.jwt"
 
+// JWT_KEY is the HMAC key of HS256 tokens. It is SECRET_KEY_JWT itself, so other services
+// sharing the secret can verify the tokens with any JWT library.
+var JWT_KEY = []byte(config.ConfigAll.SECRET_KEY_JWT)
+
+// JWT_SECRET signs legacy tokens, accepted until JWT_LEGACY_UNTIL.
 var JWT_SECRET = utils.GenerateShortHashSHA256(config.ConfigAll.SECRET_KEY_JWT)
 
-const REFRESH_TIME = time.Hour * 24 * 31
+// Token types of the token_type claim. Every handler accepts one type only, so a refresh
+// token cannot authorize a request and an access token cannot be refreshed. A challenge
+// token is only accepted by the second login step of two-factor authentication.
+const (
+	TOKEN_ACCESS    = "access"
+	TOKEN_REFRESH   = "refresh"
+	TOKEN_CHALLENGE = "challenge"
+)
+
+// JTI_BYTES is the number of random bytes of the jti claim.
+const JTI_BYTES = 16
+
+const REFRESH_TIME = config.REFRESH_TIME
 const ACCESS_TIME = time.Hour * 24
 const TYPE_CHECK_PROTOCOL = "Bearer"
 const ALGORITHM_JWT = "HS256"
 const PROTOCOL_JWT = "JWT"
 
+// MAX_DEVICE_NAME is the maximum length of a session device name.
+const MAX_DEVICE_NAME = 100
+
+// JWKS_CACHE_CONTROL lets clients cache the key set briefly. Rotated keys are published
+// ahead of use, so a cached copy never misses the signing key.
+const JWKS_CACHE_CONTROL = "public, max-age=300"
+
+// ALLOWED_ALGORITHMS lists the alg header values accepted by CheckToken. Tokens with any other
+// algorithm, "none" included, are rejected before their signature is checked. RS256 and EdDSA
+// tokens are verified with the public key of Keys named by their kid only, never with JWT_KEY.
+var ALLOWED_ALGORITHMS = []string{ALGORITHM_JWT, ALGORITHM_RS256, ALGORITHM_EDDSA}
+
+var ErrNotAdmin = errors.New("user is not an admin")
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrAlgorithm    = errors.New("algorithm not allowed")
+	ErrSignature    = errors.New("invalid signature")
+	ErrExpired      = errors.New("token expired")
+	ErrNotYetValid  = errors.New("token not valid yet")
+	ErrIssuer       = errors.New("invalid issuer")
+	ErrAudience     = errors.New("invalid audience")
+	ErrTokenType    = errors.New("wrong token type")
+
+	ErrSessionRevoked = errors.New("session revoked")
+	ErrTokenReused    = errors.New("refresh token reused")
+	ErrTokenRevoked   = errors.New("token revoked")
+)
+
+// Error codes of the error field of 401 responses, see GetErrorTokenResponse.
+const (
+	ERROR_INVALID_TOKEN     = "invalid_token"
+	ERROR_INVALID_SIGNATURE = "invalid_signature"
+	ERROR_TOKEN_EXPIRED     = "token_expired"
+	ERROR_WRONG_TOKEN_TYPE  = "wrong_token_type"
+	ERROR_SESSION_REVOKED   = "session_revoked"
+	ERROR_TOKEN_REUSED      = "token_reused"
+	ERROR_TOKEN_REVOKED     = "token_revoked"
+	ERROR_TOO_MANY_ATTEMPTS = "too_many_attempts"
+
+	ERROR_USER_TOKEN_INVALID = "user_token_invalid"
+	ERROR_EMAIL_NOT_VERIFIED = "email_not_verified"
+
+	ERROR_INVALID_CODE           = "invalid_code"
+	ERROR_TWO_FACTOR_REQUIRED    = "two_factor_required"
+	ERROR_TWO_FACTOR_ENABLED     = "two_factor_enabled"
+	ERROR_TWO_FACTOR_NOT_ENABLED = "two_factor_not_enabled"
+)
+
 var localDb *gorm.DB
@@ -2,6 +2,7 @@ package jwt
 
 import (
 	"github.com/gofiber/fiber/v2"
+	"urlshort.ru/m/config"
 	"urlshort.ru/m/models"
 )
 
@@ -13,11 +14,35 @@ import (
 func Register(api fiber.Router) {
 	apiJWT := api.Group("/jwt")
 	localDb = models.DATABASE
+	Revocations = NewRevocationCache(localDb, config.ConfigAll.JWT_REVOCATION_CACHE)
 
 	apiJWT.Get("/refresh", refreshHandler)
 	apiJWT.Get("/logout", logoutHandler)
 	apiJWT.Post("/register", registerHandler)
 	apiJWT.Post("/login", loginHandler)
+	apiJWT.Post("/login/2fa", loginTwoFactorHandler)
 	apiJWT.Post("/check", checkHandler)
+	apiJWT.Post("/revoke", revokeHandler)
+	apiJWT.Get("/verify", verifyEmailHandler)
+	apiJWT.Post("/verify", verifyEmailHandler)
+	apiJWT.Post("/verify/resend", resendVerificationHandler)
+	apiJWT.Post("/password/forgot", forgotPasswordHandler)
+	apiJWT.Post("/password/reset", resetPasswordHandler)
+	apiJWT.Post("/2fa/enroll", enrollTwoFactorHandler)
+	apiJWT.Post("/2fa/enable", enableTwoFactorHandler)
+	apiJWT.Post("/2fa/disable", disableTwoFactorHandler)
+	apiJWT.Post("/2fa/recovery-codes", recoveryCodesHandler)
 	apiJWT.Delete("/delete", deleteHandler)
+	apiJWT.Get("/sessions", getSessionsHandler)
+	apiJWT.Delete("/sessions", deleteSessionsHandler)
+	apiJWT.Delete("/sessions/:id", deleteSessionHandler)
+}
+
+// RegisterWellKnown registers the /.well-known routes with the app root.
+//
+// app - The fiber.Router of the app.
+//
+// No return value.
+func RegisterWellKnown(app fiber.Router) {
+	app.Get("/.well-known/jwks.json", jwksHandler)
 }
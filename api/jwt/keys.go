@@ -0,0 +1,374 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+	"urlshort.ru/m/config"
+)
+
+const (
+	ALGORITHM_RS256 = "RS256"
+	ALGORITHM_EDDSA = "EdDSA"
+
+	// MIN_RSA_BITS is the smallest accepted RSA modulus.
+	MIN_RSA_BITS = 2048
+)
+
+var (
+	ErrUnknownKey   = errors.New("unknown key")
+	ErrNoSigningKey = errors.New("no active signing key")
+)
+
+// KeyManifest is the JSON file listing the signing keys, set with JWT_KEYS_FILE:
+//
+//	{"keys": [{"kid": "2024-01", "file": "2024-01.pem", "active_from": "2024-01-01T00:00:00Z"}]}
+//
+// File is a PEM encoded PKCS #8 RSA or Ed25519 private key, or a PKCS #1 RSA key, relative to
+// the manifest. RSA keys sign with RS256, Ed25519 keys with EdDSA.
+type KeyManifest struct {
+	Keys []KeyManifestEntry `json:"keys"`
+}
+
+type KeyManifestEntry struct {
+	KeyID      string    `json:"kid"`
+	File       string    `json:"file"`
+	ActiveFrom time.Time `json:"active_from"`
+}
+
+// Key is a private signing key of the key set.
+type Key struct {
+	KeyID      string
+	Algorithm  string
+	ActiveFrom time.Time
+	signer     crypto.Signer
+}
+
+// JWK is a public key in the JSON Web Key format of RFC 7517.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// JWKS is the JSON Web Key Set published at /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// KeySet holds the asymmetric keys and decides which of them sign and verify at a time.
+//
+// Keys are ordered by ActiveFrom. The key with the latest ActiveFrom that has passed signs new
+// tokens. A key replaced by a newer one keeps verifying for REFRESH_TIME, the longest token
+// lifetime, so tokens it signed stay valid until they expire. Keys scheduled for the future
+// verify and are published in advance, so downstream services have them cached before the
+// first token they sign.
+type KeySet struct {
+	path string
+
+	mu      sync.RWMutex
+	keys    []Key
+	modTime time.Time
+	stop    chan struct{}
+}
+
+// OpenKeySet loads the key set of a manifest file.
+//
+// Parameters:
+// - path: the path of the manifest.
+//
+// Returns:
+// - *KeySet: the loaded key set.
+// - error: an error if the manifest or a key could not be loaded.
+func OpenKeySet(path string) (*KeySet, error) {
+	set := &KeySet{path: path}
+	if err := set.Reload(); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// Reload reads the manifest and its keys again and swaps them in. On error the previous keys
+// stay in use.
+//
+// Returns:
+// - error: an error if the manifest or a key could not be loaded.
+func (s *KeySet) Reload() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var manifest KeyManifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return err
+	}
+
+	keys := make([]Key, 0, len(manifest.Keys))
+	seen := map[string]bool{}
+	for _, entry := range manifest.Keys {
+		if entry.KeyID == "" || seen[entry.KeyID] {
+			return fmt.Errorf("%s: missing or duplicate kid %q", s.path, entry.KeyID)
+		}
+		seen[entry.KeyID] = true
+		file := entry.File
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(s.path), file)
+		}
+		key, err := loadKey(file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.KeyID, err)
+		}
+		key.KeyID, key.ActiveFrom = entry.KeyID, entry.ActiveFrom
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ActiveFrom.Before(keys[j].ActiveFrom) })
+
+	s.mu.Lock()
+	s.keys, s.modTime = keys, info.ModTime()
+	s.mu.Unlock()
+	return nil
+}
+
+// loadKey reads a PEM encoded private key.
+func loadKey(path string) (Key, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Key{}, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return Key{}, errors.New("no PEM block")
+	}
+
+	var parsed any
+	if block.Type == "RSA PRIVATE KEY" {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return Key{}, err
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < MIN_RSA_BITS {
+			return Key{}, fmt.Errorf("RSA key shorter than %d bits", MIN_RSA_BITS)
+		}
+		return Key{Algorithm: ALGORITHM_RS256, signer: key}, nil
+	case ed25519.PrivateKey:
+		return Key{Algorithm: ALGORITHM_EDDSA, signer: key}, nil
+	}
+	return Key{}, fmt.Errorf("unsupported key type %T", parsed)
+}
+
+// Signing returns the key that signs tokens at the given time.
+//
+// Parameters:
+// - now: the time.
+//
+// Returns:
+// - Key: the key with the latest ActiveFrom not after now.
+// - bool: false if no key is active yet.
+func (s *KeySet) Signing(now time.Time) (Key, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i := len(s.keys) - 1; i >= 0; i-- {
+		if !s.keys[i].ActiveFrom.After(now) {
+			return s.keys[i], true
+		}
+	}
+	return Key{}, false
+}
+
+// Verifying returns the keys whose tokens are accepted at the given time: the signing key,
+// the keys scheduled after it and the keys it replaced less than REFRESH_TIME ago.
+//
+// Parameters:
+// - now: the time.
+//
+// Returns:
+// - []Key: the keys ordered by ActiveFrom.
+func (s *KeySet) Verifying(now time.Time) []Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var keys []Key
+	for i, key := range s.keys {
+		if i+1 < len(s.keys) {
+			replaced := s.keys[i+1].ActiveFrom
+			if !replaced.After(now) && now.Sub(replaced) > REFRESH_TIME {
+				continue
+			}
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Sign signs the input of a token with the key.
+func (k Key) Sign(input string) ([]byte, error) {
+	if k.Algorithm == ALGORITHM_RS256 {
+		digest := sha256.Sum256([]byte(input))
+		return k.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	return k.signer.Sign(rand.Reader, []byte(input), crypto.Hash(0))
+}
+
+// Verify checks the signature of a token input with the public key.
+func (k Key) Verify(input string, signature []byte) bool {
+	switch public := k.signer.Public().(type) {
+	case *rsa.PublicKey:
+		digest := sha256.Sum256([]byte(input))
+		return rsa.VerifyPKCS1v15(public, crypto.SHA256, digest[:], signature) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(public, []byte(input), signature)
+	}
+	return false
+}
+
+// JWK returns the public key in the JSON Web Key format.
+func (k Key) JWK() JWK {
+	jwk := JWK{KeyID: k.KeyID, Use: "sig", Algorithm: k.Algorithm}
+	switch public := k.signer.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+	return jwk
+}
+
+// Verify checks the signature of a token signed by a key of the set.
+//
+// Parameters:
+// - algorithm: the alg header of the token.
+// - keyID: the kid header of the token.
+// - input: the encoded header and payload joined with a dot.
+// - signature: the decoded signature.
+// - now: the time.
+//
+// Returns:
+// - error: ErrUnknownKey if no verifying key has the kid and algorithm, ErrSignature if the
+// signature does not match.
+func (s *KeySet) Verify(algorithm string, keyID string, input string, signature []byte, now time.Time) error {
+	for _, key := range s.Verifying(now) {
+		if key.KeyID != keyID || key.Algorithm != algorithm {
+			continue
+		}
+		if !key.Verify(input, signature) {
+			return ErrSignature
+		}
+		return nil
+	}
+	return ErrUnknownKey
+}
+
+// JWKS returns the public keys that verify at the given time.
+func (s *KeySet) JWKS(now time.Time) JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range s.Verifying(now) {
+		jwks.Keys = append(jwks.Keys, key.JWK())
+	}
+	return jwks
+}
+
+// Watch checks the manifest for changes every interval and reloads the key set when its
+// modification time changed. Key files are read on reload only, so a new key is added by
+// writing its file first and the manifest last.
+//
+// Parameters:
+// - interval: the time between checks, 0 disables watching.
+func (s *KeySet) Watch(interval time.Duration) {
+	if s == nil || interval <= 0 || s.stop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	s.stop = stop
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if s.changed() {
+					if err := s.Reload(); err != nil {
+						slog.Error(LOGGER_HANDLER, s.path, err)
+					} else {
+						slog.Info(LOGGER_HANDLER, "reloaded", s.path)
+					}
+				}
+			}
+		}
+	}()
+}
+
+// changed reports whether the manifest differs from the loaded one.
+func (s *KeySet) changed() bool {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return !info.ModTime().Equal(s.modTime)
+}
+
+// Close stops watching the manifest.
+func (s *KeySet) Close() error {
+	if s != nil && s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+	return nil
+}
+
+// Keys is the asymmetric key set of the process, nil when JWT_KEYS_FILE is not set. Without
+// it tokens are signed with HS256.
+var Keys *KeySet
+
+// CheckConfig reports an error if JWT_LEGACY_UNTIL is not set, or JWT_KEYS_FILE is set
+// without JWT_HS256_UNTIL. Both cutoffs must be fixed times, a default counted from the start
+// of the process would move on every restart and never take effect.
+//
+// Returns:
+// - error: an error naming the missing setting.
+func CheckConfig() error {
+	if config.ConfigAll.JWT_LEGACY_UNTIL.IsZero() {
+		return errors.New("JWT_LEGACY_UNTIL is required")
+	}
+	if config.ConfigAll.JWT_KEYS_FILE != "" && config.ConfigAll.JWT_HS256_UNTIL.IsZero() {
+		return errors.New("JWT_HS256_UNTIL is required with JWT_KEYS_FILE")
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package jwt_test
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"urlshort.ru/m/api/jwt"
+	"urlshort.ru/m/config"
+)
+
+// writeKey writes a PKCS #8 PEM private key to a directory.
+func writeKey(t *testing.T, dir string, name string, key any) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	content := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, name), content, 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+// openKeySet writes four keys and their manifest and loads them: "old" replaced 40 days ago,
+// "previous" replaced a day ago, "current" signing and "next" scheduled for tomorrow.
+func openKeySet(t *testing.T, now time.Time) (*jwt.KeySet, *rsa.PrivateKey) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	writeKey(t, dir, "previous.pem", rsaKey)
+	for _, name := range []string{"old.pem", "current.pem", "next.pem"} {
+		_, key, _ := ed25519.GenerateKey(rand.Reader)
+		writeKey(t, dir, name, key)
+	}
+
+	day := 24 * time.Hour
+	manifest := jwt.KeyManifest{Keys: []jwt.KeyManifestEntry{
+		{KeyID: "current", File: "current.pem", ActiveFrom: now.Add(-day)},
+		{KeyID: "old", File: "old.pem", ActiveFrom: now.Add(-60 * day)},
+		{KeyID: "previous", File: "previous.pem", ActiveFrom: now.Add(-40 * day)},
+		{KeyID: "next", File: "next.pem", ActiveFrom: now.Add(day)},
+	}}
+	content, _ := json.Marshal(manifest)
+	path := filepath.Join(dir, "keys.json")
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	keys, err := jwt.OpenKeySet(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return keys, rsaKey
+}
+
+// signWith signs a valid access payload with a key of the set.
+func signWith(t *testing.T, key jwt.Key) string {
+	header, _ := json.Marshal(jwt.HeaderJWT{Algorithm: key.Algorithm, Protocol: jwt.PROTOCOL_JWT, KeyID: key.KeyID})
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString([]byte(claims(nil)))
+	signature, err := key.Sign(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// TestKeyRotation tests which keys sign and verify over a rotation.
+func TestKeyRotation(t *testing.T) {
+	now := time.Now()
+	keys, _ := openKeySet(t, now)
+	jwt.Keys = keys
+	defer func() { jwt.Keys = nil }()
+
+	signing, ok := keys.Signing(now)
+	if !ok || signing.KeyID != "current" || signing.Algorithm != jwt.ALGORITHM_EDDSA {
+		t.Fatalf("Expected the current EdDSA key to sign, got %+v", signing)
+	}
+	var verifying []string
+	for _, key := range keys.Verifying(now) {
+		verifying = append(verifying, key.KeyID)
+	}
+	if strings.Join(verifying, ",") != "previous,current,next" {
+		t.Errorf("Unexpected verifying keys: %v", verifying)
+	}
+
+	token, err := jwt.GenerateJWTAccess(1, "user@example.com", "user", 0, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	header, _ := jwt.DecodeSegment(strings.Split(token, ".")[0])
+	if !strings.Contains(header, `"kid":"current"`) || !strings.Contains(header, `"alg":"EdDSA"`) {
+		t.Errorf("Unexpected header: %s", header)
+	}
+	if err := jwt.ValidateToken(token); err != nil {
+		t.Errorf("Expected the token to be valid, got %v", err)
+	}
+
+	previous := keys.Verifying(now)[0]
+	if err := jwt.ValidateToken(signWith(t, previous)); err != nil {
+		t.Errorf("Expected tokens of the replaced key to stay valid, got %v", err)
+	}
+	old, _ := keys.Signing(now.Add(-50 * 24 * time.Hour))
+	if err := jwt.ValidateToken(signWith(t, old)); !errors.Is(err, jwt.ErrUnknownKey) {
+		t.Errorf("Expected tokens of the retired key to be rejected, got %v", err)
+	}
+
+	// A token claiming the kid of an EdDSA key with another algorithm must not verify.
+	parts := strings.Split(token, ".")
+	swapped, _ := json.Marshal(jwt.HeaderJWT{Algorithm: jwt.ALGORITHM_RS256, Protocol: jwt.PROTOCOL_JWT, KeyID: "current"})
+	forged := base64.RawURLEncoding.EncodeToString(swapped) + "." + parts[1] + "." + parts[2]
+	if err := jwt.ValidateToken(forged); !errors.Is(err, jwt.ErrUnknownKey) {
+		t.Errorf("Expected the algorithm to be bound to the key, got %v", err)
+	}
+
+	until := config.ConfigAll.JWT_HS256_UNTIL
+	defer func() { config.ConfigAll.JWT_HS256_UNTIL = until }()
+	config.ConfigAll.JWT_HS256_UNTIL = now.Add(time.Hour)
+	hs256 := jwt.GenerateJWT(`{"alg":"HS256","typ":"JWT"}`, claims(nil))
+	if err := jwt.ValidateToken(hs256); err != nil {
+		t.Errorf("Expected HS256 tokens to stay valid until JWT_HS256_UNTIL, got %v", err)
+	}
+	config.ConfigAll.JWT_HS256_UNTIL = now.Add(-time.Hour)
+	if err := jwt.ValidateToken(hs256); !errors.Is(err, jwt.ErrAlgorithm) {
+		t.Errorf("Expected HS256 tokens to be rejected after JWT_HS256_UNTIL, got %v", err)
+	}
+}
+
+// TestCheckConfig tests that a missing legacy cutoff, or a key set without a fixed HS256
+// cutoff, fails the start.
+func TestCheckConfig(t *testing.T) {
+	file, until, legacy := config.ConfigAll.JWT_KEYS_FILE, config.ConfigAll.JWT_HS256_UNTIL, config.ConfigAll.JWT_LEGACY_UNTIL
+	defer func() {
+		config.ConfigAll.JWT_KEYS_FILE, config.ConfigAll.JWT_HS256_UNTIL, config.ConfigAll.JWT_LEGACY_UNTIL = file, until, legacy
+	}()
+
+	config.ConfigAll.JWT_KEYS_FILE, config.ConfigAll.JWT_HS256_UNTIL, config.ConfigAll.JWT_LEGACY_UNTIL = "", time.Time{}, time.Time{}
+	if err := jwt.CheckConfig(); err == nil {
+		t.Errorf("Expected a missing JWT_LEGACY_UNTIL to be rejected")
+	}
+	config.ConfigAll.JWT_LEGACY_UNTIL = time.Date(2026, 11, 20, 0, 0, 0, 0, time.UTC)
+	if err := jwt.CheckConfig(); err != nil {
+		t.Errorf("Expected no cutoff to be required without keys, got %v", err)
+	}
+	config.ConfigAll.JWT_KEYS_FILE = "keys.json"
+	if err := jwt.CheckConfig(); err == nil {
+		t.Errorf("Expected keys without JWT_HS256_UNTIL to be rejected")
+	}
+	config.ConfigAll.JWT_HS256_UNTIL = time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC)
+	if err := jwt.CheckConfig(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+// TestJWKS tests that published RSA keys verify tokens of their private keys.
+func TestJWKS(t *testing.T) {
+	now := time.Now()
+	keys, rsaKey := openKeySet(t, now)
+
+	jwks := keys.JWKS(now)
+	if len(jwks.Keys) != 3 {
+		t.Fatalf("Expected three published keys, got %+v", jwks.Keys)
+	}
+	published := jwks.Keys[0]
+	if published.KeyID != "previous" || published.KeyType != "RSA" || published.Algorithm != jwt.ALGORITHM_RS256 || published.Use != "sig" {
+		t.Fatalf("Unexpected key: %+v", published)
+	}
+	n, _ := base64.RawURLEncoding.DecodeString(published.N)
+	e, _ := base64.RawURLEncoding.DecodeString(published.E)
+	public := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	if !public.Equal(&rsaKey.PublicKey) {
+		t.Fatalf("Expected the published key to match the private key")
+	}
+
+	token := signWith(t, keys.Verifying(now)[0])
+	parts := strings.Split(token, ".")
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(public, crypto.SHA256, digest[:], signature); err != nil {
+		t.Errorf("Expected the published key to verify the token, got %v", err)
+	}
+
+	for _, key := range jwks.Keys[1:] {
+		if key.KeyType != "OKP" || key.Curve != "Ed25519" || key.X == "" {
+			t.Errorf("Unexpected key: %+v", key)
+		}
+	}
+}
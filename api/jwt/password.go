@@ -0,0 +1,211 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/models"
+	"urlshort.ru/m/utils"
+)
+
+const (
+	// PASSWORD_PREFIX starts every argon2id hash in the PHC string format:
+	//
+	//	$argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>
+	//
+	// with the salt and hash in unpadded standard base64. Hashes without it are legacy
+	// hashes, the hex SHA-256 of the email followed by the password.
+	PASSWORD_PREFIX = "$argon2id$"
+
+	PASSWORD_SALT_BYTES = 16
+	PASSWORD_KEY_BYTES  = 32
+)
+
+var (
+	ErrPasswordHash       = errors.New("malformed password hash")
+	ErrInvalidCredentials = errors.New("invalid email or password")
+)
+
+// PasswordParams are the argon2id cost parameters of a hash.
+type PasswordParams struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+}
+
+// CurrentPasswordParams returns the parameters new hashes are made with, set with
+// PASSWORD_ARGON2_TIME, PASSWORD_ARGON2_MEMORY in KiB and PASSWORD_ARGON2_THREADS.
+func CurrentPasswordParams() PasswordParams {
+	return PasswordParams{
+		Time:    uint32(config.ConfigAll.PASSWORD_ARGON2_TIME),
+		Memory:  uint32(config.ConfigAll.PASSWORD_ARGON2_MEMORY),
+		Threads: uint8(config.ConfigAll.PASSWORD_ARGON2_THREADS),
+	}
+}
+
+// HashPassword hashes a password with argon2id, a random salt and the current parameters.
+//
+// Parameters:
+// - password: the password.
+//
+// Returns:
+// - string: the encoded hash.
+// - error: an error if no salt could be read.
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, PASSWORD_SALT_BYTES)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	params := CurrentPasswordParams()
+	key := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, PASSWORD_KEY_BYTES)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", PASSWORD_PREFIX, argon2.Version,
+		params.Memory, params.Time, params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// parsePasswordHash decodes an argon2id hash into its parameters, salt and key.
+func parsePasswordHash(encoded string) (PasswordParams, []byte, []byte, error) {
+	parts := strings.Split(strings.TrimPrefix(encoded, PASSWORD_PREFIX), "$")
+	if len(parts) != 4 {
+		return PasswordParams{}, nil, nil, ErrPasswordHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[0], "v=%d", &version); err != nil || version != argon2.Version {
+		return PasswordParams{}, nil, nil, ErrPasswordHash
+	}
+	var params PasswordParams
+	if _, err := fmt.Sscanf(parts[1], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return PasswordParams{}, nil, nil, ErrPasswordHash
+	}
+	if params.Time == 0 || params.Threads == 0 {
+		return PasswordParams{}, nil, nil, ErrPasswordHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return PasswordParams{}, nil, nil, ErrPasswordHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(key) == 0 {
+		return PasswordParams{}, nil, nil, ErrPasswordHash
+	}
+	return params, salt, key, nil
+}
+
+// VerifyPassword checks a password against a stored hash.
+//
+// Legacy SHA-256 hashes are salted with the email the user had when the hash was made, so
+// they are checked with the current email and must be rehashed on the first successful
+// login. argon2id hashes do not depend on the email.
+//
+// Parameters:
+// - encoded: the stored hash.
+// - email: the email of the user, used for legacy hashes only.
+// - password: the password to check.
+//
+// Returns:
+// - bool: true if the password matches.
+// - bool: true if the hash should be replaced by HashPassword, because it is a legacy hash or
+// its parameters differ from the current ones.
+// - error: ErrPasswordHash if the stored hash cannot be decoded.
+func VerifyPassword(encoded string, email string, password string) (bool, bool, error) {
+	if !strings.HasPrefix(encoded, PASSWORD_PREFIX) {
+		legacy := utils.GenerateShortHashSHA256(email + password)
+		return subtle.ConstantTimeCompare([]byte(legacy), []byte(encoded)) == 1, true, nil
+	}
+
+	params, salt, key, err := parsePasswordHash(encoded)
+	if err != nil {
+		return false, false, err
+	}
+	candidate := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(candidate, key) != 1 {
+		return false, false, nil
+	}
+	return true, params != CurrentPasswordParams() || len(key) != PASSWORD_KEY_BYTES, nil
+}
+
+var (
+	dummyPasswordHash string
+	dummyPasswordOnce sync.Once
+)
+
+// Authenticate loads the user of an email and checks the password. A legacy hash or a hash
+// with outdated parameters is replaced after a successful check.
+//
+// An unknown email and a legacy SHA-256 hash are also checked against a dummy argon2 hash,
+// so every check takes as long as a wrong password and the response reveals neither which
+// emails are registered nor which accounts still have a legacy hash.
+//
+// Parameters:
+// - db: the database.
+// - email: the email.
+// - password: the password.
+//
+// Returns:
+// - models.User: the user.
+// - error: ErrInvalidCredentials if the email is unknown or the password is wrong, or a
+// database error.
+func Authenticate(db *gorm.DB, email string, password string) (models.User, error) {
+	var users []models.User
+	if err := db.Limit(1).Find(&users, "email = ?", email).Error; err != nil {
+		return models.User{}, err
+	}
+	if len(users) == 0 {
+		verifyDummyPassword(email, password)
+		return models.User{}, ErrInvalidCredentials
+	}
+
+	user := users[0]
+	if !strings.HasPrefix(user.Password, PASSWORD_PREFIX) {
+		verifyDummyPassword(user.Email, password)
+	}
+	ok, rehash, err := VerifyPassword(user.Password, user.Email, password)
+	if err != nil {
+		slog.Error(LOGGER_HANDLER, "user", user.ID, "error", err)
+	}
+	if !ok {
+		return models.User{}, ErrInvalidCredentials
+	}
+	if rehash {
+		if err := SetPassword(db, &user, password); err != nil {
+			slog.Error(LOGGER_HANDLER, "user", user.ID, "error", err)
+		}
+	}
+	return user, nil
+}
+
+// verifyDummyPassword checks a password against a dummy argon2 hash and discards the result.
+func verifyDummyPassword(email string, password string) {
+	dummyPasswordOnce.Do(func() { dummyPasswordHash, _ = HashPassword("") })
+	VerifyPassword(dummyPasswordHash, email, password)
+}
+
+// SetPassword hashes a password with HashPassword and stores it on the user.
+//
+// Parameters:
+// - db: the database.
+// - user: the user, its Password is updated.
+// - password: the new password.
+//
+// Returns:
+// - error: a hashing or database error.
+func SetPassword(db *gorm.DB, user *models.User, password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if err := db.Model(user).Update("password", hash).Error; err != nil {
+		return err
+	}
+	user.Password = hash
+	return nil
+}
@@ -0,0 +1,76 @@
+package jwt_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"urlshort.ru/m/api/jwt"
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/models"
+	"urlshort.ru/m/utils"
+)
+
+// TestHashPassword tests argon2id hashes and the rehash of hashes with outdated parameters.
+func TestHashPassword(t *testing.T) {
+	defer func(memory int) { config.ConfigAll.PASSWORD_ARGON2_MEMORY = memory }(config.ConfigAll.PASSWORD_ARGON2_MEMORY)
+	config.ConfigAll.PASSWORD_ARGON2_MEMORY = 1024
+
+	hash, err := jwt.HashPassword("correct horse")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=2,p=1$") {
+		t.Errorf("Unexpected hash format: %s", hash)
+	}
+	if other, _ := jwt.HashPassword("correct horse"); other == hash {
+		t.Errorf("Expected hashes of the same password to differ by salt")
+	}
+
+	if ok, rehash, err := jwt.VerifyPassword(hash, "ignored@example.com", "correct horse"); !ok || rehash || err != nil {
+		t.Errorf("Expected the password to match without rehash, got %v, %v, %v", ok, rehash, err)
+	}
+	if ok, _, _ := jwt.VerifyPassword(hash, "", "wrong horse"); ok {
+		t.Errorf("Expected a wrong password to fail")
+	}
+
+	config.ConfigAll.PASSWORD_ARGON2_MEMORY = 2048
+	if ok, rehash, _ := jwt.VerifyPassword(hash, "", "correct horse"); !ok || !rehash {
+		t.Errorf("Expected a hash with outdated parameters to match and be rehashed, got %v, %v", ok, rehash)
+	}
+
+	if _, _, err := jwt.VerifyPassword("$argon2id$v=19$m=1024$salt$key", "", "correct horse"); !errors.Is(err, jwt.ErrPasswordHash) {
+		t.Errorf("Expected a malformed hash to be rejected, got %v", err)
+	}
+}
+
+// TestAuthenticate tests that legacy hashes are replaced on login and that argon2id hashes
+// survive an email change.
+func TestAuthenticate(t *testing.T) {
+	defer func(memory int) { config.ConfigAll.PASSWORD_ARGON2_MEMORY = memory }(config.ConfigAll.PASSWORD_ARGON2_MEMORY)
+	config.ConfigAll.PASSWORD_ARGON2_MEMORY = 1024
+	db := models.DATABASE
+	db.Unscoped().Where("email = ?", "renamed@example.com").Delete(&models.User{})
+	user := createUser(t, "legacy@example.com")
+	db.Model(&user).Update("password", utils.GenerateShortHashSHA256("legacy@example.com"+"secret"))
+
+	if _, err := jwt.Authenticate(db, "legacy@example.com", "wrong"); !errors.Is(err, jwt.ErrInvalidCredentials) {
+		t.Errorf("Expected a wrong password to fail, got %v", err)
+	}
+	if _, err := jwt.Authenticate(db, "unknown@example.com", "secret"); !errors.Is(err, jwt.ErrInvalidCredentials) {
+		t.Errorf("Expected an unknown email to fail like a wrong password, got %v", err)
+	}
+
+	authenticated, err := jwt.Authenticate(db, "legacy@example.com", "secret")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(authenticated.Password, jwt.PASSWORD_PREFIX) {
+		t.Errorf("Expected the legacy hash to be replaced, got %s", authenticated.Password)
+	}
+
+	db.Model(&user).Update("email", "renamed@example.com")
+	if _, err := jwt.Authenticate(db, "renamed@example.com", "secret"); err != nil {
+		t.Errorf("Expected the password to survive an email change, got %v", err)
+	}
+}
@@ -0,0 +1,362 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"urlshort.ru/m/audit"
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/mailer"
+	"urlshort.ru/m/models"
+	"urlshort.ru/m/utils"
+)
+
+// Purposes of user tokens. A token is accepted for its own purpose only.
+const (
+	PURPOSE_VERIFY_EMAIL   = "verify_email"
+	PURPOSE_PASSWORD_RESET = "password_reset"
+)
+
+// USER_TOKEN_BYTES is the number of random bytes of a user token. Only the SHA-256 of a
+// token is stored, so a leaked database does not leak usable links.
+const USER_TOKEN_BYTES = 32
+
+// USER_TOKEN_RESEND_INTERVAL is how long after a token another one of the same purpose is
+// not sent, so the endpoints cannot be used to flood a mailbox.
+const USER_TOKEN_RESEND_INTERVAL = time.Minute
+
+var (
+	ErrUserToken        = errors.New("invalid or expired token")
+	ErrEmailNotVerified = errors.New("email not verified")
+)
+
+// MailData is the data of the verification and password reset templates.
+type MailData struct {
+	Email     string
+	Link      string
+	Token     string
+	ExpiresAt time.Time
+	ExpiresIn string
+}
+
+// IssueUserToken creates a single-use token of a purpose for the current email of a user.
+// Unused tokens of the same purpose are invalidated, so only the latest link works.
+//
+// Parameters:
+// - db: the database.
+// - user: the user.
+// - purpose: PURPOSE_VERIFY_EMAIL or PURPOSE_PASSWORD_RESET.
+// - ttl: how long the token is valid.
+// - now: the time.
+//
+// Returns:
+// - string: the token, unpadded URL-safe base64.
+// - error: an error if no token could be generated or a database error.
+func IssueUserToken(db *gorm.DB, user models.User, purpose string, ttl time.Duration, now time.Time) (string, error) {
+	random := make([]byte, USER_TOKEN_BYTES)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(random)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.UserToken{}).Where("user_id = ? AND purpose = ? AND used_at IS NULL", user.ID, purpose).
+			Update("used_at", now).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&models.UserToken{
+			UserID:    user.ID,
+			Purpose:   purpose,
+			TokenHash: utils.GenerateShortHashSHA256(token),
+			Email:     user.Email,
+			ExpiresAt: now.Add(ttl),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// FindUserToken returns a token that is known, of the given purpose, unused and unexpired,
+// without using it.
+//
+// Parameters:
+// - db: the database.
+// - token: the token.
+// - purpose: the purpose the token must have.
+// - now: the time.
+//
+// Returns:
+// - models.UserToken: the token.
+// - error: ErrUserToken if the token is unknown, of another purpose, used or expired, or a
+// database error.
+func FindUserToken(db *gorm.DB, token string, purpose string, now time.Time) (models.UserToken, error) {
+	var userTokens []models.UserToken
+	err := db.Limit(1).Find(&userTokens, "token_hash = ? AND purpose = ?", utils.GenerateShortHashSHA256(token), purpose).Error
+	if err != nil {
+		return models.UserToken{}, err
+	}
+	if len(userTokens) == 0 || userTokens[0].UsedAt != nil || !userTokens[0].ExpiresAt.After(now) {
+		return models.UserToken{}, ErrUserToken
+	}
+	return userTokens[0], nil
+}
+
+// ConsumeUserToken marks a token as used. A token is used once even when requests race.
+//
+// Parameters:
+// - db: the database.
+// - token: the token.
+// - purpose: the purpose the token must have.
+// - now: the time.
+//
+// Returns:
+// - models.UserToken: the token.
+// - error: ErrUserToken if the token is unknown, of another purpose, used or expired, or a
+// database error.
+func ConsumeUserToken(db *gorm.DB, token string, purpose string, now time.Time) (models.UserToken, error) {
+	userToken, err := FindUserToken(db, token, purpose, now)
+	if err != nil {
+		return models.UserToken{}, err
+	}
+	result := db.Model(&models.UserToken{}).Where("id = ? AND used_at IS NULL", userToken.ID).Update("used_at", now)
+	if result.Error != nil {
+		return models.UserToken{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.UserToken{}, ErrUserToken
+	}
+	userToken.UsedAt = &now
+	return userToken, nil
+}
+
+// recentlyIssued reports whether a token of a purpose was issued to a user within
+// USER_TOKEN_RESEND_INTERVAL.
+func recentlyIssued(db *gorm.DB, userID uint, purpose string, now time.Time) (bool, error) {
+	var count int64
+	err := db.Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND created_at > ?", userID, purpose, now.Add(-USER_TOKEN_RESEND_INTERVAL)).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// expiresIn formats a token lifetime for the templates, for example "1 hour" or "30 minutes".
+func expiresIn(ttl time.Duration) string {
+	count, unit := int(ttl/time.Minute), "minute"
+	if ttl >= time.Hour && ttl%time.Hour == 0 {
+		count, unit = int(ttl/time.Hour), "hour"
+	}
+	if count == 1 {
+		return fmt.Sprintf("1 %s", unit)
+	}
+	return fmt.Sprintf("%d %ss", count, unit)
+}
+
+// sendUserToken issues a token and mails a link to it with a template.
+func sendUserToken(db *gorm.DB, user models.User, purpose string, ttl time.Duration, url string, name string, now time.Time) error {
+	token, err := IssueUserToken(db, user, purpose, ttl, now)
+	if err != nil {
+		return err
+	}
+	return mailer.Send(user.Email, name, MailData{
+		Email:     user.Email,
+		Link:      url + token,
+		Token:     token,
+		ExpiresAt: now.Add(ttl),
+		ExpiresIn: expiresIn(ttl),
+	})
+}
+
+// SendVerification mails a verification link for the current email of a user, valid for
+// EMAIL_VERIFY_TTL. The link is MAIL_VERIFY_URL followed by the token.
+//
+// Parameters:
+// - db: the database.
+// - user: the user.
+// - now: the time.
+//
+// Returns:
+// - error: a database or mail error.
+func SendVerification(db *gorm.DB, user models.User, now time.Time) error {
+	return sendUserToken(db, user, PURPOSE_VERIFY_EMAIL, config.ConfigAll.EMAIL_VERIFY_TTL,
+		config.ConfigAll.MAIL_VERIFY_URL, mailer.TEMPLATE_VERIFY_EMAIL, now)
+}
+
+// findUser returns the user of an email, or false if there is none.
+func findUser(db *gorm.DB, email string) (models.User, bool, error) {
+	var users []models.User
+	if err := db.Limit(1).Find(&users, "email = ?", email).Error; err != nil {
+		return models.User{}, false, err
+	}
+	if len(users) == 0 {
+		return models.User{}, false, nil
+	}
+	return users[0], true, nil
+}
+
+// RequestVerification mails a new verification link to an unverified email. Unknown and
+// verified emails are ignored, so the caller cannot tell them apart, and no link is sent
+// within USER_TOKEN_RESEND_INTERVAL of the previous one.
+//
+// Parameters:
+// - db: the database.
+// - email: the email.
+// - now: the time.
+//
+// Returns:
+// - error: a database or mail error.
+func RequestVerification(db *gorm.DB, email string, now time.Time) error {
+	user, found, err := findUser(db, email)
+	if err != nil || !found || user.EmailVerifiedAt != nil {
+		return err
+	}
+	if recent, err := recentlyIssued(db, user.ID, PURPOSE_VERIFY_EMAIL, now); err != nil || recent {
+		return err
+	}
+	return SendVerification(db, user, now)
+}
+
+// RequestPasswordReset mails a password reset link, valid for PASSWORD_RESET_TTL. The link
+// is MAIL_RESET_URL followed by the token. Unknown emails are ignored, so the caller cannot
+// tell them apart, and no link is sent within USER_TOKEN_RESEND_INTERVAL of the previous one.
+//
+// Parameters:
+// - db: the database.
+// - email: the email.
+// - now: the time.
+//
+// Returns:
+// - error: a database or mail error.
+func RequestPasswordReset(db *gorm.DB, email string, now time.Time) error {
+	user, found, err := findUser(db, email)
+	if err != nil || !found {
+		return err
+	}
+	if recent, err := recentlyIssued(db, user.ID, PURPOSE_PASSWORD_RESET, now); err != nil || recent {
+		return err
+	}
+	return sendUserToken(db, user, PURPOSE_PASSWORD_RESET, config.ConfigAll.PASSWORD_RESET_TTL,
+		config.ConfigAll.MAIL_RESET_URL, mailer.TEMPLATE_PASSWORD_RESET, now)
+}
+
+// userOfToken consumes a token and loads its user. A token issued for an email the user has
+// changed since is rejected.
+func userOfToken(db *gorm.DB, token string, purpose string, now time.Time) (models.User, error) {
+	userToken, err := ConsumeUserToken(db, token, purpose, now)
+	if err != nil {
+		return models.User{}, err
+	}
+	var user models.User
+	if err := db.Limit(1).Find(&user, "id = ?", userToken.UserID).Error; err != nil {
+		return models.User{}, err
+	}
+	if user.ID == 0 || user.Email != userToken.Email {
+		return models.User{}, ErrUserToken
+	}
+	return user, nil
+}
+
+// VerifyEmail marks the email of a user verified with a verification token. It is audited.
+//
+// Parameters:
+// - db: the database.
+// - token: the token.
+// - ip: the IP address of the request.
+// - now: the time.
+//
+// Returns:
+// - models.User: the user.
+// - error: ErrUserToken or a database error.
+func VerifyEmail(db *gorm.DB, token string, ip string, now time.Time) (models.User, error) {
+	user, err := userOfToken(db, token, PURPOSE_VERIFY_EMAIL, now)
+	if err != nil {
+		return models.User{}, err
+	}
+	if user.EmailVerifiedAt == nil {
+		if err := db.Model(&user).Update("email_verified_at", now).Error; err != nil {
+			return models.User{}, err
+		}
+		user.EmailVerifiedAt = &now
+	}
+	err = audit.Record(db, models.AuditEntry{
+		Action:  audit.ACTION_EMAIL_VERIFIED,
+		Subject: EmailSubject(user.Email),
+		ActorID: &user.ID,
+		IP:      ip,
+	})
+	return user, err
+}
+
+// ResetPassword sets a new password with a password reset token. Every session and access
+// token of the user is revoked and the failed logins of the email are cleared. The email
+// is verified too, the token was received through it. The reset is audited.
+//
+// The token is used and the password is changed in one transaction, so a failed reset leaves
+// the token usable and a used token always comes with the new password. The password is
+// hashed before the transaction, after a check of the token, so unknown tokens cost no
+// hashing and the database is not locked while hashing.
+//
+// Parameters:
+// - db: the database.
+// - token: the token.
+// - password: the new password.
+// - ip: the IP address of the request.
+// - now: the time.
+//
+// Returns:
+// - models.User: the user.
+// - error: ErrUserToken, a hashing or a database error.
+func ResetPassword(db *gorm.DB, token string, password string, ip string, now time.Time) (models.User, error) {
+	if _, err := FindUserToken(db, token, PURPOSE_PASSWORD_RESET, now); err != nil {
+		return models.User{}, err
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	var user models.User
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if user, err = userOfToken(tx, token, PURPOSE_PASSWORD_RESET, now); err != nil {
+			return err
+		}
+		updates := map[string]any{"password": hash, "refresh_token": ""}
+		if user.EmailVerifiedAt == nil {
+			updates["email_verified_at"] = now
+			user.EmailVerifiedAt = &now
+		}
+		if err := tx.Model(&user).Updates(updates).Error; err != nil {
+			return err
+		}
+		user.Password = hash
+		revoked, err := RevokeSessions(tx, user.ID, 0)
+		if err != nil {
+			return err
+		}
+		if err := BumpTokenVersion(tx, user.ID); err != nil {
+			return err
+		}
+		if err := ResetLoginFailures(tx, user.Email); err != nil {
+			return err
+		}
+		return audit.Record(tx, models.AuditEntry{
+			Action:  audit.ACTION_PASSWORD_RESET,
+			Subject: EmailSubject(user.Email),
+			ActorID: &user.ID,
+			IP:      ip,
+			Detail:  fmt.Sprintf("%d sessions revoked", revoked),
+		})
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+	// The revocation cache may have been reloaded before the commit.
+	Revocations.Invalidate()
+	return user, nil
+}
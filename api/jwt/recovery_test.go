@@ -0,0 +1,135 @@
+package jwt_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"urlshort.ru/m/api/jwt"
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/mailer"
+	"urlshort.ru/m/models"
+)
+
+// useOutbox sends mail to a temporary outbox for the test and returns its directory.
+func useOutbox(t *testing.T) string {
+	dir := t.TempDir()
+	original := mailer.Default
+	mailer.Default = &mailer.FileMailer{Dir: dir}
+	t.Cleanup(func() { mailer.Default = original })
+	return dir
+}
+
+// mailedToken returns the token of the only link mailed to the outbox.
+func mailedToken(t *testing.T, dir string) string {
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("Expected one mail, got %v", files)
+	}
+	defer os.Remove(files[0])
+	data, _ := os.ReadFile(files[0])
+	match := regexp.MustCompile(`token=([A-Za-z0-9_-]+)`).FindSubmatch(data)
+	if match == nil {
+		t.Fatalf("Expected a link in %s", data)
+	}
+	return string(match[1])
+}
+
+// TestPasswordReset tests that a mailed reset token sets the password once, revokes the
+// sessions of the user and that unknown emails are ignored.
+func TestPasswordReset(t *testing.T) {
+	defer func(memory int) { config.ConfigAll.PASSWORD_ARGON2_MEMORY = memory }(config.ConfigAll.PASSWORD_ARGON2_MEMORY)
+	config.ConfigAll.PASSWORD_ARGON2_MEMORY = 1024
+	db := models.DATABASE
+	dir := useOutbox(t)
+	user := createUser(t, "reset@example.com")
+	db.Unscoped().Where("user_id = ?", user.ID).Delete(&models.UserToken{})
+	session, _, _, err := jwt.StartSession(db, user, jwt.Client{IP: "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	now := time.Now()
+	if err := jwt.RequestPasswordReset(db, "unknown@example.com", now); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := jwt.RequestPasswordReset(db, "reset@example.com", now); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	token := mailedToken(t, dir)
+	if err := jwt.RequestPasswordReset(db, "reset@example.com", now); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.eml")); len(files) != 0 {
+		t.Errorf("Expected no mail within the resend interval, got %v", files)
+	}
+
+	if _, err := jwt.ConsumeUserToken(db, token, jwt.PURPOSE_VERIFY_EMAIL, now); !errors.Is(err, jwt.ErrUserToken) {
+		t.Errorf("Expected a token of another purpose to fail, got %v", err)
+	}
+	reset, err := jwt.ResetPassword(db, token, "new secret", "192.0.2.1", now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if reset.EmailVerifiedAt == nil {
+		t.Errorf("Expected the reset to verify the email")
+	}
+	if _, err := jwt.ResetPassword(db, token, "other secret", "192.0.2.1", now); !errors.Is(err, jwt.ErrUserToken) {
+		t.Errorf("Expected a used token to fail, got %v", err)
+	}
+	if _, err := jwt.Authenticate(db, "reset@example.com", "new secret"); err != nil {
+		t.Errorf("Expected the new password to work, got %v", err)
+	}
+	db.First(&session, session.ID)
+	if session.RevokedAt == nil {
+		t.Errorf("Expected the sessions to be revoked")
+	}
+
+	token, _ = jwt.IssueUserToken(db, user, jwt.PURPOSE_PASSWORD_RESET, time.Hour, now)
+	if _, err := jwt.ResetPassword(db, token, "late", "", now.Add(2*time.Hour)); !errors.Is(err, jwt.ErrUserToken) {
+		t.Errorf("Expected an expired token to fail, got %v", err)
+	}
+}
+
+// TestVerifyEmail tests that a verification token verifies the email it was sent to, that a
+// new token replaces the old one and that an email change invalidates it.
+func TestVerifyEmail(t *testing.T) {
+	db := models.DATABASE
+	dir := useOutbox(t)
+	db.Unscoped().Where("email = ?", "verified@example.com").Delete(&models.User{})
+	user := createUser(t, "verify@example.com")
+	db.Unscoped().Where("user_id = ?", user.ID).Delete(&models.UserToken{})
+
+	now := time.Now()
+	if err := jwt.SendVerification(db, user, now); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	first := mailedToken(t, dir)
+	second, _ := jwt.IssueUserToken(db, user, jwt.PURPOSE_VERIFY_EMAIL, time.Hour, now)
+	if _, err := jwt.VerifyEmail(db, first, "", now); !errors.Is(err, jwt.ErrUserToken) {
+		t.Errorf("Expected a replaced token to fail, got %v", err)
+	}
+	verified, err := jwt.VerifyEmail(db, second, "", now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if verified.EmailVerifiedAt == nil {
+		t.Errorf("Expected the email to be verified")
+	}
+
+	db.Model(&user).Updates(map[string]any{"email_verified_at": nil})
+	if err := jwt.RequestVerification(db, "verify@example.com", now); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.eml")); len(files) != 0 {
+		t.Errorf("Expected no mail within the resend interval, got %v", files)
+	}
+	token, _ := jwt.IssueUserToken(db, user, jwt.PURPOSE_VERIFY_EMAIL, time.Hour, now)
+	db.Model(&user).Update("email", "verified@example.com")
+	if _, err := jwt.VerifyEmail(db, token, "", now); !errors.Is(err, jwt.ErrUserToken) {
+		t.Errorf("Expected a token of a changed email to fail, got %v", err)
+	}
+}
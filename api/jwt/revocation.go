@@ -0,0 +1,256 @@
+package jwt
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/models"
+)
+
+// RevocationCache decides whether a valid access token has been revoked since it was signed.
+//
+// An access token is revoked when its jti is on the denylist, when its session was revoked
+// by logout or from the session list, or when the token version of its user changed, as it
+// does on a role change. The denylist and the sessions revoked within ACCESS_TIME are loaded
+// at once and reloaded after the cache TTL; token versions are loaded per user and dropped on
+// reload. A check costs at most one query per user and TTL.
+//
+// Every process has its own cache. A revocation takes effect at once in the process that made
+// it and within the TTL in the others.
+type RevocationCache struct {
+	db  *gorm.DB
+	ttl time.Duration
+
+	mu       sync.Mutex
+	loaded   time.Time
+	denied   map[string]struct{}
+	sessions map[uint]struct{}
+	versions map[uint]int
+}
+
+// NewRevocationCache creates a revocation cache.
+//
+// Parameters:
+// - db: the database.
+// - ttl: the time after which the cache is reloaded.
+//
+// Returns:
+// - *RevocationCache: the cache, loaded on the first check.
+func NewRevocationCache(db *gorm.DB, ttl time.Duration) *RevocationCache {
+	return &RevocationCache{db: db, ttl: ttl}
+}
+
+// Check returns ErrTokenRevoked if an access token has been revoked.
+//
+// Parameters:
+// - payload: the payload of a valid access token.
+// - now: the time.
+//
+// Returns:
+// - error: ErrTokenRevoked, or a database error.
+func (r *RevocationCache) Check(payload PayloadJWTAccess, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.denied == nil || now.Sub(r.loaded) >= r.ttl {
+		if err := r.load(now); err != nil {
+			return err
+		}
+	}
+
+	if _, ok := r.denied[payload.JTI]; ok && payload.JTI != "" {
+		return ErrTokenRevoked
+	}
+	if _, ok := r.sessions[payload.SID]; ok && payload.SID != 0 {
+		return ErrTokenRevoked
+	}
+
+	userID := uint(payload.UserID)
+	version, ok := r.versions[userID]
+	if !ok {
+		var users []models.User
+		if err := r.db.Select("id", "token_version").Limit(1).Find(&users, "id = ?", userID).Error; err != nil {
+			return err
+		}
+		// Tokens of deleted users get a version no token carries.
+		version = -1
+		if len(users) == 1 {
+			version = users[0].TokenVersion
+		}
+		r.versions[userID] = version
+	}
+	if payload.Version != version {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// load reads the denylist and the recently revoked sessions and drops the token versions.
+func (r *RevocationCache) load(now time.Time) error {
+	var jtis []string
+	if err := r.db.Model(&models.DeniedToken{}).Where("expires_at > ?", now).Pluck("jti", &jtis).Error; err != nil {
+		return err
+	}
+	var ids []uint
+	err := r.db.Unscoped().Model(&models.Session{}).Where("revoked_at > ?", now.Add(-ACCESS_TIME)).Pluck("id", &ids).Error
+	if err != nil {
+		return err
+	}
+
+	r.denied = make(map[string]struct{}, len(jtis))
+	for _, jti := range jtis {
+		r.denied[jti] = struct{}{}
+	}
+	r.sessions = make(map[uint]struct{}, len(ids))
+	for _, id := range ids {
+		r.sessions[id] = struct{}{}
+	}
+	r.versions = map[uint]int{}
+	r.loaded = now
+	return nil
+}
+
+// Invalidate makes the next check reload the cache. Call it after revoking a token, a session
+// or bumping a token version, so the revocation takes effect at once in this process.
+func (r *RevocationCache) Invalidate() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.denied = nil
+	r.mu.Unlock()
+}
+
+// Revocations is the revocation cache of the process, set by Register. Without it access
+// tokens are not checked for revocation.
+var Revocations *RevocationCache
+
+// CheckRevoked returns ErrTokenRevoked if a valid access token has been revoked.
+//
+// Parameters:
+// - token: the access token, checked with ValidateTokenType.
+//
+// Returns:
+// - error: ErrTokenRevoked, or an error if the payload or the database is invalid.
+func CheckRevoked(token string) error {
+	if Revocations == nil {
+		return nil
+	}
+	payload, err := GetPayloadHandlerAccess(token)
+	if err != nil {
+		return err
+	}
+	return Revocations.Check(payload, time.Now())
+}
+
+// DenyToken puts the jti of an access token on the denylist until the token expires.
+//
+// Parameters:
+// - db: the database.
+// - token: the access token, checked with ValidateTokenType.
+//
+// Returns:
+// - error: an error if the token has no jti or the database fails.
+func DenyToken(db *gorm.DB, token string) error {
+	payload, err := GetPayloadHandlerAccess(token)
+	if err != nil {
+		return err
+	}
+	if payload.JTI == "" {
+		return ErrInvalidToken
+	}
+	denied := models.DeniedToken{JTI: payload.JTI, ExpiresAt: time.Unix(payload.EXP, 0).Add(config.ConfigAll.JWT_LEEWAY)}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&denied).Error; err != nil {
+		return err
+	}
+	Revocations.Invalidate()
+	return nil
+}
+
+// BumpTokenVersion revokes every access token of a user. Their sessions stay active, so
+// clients get new tokens with the current role on their next refresh.
+//
+// Parameters:
+// - db: the database.
+// - userID: the user.
+//
+// Returns:
+// - error: a database error.
+func BumpTokenVersion(db *gorm.DB, userID uint) error {
+	err := db.Model(&models.User{}).Where("id = ?", userID).
+		Update("token_version", gorm.Expr("token_version + 1")).Error
+	if err != nil {
+		return err
+	}
+	Revocations.Invalidate()
+	return nil
+}
+
+// ChangeRole sets the role of a user and bumps the token version, so access tokens carrying
+// the old role stop being accepted.
+//
+// Parameters:
+// - db: the database.
+// - userID: the user.
+// - role: models.ROLE_USER or models.ROLE_ADMIN.
+//
+// Returns:
+// - models.User: the updated user.
+// - error: gorm.ErrRecordNotFound if the user does not exist, or a database error.
+func ChangeRole(db *gorm.DB, userID uint, role string) (models.User, error) {
+	var user models.User
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&user, "id = ?", userID).Error; err != nil {
+			return err
+		}
+		if user.Role == role {
+			return nil
+		}
+		return tx.Model(&user).Updates(map[string]any{
+			"role":          role,
+			"token_version": gorm.Expr("token_version + 1"),
+		}).Error
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+	user.Role = role
+	Revocations.Invalidate()
+	return user, nil
+}
+
+// PurgeDeniedTokens deletes the denylist entries of expired tokens.
+//
+// Parameters:
+// - db: the database.
+// - now: the time.
+//
+// Returns:
+// - int64: the number of deleted entries.
+// - error: a database error.
+func PurgeDeniedTokens(db *gorm.DB, now time.Time) (int64, error) {
+	result := db.Where("expires_at <= ?", now).Delete(&models.DeniedToken{})
+	return result.RowsAffected, result.Error
+}
+
+// StartPurge runs PurgeDeniedTokens every JWT_DENYLIST_PURGE in the background. With prefork it
+// runs in the master process only.
+//
+// Parameters:
+// - db: the database.
+func StartPurge(db *gorm.DB) {
+	go func() {
+		for {
+			time.Sleep(config.ConfigAll.JWT_DENYLIST_PURGE)
+			purged, err := PurgeDeniedTokens(db, time.Now())
+			if err != nil {
+				slog.Error(LOGGER_HANDLER, err)
+			} else if purged > 0 {
+				slog.Info(LOGGER_HANDLER, "purged denied tokens", purged)
+			}
+		}
+	}()
+}
@@ -0,0 +1,102 @@
+package jwt_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"urlshort.ru/m/api/jwt"
+	"urlshort.ru/m/models"
+)
+
+// checkAccess checks an access token as the handlers do.
+func checkAccess(token string) error {
+	_, err := jwt.GetExtractTokenHandler("Bearer "+token, jwt.TOKEN_ACCESS)
+	return err
+}
+
+// TestRevocation tests that logout, the denylist and role changes revoke access tokens.
+func TestRevocation(t *testing.T) {
+	db := models.DATABASE
+	jwt.Revocations = jwt.NewRevocationCache(db, time.Minute)
+	defer func() { jwt.Revocations = nil }()
+	user := createUser(t, "revocation@example.com")
+
+	_, refresh, access, err := jwt.StartSession(db, user, jwt.Client{DeviceName: "Laptop"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, _, other, _ := jwt.StartSession(db, user, jwt.Client{DeviceName: "Phone"})
+	if err := checkAccess(access); err != nil {
+		t.Fatalf("Expected a valid access token, got %v", err)
+	}
+
+	if err := jwt.EndSession(db, refresh); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := checkAccess(access); !errors.Is(err, jwt.ErrTokenRevoked) {
+		t.Errorf("Expected the access token to be revoked on logout, got %v", err)
+	}
+	if err := checkAccess(other); err != nil {
+		t.Errorf("Expected the other session to stay valid, got %v", err)
+	}
+
+	_, _, denied, _ := jwt.StartSession(db, user, jwt.Client{DeviceName: "Tablet"})
+	if err := jwt.DenyToken(db, denied); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := checkAccess(denied); !errors.Is(err, jwt.ErrTokenRevoked) {
+		t.Errorf("Expected the denied token to be revoked, got %v", err)
+	}
+	if purged, _ := jwt.PurgeDeniedTokens(db, time.Now()); purged != 0 {
+		t.Errorf("Expected unexpired entries to be kept, purged %d", purged)
+	}
+	if purged, _ := jwt.PurgeDeniedTokens(db, time.Now().Add(jwt.ACCESS_TIME+time.Hour)); purged != 1 {
+		t.Errorf("Expected the expired entry to be purged, purged %d", purged)
+	}
+
+	_, desktopRefresh, _, _ := jwt.StartSession(db, user, jwt.Client{DeviceName: "Desktop"})
+	if _, err := jwt.ChangeRole(db, user.ID, models.ROLE_ADMIN); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := checkAccess(other); !errors.Is(err, jwt.ErrTokenRevoked) {
+		t.Errorf("Expected tokens with the old role to be revoked, got %v", err)
+	}
+	_, _, refreshed, err := jwt.RotateSession(db, desktopRefresh, jwt.Client{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := checkAccess(refreshed); err != nil {
+		t.Errorf("Expected the refreshed token to be valid, got %v", err)
+	}
+	if payload, _ := jwt.GetPayloadHandlerAccess(refreshed); payload.Role != models.ROLE_ADMIN {
+		t.Errorf("Expected the refreshed token to carry the new role, got %q", payload.Role)
+	}
+}
+
+// TestRevocationCache tests that revocations made by other processes are seen after the TTL.
+func TestRevocationCache(t *testing.T) {
+	db := models.DATABASE
+	cache := jwt.NewRevocationCache(db, time.Minute)
+	user := createUser(t, "revocation-cache@example.com")
+	payload := jwt.PayloadJWTAccess{UserID: int(user.ID), JTI: "revocation-cache"}
+
+	now := time.Now()
+	if err := cache.Check(payload, now); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	db.Model(&user).Update("token_version", 1)
+	if err := cache.Check(payload, now.Add(time.Second)); err != nil {
+		t.Errorf("Expected the cached version within the TTL, got %v", err)
+	}
+	if err := cache.Check(payload, now.Add(time.Minute)); !errors.Is(err, jwt.ErrTokenRevoked) {
+		t.Errorf("Expected the new version after the TTL, got %v", err)
+	}
+
+	db.Delete(&user)
+	cache.Invalidate()
+	payload.Version = 1
+	if err := cache.Check(payload, now); !errors.Is(err, jwt.ErrTokenRevoked) {
+		t.Errorf("Expected tokens of deleted users to be revoked, got %v", err)
+	}
+}
@@ -1,7 +1,23 @@
 package jwt
 
+import "time"
+
 type UserJSON struct {
-	Email    string `json:"email"`
+	Email      string `json:"email"`
+	Password   string `json:"password"`
+	DeviceName string `json:"device_name,omitempty"`
+}
+
+type EmailJSON struct {
+	Email string `json:"email"`
+}
+
+type UserTokenJSON struct {
+	Token string `json:"token"`
+}
+
+type PasswordResetJSON struct {
+	Token    string `json:"token"`
 	Password string `json:"password"`
 }
 
@@ -12,18 +28,55 @@ type UserDelete struct {
 type HeaderJWT struct {
 	Algorithm string `json:"alg"`
 	Protocol  string `json:"typ"`
+	KeyID     string `json:"kid,omitempty"`
 }
 
 type PayloadJWTRefresh struct {
-	UserID int   `json:"user_id"`
-	EXP    int64 `json:"exp"`
+	UserID int    `json:"user_id"`
+	SID    uint   `json:"sid,omitempty"`
+	Type   string `json:"token_type,omitempty"`
+	JTI    string `json:"jti,omitempty"`
+	EXP    int64  `json:"exp"`
+	ISS    string `json:"iss,omitempty"`
+	AUD    string `json:"aud,omitempty"`
+	IAT    int64  `json:"iat,omitempty"`
+	NBF    int64  `json:"nbf,omitempty"`
 }
 
 type PayloadJWTAccess struct {
+	UserID  int    `json:"user_id"`
+	SID     uint   `json:"sid,omitempty"`
+	Type    string `json:"token_type,omitempty"`
+	JTI     string `json:"jti,omitempty"`
+	EXP     int64  `json:"exp"`
+	ISS     string `json:"iss,omitempty"`
+	AUD     string `json:"aud,omitempty"`
+	IAT     int64  `json:"iat,omitempty"`
+	NBF     int64  `json:"nbf,omitempty"`
+	Email   string `json:"email"`
+	Role    string `json:"role"`
+	Version int    `json:"ver,omitempty"`
+}
+
+type PayloadJWTChallenge struct {
 	UserID int    `json:"user_id"`
+	Type   string `json:"token_type"`
+	JTI    string `json:"jti"`
 	EXP    int64  `json:"exp"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
+	ISS    string `json:"iss,omitempty"`
+	AUD    string `json:"aud,omitempty"`
+	IAT    int64  `json:"iat,omitempty"`
+	NBF    int64  `json:"nbf,omitempty"`
+}
+
+// ClaimsJWT are the registered claims checked by CheckPayload. Numeric dates may be
+// fractional and the audience may be a string or a list of strings, as RFC 7519 allows.
+type ClaimsJWT struct {
+	ISS string   `json:"iss"`
+	AUD any      `json:"aud"`
+	EXP *float64 `json:"exp"`
+	NBF *float64 `json:"nbf"`
+	IAT *float64 `json:"iat"`
 }
 
 type RefreshToken struct {
@@ -36,9 +89,55 @@ type AccessToken struct {
 
 type CheckTokenJSON struct {
 	Token string `json:"token"`
+	Type  string `json:"type,omitempty"`
 }
 
 type RefreshAndAccessTokens struct {
 	Refresh string `json:"refresh"`
 	Access  string `json:"access"`
 }
+
+type SessionResponse struct {
+	ID         uint      `json:"id"`
+	DeviceName string    `json:"device_name"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+type RevokeSessionsResponse struct {
+	Revoked int64 `json:"revoked"`
+}
+
+type ChallengeResponse struct {
+	Challenge string `json:"challenge"`
+	ExpiresIn int    `json:"expires_in"`
+	Enroll    bool   `json:"enroll"`
+}
+
+type TwoFactorLoginJSON struct {
+	Code       string `json:"code"`
+	DeviceName string `json:"device_name,omitempty"`
+}
+
+type TwoFactorLoginResponse struct {
+	Refresh       string   `json:"refresh"`
+	Access        string   `json:"access"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+type CodeJSON struct {
+	Code string `json:"code"`
+}
+
+type TOTPEnrollResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type RecoveryCodesResponse struct {
+	Codes []string `json:"codes"`
+}
@@ -1,5 +1,10 @@
 package jwt
 
+import (
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/models"
+)
+
 // GetJWTRefreshAndAccessTokens returns a RefreshAndAccessTokens struct with the provided refresh token and access token.
 //
 // Parameters:
@@ -20,3 +25,44 @@ func GetJWTAccessTokens(accessToken string) AccessToken {
 		Access: accessToken,
 	}
 }
+
+// GetSessionsResponse converts sessions to their JSON representation.
+//
+// Parameters:
+// - sessions: the sessions.
+// - currentID: the session of the request's access token, 0 for none.
+//
+// Return:
+// - []SessionResponse: the sessions, current set on the session of the request.
+func GetSessionsResponse(sessions []models.Session, currentID uint) []SessionResponse {
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, SessionResponse{
+			ID:         session.ID,
+			DeviceName: session.DeviceName,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    currentID != 0 && session.ID == currentID,
+		})
+	}
+	return response
+}
+
+// GetChallengeResponse returns the response of a login that needs the second step.
+//
+// Parameters:
+// - challenge: the challenge token.
+// - user: the user, who must enroll first if two-factor authentication is not enabled.
+//
+// Return:
+// - ChallengeResponse: the challenge, its lifetime in seconds and whether to enroll.
+func GetChallengeResponse(challenge string, user models.User) ChallengeResponse {
+	return ChallengeResponse{
+		Challenge: challenge,
+		ExpiresIn: int(config.ConfigAll.TWO_FACTOR_CHALLENGE_TTL.Seconds()),
+		Enroll:    user.TOTPEnabledAt == nil,
+	}
+}
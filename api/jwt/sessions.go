@@ -0,0 +1,291 @@
+package jwt
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
+	"urlshort.ru/m/clicks"
+	"urlshort.ru/m/models"
+	"urlshort.ru/m/utils"
+)
+
+// Client describes the device a session is used from.
+type Client struct {
+	DeviceName string
+	UserAgent  string
+	IP         string
+}
+
+// GetClient returns the device of a request.
+//
+// Parameters:
+// - c: the fiber.Ctx object representing the HTTP context.
+// - deviceName: the device name sent by the client, may be empty.
+//
+// Returns:
+// - Client: the device.
+func GetClient(c *fiber.Ctx, deviceName string) Client {
+	return Client{DeviceName: deviceName, UserAgent: c.Get(fiber.HeaderUserAgent), IP: c.IP()}
+}
+
+// deviceName returns the device name of a session: the name sent by the client, or the
+// browser and operating system of its user agent.
+func (c Client) deviceName() string {
+	if c.DeviceName != "" {
+		if len(c.DeviceName) > MAX_DEVICE_NAME {
+			return c.DeviceName[:MAX_DEVICE_NAME]
+		}
+		return c.DeviceName
+	}
+	agent := clicks.ParseUserAgent(c.UserAgent)
+	if agent.Browser == "" {
+		return agent.OS
+	}
+	if agent.OS == "" {
+		return agent.Browser
+	}
+	return agent.Browser + " on " + agent.OS
+}
+
+// issueTokens signs a new refresh and access token of a session.
+func issueTokens(user models.User, session models.Session) (string, string, error) {
+	refreshToken, err := GenerateJWTRefresh(int(user.ID), session.ID)
+	if err != nil {
+		return "", "", err
+	}
+	accessToken, err := GenerateJWTAccess(int(user.ID), user.Email, user.Role, session.ID, user.TokenVersion)
+	if err != nil {
+		return "", "", err
+	}
+	return refreshToken, accessToken, nil
+}
+
+// StartSession creates a session for a user who logged in and signs its first tokens.
+//
+// Parameters:
+// - db: the database.
+// - user: the user.
+// - client: the device the user logged in from.
+//
+// Returns:
+// - models.Session: the session.
+// - string: the refresh token.
+// - string: the access token.
+// - error: a database or signing error.
+func StartSession(db *gorm.DB, user models.User, client Client) (models.Session, string, string, error) {
+	now := time.Now()
+	session := models.Session{
+		UserID:     user.ID,
+		DeviceName: client.deviceName(),
+		UserAgent:  client.UserAgent,
+		IP:         client.IP,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(REFRESH_TIME),
+	}
+	var refreshToken, accessToken string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+		var err error
+		refreshToken, accessToken, err = issueTokens(user, session)
+		if err != nil {
+			return err
+		}
+		session.RefreshTokenHash = utils.GenerateShortHashSHA256(refreshToken)
+		return tx.Model(&session).Update("refresh_token_hash", session.RefreshTokenHash).Error
+	})
+	return session, refreshToken, accessToken, err
+}
+
+// RotateSession exchanges a checked refresh token for a new refresh and access token.
+//
+// Every refresh token is used once. The session stores the hash of its latest token and the
+// swap is conditional on it, so of two requests with the same token only one succeeds. A
+// token of the session that is not the latest was rotated already: it has leaked or been
+// replayed, and the whole session is revoked, logging out both the attacker and the user.
+//
+// Refresh tokens issued before sessions existed carry no sid. They are matched against the
+// hash stored on the user and moved into a new session.
+//
+// Parameters:
+// - db: the database.
+// - token: the refresh token, checked with ValidateTokenType.
+// - client: the device the request comes from.
+//
+// Returns:
+// - models.User: the user of the session.
+// - string: the new refresh token.
+// - string: the new access token.
+// - error: ErrSessionRevoked, ErrTokenReused, ErrTwoFactorRequired if the user has to enroll
+// first, gorm.ErrRecordNotFound for an unknown legacy token or another error.
+func RotateSession(db *gorm.DB, token string, client Client) (models.User, string, string, error) {
+	decoded, err := GetTokenPayload(token)
+	if err != nil {
+		return models.User{}, "", "", err
+	}
+	payload, err := GetPayloadRefresh(decoded)
+	if err != nil {
+		return models.User{}, "", "", err
+	}
+	hash := utils.GenerateShortHashSHA256(token)
+
+	var user models.User
+	if payload.SID == 0 {
+		if err := db.Where("id = ? AND refresh_token = ?", payload.UserID, hash).First(&user).Error; err != nil {
+			return models.User{}, "", "", err
+		}
+		if err := CheckTwoFactorPolicy(db, user); err != nil {
+			return models.User{}, "", "", err
+		}
+		if err := db.Model(&user).Update("refresh_token", "").Error; err != nil {
+			return models.User{}, "", "", err
+		}
+		_, refreshToken, accessToken, err := StartSession(db, user, client)
+		return user, refreshToken, accessToken, err
+	}
+
+	var session models.Session
+	result := db.Limit(1).Find(&session, "id = ? AND user_id = ?", payload.SID, payload.UserID)
+	if result.Error != nil {
+		return models.User{}, "", "", result.Error
+	}
+	if result.RowsAffected == 0 || session.RevokedAt != nil || !time.Now().Before(session.ExpiresAt) {
+		return models.User{}, "", "", ErrSessionRevoked
+	}
+	if err := db.First(&user, "id = ?", session.UserID).Error; err != nil {
+		return models.User{}, "", "", err
+	}
+	// A session started before two-factor authentication was required for the role is not
+	// renewed until the user enrolls and logs in again.
+	if err := CheckTwoFactorPolicy(db, user); err != nil {
+		return models.User{}, "", "", err
+	}
+
+	refreshToken, accessToken, err := issueTokens(user, session)
+	if err != nil {
+		return models.User{}, "", "", err
+	}
+	now := time.Now()
+	result = db.Model(&models.Session{}).
+		Where("id = ? AND refresh_token_hash = ? AND revoked_at IS NULL", session.ID, hash).
+		Updates(map[string]any{
+			"refresh_token_hash": utils.GenerateShortHashSHA256(refreshToken),
+			"last_used_at":       now,
+			"user_agent":         client.UserAgent,
+			"ip":                 client.IP,
+		})
+	if result.Error != nil {
+		return models.User{}, "", "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		slog.Warn(LOGGER_HANDLER, "session", session.ID, "user", session.UserID, "error", ErrTokenReused)
+		if err := RevokeSession(db, session); err != nil {
+			return models.User{}, "", "", err
+		}
+		return models.User{}, "", "", ErrTokenReused
+	}
+	return user, refreshToken, accessToken, nil
+}
+
+// EndSession revokes the session of a refresh token on logout, and with it the access tokens
+// of the session. Refresh tokens without sid clear the hash stored on the user instead; their
+// access tokens carry no sid either, so the token version of the user is bumped.
+//
+// Parameters:
+// - db: the database.
+// - token: the refresh token, checked with ValidateTokenType.
+//
+// Returns:
+// - error: gorm.ErrRecordNotFound if the token is not the latest of an active session, or
+// another error.
+func EndSession(db *gorm.DB, token string) error {
+	decoded, err := GetTokenPayload(token)
+	if err != nil {
+		return err
+	}
+	payload, err := GetPayloadRefresh(decoded)
+	if err != nil {
+		return err
+	}
+	hash := utils.GenerateShortHashSHA256(token)
+
+	var result *gorm.DB
+	if payload.SID == 0 {
+		result = db.Model(&models.User{}).Where("id = ? AND refresh_token = ?", payload.UserID, hash).
+			Update("refresh_token", "")
+	} else {
+		result = db.Model(&models.Session{}).
+			Where("id = ? AND user_id = ? AND refresh_token_hash = ? AND revoked_at IS NULL", payload.SID, payload.UserID, hash).
+			Update("revoked_at", time.Now())
+	}
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	if payload.SID == 0 {
+		return BumpTokenVersion(db, uint(payload.UserID))
+	}
+	Revocations.Invalidate()
+	return nil
+}
+
+// RevokeSession ends a session, its refresh token no longer rotates and its access tokens are
+// revoked.
+//
+// Parameters:
+// - db: the database.
+// - session: the session.
+//
+// Returns:
+// - error: a database error.
+func RevokeSession(db *gorm.DB, session models.Session) error {
+	err := db.Model(&models.Session{}).Where("id = ? AND revoked_at IS NULL", session.ID).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		return err
+	}
+	Revocations.Invalidate()
+	return nil
+}
+
+// RevokeSessions ends every active session of a user and revokes their access tokens.
+//
+// Parameters:
+// - db: the database.
+// - userID: the user.
+// - exceptID: a session kept active, 0 for none.
+//
+// Returns:
+// - int64: the number of revoked sessions.
+// - error: a database error.
+func RevokeSessions(db *gorm.DB, userID uint, exceptID uint) (int64, error) {
+	result := db.Model(&models.Session{}).Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, exceptID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	Revocations.Invalidate()
+	return result.RowsAffected, nil
+}
+
+// ActiveSessions returns the sessions of a user that are neither revoked nor expired, most
+// recently used first.
+//
+// Parameters:
+// - db: the database.
+// - userID: the user.
+//
+// Returns:
+// - []models.Session: the sessions.
+// - error: a database error.
+func ActiveSessions(db *gorm.DB, userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	err := db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").Find(&sessions).Error
+	return sessions, err
+}
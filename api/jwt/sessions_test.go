@@ -0,0 +1,109 @@
+package jwt_test
+
+import (
+	"errors"
+	"testing"
+
+	"urlshort.ru/m/api/jwt"
+	"urlshort.ru/m/models"
+)
+
+// createUser creates a user without sessions.
+func createUser(t *testing.T, email string) models.User {
+	db := models.DATABASE
+	var old models.User
+	if db.Unscoped().Where("email = ?", email).First(&old).Error == nil {
+		db.Unscoped().Where("user_id = ?", old.ID).Delete(&models.Session{})
+		db.Unscoped().Delete(&old)
+	}
+
+	user := models.User{Email: email, Role: models.ROLE_USER}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return user
+}
+
+// TestRotateSession tests that refresh tokens rotate once and that reusing a rotated token
+// revokes its session only.
+func TestRotateSession(t *testing.T) {
+	db := models.DATABASE
+	user := createUser(t, "sessions@example.com")
+	client := jwt.Client{UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36", IP: "192.0.2.1"}
+
+	laptop, first, _, err := jwt.StartSession(db, user, client)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if laptop.DeviceName != "Chrome on Windows" {
+		t.Errorf("Unexpected device name: %q", laptop.DeviceName)
+	}
+	phone, phoneToken, _, err := jwt.StartSession(db, user, jwt.Client{DeviceName: "Phone"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, second, access, err := jwt.RotateSession(db, first, client)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := jwt.ValidateTokenType(access, jwt.TOKEN_ACCESS); err != nil {
+		t.Errorf("Expected a valid access token, got %v", err)
+	}
+	payload, _ := jwt.GetPayloadHandlerAccess(access)
+	if payload.SID != laptop.ID {
+		t.Errorf("Expected the access token of session %d, got %d", laptop.ID, payload.SID)
+	}
+
+	if _, _, _, err := jwt.RotateSession(db, first, client); !errors.Is(err, jwt.ErrTokenReused) {
+		t.Fatalf("Expected the reused token to be detected, got %v", err)
+	}
+	if _, _, _, err := jwt.RotateSession(db, second, client); !errors.Is(err, jwt.ErrSessionRevoked) {
+		t.Errorf("Expected the session to be revoked, got %v", err)
+	}
+	if _, _, _, err := jwt.RotateSession(db, phoneToken, client); err != nil {
+		t.Errorf("Expected the other session to stay active, got %v", err)
+	}
+
+	sessions, err := jwt.ActiveSessions(db, user.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != phone.ID {
+		t.Errorf("Expected the phone session only, got %+v", sessions)
+	}
+}
+
+// TestRevokeSessions tests logout and revoking all sessions but the current one.
+func TestRevokeSessions(t *testing.T) {
+	db := models.DATABASE
+	user := createUser(t, "revoke@example.com")
+
+	current, _, _, _ := jwt.StartSession(db, user, jwt.Client{DeviceName: "Current"})
+	_, otherToken, _, _ := jwt.StartSession(db, user, jwt.Client{DeviceName: "Other"})
+	_, loggedOut, _, _ := jwt.StartSession(db, user, jwt.Client{DeviceName: "Logged out"})
+
+	if err := jwt.EndSession(db, loggedOut); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, _, _, err := jwt.RotateSession(db, loggedOut, jwt.Client{}); !errors.Is(err, jwt.ErrSessionRevoked) {
+		t.Errorf("Expected the logged out session to be revoked, got %v", err)
+	}
+
+	revoked, err := jwt.RevokeSessions(db, user.ID, current.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if revoked != 1 {
+		t.Errorf("Expected one revoked session, got %d", revoked)
+	}
+	if _, _, _, err := jwt.RotateSession(db, otherToken, jwt.Client{}); !errors.Is(err, jwt.ErrSessionRevoked) {
+		t.Errorf("Expected the other session to be revoked, got %v", err)
+	}
+
+	sessions, _ := jwt.ActiveSessions(db, user.ID)
+	response := jwt.GetSessionsResponse(sessions, current.ID)
+	if len(response) != 1 || !response[0].Current || response[0].DeviceName != "Current" {
+		t.Errorf("Expected the current session only, got %+v", response)
+	}
+}
@@ -0,0 +1,261 @@
+package jwt
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"urlshort.ru/m/audit"
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/models"
+)
+
+// Prefixes of login throttle subjects. Failed logins are counted per email and per IP.
+// Emails are counted whether or not they are registered, so throttling and lockout do not
+// reveal which emails exist.
+const (
+	SUBJECT_EMAIL = "email:"
+	SUBJECT_IP    = "ip:"
+)
+
+// EmailSubject returns the throttle subject of an email.
+func EmailSubject(email string) string {
+	return SUBJECT_EMAIL + strings.ToLower(strings.TrimSpace(email))
+}
+
+// IPSubject returns the throttle subject of an IP address.
+func IPSubject(ip string) string {
+	return SUBJECT_IP + ip
+}
+
+// LoginSubjects returns the throttle subjects of a login attempt, the email first.
+func LoginSubjects(email string, ip string) []string {
+	return []string{EmailSubject(email), IPSubject(ip)}
+}
+
+// lockoutFailures returns the number of failures that locks a subject out. An IP is shared
+// by every user behind it and is locked out later than an account.
+func lockoutFailures(subject string) int {
+	if strings.HasPrefix(subject, SUBJECT_IP) {
+		return config.ConfigAll.LOGIN_IP_LOCKOUT_FAILURES
+	}
+	return config.ConfigAll.LOGIN_LOCKOUT_FAILURES
+}
+
+// LoginDelay returns how long after the last failure the next attempt is allowed. The first
+// LOGIN_DELAY_AFTER failures are free, then the delay starts at LOGIN_DELAY_BASE and doubles
+// with every failure up to LOGIN_DELAY_MAX.
+//
+// Parameters:
+// - failures: the number of failures within LOGIN_FAILURE_WINDOW.
+//
+// Returns:
+// - time.Duration: the delay.
+func LoginDelay(failures int) time.Duration {
+	if failures < config.ConfigAll.LOGIN_DELAY_AFTER {
+		return 0
+	}
+	delay := config.ConfigAll.LOGIN_DELAY_BASE
+	for i := config.ConfigAll.LOGIN_DELAY_AFTER; i < failures && delay < config.ConfigAll.LOGIN_DELAY_MAX; i++ {
+		delay *= 2
+	}
+	if delay > config.ConfigAll.LOGIN_DELAY_MAX {
+		delay = config.ConfigAll.LOGIN_DELAY_MAX
+	}
+	return delay
+}
+
+// active reports whether the failures of a throttle still count: they are recent and an
+// expired lockout has not ended them.
+func active(throttle models.LoginThrottle, now time.Time) bool {
+	if throttle.LockedUntil != nil && !throttle.LockedUntil.After(now) {
+		return false
+	}
+	return now.Sub(throttle.LastFailureAt) < config.ConfigAll.LOGIN_FAILURE_WINDOW
+}
+
+// LoginWait returns how long a login attempt must wait, the longest wait of its subjects.
+// Attempts are rejected before they are counted and before the password is checked.
+//
+// Parameters:
+// - db: the database.
+// - subjects: the subjects of the attempt, see LoginSubjects.
+// - now: the time.
+//
+// Returns:
+// - time.Duration: the wait, 0 if the attempt is allowed.
+// - error: a database error.
+func LoginWait(db *gorm.DB, subjects []string, now time.Time) (time.Duration, error) {
+	var throttles []models.LoginThrottle
+	if err := db.Where("subject IN ?", subjects).Find(&throttles).Error; err != nil {
+		return 0, err
+	}
+	var wait time.Duration
+	for _, throttle := range throttles {
+		if !active(throttle, now) {
+			continue
+		}
+		until := throttle.LastFailureAt.Add(LoginDelay(throttle.Failures))
+		if throttle.LockedUntil != nil {
+			until = *throttle.LockedUntil
+		}
+		if until.Sub(now) > wait {
+			wait = until.Sub(now)
+		}
+	}
+	return wait, nil
+}
+
+// RecordLoginAttempt counts a login attempt as a failure for each subject before its password
+// or code is checked, and locks out a subject reaching its lockout threshold for
+// LOGIN_LOCKOUT_DURATION. Every lockout is audited.
+//
+// The count is increased with a single upsert, so concurrent attempts are all counted. An
+// attempt that finds a subject locked out after counting must be rejected without checking
+// its credentials, which bounds the guesses of parallel requests by the lockout threshold.
+// A successful check takes its attempt back with ForgiveLoginAttempt.
+//
+// Parameters:
+// - db: the database.
+// - subjects: the subjects of the attempt, see LoginSubjects.
+// - ip: the IP address of the attempt.
+// - now: the time.
+//
+// Returns:
+// - time.Duration: the remaining lockout, 0 if the attempt may be checked.
+// - error: a database error.
+func RecordLoginAttempt(db *gorm.DB, subjects []string, ip string, now time.Time) (time.Duration, error) {
+	var wait time.Duration
+	for _, subject := range subjects {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			// Failures of an inactive throttle, see active, start over.
+			stale := gorm.Expr("(login_throttles.locked_until IS NOT NULL AND login_throttles.locked_until <= ?) OR login_throttles.last_failure_at <= ?",
+				now, now.Add(-config.ConfigAll.LOGIN_FAILURE_WINDOW))
+			err := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "subject"}},
+				DoUpdates: clause.Set{
+					{Column: clause.Column{Name: "failures"}, Value: gorm.Expr("CASE WHEN ? THEN 1 ELSE login_throttles.failures + 1 END", stale)},
+					{Column: clause.Column{Name: "locked_until"}, Value: gorm.Expr("CASE WHEN ? THEN NULL ELSE login_throttles.locked_until END", stale)},
+					{Column: clause.Column{Name: "last_failure_at"}, Value: now},
+					{Column: clause.Column{Name: "updated_at"}, Value: now},
+				},
+			}).Create(&models.LoginThrottle{Subject: subject, Failures: 1, LastFailureAt: now}).Error
+			if err != nil {
+				return err
+			}
+
+			until := now.Add(config.ConfigAll.LOGIN_LOCKOUT_DURATION)
+			result := tx.Model(&models.LoginThrottle{}).
+				Where("subject = ? AND locked_until IS NULL AND failures >= ?", subject, lockoutFailures(subject)).
+				UpdateColumn("locked_until", until)
+			if result.Error != nil {
+				return result.Error
+			}
+
+			var throttle models.LoginThrottle
+			if err := tx.Where("subject = ?", subject).First(&throttle).Error; err != nil {
+				return err
+			}
+			if throttle.LockedUntil != nil && throttle.LockedUntil.Sub(now) > wait {
+				wait = throttle.LockedUntil.Sub(now)
+			}
+			if result.RowsAffected == 0 {
+				return nil
+			}
+			return audit.Record(tx, models.AuditEntry{
+				Action:  audit.ACTION_LOGIN_LOCKOUT,
+				Subject: subject,
+				IP:      ip,
+				Detail:  fmt.Sprintf("%d failed logins, locked until %s", throttle.Failures, until.UTC().Format(time.RFC3339)),
+			})
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return wait, nil
+}
+
+// ForgiveLoginAttempt takes back the attempt counted by RecordLoginAttempt when its password or
+// code turned out to be right. Earlier failures are kept.
+//
+// Parameters:
+// - db: the database.
+// - subjects: the subjects of the attempt, see LoginSubjects.
+//
+// Returns:
+// - error: a database error.
+func ForgiveLoginAttempt(db *gorm.DB, subjects []string) error {
+	return db.Model(&models.LoginThrottle{}).Where("subject IN ? AND failures > 0", subjects).
+		UpdateColumn("failures", gorm.Expr("failures - 1")).Error
+}
+
+// ResetLoginFailures clears the failures of an email after a successful login. The failures
+// of the IP are kept, so logging in to an own account does not reset the count of guesses
+// against others.
+//
+// Parameters:
+// - db: the database.
+// - email: the email.
+//
+// Returns:
+// - error: a database error.
+func ResetLoginFailures(db *gorm.DB, email string) error {
+	return db.Unscoped().Where("subject = ?", EmailSubject(email)).Delete(&models.LoginThrottle{}).Error
+}
+
+// UnlockLogin clears the failures and lockouts of subjects. Every unlocked subject is audited.
+//
+// Parameters:
+// - db: the database.
+// - subjects: the subjects, see EmailSubject and IPSubject.
+// - actorID: the admin who unlocked them.
+// - ip: the IP address of the admin.
+//
+// Returns:
+// - int64: the number of cleared subjects.
+// - error: a database error.
+func UnlockLogin(db *gorm.DB, subjects []string, actorID uint, ip string) (int64, error) {
+	var unlocked int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var throttles []models.LoginThrottle
+		if err := tx.Where("subject IN ?", subjects).Find(&throttles).Error; err != nil {
+			return err
+		}
+		for _, throttle := range throttles {
+			if err := tx.Unscoped().Delete(&throttle).Error; err != nil {
+				return err
+			}
+			err := audit.Record(tx, models.AuditEntry{
+				Action:  audit.ACTION_LOGIN_UNLOCK,
+				Subject: throttle.Subject,
+				ActorID: &actorID,
+				IP:      ip,
+				Detail:  fmt.Sprintf("%d failed logins cleared", throttle.Failures),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		unlocked = int64(len(throttles))
+		return nil
+	})
+	return unlocked, err
+}
+
+// LockedOut returns the subjects locked out at the given time.
+//
+// Parameters:
+// - db: the database.
+// - now: the time.
+//
+// Returns:
+// - []models.LoginThrottle: the locked out subjects, the latest lockout first.
+// - error: a database error.
+func LockedOut(db *gorm.DB, now time.Time) ([]models.LoginThrottle, error) {
+	var throttles []models.LoginThrottle
+	err := db.Where("locked_until > ?", now).Order("locked_until DESC").Find(&throttles).Error
+	return throttles, err
+}
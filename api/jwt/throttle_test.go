@@ -0,0 +1,164 @@
+package jwt_test
+
+import (
+	"testing"
+	"time"
+
+	"urlshort.ru/m/api/jwt"
+	"urlshort.ru/m/audit"
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/models"
+)
+
+// setThrottleConfig sets the login throttle settings used by the tests.
+func setThrottleConfig() {
+	config.ConfigAll.LOGIN_FAILURE_WINDOW = time.Hour
+	config.ConfigAll.LOGIN_DELAY_AFTER = 3
+	config.ConfigAll.LOGIN_DELAY_BASE = time.Second
+	config.ConfigAll.LOGIN_DELAY_MAX = 4 * time.Second
+	config.ConfigAll.LOGIN_LOCKOUT_FAILURES = 6
+	config.ConfigAll.LOGIN_IP_LOCKOUT_FAILURES = 100
+	config.ConfigAll.LOGIN_LOCKOUT_DURATION = 15 * time.Minute
+}
+
+// TestLoginDelay tests the exponential delay between failed logins.
+func TestLoginDelay(t *testing.T) {
+	setThrottleConfig()
+	expected := []time.Duration{0, 0, 0, time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second}
+	for failures, delay := range expected {
+		if got := jwt.LoginDelay(failures); got != delay {
+			t.Errorf("LoginDelay(%d) = %v, expected %v", failures, got, delay)
+		}
+	}
+}
+
+// TestLoginLockout tests that failed logins delay and then lock out an email until an admin
+// unlocks it, and that lockouts and unlocks are audited.
+func TestLoginLockout(t *testing.T) {
+	setThrottleConfig()
+	db := models.DATABASE
+	subjects := jwt.LoginSubjects(" Lockout@Example.com", "192.0.2.10")
+	db.Unscoped().Where("subject IN ?", subjects).Delete(&models.LoginThrottle{})
+	db.Unscoped().Where("subject IN ?", subjects).Delete(&models.AuditEntry{})
+
+	now := time.Now()
+	wait := func(at time.Time) time.Duration {
+		wait, err := jwt.LoginWait(db, subjects, at)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return wait
+	}
+	fail := func(at time.Time) time.Duration {
+		wait, err := jwt.RecordLoginAttempt(db, subjects, "192.0.2.10", at)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return wait
+	}
+
+	fail(now)
+	fail(now)
+	if got := wait(now); got != 0 {
+		t.Errorf("Expected the first failures to be free, got %v", got)
+	}
+	fail(now)
+	if got := wait(now); got != time.Second {
+		t.Errorf("Expected a delay of a second, got %v", got)
+	}
+	now = now.Add(time.Second)
+	if got := wait(now); got != 0 {
+		t.Errorf("Expected no wait after the delay, got %v", got)
+	}
+	fail(now)
+	fail(now)
+	if got := fail(now); got != 15*time.Minute {
+		t.Errorf("Expected the attempt reaching the threshold to be locked out, got %v", got)
+	}
+	if got := wait(now); got != 15*time.Minute {
+		t.Errorf("Expected a lockout, got %v", got)
+	}
+	entries, _ := audit.List(db, audit.ACTION_LOGIN_LOCKOUT, 0)
+	lockouts := 0
+	for _, entry := range entries {
+		if entry.Subject == subjects[0] {
+			lockouts++
+		}
+	}
+	if got := fail(now); got != 15*time.Minute || lockouts != 1 {
+		t.Errorf("Expected attempts during a lockout to be rejected and audited once, got %v and %d", got, lockouts)
+	}
+
+	locked, _ := jwt.LockedOut(db, now)
+	found := false
+	for _, throttle := range locked {
+		found = found || throttle.Subject == jwt.EmailSubject("lockout@example.com")
+	}
+	if !found {
+		t.Errorf("Expected the email to be locked out, got %+v", locked)
+	}
+	entries, _ = audit.List(db, audit.ACTION_LOGIN_LOCKOUT, 0)
+	if len(entries) == 0 || entries[0].Subject != subjects[0] {
+		t.Errorf("Expected the lockout to be audited, got %+v", entries)
+	}
+
+	unlocked, err := jwt.UnlockLogin(db, subjects, 1, "198.51.100.1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if unlocked != 2 {
+		t.Errorf("Expected the email and IP to be unlocked, got %d", unlocked)
+	}
+	if got := wait(now); got != 0 {
+		t.Errorf("Expected no wait after unlock, got %v", got)
+	}
+	entries, _ = audit.List(db, audit.ACTION_LOGIN_UNLOCK, 0)
+	if len(entries) == 0 || entries[0].ActorID == nil || *entries[0].ActorID != 1 {
+		t.Errorf("Expected the unlock to be audited, got %+v", entries)
+	}
+
+	// A successful login clears the email but keeps the failures of the IP.
+	for i := 0; i < 4; i++ {
+		fail(now)
+	}
+	if err := jwt.ResetLoginFailures(db, "lockout@example.com"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := wait(now); got != 2*time.Second {
+		t.Errorf("Expected the IP to stay delayed, got %v", got)
+	}
+}
+
+// TestForgiveLoginAttempt tests that a successful check takes back its own attempt only.
+func TestForgiveLoginAttempt(t *testing.T) {
+	setThrottleConfig()
+	db := models.DATABASE
+	subjects := jwt.LoginSubjects("forgive@example.com", "192.0.2.11")
+	db.Unscoped().Where("subject IN ?", subjects).Delete(&models.LoginThrottle{})
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := jwt.RecordLoginAttempt(db, subjects, "192.0.2.11", now); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if err := jwt.ForgiveLoginAttempt(db, subjects); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var throttles []models.LoginThrottle
+	db.Where("subject IN ?", subjects).Find(&throttles)
+	if len(throttles) != 2 || throttles[0].Failures != 2 || throttles[1].Failures != 2 {
+		t.Errorf("Expected two failures per subject, got %+v", throttles)
+	}
+
+	// Failures older than LOGIN_FAILURE_WINDOW start over.
+	later := now.Add(2 * time.Hour)
+	if _, err := jwt.RecordLoginAttempt(db, subjects, "192.0.2.11", later); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	db.Where("subject IN ?", subjects).Find(&throttles)
+	if throttles[0].Failures != 1 || throttles[1].Failures != 1 {
+		t.Errorf("Expected the failures to start over, got %+v", throttles)
+	}
+}
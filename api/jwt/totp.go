@@ -0,0 +1,127 @@
+package jwt
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"urlshort.ru/m/config"
+)
+
+// TOTP parameters of RFC 6238: HMAC-SHA1, 6 digits and 30 second steps, the defaults every
+// authenticator app supports.
+const (
+	TOTP_DIGITS       = 6
+	TOTP_PERIOD       = 30 * time.Second
+	TOTP_SECRET_BYTES = 20
+)
+
+// totpEncoding encodes secrets as unpadded base32, the format of provisioning URIs.
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a random secret.
+//
+// Returns:
+// - string: the secret in unpadded base32.
+// - error: an error if no random bytes could be read.
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, TOTP_SECRET_BYTES)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPStep returns the time step of a time, the number of periods since the Unix epoch.
+func TOTPStep(now time.Time) int64 {
+	return now.Unix() / int64(TOTP_PERIOD/time.Second)
+}
+
+// TOTPCode returns the code of a time step (RFC 4226 with the step as counter).
+//
+// Parameters:
+// - secret: the secret in base32.
+// - step: the time step, see TOTPStep.
+//
+// Returns:
+// - string: the code, TOTP_DIGITS digits with leading zeros.
+// - error: an error if the secret is not base32.
+func TOTPCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", err
+	}
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	modulo := uint32(1)
+	for i := 0; i < TOTP_DIGITS; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", TOTP_DIGITS, value%modulo), nil
+}
+
+// CheckTOTP checks a code against the steps within TOTP_SKEW of the current one, to allow
+// for clock drift. Steps up to lastStep are skipped, so a code is accepted once.
+//
+// Parameters:
+// - secret: the secret in base32.
+// - code: the code to check.
+// - now: the time.
+// - lastStep: the step of the last accepted code, 0 for none.
+//
+// Returns:
+// - int64: the step of the code, to be stored as the new lastStep.
+// - bool: true if the code is valid.
+func CheckTOTP(secret string, code string, now time.Time, lastStep int64) (int64, bool) {
+	if len(code) != TOTP_DIGITS {
+		return 0, false
+	}
+	current := TOTPStep(now)
+	for skew := -int64(config.ConfigAll.TOTP_SKEW); skew <= int64(config.ConfigAll.TOTP_SKEW); skew++ {
+		step := current + skew
+		if step <= lastStep {
+			continue
+		}
+		expected, err := TOTPCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// TOTPProvisioningURI returns the otpauth:// URI of a secret. Authenticator apps add the
+// account by scanning the URI rendered as a QR code.
+//
+// Parameters:
+// - secret: the secret in base32.
+// - email: the email of the account, shown in the app with TOTP_ISSUER.
+//
+// Returns:
+// - string: the URI.
+func TOTPProvisioningURI(secret string, email string) string {
+	issuer := config.ConfigAll.TOTP_ISSUER
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(TOTP_DIGITS))
+	query.Set("period", fmt.Sprint(int(TOTP_PERIOD/time.Second)))
+	label := url.PathEscape(issuer + ":" + email)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
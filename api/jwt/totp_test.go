@@ -0,0 +1,62 @@
+package jwt_test
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"urlshort.ru/m/api/jwt"
+	"urlshort.ru/m/config"
+)
+
+// rfcSecret is the SHA1 secret of the test vectors of RFC 6238.
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+// TestTOTPCode tests codes against the test vectors of RFC 6238, cut to 6 digits.
+func TestTOTPCode(t *testing.T) {
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, expected := range vectors {
+		code, err := jwt.TOTPCode(rfcSecret, jwt.TOTPStep(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if code != expected {
+			t.Errorf("TOTPCode at %d = %s, expected %s", unix, code, expected)
+		}
+	}
+}
+
+// TestCheckTOTP tests the allowed clock drift and that a step is accepted once.
+func TestCheckTOTP(t *testing.T) {
+	config.ConfigAll.TOTP_SKEW = 1
+	now := time.Unix(1111111111, 0)
+	current := jwt.TOTPStep(now)
+	previous, _ := jwt.TOTPCode(rfcSecret, current-1)
+	old, _ := jwt.TOTPCode(rfcSecret, current-2)
+
+	step, ok := jwt.CheckTOTP(rfcSecret, previous, now, 0)
+	if !ok || step != current-1 {
+		t.Errorf("Expected the previous code to be accepted, got %d, %v", step, ok)
+	}
+	if _, ok := jwt.CheckTOTP(rfcSecret, previous, now, step); ok {
+		t.Errorf("Expected a used code to be rejected")
+	}
+	if _, ok := jwt.CheckTOTP(rfcSecret, old, now, 0); ok {
+		t.Errorf("Expected a code outside the skew to be rejected")
+	}
+	if _, ok := jwt.CheckTOTP(rfcSecret, "12345", now, 0); ok {
+		t.Errorf("Expected a short code to be rejected")
+	}
+
+	uri := jwt.TOTPProvisioningURI("SECRET", "user@example.com")
+	if !strings.HasPrefix(uri, "otpauth://totp/"+config.ConfigAll.TOTP_ISSUER+":user@example.com?") || !strings.Contains(uri, "secret=SECRET") {
+		t.Errorf("Unexpected provisioning URI: %s", uri)
+	}
+}
@@ -0,0 +1,446 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"urlshort.ru/m/audit"
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/models"
+	"urlshort.ru/m/utils"
+)
+
+// RECOVERY_CODE_BYTES is the number of random bytes of a recovery code. Codes are shown
+// once, as four groups of four base32 characters, and only their SHA-256 is stored.
+const RECOVERY_CODE_BYTES = 10
+
+var (
+	ErrInvalidCode         = errors.New("invalid code")
+	ErrTwoFactorRequired   = errors.New("two-factor authentication required")
+	ErrTwoFactorEnabled    = errors.New("two-factor authentication already enabled")
+	ErrTwoFactorNotEnabled = errors.New("two-factor authentication not enabled")
+)
+
+// TwoFactorRequired reports whether users of a role must use two-factor authentication.
+//
+// Parameters:
+// - db: the database.
+// - role: the role.
+//
+// Returns:
+// - bool: true if it is required.
+// - error: a database error.
+func TwoFactorRequired(db *gorm.DB, role string) (bool, error) {
+	var count int64
+	err := db.Model(&models.TwoFactorPolicy{}).Where("role = ? AND required = ?", role, true).Count(&count).Error
+	return count > 0, err
+}
+
+// NeedsTwoFactor reports whether a login of a user needs the second step: the user enabled
+// two-factor authentication or it is required for the role of the user.
+//
+// Parameters:
+// - db: the database.
+// - user: the user.
+//
+// Returns:
+// - bool: true if the login needs the second step.
+// - error: a database error.
+func NeedsTwoFactor(db *gorm.DB, user models.User) (bool, error) {
+	if user.TOTPEnabledAt != nil {
+		return true, nil
+	}
+	return TwoFactorRequired(db, user.Role)
+}
+
+// CheckTwoFactorPolicy reports whether a user may act without the second step: a user whose
+// role requires two-factor authentication must have enabled it.
+//
+// Parameters:
+// - db: the database.
+// - user: the user.
+//
+// Returns:
+// - error: ErrTwoFactorRequired if the user has to enroll first, or a database error.
+func CheckTwoFactorPolicy(db *gorm.DB, user models.User) error {
+	if user.TOTPEnabledAt != nil {
+		return nil
+	}
+	required, err := TwoFactorRequired(db, user.Role)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrTwoFactorRequired
+	}
+	return nil
+}
+
+// TwoFactorPolicies returns the two-factor policies of the roles, by role.
+//
+// Parameters:
+// - db: the database.
+//
+// Returns:
+// - []models.TwoFactorPolicy: the policies.
+// - error: a database error.
+func TwoFactorPolicies(db *gorm.DB) ([]models.TwoFactorPolicy, error) {
+	var policies []models.TwoFactorPolicy
+	err := db.Order("role").Find(&policies).Error
+	return policies, err
+}
+
+// SetTwoFactorRequired requires or stops requiring two-factor authentication for a role. The
+// change is audited. An admin cannot require it for the own role before enabling it, so the
+// admin is not locked out of the admin API.
+//
+// Parameters:
+// - db: the database.
+// - role: the role.
+// - required: true to require it.
+// - actor: the admin making the change.
+// - ip: the IP address of the admin.
+//
+// Returns:
+// - models.TwoFactorPolicy: the policy.
+// - error: ErrTwoFactorNotEnabled or a database error.
+func SetTwoFactorRequired(db *gorm.DB, role string, required bool, actor models.User, ip string) (models.TwoFactorPolicy, error) {
+	if required && actor.Role == role && actor.TOTPEnabledAt == nil {
+		return models.TwoFactorPolicy{}, ErrTwoFactorNotEnabled
+	}
+	policy := models.TwoFactorPolicy{Role: role}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Limit(1).Find(&policy, "role = ?", role).Error; err != nil {
+			return err
+		}
+		policy.Required = required
+		if err := tx.Save(&policy).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, models.AuditEntry{
+			Action:  audit.ACTION_TWO_FACTOR_POLICY,
+			Subject: "role:" + role,
+			ActorID: &actor.ID,
+			IP:      ip,
+			Detail:  fmt.Sprintf("required: %t", required),
+		})
+	})
+	return policy, err
+}
+
+// EnrollTOTP generates a new secret for a user without two-factor authentication. The secret
+// is pending until EnableTOTP checks a code of it, enrolling again replaces it.
+//
+// Parameters:
+// - db: the database.
+// - user: the user, its TOTPSecret is updated.
+//
+// Returns:
+// - string: the secret, see TOTPProvisioningURI.
+// - error: ErrTwoFactorEnabled or a database error.
+func EnrollTOTP(db *gorm.DB, user *models.User) (string, error) {
+	if user.TOTPEnabledAt != nil {
+		return "", ErrTwoFactorEnabled
+	}
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+	if err := db.Model(user).Updates(map[string]any{"totp_secret": secret, "totp_last_step": 0}).Error; err != nil {
+		return "", err
+	}
+	user.TOTPSecret = secret
+	user.TOTPLastStep = 0
+	return secret, nil
+}
+
+// EnableTOTP enables two-factor authentication with a code of the pending secret and
+// generates the recovery codes. It is audited.
+//
+// Parameters:
+// - db: the database.
+// - user: the user, its TOTPEnabledAt is updated.
+// - code: a code of the pending secret.
+// - ip: the IP address of the request.
+// - now: the time.
+//
+// Returns:
+// - []string: the recovery codes.
+// - error: ErrTwoFactorEnabled, ErrTwoFactorNotEnabled if there is no pending secret,
+// ErrInvalidCode or a database error.
+func EnableTOTP(db *gorm.DB, user *models.User, code string, ip string, now time.Time) ([]string, error) {
+	if user.TOTPEnabledAt != nil {
+		return nil, ErrTwoFactorEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	if err := useTOTP(db, user, code, now); err != nil {
+		return nil, err
+	}
+	if err := db.Model(user).Update("totp_enabled_at", now).Error; err != nil {
+		return nil, err
+	}
+	user.TOTPEnabledAt = &now
+	codes, err := GenerateRecoveryCodes(db, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return codes, audit.Record(db, models.AuditEntry{
+		Action:  audit.ACTION_TWO_FACTOR_ENABLED,
+		Subject: EmailSubject(user.Email),
+		ActorID: &user.ID,
+		IP:      ip,
+	})
+}
+
+// DisableTwoFactor disables two-factor authentication with a code and deletes the secret and
+// the recovery codes. It is audited.
+//
+// Parameters:
+// - db: the database.
+// - user: the user.
+// - code: a code or a recovery code, see VerifySecondFactor.
+// - ip: the IP address of the request.
+// - now: the time.
+//
+// Returns:
+// - error: ErrTwoFactorNotEnabled, ErrTwoFactorRequired if the role of the user requires it,
+// ErrInvalidCode or a database error.
+func DisableTwoFactor(db *gorm.DB, user *models.User, code string, ip string, now time.Time) error {
+	if user.TOTPEnabledAt == nil {
+		return ErrTwoFactorNotEnabled
+	}
+	required, err := TwoFactorRequired(db, user.Role)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrTwoFactorRequired
+	}
+	if err := VerifySecondFactor(db, user, code, ip, now); err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(user).Updates(map[string]any{"totp_secret": "", "totp_enabled_at": nil, "totp_last_step": 0}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		user.TOTPSecret = ""
+		user.TOTPEnabledAt = nil
+		return audit.Record(tx, models.AuditEntry{
+			Action:  audit.ACTION_TWO_FACTOR_DISABLED,
+			Subject: EmailSubject(user.Email),
+			ActorID: &user.ID,
+			IP:      ip,
+		})
+	})
+}
+
+// normalizeRecoveryCode lowercases a recovery code and drops the separators.
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+}
+
+// GenerateRecoveryCodes replaces the recovery codes of a user with TOTP_RECOVERY_CODES new ones.
+//
+// Parameters:
+// - db: the database.
+// - userID: the user.
+//
+// Returns:
+// - []string: the codes, shown to the user once.
+// - error: an error if no codes could be generated or a database error.
+func GenerateRecoveryCodes(db *gorm.DB, userID uint) ([]string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, config.ConfigAll.TOTP_RECOVERY_CODES)
+	records := make([]models.RecoveryCode, len(codes))
+	for i := range codes {
+		random := make([]byte, RECOVERY_CODE_BYTES)
+		if _, err := rand.Read(random); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(encoding.EncodeToString(random))
+		codes[i] = code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16]
+		records[i] = models.RecoveryCode{UserID: userID, CodeHash: utils.GenerateShortHashSHA256(code)}
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			return nil
+		}
+		return tx.Create(&records).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// useTOTP checks a code of the secret of a user and stores its step. The step is only
+// stored if it is later than the stored one, so a code is accepted once even when
+// requests race.
+func useTOTP(db *gorm.DB, user *models.User, code string, now time.Time) error {
+	step, ok := CheckTOTP(user.TOTPSecret, code, now, user.TOTPLastStep)
+	if !ok {
+		return ErrInvalidCode
+	}
+	result := db.Model(&models.User{}).Where("id = ? AND totp_last_step < ?", user.ID, step).Update("totp_last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidCode
+	}
+	user.TOTPLastStep = step
+	return nil
+}
+
+// useRecoveryCode marks an unused recovery code of a user as used and audits it with the
+// number of codes left.
+func useRecoveryCode(db *gorm.DB, user *models.User, code string, ip string, now time.Time) error {
+	result := db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, utils.GenerateShortHashSHA256(normalizeRecoveryCode(code))).
+		Update("used_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidCode
+	}
+	var left int64
+	if err := db.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", user.ID).Count(&left).Error; err != nil {
+		return err
+	}
+	return audit.Record(db, models.AuditEntry{
+		Action:  audit.ACTION_RECOVERY_CODE_USED,
+		Subject: EmailSubject(user.Email),
+		ActorID: &user.ID,
+		IP:      ip,
+		Detail:  fmt.Sprintf("%d recovery codes left", left),
+	})
+}
+
+// VerifySecondFactor checks a code of a user with two-factor authentication enabled. A code
+// of TOTP_DIGITS digits is checked as TOTP code, anything else as recovery code. Both are
+// accepted once.
+//
+// Parameters:
+// - db: the database.
+// - user: the user.
+// - code: the code.
+// - ip: the IP address of the request.
+// - now: the time.
+//
+// Returns:
+// - error: ErrTwoFactorNotEnabled, ErrInvalidCode or a database error.
+func VerifySecondFactor(db *gorm.DB, user *models.User, code string, ip string, now time.Time) error {
+	if user.TOTPEnabledAt == nil {
+		return ErrTwoFactorNotEnabled
+	}
+	code = strings.TrimSpace(code)
+	if len(code) == TOTP_DIGITS {
+		return useTOTP(db, user, code, now)
+	}
+	return useRecoveryCode(db, user, code, ip, now)
+}
+
+// GetPayloadChallenge decodes the payload of a challenge token.
+//
+// Parameters:
+// - token: the challenge token, already checked.
+//
+// Returns:
+// - PayloadJWTChallenge: the payload.
+// - error: ErrInvalidToken if the payload cannot be decoded.
+func GetPayloadChallenge(token string) (PayloadJWTChallenge, error) {
+	decoded, err := GetTokenPayload(token)
+	if err != nil {
+		return PayloadJWTChallenge{}, ErrInvalidToken
+	}
+	var payload PayloadJWTChallenge
+	if err := json.Unmarshal([]byte(decoded), &payload); err != nil || payload.UserID == 0 || payload.JTI == "" {
+		return PayloadJWTChallenge{}, ErrInvalidToken
+	}
+	return payload, nil
+}
+
+// ChallengeUser loads the user of an unused challenge token.
+//
+// Parameters:
+// - db: the database.
+// - token: the challenge token, already checked.
+//
+// Returns:
+// - models.User: the user.
+// - PayloadJWTChallenge: the payload.
+// - error: ErrInvalidToken, ErrTokenReused if the challenge was used, or a database error.
+func ChallengeUser(db *gorm.DB, token string) (models.User, PayloadJWTChallenge, error) {
+	payload, err := GetPayloadChallenge(token)
+	if err != nil {
+		return models.User{}, PayloadJWTChallenge{}, err
+	}
+	var used int64
+	if err := db.Model(&models.DeniedToken{}).Where("jti = ?", payload.JTI).Count(&used).Error; err != nil {
+		return models.User{}, PayloadJWTChallenge{}, err
+	}
+	if used > 0 {
+		return models.User{}, PayloadJWTChallenge{}, ErrTokenReused
+	}
+	var user models.User
+	if err := db.First(&user, "id = ?", payload.UserID).Error; err != nil {
+		return models.User{}, PayloadJWTChallenge{}, err
+	}
+	return user, payload, nil
+}
+
+// CompleteLogin checks the code of the second login step and uses up the challenge. A user
+// who must enroll checks a code of the pending secret instead, which enables two-factor
+// authentication.
+//
+// Parameters:
+// - db: the database.
+// - user: the user of the challenge, see ChallengeUser.
+// - challenge: the payload of the challenge.
+// - code: a code or a recovery code.
+// - ip: the IP address of the request.
+// - now: the time.
+//
+// Returns:
+// - []string: the recovery codes if two-factor authentication was enabled, otherwise nil.
+// - error: ErrInvalidCode, ErrTwoFactorNotEnabled if the user did not enroll, ErrTokenReused
+// if the challenge was used meanwhile, or a database error.
+func CompleteLogin(db *gorm.DB, user *models.User, challenge PayloadJWTChallenge, code string, ip string, now time.Time) ([]string, error) {
+	var codes []string
+	var err error
+	if user.TOTPEnabledAt == nil {
+		codes, err = EnableTOTP(db, user, strings.TrimSpace(code), ip, now)
+	} else {
+		err = VerifySecondFactor(db, user, code, ip, now)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	used := models.DeniedToken{JTI: challenge.JTI, ExpiresAt: time.Unix(challenge.EXP, 0).Add(config.ConfigAll.JWT_LEEWAY)}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&used)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrTokenReused
+	}
+	return codes, nil
+}
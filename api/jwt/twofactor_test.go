@@ -0,0 +1,144 @@
+package jwt_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"urlshort.ru/m/api/jwt"
+	"urlshort.ru/m/models"
+)
+
+// TestTwoFactorLogin tests enrollment, the second login step with codes and recovery codes,
+// and that challenges, codes and recovery codes are accepted once.
+func TestTwoFactorLogin(t *testing.T) {
+	db := models.DATABASE
+	user := createUser(t, "totp@example.com")
+	db.Unscoped().Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{})
+	now := time.Now()
+
+	if needs, _ := jwt.NeedsTwoFactor(db, user); needs {
+		t.Errorf("Expected no second step without two-factor authentication")
+	}
+	if _, err := jwt.EnableTOTP(db, &user, "000000", "", now); !errors.Is(err, jwt.ErrTwoFactorNotEnabled) {
+		t.Errorf("Expected enabling without enrollment to fail, got %v", err)
+	}
+	secret, err := jwt.EnrollTOTP(db, &user)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	code, _ := jwt.TOTPCode(secret, jwt.TOTPStep(now))
+	codes, err := jwt.EnableTOTP(db, &user, code, "", now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(codes) != 10 {
+		t.Errorf("Expected 10 recovery codes, got %v", codes)
+	}
+	if needs, _ := jwt.NeedsTwoFactor(db, user); !needs {
+		t.Errorf("Expected a second step with two-factor authentication")
+	}
+
+	challenge := func() (models.User, jwt.PayloadJWTChallenge) {
+		token, err := jwt.GenerateJWTChallenge(int(user.ID))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := jwt.ValidateTokenType(token, jwt.TOKEN_CHALLENGE); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		challenged, payload, err := jwt.ChallengeUser(db, token)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		t.Cleanup(func() { db.Delete(&models.DeniedToken{}, "jti = ?", payload.JTI) })
+		return challenged, payload
+	}
+
+	challenged, payload := challenge()
+	if _, err := jwt.CompleteLogin(db, &challenged, payload, code, "", now); !errors.Is(err, jwt.ErrInvalidCode) {
+		t.Errorf("Expected the code used to enable to be rejected, got %v", err)
+	}
+	next, _ := jwt.TOTPCode(secret, jwt.TOTPStep(now)+1)
+	if _, err := jwt.CompleteLogin(db, &challenged, payload, next, "", now); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := jwt.CompleteLogin(db, &challenged, payload, codes[0], "", now); !errors.Is(err, jwt.ErrTokenReused) {
+		t.Errorf("Expected a used challenge to be rejected, got %v", err)
+	}
+
+	challenged, payload = challenge()
+	if _, err := jwt.CompleteLogin(db, &challenged, payload, " "+codes[1]+" ", "", now); err != nil {
+		t.Errorf("Expected a recovery code to be accepted, got %v", err)
+	}
+	challenged, payload = challenge()
+	if _, err := jwt.CompleteLogin(db, &challenged, payload, codes[1], "", now); !errors.Is(err, jwt.ErrInvalidCode) {
+		t.Errorf("Expected a used recovery code to be rejected, got %v", err)
+	}
+
+	if err := jwt.DisableTwoFactor(db, &challenged, codes[2], "", now); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var left int64
+	db.Model(&models.RecoveryCode{}).Where("user_id = ?", user.ID).Count(&left)
+	if challenged.TOTPEnabledAt != nil || left != 0 {
+		t.Errorf("Expected the secret and recovery codes to be deleted, got %v, %d", challenged.TOTPEnabledAt, left)
+	}
+}
+
+// TestTwoFactorPolicy tests that a required policy makes users of the role enroll on login and
+// that an admin cannot require it before enabling it.
+func TestTwoFactorPolicy(t *testing.T) {
+	db := models.DATABASE
+	db.Unscoped().Where("role = ?", models.ROLE_ADMIN).Delete(&models.TwoFactorPolicy{})
+	defer db.Unscoped().Where("role = ?", models.ROLE_ADMIN).Delete(&models.TwoFactorPolicy{})
+	admin := createUser(t, "totp-admin@example.com")
+	db.Model(&admin).Update("role", models.ROLE_ADMIN)
+	user := createUser(t, "totp-user@example.com")
+
+	if _, err := jwt.SetTwoFactorRequired(db, models.ROLE_ADMIN, true, admin, ""); !errors.Is(err, jwt.ErrTwoFactorNotEnabled) {
+		t.Errorf("Expected an admin without two-factor authentication to be refused, got %v", err)
+	}
+	if _, err := jwt.SetTwoFactorRequired(db, models.ROLE_ADMIN, true, user, ""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if needs, _ := jwt.NeedsTwoFactor(db, admin); !needs {
+		t.Errorf("Expected the admin to need the second step")
+	}
+	if needs, _ := jwt.NeedsTwoFactor(db, user); needs {
+		t.Errorf("Expected the user not to need the second step")
+	}
+
+	// Sessions started before the policy are not renewed until the admin enrolls.
+	_, adminRefresh, _, err := jwt.StartSession(db, admin, jwt.Client{DeviceName: "Before policy"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, _, _, err := jwt.RotateSession(db, adminRefresh, jwt.Client{}); !errors.Is(err, jwt.ErrTwoFactorRequired) {
+		t.Errorf("Expected the session of an admin without two-factor authentication not to rotate, got %v", err)
+	}
+	_, userRefresh, _, _ := jwt.StartSession(db, user, jwt.Client{DeviceName: "Other role"})
+	if _, _, _, err := jwt.RotateSession(db, userRefresh, jwt.Client{}); err != nil {
+		t.Errorf("Expected the session of another role to rotate, got %v", err)
+	}
+
+	now := time.Now()
+	token, _ := jwt.GenerateJWTChallenge(int(admin.ID))
+	challenged, payload, _ := jwt.ChallengeUser(db, token)
+	defer db.Delete(&models.DeniedToken{}, "jti = ?", payload.JTI)
+	if _, err := jwt.CompleteLogin(db, &challenged, payload, "123456", "", now); !errors.Is(err, jwt.ErrTwoFactorNotEnabled) {
+		t.Errorf("Expected the second step to fail before enrollment, got %v", err)
+	}
+	secret, _ := jwt.EnrollTOTP(db, &challenged)
+	code, _ := jwt.TOTPCode(secret, jwt.TOTPStep(now))
+	codes, err := jwt.CompleteLogin(db, &challenged, payload, code, "", now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if challenged.TOTPEnabledAt == nil || len(codes) == 0 {
+		t.Errorf("Expected the second step to enable two-factor authentication, got %v", codes)
+	}
+	if err := jwt.DisableTwoFactor(db, &challenged, codes[0], "", now); !errors.Is(err, jwt.ErrTwoFactorRequired) {
+		t.Errorf("Expected a required two-factor authentication to stay enabled, got %v", err)
+	}
+}
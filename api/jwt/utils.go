@@ -1,6 +1,12 @@
 package jwt
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"strings"
@@ -8,6 +14,8 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/models"
 	"urlshort.ru/m/schema"
 	"urlshort.ru/m/utils"
 )
@@ -16,19 +24,27 @@ import (
 //
 // Parameters:
 // - userId: the ID of the user (int).
+// - sessionID: the session of the token, the sid claim (uint).
 //
 // Returns:
 // - token: the generated JWT refresh token (string).
 // - err: an error if there was a problem generating the token (error).
-func GenerateJWTRefresh(userId int) (string, error) {
-	headerMarshal, err := GetHeaderJWTJson()
+func GenerateJWTRefresh(userId int, sessionID uint) (string, error) {
+	jti, err := NewJTI()
 	if err != nil {
 		return "", err
 	}
-
+	now := time.Now()
 	payload := PayloadJWTRefresh{
 		UserID: userId,
-		EXP:    time.Now().Add(REFRESH_TIME).Unix(),
+		SID:    sessionID,
+		Type:   TOKEN_REFRESH,
+		JTI:    jti,
+		EXP:    now.Add(REFRESH_TIME).Unix(),
+		ISS:    config.ConfigAll.JWT_ISSUER,
+		AUD:    config.ConfigAll.JWT_AUDIENCE,
+		IAT:    now.Unix(),
+		NBF:    now.Unix(),
 	}
 
 	payloadMarshal, err := json.Marshal(payload)
@@ -36,8 +52,7 @@ func GenerateJWTRefresh(userId int) (string, error) {
 		return "", err
 	}
 
-	resultToken := GenerateJWT(string(headerMarshal), string(payloadMarshal))
-	return resultToken, nil
+	return SignPayload(payloadMarshal)
 }
 
 // GenerateJWTAccess generates a JWT access token for the given user ID, email, and role.
@@ -46,45 +61,94 @@ func GenerateJWTRefresh(userId int) (string, error) {
 // - userId: The ID of the user.
 // - email: The email of the user.
 // - role: The role of the user.
+// - sessionID: The session of the token, the sid claim.
+// - version: The token version of the user, the ver claim.
 //
 // Returns:
 // - string: The generated JWT access token.
 // - error: An error if the JWT access token generation fails.
-func GenerateJWTAccess(userId int, email string, role string) (string, error) {
-	headerMarshal, err := GetHeaderJWTJson()
+func GenerateJWTAccess(userId int, email string, role string, sessionID uint, version int) (string, error) {
+	jti, err := NewJTI()
 	if err != nil {
 		return "", err
 	}
-
+	now := time.Now()
 	payload := PayloadJWTAccess{
-		UserID: userId,
-		EXP:    time.Now().Add(ACCESS_TIME).Unix(),
-		Email:  email,
-		Role:   role,
+		UserID:  userId,
+		SID:     sessionID,
+		Type:    TOKEN_ACCESS,
+		JTI:     jti,
+		EXP:     now.Add(ACCESS_TIME).Unix(),
+		ISS:     config.ConfigAll.JWT_ISSUER,
+		AUD:     config.ConfigAll.JWT_AUDIENCE,
+		IAT:     now.Unix(),
+		NBF:     now.Unix(),
+		Email:   email,
+		Role:    role,
+		Version: version,
 	}
 	payloadMarshal, err := json.Marshal(payload)
 
 	if err != nil {
 		return "", err
 	}
-	resultToken := GenerateJWT(string(headerMarshal), string(payloadMarshal))
-	return resultToken, nil
+	return SignPayload(payloadMarshal)
 }
 
-// GenerateSignatureJWT generates a signature JWT.
+// GenerateJWTChallenge generates the challenge token of the second login step of a user
+// with two-factor authentication. It expires after TWO_FACTOR_CHALLENGE_TTL and is accepted
+// once, by the second step only.
 //
 // Parameters:
-// - header: the header of the JWT.
-// - payload: the payload of the JWT.
+// - userId: the ID of the user.
 //
 // Returns:
-// - string: the signature JWT.
+// - string: the challenge token.
+// - error: an error if the token generation fails.
+func GenerateJWTChallenge(userId int) (string, error) {
+	jti, err := NewJTI()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	payload := PayloadJWTChallenge{
+		UserID: userId,
+		Type:   TOKEN_CHALLENGE,
+		JTI:    jti,
+		EXP:    now.Add(config.ConfigAll.TWO_FACTOR_CHALLENGE_TTL).Unix(),
+		ISS:    config.ConfigAll.JWT_ISSUER,
+		AUD:    config.ConfigAll.JWT_AUDIENCE,
+		IAT:    now.Unix(),
+		NBF:    now.Unix(),
+	}
+
+	payloadMarshal, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	return SignPayload(payloadMarshal)
+}
+
+// GenerateSignatureJWT generates the HS256 signature of a JWT.
+//
+// Parameters:
+// - header: the base64url encoded header of the JWT.
+// - payload: the base64url encoded payload of the JWT.
+//
+// Returns:
+// - string: the base64url encoded HMAC-SHA256 of "header.payload" with JWT_KEY.
 func GenerateSignatureJWT(header string, payload string) string {
-	return utils.GenerateShortHashSHA256(header + payload + JWT_SECRET)
+	mac := hmac.New(sha256.New, JWT_KEY)
+	mac.Write([]byte(header + "." + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
 }
 
 // GenerateJWT generates a JSON Web Token (JWT) using the provided header and payload.
 //
+// The header and payload are base64url encoded without padding and signed with
+// GenerateSignatureJWT, as RFC 7519 requires.
+//
 // Parameters:
 // - header: the header string for the JWT.
 // - payload: the payload string for the JWT.
@@ -93,8 +157,8 @@ func GenerateSignatureJWT(header string, payload string) string {
 // - string: the JWT generated from the provided header and payload.
 func GenerateJWT(header string, payload string) string {
 
-	header = string(utils.Base64Encode(header))
-	payload = string(utils.Base64Encode(payload))
+	header = base64.RawURLEncoding.EncodeToString([]byte(header))
+	payload = base64.RawURLEncoding.EncodeToString([]byte(payload))
 
 	signature := GenerateSignatureJWT(header, payload)
 
@@ -102,6 +166,49 @@ func GenerateJWT(header string, payload string) string {
 	return resultToken
 }
 
+// NewJTI returns a random token ID for the jti claim.
+func NewJTI() (string, error) {
+	value := make([]byte, JTI_BYTES)
+	if _, err := rand.Read(value); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(value), nil
+}
+
+// SignPayload signs a token payload with the signing key of Keys, or with HS256 and JWT_KEY
+// when no key set is loaded.
+//
+// Parameters:
+// - payload: the JSON payload.
+//
+// Returns:
+// - string: the token.
+// - error: ErrNoSigningKey if no key of the set is active yet, or a signing error.
+func SignPayload(payload []byte) (string, error) {
+	if Keys == nil {
+		headerMarshal, err := GetHeaderJWTJson()
+		if err != nil {
+			return "", err
+		}
+		return GenerateJWT(string(headerMarshal), string(payload)), nil
+	}
+
+	key, ok := Keys.Signing(time.Now())
+	if !ok {
+		return "", ErrNoSigningKey
+	}
+	headerMarshal, err := json.Marshal(HeaderJWT{Algorithm: key.Algorithm, Protocol: PROTOCOL_JWT, KeyID: key.KeyID})
+	if err != nil {
+		return "", err
+	}
+	input := base64.RawURLEncoding.EncodeToString(headerMarshal) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature, err := key.Sign(input)
+	if err != nil {
+		return "", err
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
 // GetHeaderJWTJson generates the JSON representation of the JWT header.
 //
 // It does not take any parameters.
@@ -132,42 +239,163 @@ func ExtractToken(authorization string) (string, error) {
 	return parts[1], nil
 }
 
+// DecodeSegment decodes a base64url encoded part of a token. Legacy tokens use standard
+// base64 with padding, which is accepted as well.
+//
+// Parameters:
+// - segment: the encoded header or payload.
+//
+// Returns:
+// - string: the decoded JSON.
+// - error: an error if the segment is not valid base64.
+func DecodeSegment(segment string) (string, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return utils.Base64Decode([]byte(segment))
+	}
+	return string(decoded), nil
+}
+
+// GetTokenPayload returns the decoded payload of a token without checking it.
+//
+// Parameters:
+// - token: the token.
+//
+// Returns:
+// - string: the decoded payload.
+// - error: an error if the token is malformed.
+func GetTokenPayload(token string) (string, error) {
+	tokenSplit := strings.Split(token, ".")
+	if len(tokenSplit) != 3 {
+		return "", ErrInvalidToken
+	}
+	return DecodeSegment(tokenSplit[1])
+}
+
 // CheckToken checks if the given token is valid.
 //
 // It takes a string parameter named "token" and returns a boolean value.
 func CheckToken(token string) bool {
+	return ValidateToken(token) == nil
+}
+
+// ValidateToken checks a token and returns why it is invalid.
+//
+// The alg header must be in ALLOWED_ALGORITHMS and the signature must match: HS256 tokens are
+// checked with JWT_KEY, RS256 and EdDSA tokens with the verifying key of Keys named by their
+// kid. The exp claim
+// is required, nbf and iat must not be in the future, and iss and aud must match JWT_ISSUER
+// and JWT_AUDIENCE, all with JWT_LEEWAY of clock skew. Legacy tokens, signed before the move
+// to RFC 7519, carry no iss and aud and are accepted until JWT_LEGACY_UNTIL. Once Keys is
+// loaded, HS256 and legacy tokens are accepted until JWT_HS256_UNTIL only, so a leaked
+// SECRET_KEY_JWT stops minting tokens after the move to asymmetric keys.
+//
+// Parameters:
+// - token: the token.
+//
+// Returns:
+// - error: nil for a valid token, otherwise ErrInvalidToken, ErrAlgorithm, ErrSignature,
+// ErrUnknownKey, ErrExpired, ErrNotYetValid, ErrIssuer or ErrAudience.
+func ValidateToken(token string) error {
 	if token == "" {
-		return false
+		return ErrInvalidToken
 	}
 
 	tokenParts := strings.Split(token, ".")
 	if len(tokenParts) != 3 {
-		return false
+		return ErrInvalidToken
 	}
 
 	header, payload, signature := tokenParts[0], tokenParts[1], tokenParts[2]
 	if header == "" || payload == "" || signature == "" {
-		return false
+		return ErrInvalidToken
 	}
 
-	if !CheckSignature(header, payload, signature) {
-		return false
+	decodedHeader, err := DecodeSegment(header)
+	if err != nil || !CheckProtocol(decodedHeader) {
+		return ErrInvalidToken
+	}
+	if !CheckAlgorithm(decodedHeader) {
+		return ErrAlgorithm
 	}
 
-	decodedHeader, err := utils.Base64Decode([]byte(header))
-	if err != nil || !CheckProtocol(decodedHeader) {
-		return false
+	var parsedHeader HeaderJWT
+	if err := json.Unmarshal([]byte(decodedHeader), &parsedHeader); err != nil {
+		return ErrInvalidToken
+	}
+	legacy := false
+	if parsedHeader.Algorithm != ALGORITHM_JWT {
+		decodedSignature, err := base64.RawURLEncoding.DecodeString(signature)
+		if err != nil {
+			return ErrSignature
+		}
+		if Keys == nil {
+			return ErrUnknownKey
+		}
+		if err := Keys.Verify(parsedHeader.Algorithm, parsedHeader.KeyID, header+"."+payload, decodedSignature, time.Now()); err != nil {
+			return err
+		}
+	} else if Keys != nil && !time.Now().Before(config.ConfigAll.JWT_HS256_UNTIL) {
+		return ErrAlgorithm
+	} else if !CheckSignature(header, payload, signature) {
+		if !CheckLegacySignature(header, payload, signature) {
+			return ErrSignature
+		}
+		legacy = true
 	}
 
-	decodedPayload, err := utils.Base64Decode([]byte(payload))
-	if err != nil || !CheckPayload(decodedPayload) {
-		return false
+	decodedPayload, err := DecodeSegment(payload)
+	if err != nil {
+		return ErrInvalidToken
 	}
+	return checkClaims(decodedPayload, legacy)
+}
+
+// ValidateTokenType checks a token with ValidateToken and that it has the expected type.
+//
+// Legacy tokens have no token_type claim. Their type is inferred from the role claim, which
+// only access tokens carry.
+//
+// Parameters:
+// - token: the token.
+// - tokenType: TOKEN_ACCESS or TOKEN_REFRESH.
+//
+// Returns:
+// - error: an error of ValidateToken, or ErrTokenType if the token has another type.
+func ValidateTokenType(token string, tokenType string) error {
+	if err := ValidateToken(token); err != nil {
+		return err
+	}
+	payload, err := GetTokenPayload(token)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if GetTokenType(payload) != tokenType {
+		return ErrTokenType
+	}
+	return nil
+}
 
-	return true
+// GetTokenType returns the type of a decoded payload.
+//
+// payload: the decoded payload.
+// returns: the token_type claim, TOKEN_ACCESS or TOKEN_REFRESH for legacy tokens without it, or an empty string for an invalid payload.
+func GetTokenType(payload string) string {
+	var claims map[string]any
+	if err := json.Unmarshal([]byte(payload), &claims); err != nil {
+		return ""
+	}
+	if tokenType, ok := claims["token_type"].(string); ok {
+		return tokenType
+	}
+	if _, ok := claims["role"]; ok {
+		return TOKEN_ACCESS
+	}
+	return TOKEN_REFRESH
 }
 
 // CheckSignature checks if the given header, payload, and signature match.
+// The comparison takes constant time.
 //
 // Parameters:
 // - header: the header string.
@@ -177,7 +405,30 @@ func CheckToken(token string) bool {
 // Returns:
 // - a boolean indicating whether the signature is valid.
 func CheckSignature(header string, payload string, signature string) bool {
-	return utils.GenerateShortHashSHA256(header+payload+JWT_SECRET) == signature
+	decoded, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	expected, _ := base64.RawURLEncoding.DecodeString(GenerateSignatureJWT(header, payload))
+	return hmac.Equal(decoded, expected)
+}
+
+// CheckLegacySignature checks the signature of a legacy token, a hex SHA-256 of the header,
+// the payload and JWT_SECRET. It returns false once JWT_LEGACY_UNTIL has passed.
+//
+// Parameters:
+// - header: the header string.
+// - payload: the payload string.
+// - signature: the signature string.
+//
+// Returns:
+// - a boolean indicating whether the signature is valid.
+func CheckLegacySignature(header string, payload string, signature string) bool {
+	if !time.Now().Before(config.ConfigAll.JWT_LEGACY_UNTIL) {
+		return false
+	}
+	expected := utils.GenerateShortHashSHA256(header + payload + JWT_SECRET)
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(signature)) == 1
 }
 
 // CheckProtocol checks if the given header matches the PROTOCOL_JWT constant.
@@ -198,23 +449,78 @@ func CheckProtocol(header string) bool {
 	return parseJson.Protocol == PROTOCOL_JWT
 }
 
+// CheckAlgorithm checks if the alg of the given header is in ALLOWED_ALGORITHMS.
+//
+// header: a string representing the header to be checked.
+// returns: a boolean indicating if the algorithm is allowed.
+func CheckAlgorithm(header string) bool {
+	var parseJson HeaderJWT
+	if err := json.Unmarshal([]byte(header), &parseJson); err != nil {
+		return false
+	}
+	for _, algorithm := range ALLOWED_ALGORITHMS {
+		if parseJson.Algorithm == algorithm {
+			return true
+		}
+	}
+	return false
+}
+
 // CheckPayload checks the validity of a payload.
 //
 // It takes a payload string as a parameter and returns a boolean value indicating
 // whether the payload is valid or not.
 func CheckPayload(payload string) bool {
-	dictonary := make(map[string]any)
-	err := json.Unmarshal([]byte(payload), &dictonary)
-	if err != nil {
-		return false
+	return checkClaims(payload, false) == nil
+}
+
+// checkClaims validates the registered claims of a payload. Legacy payloads have no
+// iss, aud, nbf and iat, so only their exp is checked.
+func checkClaims(payload string, legacy bool) error {
+	var claims ClaimsJWT
+	if err := json.Unmarshal([]byte(payload), &claims); err != nil {
+		return ErrInvalidToken
 	}
-	if dictonary["exp"] == nil {
-		return false
+	now := float64(time.Now().Unix())
+	leeway := config.ConfigAll.JWT_LEEWAY.Seconds()
+
+	if claims.EXP == nil {
+		return ErrInvalidToken
 	}
-	if int64(dictonary["exp"].(float64)) < time.Now().Unix() {
-		return false
+	if *claims.EXP+leeway < now {
+		return ErrExpired
+	}
+	if legacy {
+		return nil
+	}
+	if claims.NBF != nil && *claims.NBF-leeway > now {
+		return ErrNotYetValid
+	}
+	if claims.IAT != nil && *claims.IAT-leeway > now {
+		return ErrNotYetValid
+	}
+	if claims.ISS != config.ConfigAll.JWT_ISSUER {
+		return ErrIssuer
 	}
-	return true
+	if !hasAudience(claims.AUD, config.ConfigAll.JWT_AUDIENCE) {
+		return ErrAudience
+	}
+	return nil
+}
+
+// hasAudience reports whether an aud claim, a string or a list of strings, contains the audience.
+func hasAudience(claim any, audience string) bool {
+	switch value := claim.(type) {
+	case string:
+		return value == audience
+	case []any:
+		for _, item := range value {
+			if item == audience {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // GetPayloadRefresh retrieves the payload from a JWT refresh token.
@@ -263,35 +569,109 @@ func GetPayloadAccess(payload string) (PayloadJWTAccess, error) {
 	return dictonary, nil
 }
 
-// ExtractTokenHandler extracts a token from the authorization header.
+// ExtractTokenHandler extracts a token of the given type from the authorization header.
 //
-// The authorization parameter is a string representing the authorization header.
-// It returns a string representing the extracted token and an error if any occurred.
-func ExtractTokenHandler(c *fiber.Ctx) (string, error) {
-	return GetExtractTokenHandler(c.GetReqHeaders()["Authorization"])
+// Parameters:
+// - c: the fiber.Ctx object representing the HTTP context.
+// - tokenType: TOKEN_ACCESS or TOKEN_REFRESH.
+//
+// Returns:
+// - string: the checked token.
+// - error: an error of ExtractToken or ValidateTokenType.
+func ExtractTokenHandler(c *fiber.Ctx, tokenType string) (string, error) {
+	return GetExtractTokenHandler(c.GetReqHeaders()["Authorization"], tokenType)
 }
 
-// checkErrorTokenHandler is a function that takes a token string and an error as parameters.
+// checkErrorTokenHandler is a function that takes a token string, an error and the expected token type.
 // It checks if the error is not nil and returns an empty string and the error if it is.
-// Then it checks if the token is valid using the CheckToken function.
-// If the token is not valid, it returns an empty string and an error with the message "invalid token".
+// Then it checks the token and its type using the ValidateTokenType function.
+// If the token is not valid, it returns an empty string and the error of ValidateTokenType.
+// Access tokens are then checked for revocation with CheckRevoked.
 // If the token is valid, it returns the token and nil as the error.
-func checkErrorTokenHandler(token string, err error) (string, error) {
+func checkErrorTokenHandler(token string, err error, tokenType string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	if !CheckToken(token) {
-		return "", errors.New("invalid token")
+	if err := ValidateTokenType(token, tokenType); err != nil {
+		return "", err
+	}
+	if tokenType == TOKEN_ACCESS {
+		if err := CheckRevoked(token); err != nil {
+			return "", err
+		}
 	}
 	return token, nil
 }
 
-// GetExtractTokenHandler returns the extracted token from the given authorization string.
+// GetExtractTokenHandler returns the extracted token of the given type from the given authorization string.
 //
-// It takes the authorization string as a parameter and returns the extracted token and any error encountered.
-func GetExtractTokenHandler(authorization string) (string, error) {
+// It takes the authorization string and the expected token type as parameters and returns the extracted token and any error encountered.
+func GetExtractTokenHandler(authorization string, tokenType string) (string, error) {
 	token, err := ExtractToken(authorization)
-	return checkErrorTokenHandler(token, err)
+	return checkErrorTokenHandler(token, err, tokenType)
+}
+
+// GetErrorTokenResponse returns the 401 response of a failed token check, with the error
+// code of GetTokenErrorCode.
+//
+// Parameters:
+// - err: the error of a token check.
+//
+// Returns:
+// - schema.Response: the 401 response.
+func GetErrorTokenResponse(err error) schema.Response {
+	response := schema.GetError401Response()
+	response.Error = GetTokenErrorCode(err)
+	return response
+}
+
+// GetErrorAdminResponse maps an error of GetPayloadHandlerAdmin to a status code and response.
+//
+// Parameters:
+// - err: the error returned by GetPayloadHandlerAdmin.
+//
+// Returns:
+// - int: the HTTP status code, 403 for ErrNotAdmin and ErrTwoFactorRequired, otherwise 401.
+// - schema.Response: the error response.
+func GetErrorAdminResponse(err error) (int, schema.Response) {
+	if errors.Is(err, ErrNotAdmin) {
+		return 403, schema.GetError403Response()
+	}
+	if errors.Is(err, ErrTwoFactorRequired) {
+		response := schema.GetError403Response()
+		response.Error = ERROR_TWO_FACTOR_REQUIRED
+		return 403, response
+	}
+	return 401, GetErrorTokenResponse(err)
+}
+
+// GetTokenErrorCode maps the error of a token check to an error code. The code tells clients
+// whether to refresh the token (token_expired), to send the other token (wrong_token_type)
+// or to log in again (invalid_signature, invalid_token, session_revoked, token_reused).
+// An access token failing with token_revoked may still be refreshed.
+//
+// Parameters:
+// - err: the error of a token check.
+//
+// Returns:
+// - string: ERROR_TOKEN_EXPIRED, ERROR_WRONG_TOKEN_TYPE, ERROR_INVALID_SIGNATURE,
+// ERROR_SESSION_REVOKED, ERROR_TOKEN_REUSED, ERROR_TOKEN_REVOKED or ERROR_INVALID_TOKEN.
+func GetTokenErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrExpired):
+		return ERROR_TOKEN_EXPIRED
+	case errors.Is(err, ErrTokenType):
+		return ERROR_WRONG_TOKEN_TYPE
+	case errors.Is(err, ErrSignature), errors.Is(err, ErrUnknownKey):
+		return ERROR_INVALID_SIGNATURE
+	case errors.Is(err, ErrSessionRevoked):
+		return ERROR_SESSION_REVOKED
+	case errors.Is(err, ErrTokenReused):
+		return ERROR_TOKEN_REUSED
+	case errors.Is(err, ErrTokenRevoked):
+		return ERROR_TOKEN_REVOKED
+	}
+	return ERROR_INVALID_TOKEN
 }
 
 // CheckErrorQueryDB checks if there is an error in the result of a database query.
@@ -329,20 +709,105 @@ func GetPayloadHandlerAccess(token string) (PayloadJWTAccess, error) {
 		return PayloadJWTAccess{}, errors.New("token is empty")
 	}
 
-	tokenSplit := strings.Split(token, ".")
+	decodeToken, err := GetTokenPayload(token)
+	if err != nil {
+		return PayloadJWTAccess{}, err
+	}
 
-	if len(tokenSplit) != 3 {
-		return PayloadJWTAccess{}, errors.New("invalid token")
+	payload, err := GetPayloadAccess(decodeToken)
+	if err != nil {
+		return PayloadJWTAccess{}, err
 	}
+	return payload, nil
+}
 
-	decodeToken, err := utils.Base64Decode([]byte(tokenSplit[1]))
+// GetUserHandler extracts the access token from the request and loads the user it belongs to.
+//
+// Parameters:
+// - c: the fiber.Ctx object representing the HTTP context.
+//
+// Returns:
+// - models.User: the user of the access token.
+// - error: an error if the token is missing or invalid or the user does not exist.
+func GetUserHandler(c *fiber.Ctx) (models.User, error) {
+	token, err := ExtractTokenHandler(c, TOKEN_ACCESS)
+	if err != nil {
+		return models.User{}, err
+	}
+	return GetUserByToken(token)
+}
+
+// GetUserByToken loads the user an access token belongs to. The token must already be checked,
+// for example by GetExtractTokenHandler with TOKEN_ACCESS.
+//
+// Parameters:
+// - token: the access token.
+//
+// Returns:
+// - models.User: the user of the access token.
+// - error: an error if the payload is invalid or the user does not exist.
+func GetUserByToken(token string) (models.User, error) {
+	payload, err := GetPayloadHandlerAccess(token)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	var user models.User
+	if err := localDb.First(&user, "id = ?", payload.UserID).Error; err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// GetOptionalUserHandler loads the user of the request's access token, or returns nil for requests
+// without an Authorization header.
+//
+// Parameters:
+// - c: the fiber.Ctx object representing the HTTP context.
+//
+// Returns:
+// - *models.User: the authenticated user or nil.
+// - error: an error if a token was sent but is invalid.
+func GetOptionalUserHandler(c *fiber.Ctx) (*models.User, error) {
+	if c.Get(fiber.HeaderAuthorization) == "" {
+		return nil, nil
+	}
+	user, err := GetUserHandler(c)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetPayloadHandlerAdmin extracts the access token from the request and checks that it belongs to an existing admin.
+// If two-factor authentication is required for admins, an admin who has not enabled it is rejected.
+//
+// Parameters:
+// - c: the fiber.Ctx object representing the HTTP context.
+//
+// Returns:
+// - PayloadJWTAccess: the payload of the access token.
+// - error: ErrNotAdmin if the user is not an admin, ErrTwoFactorRequired, or another error if the token or user is invalid.
+func GetPayloadHandlerAdmin(c *fiber.Ctx) (PayloadJWTAccess, error) {
+	token, err := ExtractTokenHandler(c, TOKEN_ACCESS)
 	if err != nil {
 		return PayloadJWTAccess{}, err
 	}
 
-	payload, err := GetPayloadAccess(decodeToken)
+	payload, err := GetPayloadHandlerAccess(token)
 	if err != nil {
 		return PayloadJWTAccess{}, err
 	}
+
+	var user models.User
+	if err := localDb.First(&user, "id = ?", payload.UserID).Error; err != nil {
+		return PayloadJWTAccess{}, err
+	}
+	if user.Role != models.ROLE_ADMIN {
+		return PayloadJWTAccess{}, ErrNotAdmin
+	}
+	if err := CheckTwoFactorPolicy(localDb, user); err != nil {
+		return PayloadJWTAccess{}, err
+	}
 	return payload, nil
 }
@@ -1,24 +1,31 @@
 package jwt
 
 import (
-	"strings"
+	"errors"
+	"math"
+	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"golang.org/x/exp/slog"
 	"gorm.io/gorm"
+	"urlshort.ru/m/config"
 	"urlshort.ru/m/models"
 	"urlshort.ru/m/schema"
 	"urlshort.ru/m/utils"
 )
 
 // @Summary Refresh JWT token
-// @Description Refreshes the JWT token using the refresh token
+// @Description Exchanges the refresh token for a new refresh and access token. Every refresh token is used once:
+// @Description presenting a rotated token again revokes its session, and the error is token_reused.
 // @Tags JWT
 // @Accept json
 // @Produce json
 // @Param Authorization header string true "Bearer {refresh_token}"
-// @Success 200 {object} AccessToken
+// @Success 200 {object} RefreshAndAccessTokens
 // @Failure 400 {object} schema.Response
-// @Failure 401 {object} schema.Response
+// @Failure 401 {object} schema.Response "error: invalid_token, invalid_signature, token_expired, wrong_token_type, session_revoked or token_reused"
+// @Failure 403 {object} schema.Response "error: two_factor_required if the role requires two-factor authentication and the user has not enabled it"
 // @Failure 404 {object} schema.Response
 // @Router /api/jwt/refresh [get]
 //
@@ -28,55 +35,47 @@ import (
 func refreshHandler(c *fiber.Ctx) error {
 	c.Accepts("application/json")
 	c.AcceptsCharsets("UTF-8", "UTF-16")
-	token, err := ExtractTokenHandler(c)
-	if err != nil {
-		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
-		return c.Status(400).JSON(schema.GetError400Response())
-	}
-
-	tokenSplit := strings.Split(token, ".")
-	decodeToken, err := utils.Base64Decode([]byte(tokenSplit[1]))
+	token, err := ExtractTokenHandler(c, TOKEN_REFRESH)
 	if err != nil {
-		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
-		return c.Status(400).JSON(schema.GetError400Response())
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 401)
+		return c.Status(401).JSON(GetErrorTokenResponse(err))
 	}
-	payloadRefresh, err := GetPayloadRefresh(decodeToken)
 
+	_, refreshToken, accessToken, err := RotateSession(localDb, token, GetClient(c, ""))
 	if err != nil {
-		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
-		return c.Status(400).JSON(schema.GetError400Response())
-	}
-
-	var user models.User
-	result := localDb.Where("id = ? AND refresh_token = ?", payloadRefresh.UserID, utils.GenerateShortHashSHA256(token)).First(&user)
-
-	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
+		switch {
+		case errors.Is(err, ErrSessionRevoked), errors.Is(err, ErrTokenReused):
+			utils.LoggerRequestUser(c, LOGGER_HANDLER, 401)
+			return c.Status(401).JSON(GetErrorTokenResponse(err))
+		case errors.Is(err, ErrTwoFactorRequired):
+			response := schema.GetError403Response()
+			response.Error = ERROR_TWO_FACTOR_REQUIRED
+			utils.LoggerRequestUser(c, LOGGER_HANDLER, 403)
+			return c.Status(403).JSON(response)
+		case errors.Is(err, gorm.ErrRecordNotFound):
 			utils.LoggerRequestUser(c, LOGGER_HANDLER, 404)
 			return c.Status(404).JSON(schema.GetError404Response())
 		}
-		utils.LoggerRequestUser(c, LOGGER_HANDLER, 401)
-		return c.Status(401).JSON(schema.GetError401Response())
-	}
-
-	accessToken, err := GenerateJWTAccess(int(user.ID), user.Email, user.Role)
-	if err != nil {
 		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
 		return c.Status(400).JSON(schema.GetError400Response())
 	}
 
 	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
-	return c.JSON(GetJWTAccessTokens(accessToken))
+	return c.JSON(GetJWTRefreshAndAccessTokens(refreshToken, accessToken))
 
 }
 
 // @Summary Register user
-// @Description Registers a new user
+// @Description Registers a new user and starts a session on the device named by device_name,
+// @Description or by the browser and operating system of the User-Agent header.
+// @Description A verification link is mailed to the email. If verification is required, no session is started
+// @Description and the response is 202 with empty tokens until the email is verified.
 // @Tags JWT
 // @Accept json
 // @Produce json
 // @Param requestBody body UserJSON true "User object"
 // @Success 200 {object} RefreshAndAccessTokens
+// @Success 202 {object} RefreshAndAccessTokens "Verification required, the tokens are empty"
 // @Failure 400 {object} schema.Response
 // @Router /api/jwt/register [post]
 //
@@ -93,28 +92,31 @@ func registerHandler(c *fiber.Ctx) error {
 		return c.Status(400).JSON(schema.GetError400Response())
 	}
 
-	var user models.User
-	user.Email = inputUserJson.Email
-	user.Password = utils.GenerateShortHashSHA256(inputUserJson.Email + inputUserJson.Password)
-	user.Role = "user"
-	if err := localDb.Create(&user).Error; err != nil {
-		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
-		return c.Status(400).JSON(schema.GetError400Response())
-	}
-
-	refreshToken, err := GenerateJWTRefresh(int(user.ID))
+	password, err := HashPassword(inputUserJson.Password)
 	if err != nil {
 		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
 		return c.Status(400).JSON(schema.GetError400Response())
 	}
 
-	user.RefreshToken = utils.GenerateShortHashSHA256(refreshToken)
-	if err := localDb.Save(&user).Error; err != nil {
+	var user models.User
+	user.Email = inputUserJson.Email
+	user.Password = password
+	user.Role = "user"
+	if err := localDb.Create(&user).Error; err != nil {
 		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
 		return c.Status(400).JSON(schema.GetError400Response())
 	}
+	go func() {
+		if err := SendVerification(localDb, user, time.Now()); err != nil {
+			slog.Error(LOGGER_HANDLER, "user", user.ID, "error", err)
+		}
+	}()
+	if config.ConfigAll.EMAIL_VERIFICATION_REQUIRED {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 202)
+		return c.Status(202).JSON(GetJWTRefreshAndAccessTokens("", ""))
+	}
 
-	accessToken, err := GenerateJWTAccess(int(user.ID), user.Email, user.Role)
+	_, refreshToken, accessToken, err := StartSession(localDb, user, GetClient(c, inputUserJson.DeviceName))
 	if err != nil {
 		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
 		return c.Status(400).JSON(schema.GetError400Response())
@@ -125,14 +127,23 @@ func registerHandler(c *fiber.Ctx) error {
 }
 
 // @Summary User login
-// @Description Logs in a user
+// @Description Logs in a user and starts a session on the device named by device_name,
+// @Description or by the browser and operating system of the User-Agent header. Other sessions stay active.
+// @Description Failed logins are counted per email and per IP: after a few failures every attempt waits longer,
+// @Description and after more the email or IP is locked out for a while. Unknown emails are counted the same way.
+// @Description If verification is required, a user with an unverified email gets 403 with error email_not_verified.
+// @Description If the user enabled two-factor authentication or it is required for the role, the response is 202 with a
+// @Description challenge token for /api/jwt/login/2fa instead of the tokens. enroll tells a user without it to enroll first.
 // @Tags JWT
 // @Accept json
 // @Produce json
 // @Param requestBody body UserJSON true "User object"
 // @Success 200 {object} RefreshAndAccessTokens
+// @Success 202 {object} ChallengeResponse "Two-factor authentication needed"
 // @Failure 400 {object} schema.Response
 // @Failure 401 {object} schema.Response
+// @Failure 403 {object} schema.Response "error: email_not_verified"
+// @Failure 429 {object} schema.Response "error: too_many_attempts, the Retry-After header gives the wait in seconds"
 // @Router /api/jwt/login [post]
 //
 // Parameters:
@@ -146,25 +157,62 @@ func loginHandler(c *fiber.Ctx) error {
 		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
 		return c.Status(400).JSON(schema.GetError400Response())
 	}
-	var user models.User
-	passwordDB := utils.GenerateShortHashSHA256(inputUserJson.Email + inputUserJson.Password)
-	if err := localDb.Where("email = ? AND password = ?", inputUserJson.Email, passwordDB).First(&user).Error; err != nil {
-		utils.LoggerRequestUser(c, LOGGER_HANDLER, 401)
-		return c.Status(401).JSON(schema.GetError401Response())
-	}
-	refreshToken, err := GenerateJWTRefresh(int(user.ID))
+	now := time.Now()
+	subjects := LoginSubjects(inputUserJson.Email, c.IP())
+	wait, err := LoginWait(localDb, subjects, now)
 	if err != nil {
 		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
 		return c.Status(400).JSON(schema.GetError400Response())
 	}
+	if wait > 0 {
+		return tooManyAttemptsResponse(c, wait)
+	}
+	if wait, err = RecordLoginAttempt(localDb, subjects, c.IP(), now); err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
+	if wait > 0 {
+		return tooManyAttemptsResponse(c, wait)
+	}
 
-	user.RefreshToken = utils.GenerateShortHashSHA256(refreshToken)
-	if err := localDb.Save(&user).Error; err != nil {
+	user, err := Authenticate(localDb, inputUserJson.Email, inputUserJson.Password)
+	// Only wrong credentials keep the attempt counted.
+	if !errors.Is(err, ErrInvalidCredentials) {
+		if err := ForgiveLoginAttempt(localDb, subjects); err != nil {
+			slog.Error(LOGGER_HANDLER, err)
+		}
+	}
+	if err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 401)
+		return c.Status(401).JSON(schema.GetError401Response())
+	}
+	if config.ConfigAll.EMAIL_VERIFICATION_REQUIRED && user.EmailVerifiedAt == nil {
+		response := schema.GetError403Response()
+		response.Error = ERROR_EMAIL_NOT_VERIFIED
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 403)
+		return c.Status(403).JSON(response)
+	}
+	needsTwoFactor, err := NeedsTwoFactor(localDb, user)
+	if err != nil {
 		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
 		return c.Status(400).JSON(schema.GetError400Response())
 	}
+	if needsTwoFactor {
+		// The failures are kept until the second step, so a known password does not reset
+		// the count of guessed codes.
+		challenge, err := GenerateJWTChallenge(int(user.ID))
+		if err != nil {
+			utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+			return c.Status(400).JSON(schema.GetError400Response())
+		}
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 202)
+		return c.Status(202).JSON(GetChallengeResponse(challenge, user))
+	}
+	if err := ResetLoginFailures(localDb, inputUserJson.Email); err != nil {
+		slog.Error(LOGGER_HANDLER, err)
+	}
 
-	accessToken, err := GenerateJWTAccess(int(user.ID), user.Email, user.Role)
+	_, refreshToken, accessToken, err := StartSession(localDb, user, GetClient(c, inputUserJson.DeviceName))
 	if err != nil {
 		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
 		return c.Status(400).JSON(schema.GetError400Response())
@@ -174,14 +222,15 @@ func loginHandler(c *fiber.Ctx) error {
 }
 
 // @Summary User logout
-// @Description Logs out a user
+// @Description Logs out a user by revoking the session of the refresh token and the access tokens of the session
 // @Tags JWT
 // @Accept json
 // @Produce json
-// @Param Authorization header string true "Bearer token"
+// @Param Authorization header string true "Bearer {refresh_token}"
 // @Success 200 {object} RefreshAndAccessTokens
 // @Failure 400 {object} schema.Response
-// @Failure 401 {object} schema.Response
+// @Failure 401 {object} schema.Response "error: invalid_token, invalid_signature, token_expired or wrong_token_type"
+// @Failure 404 {object} schema.Response
 // @Router /api/jwt/logout [get]
 //
 // Parameters:
@@ -190,74 +239,233 @@ func loginHandler(c *fiber.Ctx) error {
 func logoutHandler(c *fiber.Ctx) error {
 	c.Accepts("application/json")
 	c.AcceptsCharsets("UTF-8", "UTF-16")
-	token, err := ExtractTokenHandler(c)
+	token, err := ExtractTokenHandler(c, TOKEN_REFRESH)
 	if err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 401)
+		return c.Status(401).JSON(GetErrorTokenResponse(err))
+	}
+
+	if err := EndSession(localDb, token); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.LoggerRequestUser(c, LOGGER_HANDLER, 404)
+			return c.Status(404).JSON(schema.GetError404Response())
+		}
 		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
 		return c.Status(400).JSON(schema.GetError400Response())
 	}
 
-	tokenSplit := strings.Split(token, ".")
-	decodeToken, err := utils.Base64Decode([]byte(tokenSplit[1]))
-	if err != nil {
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.JSON(GetJWTRefreshAndAccessTokens("", ""))
+}
+
+// @Summary Check token
+// @Description Checks the validity of a token of the given type, access by default.
+// @Description The error field of a failed check is invalid_token, invalid_signature, token_expired, wrong_token_type or token_revoked.
+// @Tags JWT
+// @Accept json
+// @Produce json
+// @Param requestBody body CheckTokenJSON true "Token object, type is access or refresh"
+// @Success 200 {object} string
+// @Failure 400 {object} schema.Response
+// @Router /api/jwt/check [post]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func checkHandler(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	c.AcceptsCharsets("UTF-8", "UTF-16")
+
+	body := new(CheckTokenJSON)
+	if err := c.BodyParser(body); err != nil {
 		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
 		return c.Status(400).JSON(schema.GetError400Response())
 	}
-	payloadRefresh, err := GetPayloadRefresh(decodeToken)
-	if err != nil {
+	if body.Token == "" {
 		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
 		return c.Status(400).JSON(schema.GetError400Response())
 	}
 
-	var user models.User
-	result := localDb.Where("id = ? AND refresh_token = ?", payloadRefresh.UserID, utils.GenerateShortHashSHA256(token)).First(&user)
+	if body.Type == "" {
+		body.Type = TOKEN_ACCESS
+	}
+	if body.Type != TOKEN_ACCESS && body.Type != TOKEN_REFRESH {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
 
-	err = CheckErrorQueryDB(c, result)
+	_, err := GetExtractTokenHandler(body.Token, body.Type)
 	if err != nil {
-		return err
+		response := schema.GetError400Response()
+		response.Error = GetTokenErrorCode(err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(response)
+	}
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.SendStatus(200)
+}
+
+// @Summary Revoke access token
+// @Description Revokes the access token of the request until it expires, other tokens of the session stay valid
+// @Tags JWT
+// @Produce json
+// @Param Authorization header string true "Bearer {access_token}"
+// @Success 200 {object} string
+// @Failure 400 {object} schema.Response
+// @Failure 401 {object} schema.Response "error: invalid_token, invalid_signature, token_expired, wrong_token_type or token_revoked"
+// @Router /api/jwt/revoke [post]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func revokeHandler(c *fiber.Ctx) error {
+	token, err := ExtractTokenHandler(c, TOKEN_ACCESS)
+	if err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 401)
+		return c.Status(401).JSON(GetErrorTokenResponse(err))
 	}
 
-	user.RefreshToken = ""
-	if err := localDb.Save(&user).Error; err != nil {
+	if err := DenyToken(localDb, token); err != nil {
 		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
 		return c.Status(400).JSON(schema.GetError400Response())
 	}
 
 	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
-	return c.JSON(GetJWTRefreshAndAccessTokens("", ""))
+	return c.SendStatus(200)
 }
 
-// @Summary Check token
-// @Description Checks the validity of a token
+// @Summary Verify email
+// @Description Verifies the email of a user with the token of a verification link. The token is taken from the token
+// @Description query parameter, so the mailed link works in a browser, or from the JSON body. Every token is used once.
 // @Tags JWT
 // @Accept json
 // @Produce json
-// @Param requestBody body CheckTokenJSON true "Token object"
+// @Param token query string false "Verification token"
+// @Param requestBody body UserTokenJSON false "Token object"
 // @Success 200 {object} string
-// @Failure 400 {object} schema.Response
-// @Router /api/jwt/check [post]
+// @Failure 400 {object} schema.Response "error: user_token_invalid if the token is unknown, used or expired"
+// @Router /api/jwt/verify [get]
+// @Router /api/jwt/verify [post]
 //
 // Parameters:
 // - c: Указатель на объект fiber.Ctx, представляющий контекст запроса.
 // Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
-func checkHandler(c *fiber.Ctx) error {
-	c.Accepts("application/json")
-	c.AcceptsCharsets("UTF-8", "UTF-16")
+func verifyEmailHandler(c *fiber.Ctx) error {
+	body := UserTokenJSON{Token: c.Query("token")}
+	if body.Token == "" {
+		if err := c.BodyParser(&body); err != nil {
+			utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+			return c.Status(400).JSON(schema.GetError400Response())
+		}
+	}
 
-	body := new(CheckTokenJSON)
-	if err := c.BodyParser(body); err != nil {
+	if _, err := VerifyEmail(localDb, body.Token, c.IP(), time.Now()); err != nil {
+		response := schema.GetError400Response()
+		if errors.Is(err, ErrUserToken) {
+			response.Error = ERROR_USER_TOKEN_INVALID
+		}
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(response)
+	}
+
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.SendStatus(200)
+}
+
+// @Summary Resend verification
+// @Description Mails a new verification link if the email is registered and not verified yet, earlier links stop working.
+// @Description The response is the same for every email, so it does not reveal which emails are registered.
+// @Tags JWT
+// @Accept json
+// @Produce json
+// @Param requestBody body EmailJSON true "Email object"
+// @Success 200 {object} string
+// @Failure 400 {object} schema.Response
+// @Router /api/jwt/verify/resend [post]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func resendVerificationHandler(c *fiber.Ctx) error {
+	body := new(EmailJSON)
+	if err := c.BodyParser(body); err != nil || body.Email == "" {
 		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
 		return c.Status(400).JSON(schema.GetError400Response())
 	}
-	if body.Token == "" {
+
+	go func(email string) {
+		if err := RequestVerification(localDb, email, time.Now()); err != nil {
+			slog.Error(LOGGER_HANDLER, "error", err)
+		}
+	}(body.Email)
+
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.SendStatus(200)
+}
+
+// @Summary Request password reset
+// @Description Mails a password reset link if the email is registered, earlier links stop working.
+// @Description The response is the same for every email, so it does not reveal which emails are registered.
+// @Tags JWT
+// @Accept json
+// @Produce json
+// @Param requestBody body EmailJSON true "Email object"
+// @Success 200 {object} string
+// @Failure 400 {object} schema.Response
+// @Router /api/jwt/password/forgot [post]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func forgotPasswordHandler(c *fiber.Ctx) error {
+	body := new(EmailJSON)
+	if err := c.BodyParser(body); err != nil || body.Email == "" {
 		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
 		return c.Status(400).JSON(schema.GetError400Response())
 	}
 
-	_, err := GetExtractTokenHandler(body.Token)
-	if err != nil {
+	go func(email string) {
+		if err := RequestPasswordReset(localDb, email, time.Now()); err != nil {
+			slog.Error(LOGGER_HANDLER, "error", err)
+		}
+	}(body.Email)
+
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.SendStatus(200)
+}
+
+// @Summary Reset password
+// @Description Sets a new password with the token of a password reset link. Every token is used once.
+// @Description All sessions and access tokens of the user are revoked, the user logs in again with the new password.
+// @Tags JWT
+// @Accept json
+// @Produce json
+// @Param requestBody body PasswordResetJSON true "Token and new password"
+// @Success 200 {object} string
+// @Failure 400 {object} schema.Response "error: user_token_invalid if the token is unknown, used or expired"
+// @Router /api/jwt/password/reset [post]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func resetPasswordHandler(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	c.AcceptsCharsets("UTF-8", "UTF-16")
+	body := new(PasswordResetJSON)
+	if err := c.BodyParser(body); err != nil || body.Token == "" || body.Password == "" {
 		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
 		return c.Status(400).JSON(schema.GetError400Response())
 	}
+
+	if _, err := ResetPassword(localDb, body.Token, body.Password, c.IP(), time.Now()); err != nil {
+		response := schema.GetError400Response()
+		if errors.Is(err, ErrUserToken) {
+			response.Error = ERROR_USER_TOKEN_INVALID
+		}
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(response)
+	}
+
 	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
 	return c.SendStatus(200)
 }
@@ -270,7 +478,8 @@ func checkHandler(c *fiber.Ctx) error {
 // @Param Authorization header string true "Bearer token"
 // @Success 200 {object} string
 // @Failure 400 {object} schema.Response
-// @Failure 400 {object} schema.Response
+// @Failure 401 {object} schema.Response
+// @Failure 403 {object} schema.Response "error: two_factor_required if the admin has not enabled required two-factor authentication"
 // @Failure 404 {object} schema.Response
 // @Router /api/jwt/delete [delete]
 //
@@ -291,41 +500,466 @@ func deleteHandler(c *fiber.Ctx) error {
 		return c.Status(400).JSON(schema.GetError400Response())
 	}
 
-	token, err := ExtractTokenHandler(c)
+	if _, err := GetPayloadHandlerAdmin(c); err != nil {
+		status, response := GetErrorAdminResponse(err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, status)
+		return c.Status(status).JSON(response)
+	}
+
+	var user models.User
+	result := localDb.First(&user, "id = ?", body.UserId)
+	err := CheckErrorQueryDB(c, result)
+	if err != nil {
+		return err
+	}
+	if err = localDb.Delete(&user, "id = ?", body.UserId).Error; err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
+	if _, err = RevokeSessions(localDb, user.ID, 0); err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
+
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.SendStatus(200)
+}
+
+// @Summary JSON Web Key Set
+// @Description Returns the public keys that verify RS256 and EdDSA tokens, looked up by the kid header.
+// @Description Keys scheduled for rotation are published before they sign, replaced keys until their tokens expire.
+// @Tags JWT
+// @Produce json
+// @Success 200 {object} JWKS
+// @Failure 404 {object} schema.Response
+// @Router /.well-known/jwks.json [get]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func jwksHandler(c *fiber.Ctx) error {
+	if Keys == nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 404)
+		return c.Status(404).JSON(schema.GetError404Response())
+	}
+
+	c.Set(fiber.HeaderCacheControl, JWKS_CACHE_CONTROL)
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.JSON(Keys.JWKS(time.Now()))
+}
+
+// @Summary List sessions
+// @Description Returns the active sessions of the user, most recently used first. current marks the session of the access token.
+// @Tags JWT
+// @Produce json
+// @Param Authorization header string true "Bearer {access_token}"
+// @Success 200 {array} SessionResponse
+// @Failure 400 {object} schema.Response
+// @Failure 401 {object} schema.Response "error: invalid_token, invalid_signature, token_expired, wrong_token_type or token_revoked"
+// @Router /api/jwt/sessions [get]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func getSessionsHandler(c *fiber.Ctx) error {
+	payload, err := getSessionPayload(c)
 	if err != nil {
 		utils.LoggerRequestUser(c, LOGGER_HANDLER, 401)
-		return c.Status(401).JSON(schema.GetError401Response())
+		return c.Status(401).JSON(GetErrorTokenResponse(err))
 	}
 
-	tokenSplit := strings.Split(token, ".")
-	payloadAccess, err := GetPayloadAccess(tokenSplit[1])
+	sessions, err := ActiveSessions(localDb, uint(payload.UserID))
 	if err != nil {
 		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
 		return c.Status(400).JSON(schema.GetError400Response())
 	}
 
-	var user models.User
-	result := localDb.Where("id = ?", payloadAccess.UserID, utils.GenerateShortHashSHA256(token)).First(&user)
-	err = CheckErrorQueryDB(c, result)
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.JSON(GetSessionsResponse(sessions, payload.SID))
+}
+
+// @Summary Revoke session
+// @Description Revokes a session of the user. Its refresh token no longer rotates.
+// @Tags JWT
+// @Produce json
+// @Param Authorization header string true "Bearer {access_token}"
+// @Param id path int true "Session ID"
+// @Success 200 {object} string
+// @Failure 400 {object} schema.Response
+// @Failure 401 {object} schema.Response "error: invalid_token, invalid_signature, token_expired, wrong_token_type or token_revoked"
+// @Failure 404 {object} schema.Response
+// @Router /api/jwt/sessions/{id} [delete]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func deleteSessionHandler(c *fiber.Ctx) error {
+	payload, err := getSessionPayload(c)
+	if err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 401)
+		return c.Status(401).JSON(GetErrorTokenResponse(err))
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
 	if err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
+
+	var session models.Session
+	result := localDb.Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, payload.UserID).First(&session)
+	if err := CheckErrorQueryDB(c, result); err != nil {
 		return err
 	}
+	if err := RevokeSession(localDb, session); err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
 
-	if user.Role != "admin" {
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.SendStatus(200)
+}
+
+// @Summary Revoke all sessions
+// @Description Revokes every session of the user, logging out all devices. With except_current the session of the access token stays active.
+// @Tags JWT
+// @Produce json
+// @Param Authorization header string true "Bearer {access_token}"
+// @Param except_current query bool false "Keep the current session"
+// @Success 200 {object} RevokeSessionsResponse
+// @Failure 400 {object} schema.Response
+// @Failure 401 {object} schema.Response "error: invalid_token, invalid_signature, token_expired, wrong_token_type or token_revoked"
+// @Router /api/jwt/sessions [delete]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func deleteSessionsHandler(c *fiber.Ctx) error {
+	payload, err := getSessionPayload(c)
+	if err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 401)
+		return c.Status(401).JSON(GetErrorTokenResponse(err))
+	}
+
+	var except uint
+	if c.QueryBool("except_current") {
+		except = payload.SID
+	}
+	revoked, err := RevokeSessions(localDb, uint(payload.UserID), except)
+	if err != nil {
 		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
 		return c.Status(400).JSON(schema.GetError400Response())
 	}
 
-	result = localDb.First(&user, "id = ?", body.UserId)
-	err = CheckErrorQueryDB(c, result)
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.JSON(RevokeSessionsResponse{Revoked: revoked})
+}
+
+// getSessionPayload extracts the access token of a session request and returns its payload.
+func getSessionPayload(c *fiber.Ctx) (PayloadJWTAccess, error) {
+	token, err := ExtractTokenHandler(c, TOKEN_ACCESS)
+	if err != nil {
+		return PayloadJWTAccess{}, err
+	}
+	return GetPayloadHandlerAccess(token)
+}
+
+// tooManyAttemptsResponse sends the 429 response of a throttled attempt with the wait in the
+// Retry-After header.
+func tooManyAttemptsResponse(c *fiber.Ctx, wait time.Duration) error {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	response := schema.GetError429Response()
+	response.Error = ERROR_TOO_MANY_ATTEMPTS
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 429)
+	return c.Status(429).JSON(response)
+}
+
+// checkCode runs a code check of a user with the login throttle: the check waits and is
+// counted like a login of the email of the user from the IP of the request, and only a wrong
+// code stays counted as a failed login. If the check fails, the response is sent and handled is true.
+func checkCode(c *fiber.Ctx, user models.User, check func(now time.Time) error) (bool, error) {
+	now := time.Now()
+	subjects := LoginSubjects(user.Email, c.IP())
+	wait, err := LoginWait(localDb, subjects, now)
+	if err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return true, c.Status(400).JSON(schema.GetError400Response())
+	}
+	if wait > 0 {
+		return true, tooManyAttemptsResponse(c, wait)
+	}
+	if wait, err = RecordLoginAttempt(localDb, subjects, c.IP(), now); err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return true, c.Status(400).JSON(schema.GetError400Response())
+	}
+	if wait > 0 {
+		return true, tooManyAttemptsResponse(c, wait)
+	}
+
+	err = check(now)
+	// Only wrong codes keep the attempt counted.
+	if !errors.Is(err, ErrInvalidCode) {
+		if err := ForgiveLoginAttempt(localDb, subjects); err != nil {
+			slog.Error(LOGGER_HANDLER, err)
+		}
+	}
+	if err == nil {
+		return false, nil
+	}
+	status, response := 400, schema.GetError400Response()
+	switch {
+	case errors.Is(err, ErrInvalidCode):
+		response.Error = ERROR_INVALID_CODE
+	case errors.Is(err, ErrTwoFactorNotEnabled):
+		response.Error = ERROR_TWO_FACTOR_NOT_ENABLED
+	case errors.Is(err, ErrTwoFactorEnabled):
+		status, response = 409, schema.GetError409Response()
+		response.Error = ERROR_TWO_FACTOR_ENABLED
+	case errors.Is(err, ErrTwoFactorRequired):
+		status, response = 403, schema.GetError403Response()
+		response.Error = ERROR_TWO_FACTOR_REQUIRED
+	case errors.Is(err, ErrTokenReused):
+		status, response = 401, GetErrorTokenResponse(err)
+	default:
+		slog.Error(LOGGER_HANDLER, err)
+	}
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, status)
+	return true, c.Status(status).JSON(response)
+}
+
+// @Summary Second login step
+// @Description Exchanges the challenge token of a login and a code of the authenticator app, or a recovery code, for tokens.
+// @Description A user who had to enroll sends a code of the enrolled secret, which enables two-factor authentication, and gets
+// @Description the recovery codes in the response. Every challenge and code is used once. Wrong codes count as failed logins.
+// @Tags JWT
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer {challenge}"
+// @Param requestBody body TwoFactorLoginJSON true "Code object"
+// @Success 200 {object} TwoFactorLoginResponse
+// @Failure 400 {object} schema.Response "error: invalid_code or two_factor_not_enabled if the user did not enroll"
+// @Failure 401 {object} schema.Response "error: invalid_token, invalid_signature, token_expired, wrong_token_type or token_reused"
+// @Failure 429 {object} schema.Response "error: too_many_attempts, the Retry-After header gives the wait in seconds"
+// @Router /api/jwt/login/2fa [post]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func loginTwoFactorHandler(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	c.AcceptsCharsets("UTF-8", "UTF-16")
+	token, err := ExtractTokenHandler(c, TOKEN_CHALLENGE)
 	if err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 401)
+		return c.Status(401).JSON(GetErrorTokenResponse(err))
+	}
+	body := new(TwoFactorLoginJSON)
+	if err := c.BodyParser(body); err != nil || body.Code == "" {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
+
+	user, challenge, err := ChallengeUser(localDb, token)
+	if err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 401)
+		return c.Status(401).JSON(GetErrorTokenResponse(err))
+	}
+	var recoveryCodes []string
+	handled, err := checkCode(c, user, func(now time.Time) error {
+		var err error
+		recoveryCodes, err = CompleteLogin(localDb, &user, challenge, body.Code, c.IP(), now)
+		return err
+	})
+	if handled {
 		return err
 	}
-	if err = localDb.Delete(&user, "id = ?", body.UserId).Error; err != nil {
+	if err := ResetLoginFailures(localDb, user.Email); err != nil {
+		slog.Error(LOGGER_HANDLER, err)
+	}
+
+	_, refreshToken, accessToken, err := StartSession(localDb, user, GetClient(c, body.DeviceName))
+	if err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.JSON(TwoFactorLoginResponse{Refresh: refreshToken, Access: accessToken, RecoveryCodes: recoveryCodes})
+}
+
+// @Summary Enroll two-factor authentication
+// @Description Generates a TOTP secret (RFC 6238, SHA1, 6 digits, 30 seconds) and returns it with its otpauth:// provisioning URI,
+// @Description which the client shows as a QR code for the authenticator app. The secret is pending until it is enabled.
+// @Description Accepts an access token, or the challenge token of a login whose role requires two-factor authentication.
+// @Tags JWT
+// @Produce json
+// @Param Authorization header string true "Bearer {access_token} or Bearer {challenge}"
+// @Success 200 {object} TOTPEnrollResponse
+// @Failure 400 {object} schema.Response
+// @Failure 401 {object} schema.Response "error: invalid_token, invalid_signature, token_expired, wrong_token_type, token_revoked or token_reused"
+// @Failure 409 {object} schema.Response "error: two_factor_enabled"
+// @Router /api/jwt/2fa/enroll [post]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func enrollTwoFactorHandler(c *fiber.Ctx) error {
+	var user models.User
+	token, err := ExtractTokenHandler(c, TOKEN_ACCESS)
+	if errors.Is(err, ErrTokenType) {
+		token, err = ExtractTokenHandler(c, TOKEN_CHALLENGE)
+		if err == nil {
+			user, _, err = ChallengeUser(localDb, token)
+		}
+	} else if err == nil {
+		user, err = GetUserByToken(token)
+	}
+	if err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 401)
+		return c.Status(401).JSON(GetErrorTokenResponse(err))
+	}
+
+	secret, err := EnrollTOTP(localDb, &user)
+	if err != nil {
+		if errors.Is(err, ErrTwoFactorEnabled) {
+			response := schema.GetError409Response()
+			response.Error = ERROR_TWO_FACTOR_ENABLED
+			utils.LoggerRequestUser(c, LOGGER_HANDLER, 409)
+			return c.Status(409).JSON(response)
+		}
 		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
 		return c.Status(400).JSON(schema.GetError400Response())
 	}
 
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.JSON(TOTPEnrollResponse{Secret: secret, URI: TOTPProvisioningURI(secret, user.Email)})
+}
+
+// @Summary Enable two-factor authentication
+// @Description Enables two-factor authentication with a code of the enrolled secret and returns the recovery codes.
+// @Description The recovery codes are shown once, every code can be used once instead of a code of the authenticator app.
+// @Tags JWT
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer {access_token}"
+// @Param requestBody body CodeJSON true "Code object"
+// @Success 200 {object} RecoveryCodesResponse
+// @Failure 400 {object} schema.Response "error: invalid_code or two_factor_not_enabled if the user did not enroll"
+// @Failure 401 {object} schema.Response "error: invalid_token, invalid_signature, token_expired, wrong_token_type or token_revoked"
+// @Failure 409 {object} schema.Response "error: two_factor_enabled"
+// @Failure 429 {object} schema.Response "error: too_many_attempts"
+// @Router /api/jwt/2fa/enable [post]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func enableTwoFactorHandler(c *fiber.Ctx) error {
+	user, body, handled, err := getCodeRequest(c)
+	if handled {
+		return err
+	}
+
+	var codes []string
+	handled, err = checkCode(c, user, func(now time.Time) error {
+		var err error
+		codes, err = EnableTOTP(localDb, &user, body.Code, c.IP(), now)
+		return err
+	})
+	if handled {
+		return err
+	}
+
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.JSON(RecoveryCodesResponse{Codes: codes})
+}
+
+// @Summary Disable two-factor authentication
+// @Description Disables two-factor authentication with a code or a recovery code and deletes the secret and recovery codes.
+// @Description It cannot be disabled while it is required for the role of the user.
+// @Tags JWT
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer {access_token}"
+// @Param requestBody body CodeJSON true "Code object"
+// @Success 200 {object} string
+// @Failure 400 {object} schema.Response "error: invalid_code or two_factor_not_enabled"
+// @Failure 401 {object} schema.Response "error: invalid_token, invalid_signature, token_expired, wrong_token_type or token_revoked"
+// @Failure 403 {object} schema.Response "error: two_factor_required"
+// @Failure 429 {object} schema.Response "error: too_many_attempts"
+// @Router /api/jwt/2fa/disable [post]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func disableTwoFactorHandler(c *fiber.Ctx) error {
+	user, body, handled, err := getCodeRequest(c)
+	if handled {
+		return err
+	}
+
+	handled, err = checkCode(c, user, func(now time.Time) error {
+		return DisableTwoFactor(localDb, &user, body.Code, c.IP(), now)
+	})
+	if handled {
+		return err
+	}
+
 	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
 	return c.SendStatus(200)
 }
+
+// @Summary Regenerate recovery codes
+// @Description Replaces the recovery codes with new ones after checking a code or a recovery code. The old codes stop working.
+// @Tags JWT
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer {access_token}"
+// @Param requestBody body CodeJSON true "Code object"
+// @Success 200 {object} RecoveryCodesResponse
+// @Failure 400 {object} schema.Response "error: invalid_code or two_factor_not_enabled"
+// @Failure 401 {object} schema.Response "error: invalid_token, invalid_signature, token_expired, wrong_token_type or token_revoked"
+// @Failure 429 {object} schema.Response "error: too_many_attempts"
+// @Router /api/jwt/2fa/recovery-codes [post]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func recoveryCodesHandler(c *fiber.Ctx) error {
+	user, body, handled, err := getCodeRequest(c)
+	if handled {
+		return err
+	}
+
+	var codes []string
+	handled, err = checkCode(c, user, func(now time.Time) error {
+		if err := VerifySecondFactor(localDb, &user, body.Code, c.IP(), now); err != nil {
+			return err
+		}
+		var err error
+		codes, err = GenerateRecoveryCodes(localDb, user.ID)
+		return err
+	})
+	if handled {
+		return err
+	}
+
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.JSON(RecoveryCodesResponse{Codes: codes})
+}
+
+// getCodeRequest loads the user of the access token and the code of a two-factor request.
+// If either is invalid, the response is sent and handled is true.
+func getCodeRequest(c *fiber.Ctx) (models.User, *CodeJSON, bool, error) {
+	c.Accepts("application/json")
+	c.AcceptsCharsets("UTF-8", "UTF-16")
+	user, err := GetUserHandler(c)
+	if err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 401)
+		return models.User{}, nil, true, c.Status(401).JSON(GetErrorTokenResponse(err))
+	}
+	body := new(CodeJSON)
+	if err := c.BodyParser(body); err != nil || body.Code == "" {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return models.User{}, nil, true, c.Status(400).JSON(schema.GetError400Response())
+	}
+	return user, body, false, nil
+}
@@ -0,0 +1,24 @@
+package redirect
+
+import (
+	"embed"
+	"html/template"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var localDb *gorm.DB
+
+const LOGGER_HANDLER string = "api.redirect"
+
+const STATS_PAGE_RANGE = time.Hour * 24 * 30
+
+const STATS_PAGE_REFERRERS = 10
+
+//go:embed templates
+var templates embed.FS
+
+var statsTemplate = template.Must(template.New("stats.html").Funcs(template.FuncMap{
+	"percent": percent,
+}).ParseFS(templates, "templates/stats.html"))
@@ -0,0 +1,17 @@
+package redirect
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"urlshort.ru/m/models"
+)
+
+// Register registers the public redirect routes on the root of the app.
+//
+// app: The fiber.Router instance to register.
+//
+// Return type: None.
+func Register(app fiber.Router) {
+	localDb = models.DATABASE
+	app.Get("/:shorturl", redirectWithShort)
+	app.Get("/:shorturl/stats", getStatsPage)
+}
@@ -0,0 +1,20 @@
+package redirect
+
+import (
+	"time"
+
+	"urlshort.ru/m/stats"
+)
+
+type StatsPageResponse struct {
+	ShortURL    string        `json:"short_url"`
+	OriginalURL string        `json:"original_url"`
+	CreatedAt   time.Time     `json:"created_at"`
+	From        time.Time     `json:"from"`
+	To          time.Time     `json:"to"`
+	TimeZone    string        `json:"time_zone"`
+	Total       int64         `json:"total"`
+	Unique      int64         `json:"unique"`
+	Series      []stats.Point `json:"series"`
+	Referrers   []stats.Item  `json:"referrers"`
+}
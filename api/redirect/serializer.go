@@ -0,0 +1,36 @@
+package redirect
+
+import (
+	"urlshort.ru/m/models"
+	"urlshort.ru/m/stats"
+)
+
+// GetStatsPageResponse returns the public summary of a link built from its stats report.
+//
+// Parameters:
+// - url: the link.
+// - report: the daily report of the link.
+// Return:
+// - StatsPageResponse: the summary shown on the stats page.
+func GetStatsPageResponse(url models.URL, report stats.Report) StatsPageResponse {
+	return StatsPageResponse{
+		ShortURL:    url.ShortURL,
+		OriginalURL: url.OriginalURL,
+		CreatedAt:   url.CreatedAt,
+		From:        report.From,
+		To:          report.To,
+		TimeZone:    report.TimeZone,
+		Total:       report.Total,
+		Unique:      report.Unique,
+		Series:      report.Series,
+		Referrers:   report.Breakdowns[stats.DIMENSION_REFERRER],
+	}
+}
+
+// percent returns the share of value in max as a CSS width percentage.
+func percent(value int64, max int64) int64 {
+	if max <= 0 {
+		return 0
+	}
+	return value * 100 / max
+}
@@ -0,0 +1,162 @@
+package redirect
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
+	"urlshort.ru/m/anomaly"
+	"urlshort.ru/m/api/jwt"
+	"urlshort.ru/m/clicks"
+	"urlshort.ru/m/health"
+	"urlshort.ru/m/models"
+	"urlshort.ru/m/privacy"
+	"urlshort.ru/m/schema"
+	"urlshort.ru/m/stats"
+	"urlshort.ru/m/targeting"
+	"urlshort.ru/m/utils"
+)
+
+// redirectWithShort перенаправляет посетителя на адрес, сохраненный для короткого URL.
+//
+// @Summary Перейти по короткому URL
+// @Description Перенаправляет на исходный URL или на резервный URL, если исходный недоступен.
+// @Description Если страна или регион посетителя совпадает с правилом таргетинга ссылки, перенаправляет на адрес из правила.
+// @Description К адресу добавляется идентификатор перехода (параметр CLICK_ID_PARAM) для учета конверсий.
+// @Description Ссылки, приостановленные из-за всплеска переходов, отвечают 403, ограниченные — 429 сверх лимита.
+// @Description Ссылки с истекшим сроком действия (expires_at) отвечают 410.
+// @Tags Переход
+// @Param shorturl path string true "Короткий URL"
+// @Success 302
+// @Failure 403 {object} schema.Response
+// @Failure 404 {object} schema.Response
+// @Failure 410 {object} schema.Response
+// @Failure 429 {object} schema.Response
+// @Router /{shorturl} [get]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст HTTP-запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func redirectWithShort(c *fiber.Ctx) error {
+	var url models.URL
+	result := localDb.First(&url, "short_url = ?", c.Params("shorturl"))
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			utils.LoggerRequestUser(c, LOGGER_HANDLER, 404)
+			return c.Status(404).JSON(schema.GetError404Response())
+		}
+		slog.Debug(LOGGER_HANDLER, result.Error)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
+
+	if url.Blocked || url.Paused {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 403)
+		return c.Status(403).JSON(schema.GetError403Response())
+	}
+	if url.ExpiresAt != nil && !time.Now().Before(*url.ExpiresAt) {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 410)
+		return c.Status(410).JSON(schema.GetError410Response())
+	}
+	if !anomaly.Allow(url, time.Now()) {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 429)
+		return c.Status(429).JSON(schema.GetError429Response())
+	}
+
+	location := clicks.Locate(c.IP())
+	destination, fallback := health.Destination(url)
+	// Targeting rules are checked only while the primary destination is healthy,
+	// a failing link keeps sending everybody to its fallback.
+	if !fallback {
+		target, ok, err := targeting.Destination(localDb, url.ID, location)
+		if err != nil {
+			slog.Error(LOGGER_HANDLER, err)
+		} else if ok {
+			destination = target
+		}
+	}
+
+	click := clicks.NewClick(url, destination, fallback, clicks.Visit{
+		IP:             c.IP(),
+		Referrer:       c.Get(fiber.HeaderReferer),
+		UserAgent:      c.Get(fiber.HeaderUserAgent),
+		AcceptLanguage: c.Get(fiber.HeaderAcceptLanguage),
+		DoNotTrack:     privacy.OptedOut(c.Get(fiber.HeaderDNT), c.Get("Sec-GPC")),
+		Location:       &location,
+	})
+	clicks.Track(localDb, click)
+
+	health.CheckIfStale(localDb, url)
+
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 302)
+	return c.Redirect(clicks.AppendClickID(destination, click.ClickID), 302)
+}
+
+// getStatsPage показывает сводку переходов по короткому URL за последние 30 дней.
+//
+// @Summary Страница статистики URL
+// @Description Возвращает HTML-страницу или JSON (по заголовку Accept или параметру format=json) с числом переходов
+// @Description по дням и основными источниками. Страница доступна всем для ссылок с видимостью public,
+// @Description только владельцу и администраторам для private и отключена для disabled.
+// @Tags Переход
+// @Produce html
+// @Produce json
+// @Param Authorization header string false "Bearer token"
+// @Param shorturl path string true "Короткий URL"
+// @Param format query string false "json для ответа в формате JSON"
+// @Success 200 {object} StatsPageResponse
+// @Failure 404 {object} schema.Response
+// @Failure 500 {object} schema.Response
+// @Router /{shorturl}/stats [get]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст HTTP-запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func getStatsPage(c *fiber.Ctx) error {
+	var url models.URL
+	result := localDb.First(&url, "short_url = ?", c.Params("shorturl"))
+	if result.Error != nil || url.Blocked || !stats.PageEnabled(url) {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 404)
+		return c.Status(404).JSON(schema.GetError404Response())
+	}
+
+	// Private pages answer like missing ones, so their existence is not revealed.
+	viewer, err := jwt.GetOptionalUserHandler(c)
+	if err != nil || !stats.CanView(url, viewer) {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 404)
+		return c.Status(404).JSON(schema.GetError404Response())
+	}
+
+	to := time.Now()
+	report, err := stats.Query(localDb, url.ID, stats.INTERVAL_DAY, to.Add(-STATS_PAGE_RANGE), to, STATS_PAGE_REFERRERS, []string{models.TRAFFIC_HUMAN})
+	if err != nil {
+		slog.Error(LOGGER_HANDLER, err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+		return c.Status(500).JSON(schema.GetError500Response())
+	}
+	page := GetStatsPageResponse(url, report)
+
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	if c.Query("format") == "json" || c.Accepts(fiber.MIMETextHTML, fiber.MIMEApplicationJSON) == fiber.MIMEApplicationJSON {
+		return c.JSON(page)
+	}
+
+	view := struct {
+		Page        StatsPageResponse
+		MaxDay      int64
+		MaxReferrer int64
+	}{Page: page}
+	for _, point := range page.Series {
+		if point.Total > view.MaxDay {
+			view.MaxDay = point.Total
+		}
+	}
+	if len(page.Referrers) > 0 {
+		view.MaxReferrer = page.Referrers[0].Total
+	}
+
+	c.Type("html", "utf-8")
+	return statsTemplate.Execute(c.Response().BodyWriter(), view)
+}
@@ -1,7 +1,18 @@
 package urls
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 var localDb *gorm.DB
 
 const LOGGER_HANDLER string = "api.urls"
+
+const DEFAULT_STATS_RANGE = time.Hour * 24 * 30
+
+const DEFAULT_STATS_LIMIT = 10
+
+// LIVE_RETRY is the reconnection delay suggested to event stream clients.
+const LIVE_RETRY = time.Second * 3
@@ -5,16 +5,74 @@ import (
 )
 
 type CreateURLBody struct {
-	OriginalURL string `json:"original_url"`
+	OriginalURL     string   `json:"original_url"`
+	FallbackURL     string   `json:"fallback_url,omitempty"`
+	StatsVisibility string   `json:"stats_visibility,omitempty"`
+	NoTracking      bool     `json:"no_tracking,omitempty"`
+	Tags            []string `json:"tags,omitempty"`
+	ExpiresAt       string   `json:"expires_at,omitempty"`
 }
 
 type URLResponse struct {
-	ID          uint      `json:"id"`
-	OriginalURL string    `json:"original_url"`
-	ShortURL    string    `json:"short_url"`
-	CreatedAt   time.Time `json:"created_at,omitempty"`
+	ID          uint       `json:"id"`
+	OriginalURL string     `json:"original_url"`
+	ShortURL    string     `json:"short_url"`
+	FallbackURL string     `json:"fallback_url,omitempty"`
+	CreatedAt   time.Time  `json:"created_at,omitempty"`
+	Blocked     bool       `json:"blocked"`
+	BlockReason string     `json:"block_reason,omitempty"`
+	Paused      bool       `json:"paused"`
+	Throttled   *time.Time `json:"throttled_until,omitempty"`
+	Clicks      URLClicks  `json:"clicks"`
+	Health      URLHealth  `json:"health"`
+	Visibility  string     `json:"stats_visibility"`
+	NoTracking  bool       `json:"no_tracking"`
+	Tags        []string   `json:"tags"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+type URLClicks struct {
+	Total  int64 `json:"total"`
+	Unique int64 `json:"unique"`
+	Bots   int64 `json:"bots"`
+}
+
+type URLHealth struct {
+	Status    int        `json:"status,omitempty"`
+	Failing   bool       `json:"failing"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
 }
 
 type ShortURLBody struct {
-	OriginalURL string `json:"original_url"`
+	OriginalURL string    `json:"original_url"`
+	FallbackURL *string   `json:"fallback_url,omitempty"`
+	NoTracking  *bool     `json:"no_tracking,omitempty"`
+	Tags        *[]string `json:"tags,omitempty"`
+	ExpiresAt   *string   `json:"expires_at,omitempty"`
+}
+
+type StatsQuery struct {
+	Interval string `query:"interval"`
+	From     string `query:"from"`
+	To       string `query:"to"`
+	Limit    int    `query:"limit"`
+	Bots     bool   `query:"bots"`
+}
+
+type StatsVisibilityBody struct {
+	Visibility string `json:"visibility"`
+}
+
+type TargetingRuleBody struct {
+	Country     string `json:"country"`
+	Region      string `json:"region,omitempty"`
+	Destination string `json:"destination"`
+}
+
+type TargetingBody struct {
+	Rules []TargetingRuleBody `json:"rules"`
+}
+
+type TargetingResponse struct {
+	Rules []TargetingRuleBody `json:"rules"`
 }
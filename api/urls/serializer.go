@@ -2,22 +2,60 @@ package urls
 
 import (
 	"urlshort.ru/m/models"
+	"urlshort.ru/m/screening"
 
 	"urlshort.ru/m/schema"
 )
 
 // GetURLResponse returns a URLResponse struct based on the provided URL.
 //
-// It takes a parameter "url" of type models.URL and returns a URLResponse struct.
-func GetURLResponse(url models.URL) URLResponse {
+// It takes a parameter "url" of type models.URL and the tags of the link and returns a URLResponse struct.
+func GetURLResponse(url models.URL, linkTags []string) URLResponse {
 	return URLResponse{
 		ID:          url.ID,
 		OriginalURL: url.OriginalURL,
 		ShortURL:    url.ShortURL,
+		FallbackURL: url.FallbackURL,
 		CreatedAt:   url.CreatedAt,
+		Blocked:     url.Blocked,
+		BlockReason: url.BlockReason,
+		Paused:      url.Paused,
+		Throttled:   url.ThrottledUntil,
+		Clicks: URLClicks{
+			Total:  url.TotalClicks,
+			Unique: url.UniqueClicks,
+			Bots:   url.BotClicks,
+		},
+		Health: URLHealth{
+			Status:    url.HealthStatus,
+			Failing:   url.HealthFailing,
+			CheckedAt: url.HealthCheckedAt,
+		},
+		Visibility: url.StatsVisibility,
+		NoTracking: url.NoTracking,
+		Tags:       linkTags,
+		ExpiresAt:  url.ExpiresAt,
 	}
 }
 
+// GetTargetingResponse returns the targeting rules of a link in the order they are checked.
+//
+// Parameters:
+// - rules: the stored rules.
+// Return:
+// - TargetingResponse: the rules.
+func GetTargetingResponse(rules []models.TargetingRule) TargetingResponse {
+	response := TargetingResponse{Rules: []TargetingRuleBody{}}
+	for _, rule := range rules {
+		response.Rules = append(response.Rules, TargetingRuleBody{
+			Country:     rule.Country,
+			Region:      rule.Region,
+			Destination: rule.Destination,
+		})
+	}
+	return response
+}
+
 // GetError404Response generates an error response with a 404 status code.
 //
 // Parameters:
@@ -43,3 +81,16 @@ func GetError400Response() schema.Response {
 		Message: "Bad Request",
 	}
 }
+
+// GetErrorScreeningResponse returns a 400 response carrying the reason a destination was rejected.
+//
+// Parameters:
+// - verdict: the blocking verdict of the screening pipeline.
+// Return:
+// - schema.Response: the error response with the 400 status code.
+func GetErrorScreeningResponse(verdict screening.Verdict) schema.Response {
+	return schema.Response{
+		Code:    400,
+		Message: verdict.Reason,
+	}
+}
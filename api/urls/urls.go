@@ -20,6 +20,11 @@ func Register(api fiber.Router) {
 	apiUrls := api.Group("/urls")
 	localDb = models.DATABASE
 	apiUrls.Get("/:shorturl", getURLWithShort)
+	apiUrls.Get("/:shorturl/stats", getURLStats)
+	apiUrls.Get("/:shorturl/live", getURLLive)
+	apiUrls.Put("/:shorturl/stats/visibility", updateStatsVisibility)
+	apiUrls.Get("/:shorturl/targeting", getURLTargeting)
+	apiUrls.Put("/:shorturl/targeting", updateURLTargeting)
 	apiUrls.Delete("/:shorturl", deleteURLWithShort)
 	// TODO api.Patch("/:shorturl", updateURLWithShort)
 	apiUrls.Patch("/:shorturl", updateURLWithShort)
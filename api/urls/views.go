@@ -1,17 +1,29 @@
 package urls
 
 import (
+	"bufio"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
 	"golang.org/x/exp/slog"
 	"gorm.io/gorm"
 	"urlshort.ru/m/api/jwt"
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/live"
 	"urlshort.ru/m/models"
 	"urlshort.ru/m/schema"
+	"urlshort.ru/m/screening"
+	"urlshort.ru/m/stats"
+	"urlshort.ru/m/tags"
+	"urlshort.ru/m/targeting"
 	"urlshort.ru/m/utils"
+	"urlshort.ru/m/webhooks"
 )
 
 // getURLWithShort обрабатывает HTTP-запрос для получения параметров URL.
@@ -45,20 +57,32 @@ func getURLWithShort(c *fiber.Ctx) error {
 		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
 		return c.Status(400).JSON(GetError400Response())
 	}
+	linkTags, err := tags.Get(localDb, url.ID)
+	if err != nil {
+		slog.Error(LOGGER_HANDLER, err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+		return c.Status(500).JSON(schema.GetError500Response())
+	}
 	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
-	return c.JSON(GetURLResponse(url))
+	return c.JSON(GetURLResponse(url, linkTags))
 }
 
 // createURLWithOriginal создает URL с предоставленным исходным URL.
 //
 // @Summary Создать URL
-// @Description Создает URL с предоставленным исходным URL.
+// @Description Создает URL с предоставленным исходным URL. Если передан токен, пользователь становится владельцем ссылки.
+// @Description Для уже существующего исходного URL возвращается существующая ссылка без изменения владельца и меток.
+// @Description Видимость статистики private и disabled можно задать только с токеном.
+// @Description Необязательный срок действия expires_at (RFC 3339) должен быть в будущем, после него ссылка отвечает 410.
 // @Tags Параметры URL
 // @Accept json
 // @Produce json
+// @Param Authorization header string false "Bearer token"
 // @Param c body CreateURLBody true "Тело запроса"
 // @Success 200 {object} URLResponse
 // @Failure 400 {object} schema.Response
+// @Failure 401 {object} schema.Response
+// @Failure 500 {object} schema.Response
 // @Router /api/urls/ [post]
 //
 // Parameters:
@@ -72,19 +96,71 @@ func createURLWithOriginal(c *fiber.Ctx) error {
 		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
 		return c.Status(400).JSON(GetError400Response())
 	}
+	if !validDestinations(inputJson.OriginalURL, inputJson.FallbackURL) {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(GetError400Response())
+	}
+	linkTags, err := tags.Normalize(inputJson.Tags)
+	if err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(GetError400Response())
+	}
+	expiresAt, ok := parseExpiry(inputJson.ExpiresAt, time.Now())
+	if !ok {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(GetError400Response())
+	}
+
+	if inputJson.StatsVisibility == "" {
+		inputJson.StatsVisibility = models.STATS_PUBLIC
+	}
+	if !stats.IsVisibility(inputJson.StatsVisibility) {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(GetError400Response())
+	}
+
+	owner, err := jwt.GetOptionalUserHandler(c)
+	if err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 401)
+		return c.Status(401).JSON(jwt.GetErrorTokenResponse(err))
+	}
+	// Without an owner nobody could ever see or change private or disabled statistics.
+	if owner == nil && inputJson.StatsVisibility != models.STATS_PUBLIC {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(GetError400Response())
+	}
+
+	verdict, err := screenDestinations(c.Hostname(), inputJson.OriginalURL, inputJson.FallbackURL)
+	if err != nil {
+		slog.Error(LOGGER_HANDLER, err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+		return c.Status(500).JSON(schema.GetError500Response())
+	}
+	if verdict.Blocked {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(GetErrorScreeningResponse(verdict))
+	}
 
 	var url models.URL
 	newShortUrl := utils.GenerateShortHashMD5(inputJson.OriginalURL)
 	url.OriginalURL = inputJson.OriginalURL
+	url.FallbackURL = inputJson.FallbackURL
 	url.ShortURL = newShortUrl
+	url.StatsVisibility = inputJson.StatsVisibility
+	url.NoTracking = inputJson.NoTracking
+	url.ExpiresAt = expiresAt
 	url.CreatedAt = time.Now()
+	if owner != nil {
+		url.UserID = &owner.ID
+	}
 
 	result := localDb.Create(&url)
 	if result.Error != nil {
 		if strings.Contains(result.Error.Error(), "UNIQUE constraint failed") {
 			localDb.First(&url, "original_url = ?", inputJson.OriginalURL)
+			existingTags, _ := tags.Get(localDb, url.ID)
 			utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
-			return c.JSON(GetURLResponse(url))
+			return c.JSON(GetURLResponse(url, existingTags))
 		}
 		slog.Debug(LOGGER_HANDLER, result.Error)
 		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
@@ -93,10 +169,14 @@ func createURLWithOriginal(c *fiber.Ctx) error {
 
 	url.ShortURL = utils.Conver10IntTo32String(int64(url.ID))
 	localDb.Save(&url)
+	if err := tags.Set(localDb, url.ID, linkTags); err != nil {
+		slog.Error(LOGGER_HANDLER, err)
+	}
+	webhooks.NotifyLink(localDb, webhooks.EVENT_LINK_CREATED, url)
 
 	slog.Debug(LOGGER_HANDLER, url)
 	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
-	return c.JSON(GetURLResponse(url))
+	return c.JSON(GetURLResponse(url, linkTags))
 }
 
 // deleteURLWithShort deletes a URL with a given short code.
@@ -114,6 +194,7 @@ func createURLWithOriginal(c *fiber.Ctx) error {
 // @Success 200 {object} URLResponse
 // @Failure 400 {object} schema.Response
 // @Failure 401 {object} schema.Response
+// @Failure 403 {object} schema.Response "error: two_factor_required if the admin has not enabled required two-factor authentication"
 // @Failure 404 {object} schema.Response
 // @Router /api/urls/{shorturl} [delete]
 //
@@ -131,33 +212,15 @@ func deleteURLWithShort(c *fiber.Ctx) error {
 		return c.Status(400).JSON(schema.GetError400Response())
 	}
 
-	token, err := jwt.ExtractTokenHandler(c)
-	if err != nil {
-		utils.LoggerRequestUser(c, LOGGER_HANDLER, 401)
-		return c.Status(401).JSON(schema.GetError401Response())
-	}
-
-	resultPayload, err := jwt.GetPayloadHandlerAccess(token)
-	if err != nil {
-		utils.LoggerRequestUser(c, LOGGER_HANDLER, 401)
-		return c.Status(401).JSON(schema.GetError401Response())
-	}
-	if resultPayload.Role != models.ROLE_ADMIN {
-		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
-		return c.Status(400).JSON(schema.GetError400Response())
-	}
-
-	var user models.User
-
-	result := localDb.First(&user, "id = ?", resultPayload.UserID)
-	err = jwt.CheckErrorQueryDB(c, result)
-	if err != nil {
-		return err
+	if _, err := jwt.GetPayloadHandlerAdmin(c); err != nil {
+		status, response := jwt.GetErrorAdminResponse(err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, status)
+		return c.Status(status).JSON(response)
 	}
 
 	var url models.URL
 
-	result = localDb.First(&url, "short_url = ? and deleted_at IS NULL", c.Params("shorturl"))
+	result := localDb.First(&url, "short_url = ? and deleted_at IS NULL", c.Params("shorturl"))
 	if result.Error != nil {
 		utils.LoggerRequestUser(c, LOGGER_HANDLER, 404)
 		return c.Status(404).JSON(schema.GetError404Response())
@@ -171,6 +234,7 @@ func deleteURLWithShort(c *fiber.Ctx) error {
 		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
 		return c.Status(400).JSON(schema.GetError400Response())
 	}
+	webhooks.NotifyLink(localDb, webhooks.EVENT_LINK_DELETED, url)
 
 	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
 	return c.JSON(schema.GetSuccess200Response())
@@ -183,6 +247,7 @@ func deleteURLWithShort(c *fiber.Ctx) error {
 // and the "Content-Type" header to be set to "application/json".
 // @Summary Обновить URL
 // @Description Обновить URL с предоставленным коротким и существующим URL.
+// @Description Срок действия expires_at (RFC 3339) должен быть в будущем, пустая строка снимает его.
 // @Tags Параметры URL
 // @Accept json
 // @Produce json
@@ -192,7 +257,9 @@ func deleteURLWithShort(c *fiber.Ctx) error {
 // @Success 200 {object} URLResponse
 // @Failure 400 {object} schema.Response
 // @Failure 401 {object} schema.Response
+// @Failure 403 {object} schema.Response "error: two_factor_required if the admin has not enabled required two-factor authentication"
 // @Failure 404 {object} schema.Response
+// @Failure 500 {object} schema.Response
 // @Router /api/urls/{shorturl} [patch]
 //
 // Parameters:
@@ -215,52 +282,636 @@ func updateURLWithShort(c *fiber.Ctx) error {
 		return c.Status(400).JSON(schema.GetError400Response())
 	}
 
-	if bodyJson.OriginalURL == "" {
+	fallbackURL := ""
+	if bodyJson.FallbackURL != nil {
+		fallbackURL = *bodyJson.FallbackURL
+	}
+	if !validDestinations(bodyJson.OriginalURL, fallbackURL) {
 		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
 		return c.Status(400).JSON(schema.GetError400Response())
 	}
+	var linkTags []string
+	if bodyJson.Tags != nil {
+		var err error
+		if linkTags, err = tags.Normalize(*bodyJson.Tags); err != nil {
+			utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+			return c.Status(400).JSON(schema.GetError400Response())
+		}
+	}
+	var expiresAt *time.Time
+	if bodyJson.ExpiresAt != nil {
+		var ok bool
+		if expiresAt, ok = parseExpiry(*bodyJson.ExpiresAt, time.Now()); !ok {
+			utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+			return c.Status(400).JSON(schema.GetError400Response())
+		}
+	}
+
+	if _, err := jwt.GetPayloadHandlerAdmin(c); err != nil {
+		status, response := jwt.GetErrorAdminResponse(err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, status)
+		return c.Status(status).JSON(response)
+	}
+
+	var url models.URL
 
-	token, err := jwt.ExtractTokenHandler(c)
+	result := localDb.First(&url, "short_url = ?", c.Params("shorturl"))
+	if result.Error != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 404)
+		return c.Status(404).JSON(schema.GetError404Response())
+	}
+
+	if url.OriginalURL != bodyJson.OriginalURL {
+		url.OriginalURL = bodyJson.OriginalURL
+		url.HealthStatus = 0
+		url.HealthFailing = false
+		url.HealthCheckedAt = nil
+	}
+	if bodyJson.FallbackURL != nil {
+		url.FallbackURL = *bodyJson.FallbackURL
+	}
+	if bodyJson.NoTracking != nil {
+		url.NoTracking = *bodyJson.NoTracking
+	}
+	if bodyJson.ExpiresAt != nil {
+		url.ExpiresAt = expiresAt
+		url.ExpiryNotified = false
+	}
+
+	verdict, err := screenDestinations(c.Hostname(), url.OriginalURL, url.FallbackURL)
 	if err != nil {
-		utils.LoggerRequestUser(c, LOGGER_HANDLER, 401)
-		return c.Status(401).JSON(schema.GetError401Response())
+		slog.Error(LOGGER_HANDLER, err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+		return c.Status(500).JSON(schema.GetError500Response())
+	}
+	if verdict.Blocked {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(GetErrorScreeningResponse(verdict))
+	}
+	url.Blocked = false
+	url.BlockReason = ""
+
+	result = localDb.Omit("total_clicks", "unique_clicks", "bot_clicks").Save(&url)
+	if result.Error != nil {
+		slog.Debug(LOGGER_HANDLER, result.Error)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
+	if bodyJson.Tags != nil {
+		if err := tags.Set(localDb, url.ID, linkTags); err != nil {
+			slog.Error(LOGGER_HANDLER, err)
+			utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+			return c.Status(500).JSON(schema.GetError500Response())
+		}
 	}
+	webhooks.NotifyLink(localDb, webhooks.EVENT_LINK_UPDATED, url)
 
-	resultPayload, err := jwt.GetPayloadHandlerAccess(token)
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.JSON(schema.GetSuccess200Response())
+}
+
+// validDestinations reports whether the primary destination and the optional
+// fallback are absolute http or https URLs with a host.
+//
+// Parameters:
+// - original: the primary destination, required.
+// - fallback: the fallback destination, may be empty.
+//
+// Returns:
+// - bool: true if both destinations are valid.
+func validDestinations(original string, fallback string) bool {
+	if _, err := screening.ParseTarget(original); err != nil {
+		return false
+	}
+	if fallback == "" {
+		return true
+	}
+	_, err := screening.ParseTarget(fallback)
+	return err == nil
+}
+
+// parseExpiry parses the expiry of a link.
+//
+// Parameters:
+// - raw: an RFC 3339 time, or an empty string for a link without expiry.
+// - now: the current time.
+//
+// Returns:
+// - *time.Time: the expiry, nil for an empty value.
+// - bool: false if the value is not a time or not in the future.
+func parseExpiry(raw string, now time.Time) (*time.Time, bool) {
+	if raw == "" {
+		return nil, true
+	}
+	expiresAt, err := time.Parse(time.RFC3339, raw)
+	if err != nil || !expiresAt.After(now) {
+		return nil, false
+	}
+	return &expiresAt, true
+}
+
+// screenDestinations runs the screening pipeline for the primary and fallback destinations.
+// A destination behind a shortener chain that could not be followed is blocked, the client
+// may retry once the shortener answers.
+//
+// Parameters:
+// - serviceHost: the Host of the request, treated as a host of this service.
+// - destinations: the URLs to screen, empty values are skipped.
+//
+// Returns:
+// - screening.Verdict: the first blocking verdict or an empty verdict.
+// - error: an error if the screening lists could not be read.
+func screenDestinations(serviceHost string, destinations ...string) (screening.Verdict, error) {
+	for _, destination := range destinations {
+		if destination == "" {
+			continue
+		}
+		verdict, err := screening.Screen(localDb, destination, serviceHost)
+		if errors.Is(err, screening.ErrUnverified) {
+			return screening.Block(screening.REASON_UNVERIFIED), nil
+		}
+		if err != nil || verdict.Blocked {
+			return verdict, err
+		}
+	}
+	return screening.Verdict{}, nil
+}
+
+// getURLStats возвращает статистику переходов по короткому URL.
+//
+// @Summary Получить статистику URL
+// @Description Возвращает общее и уникальное число переходов, временной ряд и разбивки по источникам,
+// @Description странам, браузерам, ОС, устройствам и языкам. Интервалы считаются в часовом поясе TIME_ZONE.
+// @Description По умолчанию учитываются только переходы людей, боты и сервисы предпросмотра ссылок исключаются.
+// @Description Доступно только владельцу ссылки и администраторам независимо от видимости статистики;
+// @Description публичная сводка для всех отдается страницей /{shorturl}/stats.
+// @Tags Параметры URL
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param shorturl path string true "Короткий URL"
+// @Param interval query string false "hour, day, week или month" default(day)
+// @Param from query string false "Начало периода: RFC3339 или YYYY-MM-DD"
+// @Param to query string false "Конец периода (не включительно): RFC3339 или YYYY-MM-DD"
+// @Param limit query int false "Число значений в каждой разбивке" default(10)
+// @Param bots query bool false "Учитывать ботов и сервисы предпросмотра" default(false)
+// @Success 200 {object} stats.Report
+// @Failure 400 {object} schema.Response
+// @Failure 401 {object} schema.Response
+// @Failure 403 {object} schema.Response
+// @Failure 404 {object} schema.Response
+// @Router /api/urls/{shorturl}/stats [get]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст HTTP-запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func getURLStats(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+
+	query := new(StatsQuery)
+	if err := c.QueryParser(query); err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
+	if query.Interval == "" {
+		query.Interval = stats.INTERVAL_DAY
+	}
+	if query.Limit == 0 {
+		query.Limit = DEFAULT_STATS_LIMIT
+	}
+
+	to, err := stats.ParseTime(query.To, time.Now())
+	if err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
+	from, err := stats.ParseTime(query.From, to.Add(-DEFAULT_STATS_RANGE))
+	if err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
+
+	var url models.URL
+	result := localDb.First(&url, "short_url = ?", c.Params("shorturl"))
+	if result.Error != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 404)
+		return c.Status(404).JSON(schema.GetError404Response())
+	}
+
+	viewer, err := jwt.GetOptionalUserHandler(c)
 	if err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 401)
+		return c.Status(401).JSON(jwt.GetErrorTokenResponse(err))
+	}
+	if viewer == nil {
 		utils.LoggerRequestUser(c, LOGGER_HANDLER, 401)
 		return c.Status(401).JSON(schema.GetError401Response())
 	}
-	if resultPayload.Role != models.ROLE_ADMIN {
+	if !stats.CanManage(url, viewer) {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 403)
+		return c.Status(403).JSON(schema.GetError403Response())
+	}
+
+	traffic := []string{models.TRAFFIC_HUMAN}
+	if query.Bots {
+		traffic = nil
+	}
+
+	report, err := stats.Query(localDb, url.ID, query.Interval, from, to, query.Limit, traffic)
+	if err != nil {
+		if errors.Is(err, stats.ErrInvalidInterval) || errors.Is(err, stats.ErrInvalidRange) {
+			utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+			return c.Status(400).JSON(schema.GetError400Response())
+		}
+		slog.Error(LOGGER_HANDLER, err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+		return c.Status(500).JSON(schema.GetError500Response())
+	}
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.JSON(report)
+}
+
+// updateStatsVisibility изменяет видимость статистики короткого URL.
+//
+// @Summary Изменить видимость статистики URL
+// @Description Устанавливает видимость статистики: public — страница /{shorturl}/stats доступна всем,
+// @Description private — только владельцу и администраторам, disabled — страница статистики отключена.
+// @Description Подробная статистика /api/urls/{shorturl}/stats всегда доступна только владельцу и администраторам.
+// @Tags Параметры URL
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param shorturl path string true "Короткий URL"
+// @Param bodyJson body StatsVisibilityBody true "Видимость статистики"
+// @Success 200 {object} URLResponse
+// @Failure 400 {object} schema.Response
+// @Failure 401 {object} schema.Response
+// @Failure 403 {object} schema.Response
+// @Failure 404 {object} schema.Response
+// @Failure 500 {object} schema.Response
+// @Router /api/urls/{shorturl}/stats/visibility [put]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст HTTP-запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func updateStatsVisibility(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	c.AcceptsCharsets("UTF-8", "UTF-16")
+
+	bodyJson := new(StatsVisibilityBody)
+	if err := c.BodyParser(bodyJson); err != nil || !stats.IsVisibility(bodyJson.Visibility) {
 		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
 		return c.Status(400).JSON(schema.GetError400Response())
 	}
 
-	var user models.User
-
-	result := localDb.First(&user, "id = ?", resultPayload.UserID)
-	err = jwt.CheckErrorQueryDB(c, result)
+	user, err := jwt.GetUserHandler(c)
 	if err != nil {
-		return err
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 401)
+		return c.Status(401).JSON(jwt.GetErrorTokenResponse(err))
 	}
 
 	var url models.URL
-
-	result = localDb.First(&url, "short_url = ?", c.Params("shorturl"))
+	result := localDb.First(&url, "short_url = ?", c.Params("shorturl"))
 	if result.Error != nil {
 		utils.LoggerRequestUser(c, LOGGER_HANDLER, 404)
 		return c.Status(404).JSON(schema.GetError404Response())
 	}
+	if !stats.CanManage(url, &user) {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 403)
+		return c.Status(403).JSON(schema.GetError403Response())
+	}
+
+	url.StatsVisibility = bodyJson.Visibility
+	result = localDb.Model(&url).Update("stats_visibility", url.StatsVisibility)
+	if result.Error != nil {
+		slog.Error(LOGGER_HANDLER, result.Error)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+		return c.Status(500).JSON(schema.GetError500Response())
+	}
+	webhooks.NotifyLink(localDb, webhooks.EVENT_LINK_UPDATED, url)
+	linkTags, err := tags.Get(localDb, url.ID)
+	if err != nil {
+		slog.Error(LOGGER_HANDLER, err)
+	}
+
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.JSON(GetURLResponse(url, linkTags))
+}
 
-	url.OriginalURL = bodyJson.OriginalURL
+// getURLTargeting возвращает правила геотаргетинга короткого URL.
+//
+// @Summary Получить правила таргетинга URL
+// @Description Возвращает правила в порядке проверки. Доступно владельцу ссылки и администраторам.
+// @Tags Параметры URL
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param shorturl path string true "Короткий URL"
+// @Success 200 {object} TargetingResponse
+// @Failure 401 {object} schema.Response
+// @Failure 403 {object} schema.Response
+// @Failure 404 {object} schema.Response
+// @Failure 500 {object} schema.Response
+// @Router /api/urls/{shorturl}/targeting [get]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст HTTP-запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func getURLTargeting(c *fiber.Ctx) error {
+	user, err := jwt.GetUserHandler(c)
+	if err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 401)
+		return c.Status(401).JSON(jwt.GetErrorTokenResponse(err))
+	}
 
-	result = localDb.Save(&url)
+	var url models.URL
+	result := localDb.First(&url, "short_url = ?", c.Params("shorturl"))
 	if result.Error != nil {
-		slog.Debug(LOGGER_HANDLER, result.Error)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 404)
+		return c.Status(404).JSON(schema.GetError404Response())
+	}
+	if !stats.CanManage(url, &user) {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 403)
+		return c.Status(403).JSON(schema.GetError403Response())
+	}
+
+	rules, err := targeting.Rules(localDb, url.ID)
+	if err != nil {
+		slog.Error(LOGGER_HANDLER, err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+		return c.Status(500).JSON(schema.GetError500Response())
+	}
+
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.JSON(GetTargetingResponse(rules))
+}
+
+// updateURLTargeting заменяет правила геотаргетинга короткого URL.
+//
+// @Summary Изменить правила таргетинга URL
+// @Description Заменяет все правила ссылки. Правила проверяются по порядку: посетитель из страны country
+// @Description (код ISO 3166-1 alpha-2) и, если задан, региона region перенаправляется на destination.
+// @Description Адреса правил проверяются так же, как исходный URL. Пустой список удаляет все правила.
+// @Description Страна и регион определяются по базе GEO_DB_PATH, без нее правила не применяются.
+// @Tags Параметры URL
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param shorturl path string true "Короткий URL"
+// @Param bodyJson body TargetingBody true "Правила таргетинга"
+// @Success 200 {object} TargetingResponse
+// @Failure 400 {object} schema.Response
+// @Failure 401 {object} schema.Response
+// @Failure 403 {object} schema.Response
+// @Failure 404 {object} schema.Response
+// @Failure 500 {object} schema.Response
+// @Router /api/urls/{shorturl}/targeting [put]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст HTTP-запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func updateURLTargeting(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	c.AcceptsCharsets("UTF-8", "UTF-16")
+
+	bodyJson := new(TargetingBody)
+	if err := c.BodyParser(bodyJson); err != nil || len(bodyJson.Rules) > targeting.MAX_RULES {
 		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
 		return c.Status(400).JSON(schema.GetError400Response())
 	}
 
+	rules := make([]models.TargetingRule, 0, len(bodyJson.Rules))
+	destinations := make([]string, 0, len(bodyJson.Rules))
+	for _, item := range bodyJson.Rules {
+		rule, err := targeting.Normalize(models.TargetingRule{Country: item.Country, Region: item.Region, Destination: item.Destination})
+		if err != nil || !validDestinations(rule.Destination, "") {
+			utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+			return c.Status(400).JSON(schema.GetError400Response())
+		}
+		rules = append(rules, rule)
+		destinations = append(destinations, rule.Destination)
+	}
+
+	user, err := jwt.GetUserHandler(c)
+	if err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 401)
+		return c.Status(401).JSON(jwt.GetErrorTokenResponse(err))
+	}
+
+	var url models.URL
+	result := localDb.First(&url, "short_url = ?", c.Params("shorturl"))
+	if result.Error != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 404)
+		return c.Status(404).JSON(schema.GetError404Response())
+	}
+	if !stats.CanManage(url, &user) {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 403)
+		return c.Status(403).JSON(schema.GetError403Response())
+	}
+
+	verdict, err := screenDestinations(c.Hostname(), destinations...)
+	if err != nil {
+		slog.Error(LOGGER_HANDLER, err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+		return c.Status(500).JSON(schema.GetError500Response())
+	}
+	if verdict.Blocked {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(GetErrorScreeningResponse(verdict))
+	}
+
+	rules, err = targeting.Replace(localDb, url.ID, rules)
+	if err != nil {
+		slog.Error(LOGGER_HANDLER, err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+		return c.Status(500).JSON(schema.GetError500Response())
+	}
+	webhooks.NotifyLink(localDb, webhooks.EVENT_LINK_UPDATED, url)
+
 	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
-	return c.JSON(schema.GetSuccess200Response())
+	return c.JSON(GetTargetingResponse(rules))
+}
+
+// getURLLive передает переходы по короткому URL в реальном времени.
+//
+// @Summary Поток переходов URL
+// @Description Передает новые переходы по ссылке как Server-Sent Events (событие click, id — номер перехода)
+// @Description или, при запросе на обновление соединения, через WebSocket (сообщения JSON с полями id и data).
+// @Description Доступно владельцу ссылки и администраторам. Токен передается в заголовке Authorization или,
+// @Description для EventSource и WebSocket в браузере, в параметре access_token. Раз в LIVE_HEARTBEAT
+// @Description отправляется комментарий heartbeat (для WebSocket — ping). При переподключении с заголовком
+// @Description Last-Event-ID или параметром last_event_id сначала передаются пропущенные переходы (не более LIVE_REPLAY_LIMIT).
+// @Tags Параметры URL
+// @Produce text/event-stream
+// @Param Authorization header string false "Bearer token"
+// @Param Last-Event-ID header int false "Номер последнего полученного перехода"
+// @Param shorturl path string true "Короткий URL"
+// @Param access_token query string false "Токен доступа, если заголовок Authorization недоступен"
+// @Param last_event_id query int false "Номер последнего полученного перехода"
+// @Success 200 {object} live.Event
+// @Failure 400 {object} schema.Response
+// @Failure 401 {object} schema.Response
+// @Failure 403 {object} schema.Response
+// @Failure 404 {object} schema.Response
+// @Failure 500 {object} schema.Response
+// @Router /api/urls/{shorturl}/live [get]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст HTTP-запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func getURLLive(c *fiber.Ctx) error {
+	lastEventID := c.Get("Last-Event-ID", c.Query("last_event_id"))
+	var lastID uint64
+	if lastEventID != "" {
+		var err error
+		if lastID, err = strconv.ParseUint(lastEventID, 10, 64); err != nil {
+			utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+			return c.Status(400).JSON(schema.GetError400Response())
+		}
+	}
+
+	// EventSource and WebSocket clients in browsers cannot set headers, so the
+	// token may also be passed as a query parameter.
+	authorization := c.Get(fiber.HeaderAuthorization)
+	if authorization == "" && c.Query("access_token") != "" {
+		authorization = "Bearer " + c.Query("access_token")
+	}
+	token, err := jwt.GetExtractTokenHandler(authorization, jwt.TOKEN_ACCESS)
+	if err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 401)
+		return c.Status(401).JSON(jwt.GetErrorTokenResponse(err))
+	}
+	user, err := jwt.GetUserByToken(token)
+	if err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 401)
+		return c.Status(401).JSON(schema.GetError401Response())
+	}
+
+	var url models.URL
+	result := localDb.First(&url, "short_url = ?", c.Params("shorturl"))
+	if result.Error != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 404)
+		return c.Status(404).JSON(schema.GetError404Response())
+	}
+	if !stats.CanManage(url, &user) {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 403)
+		return c.Status(403).JSON(schema.GetError403Response())
+	}
+	if live.Default == nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+		return c.Status(500).JSON(schema.GetError500Response())
+	}
+
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	if websocket.IsWebSocketUpgrade(c) {
+		return websocket.New(func(conn *websocket.Conn) {
+			streamWebSocket(conn, url, uint(lastID))
+		})(c)
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		fmt.Fprintf(w, "retry: %d\n\n", LIVE_RETRY.Milliseconds())
+		if err := w.Flush(); err != nil {
+			return
+		}
+		send := func(event live.Event) error {
+			data, err := json.Marshal(event.Data)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "id: %d\nevent: click\ndata: %s\n\n", event.ID, data)
+			return w.Flush()
+		}
+		heartbeat := func() error {
+			w.WriteString(": heartbeat\n\n")
+			return w.Flush()
+		}
+		streamClicks(url, uint(lastID), send, heartbeat, nil)
+	})
+	return nil
+}
+
+// streamWebSocket sends the live clicks of a link as JSON messages and pings the client
+// every LIVE_HEARTBEAT. Messages from the client are only read to notice when it leaves.
+//
+// Parameters:
+// - conn: the upgraded connection.
+// - url: the link.
+// - lastID: the last click ID the client received, 0 for none.
+func streamWebSocket(conn *websocket.Conn, url models.URL, lastID uint) {
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(event live.Event) error {
+		return conn.WriteJSON(event)
+	}
+	heartbeat := func() error {
+		return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(config.ConfigAll.LIVE_HEARTBEAT))
+	}
+	streamClicks(url, lastID, send, heartbeat, closed)
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(time.Second))
+}
+
+// streamClicks replays the clicks missed since lastID and then sends live clicks of a link
+// until a send fails, the client leaves or the hub closes.
+//
+// The subscription starts before the replay is read, so no click falls between them;
+// clicks seen in both are sent once.
+//
+// Parameters:
+// - url: the link.
+// - lastID: the last click ID the client received, 0 to start with new clicks.
+// - send: writes one event to the client.
+// - heartbeat: keeps the connection alive.
+// - closed: closed when the client leaves, nil if leaving is only noticed by failed writes.
+func streamClicks(url models.URL, lastID uint, send func(live.Event) error, heartbeat func() error, closed <-chan struct{}) {
+	subscriber := live.Default.Subscribe(url)
+	defer live.Default.Unsubscribe(subscriber)
+
+	if lastID > 0 {
+		missed, err := live.Since(localDb, url, lastID, config.ConfigAll.LIVE_REPLAY_LIMIT)
+		if err != nil {
+			slog.Error(LOGGER_HANDLER, err)
+			return
+		}
+		for _, event := range missed {
+			if err := send(event); err != nil {
+				return
+			}
+			lastID = event.ID
+		}
+	}
+
+	ticker := time.NewTicker(config.ConfigAll.LIVE_HEARTBEAT)
+	defer ticker.Stop()
+	for {
+		select {
+		case event, ok := <-subscriber.Events:
+			if !ok {
+				return
+			}
+			if event.ID <= lastID {
+				continue
+			}
+			if err := send(event); err != nil {
+				return
+			}
+			lastID = event.ID
+		case <-ticker.C:
+			if err := heartbeat(); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
 }
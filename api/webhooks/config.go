@@ -0,0 +1,11 @@
+package webhooks
+
+import "gorm.io/gorm"
+
+var localDb *gorm.DB
+
+const LOGGER_HANDLER string = "api.webhooks"
+
+const DEFAULT_DELIVERIES_LIMIT = 50
+
+const MAX_DELIVERIES_LIMIT = 500
@@ -0,0 +1,46 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"strings"
+
+	"urlshort.ru/m/models"
+)
+
+// GetWebhookResponse returns the response of a webhook. The secret is only set in the
+// response to the creation request.
+//
+// Parameters:
+// - webhook: the webhook.
+// Return:
+// - WebhookResponse: the webhook without its secret.
+func GetWebhookResponse(webhook models.Webhook) WebhookResponse {
+	return WebhookResponse{
+		ID:        webhook.ID,
+		URL:       webhook.URL,
+		Events:    strings.Split(webhook.Events, ","),
+		CreatedAt: webhook.CreatedAt,
+	}
+}
+
+// GetDeliveryResponse returns the response of a delivery.
+//
+// Parameters:
+// - delivery: the delivery.
+// Return:
+// - DeliveryResponse: the delivery with its payload as JSON.
+func GetDeliveryResponse(delivery models.WebhookDelivery) DeliveryResponse {
+	return DeliveryResponse{
+		ID:             delivery.ID,
+		EventID:        delivery.EventID,
+		Event:          delivery.Event,
+		Status:         delivery.Status,
+		Attempts:       delivery.Attempts,
+		ResponseStatus: delivery.ResponseStatus,
+		LastError:      delivery.LastError,
+		NextAttemptAt:  delivery.NextAttemptAt,
+		DeliveredAt:    delivery.DeliveredAt,
+		CreatedAt:      delivery.CreatedAt,
+		Payload:        json.RawMessage(delivery.Payload),
+	}
+}
@@ -0,0 +1,345 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
+	"urlshort.ru/m/api/jwt"
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/models"
+	"urlshort.ru/m/outbound"
+	"urlshort.ru/m/schema"
+	"urlshort.ru/m/utils"
+	hooks "urlshort.ru/m/webhooks"
+)
+
+// listWebhooks возвращает вебхуки текущего пользователя.
+//
+// @Summary Список вебхуков
+// @Description Возвращает вебхуки, зарегистрированные текущим пользователем. Секреты не возвращаются.
+// @Tags Вебхуки
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {array} WebhookResponse
+// @Failure 401 {object} schema.Response
+// @Failure 500 {object} schema.Response
+// @Router /api/webhooks/ [get]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст HTTP-запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func listWebhooks(c *fiber.Ctx) error {
+	user, err := jwt.GetUserHandler(c)
+	if err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 401)
+		return c.Status(401).JSON(jwt.GetErrorTokenResponse(err))
+	}
+
+	var webhooks []models.Webhook
+	if err := localDb.Where("user_id = ?", user.ID).Order("id").Find(&webhooks).Error; err != nil {
+		slog.Error(LOGGER_HANDLER, err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+		return c.Status(500).JSON(schema.GetError500Response())
+	}
+
+	response := make([]WebhookResponse, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		response = append(response, GetWebhookResponse(webhook))
+	}
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.JSON(response)
+}
+
+// createWebhook регистрирует вебхук.
+//
+// @Summary Создать вебхук
+// @Description Регистрирует адрес, на который отправляются события ссылок текущего пользователя:
+// @Description link.created, link.updated, link.deleted, link.expired, link.spike и click (переходы отправляются пакетами).
+// @Description Адрес должен указывать только на публичные IP-адреса, перенаправления не выполняются.
+// @Description Запросы подписываются HMAC-SHA256 в заголовке X-Webhook-Signature вида t=<время>,v1=<подпись>,
+// @Description где подпись вычисляется от строки "<время>.<тело>". Секрет возвращается только в ответе на этот запрос.
+// @Tags Вебхуки
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param bodyJson body WebhookBody true "Вебхук"
+// @Success 201 {object} WebhookResponse
+// @Failure 400 {object} schema.Response
+// @Failure 401 {object} schema.Response
+// @Failure 500 {object} schema.Response
+// @Router /api/webhooks/ [post]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст HTTP-запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func createWebhook(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+
+	user, err := jwt.GetUserHandler(c)
+	if err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 401)
+		return c.Status(401).JSON(jwt.GetErrorTokenResponse(err))
+	}
+
+	body := new(WebhookBody)
+	if err := c.BodyParser(body); err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
+	events, ok := parseEvents(body.Events)
+	if !ok || !validURL(body.URL) {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
+
+	secret, err := hooks.NewSecret()
+	if err != nil {
+		slog.Error(LOGGER_HANDLER, err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+		return c.Status(500).JSON(schema.GetError500Response())
+	}
+	webhook := models.Webhook{UserID: user.ID, URL: body.URL, Secret: secret, Events: strings.Join(events, ",")}
+	if err := localDb.Create(&webhook).Error; err != nil {
+		slog.Error(LOGGER_HANDLER, err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+		return c.Status(500).JSON(schema.GetError500Response())
+	}
+
+	response := GetWebhookResponse(webhook)
+	response.Secret = webhook.Secret
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 201)
+	return c.Status(201).JSON(response)
+}
+
+// deleteWebhook удаляет вебхук.
+//
+// @Summary Удалить вебхук
+// @Description Удаляет вебхук. Неотправленные события этого вебхука переносятся в журнал недоставленных.
+// @Tags Вебхуки
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "ID вебхука"
+// @Success 200 {object} schema.Response
+// @Failure 400 {object} schema.Response
+// @Failure 401 {object} schema.Response
+// @Failure 403 {object} schema.Response
+// @Failure 404 {object} schema.Response
+// @Failure 500 {object} schema.Response
+// @Router /api/webhooks/{id} [delete]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст HTTP-запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func deleteWebhook(c *fiber.Ctx) error {
+	webhook, failure := getWebhook(c)
+	if failure.Code != 200 {
+		return c.Status(failure.Code).JSON(failure)
+	}
+
+	if err := localDb.Delete(&webhook).Error; err != nil {
+		slog.Error(LOGGER_HANDLER, err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+		return c.Status(500).JSON(schema.GetError500Response())
+	}
+
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.JSON(schema.GetSuccess200Response())
+}
+
+// listDeliveries возвращает отправки вебхука.
+//
+// @Summary Список отправок вебхука
+// @Description Возвращает последние отправки вебхука, новые первыми. Отправки, не доставленные
+// @Description за WEBHOOK_MAX_ATTEMPTS попыток, имеют статус dead и образуют журнал недоставленных событий.
+// @Tags Вебхуки
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "ID вебхука"
+// @Param status query string false "pending, delivered или dead"
+// @Param limit query int false "Число отправок" default(50)
+// @Success 200 {array} DeliveryResponse
+// @Failure 400 {object} schema.Response
+// @Failure 401 {object} schema.Response
+// @Failure 403 {object} schema.Response
+// @Failure 404 {object} schema.Response
+// @Failure 500 {object} schema.Response
+// @Router /api/webhooks/{id}/deliveries [get]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст HTTP-запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func listDeliveries(c *fiber.Ctx) error {
+	query := new(DeliveriesQuery)
+	if err := c.QueryParser(query); err != nil || query.Limit < 0 || query.Limit > MAX_DELIVERIES_LIMIT {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
+	switch query.Status {
+	case "", hooks.STATUS_PENDING, hooks.STATUS_DELIVERED, hooks.STATUS_DEAD:
+	default:
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
+	if query.Limit == 0 {
+		query.Limit = DEFAULT_DELIVERIES_LIMIT
+	}
+
+	webhook, failure := getWebhook(c)
+	if failure.Code != 200 {
+		return c.Status(failure.Code).JSON(failure)
+	}
+
+	var deliveries []models.WebhookDelivery
+	db := localDb.Where("webhook_id = ?", webhook.ID)
+	if query.Status != "" {
+		db = db.Where("status = ?", query.Status)
+	}
+	if err := db.Order("id DESC").Limit(query.Limit).Find(&deliveries).Error; err != nil {
+		slog.Error(LOGGER_HANDLER, err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+		return c.Status(500).JSON(schema.GetError500Response())
+	}
+
+	response := make([]DeliveryResponse, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		response = append(response, GetDeliveryResponse(delivery))
+	}
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.JSON(response)
+}
+
+// redeliver повторно отправляет событие вебхука.
+//
+// @Summary Повторить отправку
+// @Description Ставит отправку в очередь на немедленную повторную доставку с новой серией попыток,
+// @Description в том числе из журнала недоставленных. Идентификатор события не меняется.
+// @Tags Вебхуки
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "ID вебхука"
+// @Param delivery path int true "ID отправки"
+// @Success 200 {object} DeliveryResponse
+// @Failure 400 {object} schema.Response
+// @Failure 401 {object} schema.Response
+// @Failure 403 {object} schema.Response
+// @Failure 404 {object} schema.Response
+// @Failure 500 {object} schema.Response
+// @Router /api/webhooks/{id}/deliveries/{delivery}/redeliver [post]
+//
+// Parameters:
+// - c: Указатель на объект fiber.Ctx, представляющий контекст HTTP-запроса.
+// Return type: error. Объект ошибки, если произошла ошибка при обработке запроса, в противном случае nil.
+func redeliver(c *fiber.Ctx) error {
+	webhook, failure := getWebhook(c)
+	if failure.Code != 200 {
+		return c.Status(failure.Code).JSON(failure)
+	}
+	deliveryID, err := c.ParamsInt("delivery")
+	if err != nil || deliveryID <= 0 {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return c.Status(400).JSON(schema.GetError400Response())
+	}
+
+	var delivery models.WebhookDelivery
+	if err := localDb.First(&delivery, "id = ? AND webhook_id = ?", deliveryID, webhook.ID).Error; err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 404)
+		return c.Status(404).JSON(schema.GetError404Response())
+	}
+
+	delivery, err = hooks.Redeliver(localDb, delivery)
+	if err != nil {
+		slog.Error(LOGGER_HANDLER, err)
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+		return c.Status(500).JSON(schema.GetError500Response())
+	}
+
+	utils.LoggerRequestUser(c, LOGGER_HANDLER, 200)
+	return c.JSON(GetDeliveryResponse(delivery))
+}
+
+// getWebhook loads the webhook of the :id parameter and checks that the current user
+// owns it or is an admin. The request is logged for every status but 200.
+//
+// Parameters:
+// - c: the request context.
+//
+// Returns:
+// - models.Webhook: the webhook.
+// - schema.Response: a response with code 200, or the error response to send.
+func getWebhook(c *fiber.Ctx) (models.Webhook, schema.Response) {
+	var webhook models.Webhook
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 400)
+		return webhook, errorResponse(400)
+	}
+
+	user, err := jwt.GetUserHandler(c)
+	if err != nil {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 401)
+		return webhook, jwt.GetErrorTokenResponse(err)
+	}
+
+	if err := localDb.First(&webhook, id).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.Error(LOGGER_HANDLER, err)
+			utils.LoggerRequestUser(c, LOGGER_HANDLER, 500)
+			return webhook, errorResponse(500)
+		}
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 404)
+		return webhook, errorResponse(404)
+	}
+	if webhook.UserID != user.ID && user.Role != models.ROLE_ADMIN {
+		utils.LoggerRequestUser(c, LOGGER_HANDLER, 403)
+		return webhook, errorResponse(403)
+	}
+	return webhook, schema.GetSuccess200Response()
+}
+
+// errorResponse returns the error response of a status returned by getWebhook.
+func errorResponse(status int) schema.Response {
+	switch status {
+	case 400:
+		return schema.GetError400Response()
+	case 401:
+		return schema.GetError401Response()
+	case 403:
+		return schema.GetError403Response()
+	case 404:
+		return schema.GetError404Response()
+	}
+	return schema.GetError500Response()
+}
+
+// parseEvents validates and deduplicates the subscribed events.
+func parseEvents(events []string) ([]string, bool) {
+	result := []string{}
+	seen := map[string]bool{}
+	for _, event := range events {
+		if !hooks.IsEvent(event) {
+			return nil, false
+		}
+		if !seen[event] {
+			seen[event] = true
+			result = append(result, event)
+		}
+	}
+	return result, len(result) > 0
+}
+
+// validURL reports whether a webhook URL is an absolute http or https URL whose host
+// resolves to public addresses only. Deliveries repeat the address check on every connection.
+func validURL(raw string) bool {
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), config.ConfigAll.WEBHOOK_TIMEOUT)
+	defer cancel()
+	return outbound.CheckHost(ctx, parsed.Hostname()) == nil
+}
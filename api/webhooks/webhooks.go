@@ -0,0 +1,21 @@
+package webhooks
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"urlshort.ru/m/models"
+)
+
+// Register registers the webhook routes with the provided fiber.Router.
+//
+// api: The fiber.Router instance to register.
+//
+// Return type: None.
+func Register(api fiber.Router) {
+	apiWebhooks := api.Group("/webhooks")
+	localDb = models.DATABASE
+	apiWebhooks.Get("/", listWebhooks)
+	apiWebhooks.Post("/", createWebhook)
+	apiWebhooks.Delete("/:id", deleteWebhook)
+	apiWebhooks.Get("/:id/deliveries", listDeliveries)
+	apiWebhooks.Post("/:id/deliveries/:delivery/redeliver", redeliver)
+}
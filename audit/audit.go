@@ -0,0 +1,62 @@
+package audit
+
+import (
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
+	"urlshort.ru/m/models"
+)
+
+const LOGGER_HANDLER = "audit"
+
+// Actions of audit entries.
+const (
+	ACTION_LOGIN_LOCKOUT = "login.lockout"
+	ACTION_LOGIN_UNLOCK  = "login.unlock"
+
+	ACTION_EMAIL_VERIFIED = "email.verified"
+	ACTION_PASSWORD_RESET = "password.reset"
+
+	ACTION_TWO_FACTOR_ENABLED  = "two_factor.enabled"
+	ACTION_TWO_FACTOR_DISABLED = "two_factor.disabled"
+	ACTION_RECOVERY_CODE_USED  = "two_factor.recovery_code"
+	ACTION_TWO_FACTOR_POLICY   = "two_factor.policy"
+)
+
+// LIST_LIMIT is the default and maximum number of entries returned by List.
+const LIST_LIMIT = 100
+
+// Record stores an audit entry. Entries are also logged, so a failed insert is not lost.
+//
+// Parameters:
+// - db: the database.
+// - entry: the entry, Action is required.
+//
+// Returns:
+// - error: a database error.
+func Record(db *gorm.DB, entry models.AuditEntry) error {
+	slog.Info(LOGGER_HANDLER, "action", entry.Action, "subject", entry.Subject, "ip", entry.IP, "detail", entry.Detail)
+	return db.Create(&entry).Error
+}
+
+// List returns the latest audit entries, newest first.
+//
+// Parameters:
+// - db: the database.
+// - action: the action to filter by, empty for all.
+// - limit: the number of entries, at most LIST_LIMIT.
+//
+// Returns:
+// - []models.AuditEntry: the entries.
+// - error: a database error.
+func List(db *gorm.DB, action string, limit int) ([]models.AuditEntry, error) {
+	if limit < 1 || limit > LIST_LIMIT {
+		limit = LIST_LIMIT
+	}
+	query := db.Order("id DESC").Limit(limit)
+	if action != "" {
+		query = query.Where("action = ?", action)
+	}
+	var entries []models.AuditEntry
+	err := query.Find(&entries).Error
+	return entries, err
+}
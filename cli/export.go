@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"urlshort.ru/m/export"
+	"urlshort.ru/m/models"
+	"urlshort.ru/m/stats"
+	"urlshort.ru/m/tags"
+)
+
+// Export runs the export command, which writes clicks to a file or to stdout.
+//
+//	urlshort export -format parquet -link 1a -from 2023-08-01 -to 2023-09-01 -out clicks.parquet
+//	urlshort export -format ndjson -tag campaign-2023 -out clicks.ndjson
+//
+// Parameters:
+// - args: the command line arguments after "export".
+//
+// Returns:
+// - int: the exit code.
+func Export(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", export.FORMAT_CSV, "output format: csv, ndjson or parquet")
+	link := flags.String("link", "", "short URL of the link to export")
+	user := flags.Uint("user", 0, "ID of the user whose links are exported")
+	tag := flags.String("tag", "", "tag of the links to export")
+	from := flags.String("from", "", "start of the range, RFC3339 or YYYY-MM-DD")
+	to := flags.String("to", "", "exclusive end of the range, RFC3339 or YYYY-MM-DD")
+	out := flags.String("out", "", "output file, stdout if empty")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if !export.IsFormat(*format) {
+		fmt.Fprintln(os.Stderr, export.ErrInvalidFormat, *format)
+		return 2
+	}
+
+	filter := export.Filter{UserID: uint(*user)}
+	var err error
+	if *tag != "" {
+		if filter.Tag, err = tags.NormalizeTag(*tag); err != nil {
+			fmt.Fprintln(os.Stderr, "invalid -tag:", err)
+			return 2
+		}
+	}
+	if filter.From, err = stats.ParseTime(*from, time.Time{}); err != nil {
+		fmt.Fprintln(os.Stderr, "invalid -from:", err)
+		return 2
+	}
+	if filter.To, err = stats.ParseTime(*to, time.Time{}); err != nil {
+		fmt.Fprintln(os.Stderr, "invalid -to:", err)
+		return 2
+	}
+	if *link != "" {
+		var url models.URL
+		if err := models.DATABASE.First(&url, "short_url = ?", *link).Error; err != nil {
+			fmt.Fprintln(os.Stderr, "link not found:", *link)
+			return 1
+		}
+		filter.URLID = url.ID
+	}
+
+	var output io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer file.Close()
+		output = file
+	}
+	buffered := bufio.NewWriter(output)
+
+	count, err := export.Write(models.DATABASE, buffered, *format, filter)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "exported %d clicks\n", count)
+	return 0
+}
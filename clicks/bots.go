@@ -0,0 +1,170 @@
+package clicks
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/models"
+)
+
+//go:embed bots.txt
+var defaultSignatures string
+
+// BotSignature is a User-Agent token of automated traffic.
+type BotSignature struct {
+	Traffic string
+	Token   string
+}
+
+// ParseBotSignatures reads a signature list with one "<class> <token>" pair per line.
+// Empty lines and lines starting with "#" are skipped.
+//
+// Parameters:
+// - reader: the signature list.
+//
+// Returns:
+// - []BotSignature: the signatures in list order, tokens lowercased.
+// - error: an error for an unknown class or a malformed line.
+func ParseBotSignatures(reader io.Reader) ([]BotSignature, error) {
+	signatures := []BotSignature{}
+	scanner := bufio.NewScanner(reader)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		traffic, token, ok := strings.Cut(text, " ")
+		token = strings.TrimSpace(token)
+		if !ok || token == "" || (traffic != models.TRAFFIC_BOT && traffic != models.TRAFFIC_PREVIEW) {
+			return nil, fmt.Errorf("line %d: invalid signature %q", line, text)
+		}
+		signatures = append(signatures, BotSignature{Traffic: traffic, Token: strings.ToLower(token)})
+	}
+	return signatures, scanner.Err()
+}
+
+// BotDetector classifies clicks as human, bot or preview traffic.
+//
+// A click is automated if its User-Agent is empty or matches a signature, or if
+// its IP made more than hitsPerSecond clicks in the current second. The rate is
+// tracked per process, so with prefork every child applies the limit to the
+// share of traffic it receives.
+type BotDetector struct {
+	signatures    []BotSignature
+	hitsPerSecond int
+
+	mu     sync.Mutex
+	second int64
+	hits   map[string]int
+}
+
+// NewBotDetector creates a detector.
+//
+// Parameters:
+// - signatures: the User-Agent signatures, checked in order.
+// - hitsPerSecond: the number of clicks per second from one IP above which clicks are bots, 0 disables the check.
+//
+// Returns:
+// - *BotDetector: the detector.
+func NewBotDetector(signatures []BotSignature, hitsPerSecond int) *BotDetector {
+	return &BotDetector{
+		signatures:    signatures,
+		hitsPerSecond: hitsPerSecond,
+		hits:          map[string]int{},
+	}
+}
+
+// Classify returns the traffic class of a click.
+//
+// Parameters:
+// - ipHash: the hashed IP of the visitor.
+// - userAgent: the User-Agent header value.
+// - at: the time of the click.
+//
+// Returns:
+// - string: models.TRAFFIC_HUMAN, models.TRAFFIC_BOT or models.TRAFFIC_PREVIEW.
+func (d *BotDetector) Classify(ipHash string, userAgent string, at time.Time) string {
+	// Every click is counted, so a client sending a browser User-Agent cannot
+	// hide a burst behind interleaved bot requests.
+	burst := d.count(ipHash, at)
+
+	if strings.TrimSpace(userAgent) == "" {
+		return models.TRAFFIC_BOT
+	}
+	lower := strings.ToLower(userAgent)
+	for _, signature := range d.signatures {
+		if strings.Contains(lower, signature.Token) {
+			return signature.Traffic
+		}
+	}
+	if burst {
+		return models.TRAFFIC_BOT
+	}
+	return models.TRAFFIC_HUMAN
+}
+
+// count records a hit of the IP and reports whether it exceeds the rate limit.
+func (d *BotDetector) count(ipHash string, at time.Time) bool {
+	if d.hitsPerSecond <= 0 {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if second := at.Unix(); second != d.second {
+		d.second = second
+		d.hits = map[string]int{}
+	}
+	d.hits[ipHash]++
+	return d.hits[ipHash] > d.hitsPerSecond
+}
+
+// Bots is the detector used by NewClick.
+var Bots = NewBotDetector(mustParseSignatures(defaultSignatures), 0)
+
+// LoadBots creates the Bots detector from the built-in signatures, the optional
+// BOT_SIGNATURES_PATH file, whose entries are checked first, and BOT_HITS_PER_SECOND.
+//
+// Returns:
+// - error: an error if the signature file could not be read, in which case the built-in list is used.
+func LoadBots() error {
+	signatures := mustParseSignatures(defaultSignatures)
+	var err error
+	if path := config.ConfigAll.BOT_SIGNATURES_PATH; path != "" {
+		var custom []BotSignature
+		custom, err = readSignatureFile(path)
+		if err == nil {
+			signatures = append(custom, signatures...)
+		}
+	}
+	Bots = NewBotDetector(signatures, config.ConfigAll.BOT_HITS_PER_SECOND)
+	return err
+}
+
+// readSignatureFile parses a signature list file.
+func readSignatureFile(path string) ([]BotSignature, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseBotSignatures(file)
+}
+
+// mustParseSignatures parses the built-in signature list.
+func mustParseSignatures(list string) []BotSignature {
+	signatures, err := ParseBotSignatures(strings.NewReader(list))
+	if err != nil {
+		panic(err)
+	}
+	return signatures
+}
@@ -0,0 +1,54 @@
+package clicks
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+
+	"golang.org/x/exp/slog"
+	"urlshort.ru/m/config"
+)
+
+// CLICK_ID_BYTES is the number of random bytes in a click ID.
+const CLICK_ID_BYTES = 16
+
+// NewClickID returns a random opaque click ID.
+//
+// Returns:
+// - string: the hex encoded ID, empty if the system random source failed.
+func NewClickID() string {
+	id := make([]byte, CLICK_ID_BYTES)
+	if _, err := rand.Read(id); err != nil {
+		slog.Error(LOGGER_HANDLER, err)
+		return ""
+	}
+	return hex.EncodeToString(id)
+}
+
+// AppendClickID adds the click ID to the query of a destination as the CLICK_ID_PARAM parameter.
+//
+// The existing query is kept as is, so parameters the destination relies on are not
+// reordered or re-encoded.
+//
+// Parameters:
+// - destination: the URL the visitor is sent to.
+// - clickID: the click ID, empty if the click has none.
+//
+// Returns:
+// - string: the destination with the click ID, or the unchanged destination if there is
+// no click ID or the destination cannot be parsed.
+func AppendClickID(destination string, clickID string) string {
+	param := config.ConfigAll.CLICK_ID_PARAM
+	if clickID == "" || param == "" {
+		return destination
+	}
+	parsed, err := url.Parse(destination)
+	if err != nil {
+		return destination
+	}
+	if parsed.RawQuery != "" {
+		parsed.RawQuery += "&"
+	}
+	parsed.RawQuery += url.QueryEscape(param) + "=" + url.QueryEscape(clickID)
+	return parsed.String()
+}
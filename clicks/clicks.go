@@ -0,0 +1,277 @@
+package clicks
+
+import (
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/geo"
+	"urlshort.ru/m/models"
+	"urlshort.ru/m/privacy"
+	"urlshort.ru/m/stats"
+	"urlshort.ru/m/utils"
+	"urlshort.ru/m/webhooks"
+)
+
+const LOGGER_HANDLER = "clicks"
+
+const MAX_FIELD_LENGTH = 1024
+
+// Visit holds the request data a click is built from.
+type Visit struct {
+	IP             string
+	Referrer       string
+	UserAgent      string
+	AcceptLanguage string
+	// DoNotTrack is set when the visitor opted out with the DNT or Sec-GPC header.
+	DoNotTrack bool
+	// Location is set when the caller already resolved the IP, otherwise it is looked up.
+	Location *geo.Location
+}
+
+// Locator resolves an IP address to the place it is registered in.
+type Locator interface {
+	Lookup(ip string) geo.Location
+}
+
+// Geo is the configured IP locator. It is nil when no geo database is configured,
+// in which case clicks are stored without a location.
+var Geo Locator
+
+// Locate resolves an IP address with the configured locator.
+// Without a geo database the location is empty.
+func Locate(ip string) geo.Location {
+	if Geo == nil {
+		return geo.Location{}
+	}
+	return Geo.Lookup(ip)
+}
+
+// VisitorHash identifies a visitor by the hashed IP and the User-Agent header.
+// It is used to count unique clicks.
+func VisitorHash(ipHash string, userAgent string) string {
+	return utils.GenerateShortHashSHA256(ipHash + "|" + userAgent)
+}
+
+// ParseLanguage returns the primary language of the most preferred Accept-Language entry.
+//
+// For "ru-RU,ru;q=0.9,en;q=0.8" it returns "ru".
+func ParseLanguage(acceptLanguage string) string {
+	first := strings.Split(acceptLanguage, ",")[0]
+	first = strings.TrimSpace(strings.Split(first, ";")[0])
+	first = strings.Split(first, "-")[0]
+	if first == "*" {
+		return ""
+	}
+	return strings.ToLower(first)
+}
+
+// NewClick builds a click row for a redirect.
+//
+// The IP is anonymized according to PRIVACY_IP_MODE. Clicks of visitors who opted out and
+// clicks on links with NoTracking are anonymous: only the destination, the time and the
+// traffic class are kept, so they count towards totals but not towards visitors or breakdowns.
+// Other clicks get a click ID when CLICK_ID_ENABLED is set, anonymous clicks never do.
+//
+// Parameters:
+// - url: the followed link.
+// - destination: the URL the visitor was sent to.
+// - fallback: true if the destination is the fallback URL.
+// - visit: the request data.
+//
+// Returns:
+// - models.Click: the click, not yet stored.
+func NewClick(url models.URL, destination string, fallback bool, visit Visit) models.Click {
+	now := time.Now()
+	ipHash := privacy.AnonymizeIP(visit.IP, now)
+	traffic := Bots.Classify(ipHash, visit.UserAgent, now)
+
+	if visit.DoNotTrack || url.NoTracking {
+		click := models.Click{
+			URLID:       url.ID,
+			Destination: destination,
+			Fallback:    fallback,
+			Traffic:     traffic,
+			Anonymous:   true,
+		}
+		click.CreatedAt = now
+		return click
+	}
+
+	agent := ParseUserAgent(visit.UserAgent)
+	click := models.Click{
+		URLID:       url.ID,
+		Destination: destination,
+		Fallback:    fallback,
+		IPHash:      ipHash,
+		VisitorHash: VisitorHash(ipHash, visit.UserAgent),
+		Referrer:    truncate(visit.Referrer),
+		UserAgent:   truncate(visit.UserAgent),
+		Browser:     agent.Browser,
+		OS:          agent.OS,
+		Device:      agent.Device,
+		Language:    ParseLanguage(visit.AcceptLanguage),
+		Traffic:     traffic,
+	}
+	click.CreatedAt = now
+	if config.ConfigAll.CLICK_ID_ENABLED {
+		click.ClickID = NewClickID()
+	}
+	location := visit.Location
+	if location == nil {
+		resolved := Locate(visit.IP)
+		location = &resolved
+	}
+	click.Country, click.Region, click.City = location.Country, location.Region, location.City
+	return click
+}
+
+// Record stores a single click synchronously and updates the denormalized counters of its link.
+//
+// Parameters:
+// - db: the database to store the click in.
+// - click: the click to store, FirstVisit is set by Record.
+//
+// Returns:
+// - error: an error if the click could not be stored.
+func Record(db *gorm.DB, click *models.Click) error {
+	batch := []models.Click{*click}
+	if err := WriteBatch(db, batch); err != nil {
+		return err
+	}
+	*click = batch[0]
+	return nil
+}
+
+// WriteBatch stores clicks in one transaction and updates the counters of their links.
+// Human clicks are counted in total_clicks and unique_clicks, bot and preview clicks in bot_clicks.
+//
+// Unique visitors are claimed through the click_visitors primary key and counters are
+// incremented in SQL, so concurrent writers in different prefork children never
+// overwrite each other's counts.
+//
+// Parameters:
+// - db: the database to store the clicks in.
+// - batch: the clicks to store, FirstVisit is set for every click.
+//
+// Returns:
+// - error: an error if the batch could not be stored, in which case nothing is stored.
+// A stored batch is passed to the click webhooks of the link owners.
+func WriteBatch(db *gorm.DB, batch []models.Click) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		type counters struct{ total, unique, bots int64 }
+		perURL := map[uint]*counters{}
+
+		for i := range batch {
+			// Anonymous clicks have no visitor and are never a first visit.
+			if batch[i].VisitorHash != "" {
+				visitor := models.ClickVisitor{URLID: batch[i].URLID, VisitorHash: batch[i].VisitorHash}
+				result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&visitor)
+				if result.Error != nil {
+					return result.Error
+				}
+				batch[i].FirstVisit = result.RowsAffected > 0
+			}
+
+			count, ok := perURL[batch[i].URLID]
+			if !ok {
+				count = &counters{}
+				perURL[batch[i].URLID] = count
+			}
+			switch {
+			case batch[i].Traffic != "" && batch[i].Traffic != models.TRAFFIC_HUMAN:
+				count.bots++
+			case batch[i].FirstVisit:
+				count.total++
+				count.unique++
+			default:
+				count.total++
+			}
+		}
+
+		if err := tx.CreateInBatches(batch, 100).Error; err != nil {
+			return err
+		}
+		if err := stats.Rollup(tx, batch); err != nil {
+			return err
+		}
+		if err := stats.UpdateSketches(tx, batch); err != nil {
+			return err
+		}
+
+		for urlID, count := range perURL {
+			err := tx.Model(&models.URL{}).Where("id = ?", urlID).Updates(map[string]any{
+				"total_clicks":  gorm.Expr("total_clicks + ?", count.total),
+				"unique_clicks": gorm.Expr("unique_clicks + ?", count.unique),
+				"bot_clicks":    gorm.Expr("bot_clicks + ?", count.bots),
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	webhooks.NotifyClicks(db, batch)
+	return nil
+}
+
+// truncate limits stored header values to MAX_FIELD_LENGTH bytes.
+func truncate(value string) string {
+	if len(value) > MAX_FIELD_LENGTH {
+		return value[:MAX_FIELD_LENGTH]
+	}
+	return value
+}
+
+// Default is the pipeline used by the redirect handler. It is nil until Start is called,
+// in which case clicks are recorded synchronously.
+var Default *Pipeline
+
+// Start creates the Default pipeline from the config.
+//
+// Parameters:
+// - db: the database to write clicks to.
+func Start(db *gorm.DB) {
+	Default = NewPipeline(db, PipelineOptions{
+		QueueSize:      config.ConfigAll.CLICK_QUEUE_SIZE,
+		BatchSize:      config.ConfigAll.CLICK_BATCH_SIZE,
+		FlushInterval:  config.ConfigAll.CLICK_FLUSH_INTERVAL,
+		DropPolicy:     config.ConfigAll.CLICK_DROP_POLICY,
+		EnqueueTimeout: config.ConfigAll.CLICK_ENQUEUE_TIMEOUT,
+	})
+}
+
+// Stop flushes and closes the Default pipeline.
+//
+// Returns:
+// - error: an error if the final flush did not finish within SHUTDOWN_TIMEOUT.
+func Stop() error {
+	if Default == nil {
+		return nil
+	}
+	return Default.Close(config.ConfigAll.SHUTDOWN_TIMEOUT)
+}
+
+// Track stores a click through the Default pipeline, or synchronously when no pipeline is running.
+//
+// Parameters:
+// - db: the database used for synchronous writes.
+// - click: the click to store.
+func Track(db *gorm.DB, click models.Click) {
+	if Default != nil {
+		Default.Enqueue(click)
+		return
+	}
+	if err := Record(db, &click); err != nil {
+		slog.Error(LOGGER_HANDLER, err)
+	}
+}
@@ -0,0 +1,223 @@
+package clicks_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"urlshort.ru/m/clicks"
+	"urlshort.ru/m/models"
+	"urlshort.ru/m/privacy"
+)
+
+// TestParseUserAgent tests browser, operating system and device detection.
+func TestParseUserAgent(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		want      clicks.Agent
+	}{
+		{
+			name:      "Chrome on Windows",
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.0.0 Safari/537.36",
+			want:      clicks.Agent{Browser: "Chrome", OS: "Windows", Device: clicks.DEVICE_DESKTOP},
+		},
+		{
+			name:      "Edge on Windows",
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.0.0 Safari/537.36 Edg/116.0.1938.54",
+			want:      clicks.Agent{Browser: "Edge", OS: "Windows", Device: clicks.DEVICE_DESKTOP},
+		},
+		{
+			name:      "Safari on iPhone",
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1",
+			want:      clicks.Agent{Browser: "Safari", OS: "iOS", Device: clicks.DEVICE_MOBILE},
+		},
+		{
+			name:      "Chrome on Android tablet",
+			userAgent: "Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.0.0 Safari/537.36",
+			want:      clicks.Agent{Browser: "Chrome", OS: "Android", Device: clicks.DEVICE_TABLET},
+		},
+		{
+			name:      "Firefox on Linux",
+			userAgent: "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/117.0",
+			want:      clicks.Agent{Browser: "Firefox", OS: "Linux", Device: clicks.DEVICE_DESKTOP},
+		},
+		{
+			name:      "Empty",
+			userAgent: "",
+			want:      clicks.Agent{Browser: clicks.UNKNOWN, OS: clicks.UNKNOWN, Device: clicks.DEVICE_DESKTOP},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clicks.ParseUserAgent(tt.userAgent); got != tt.want {
+				t.Errorf("ParseUserAgent() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseLanguage tests extracting the primary language from Accept-Language.
+func TestParseLanguage(t *testing.T) {
+	tests := map[string]string{
+		"ru-RU,ru;q=0.9,en;q=0.8": "ru",
+		"en":                      "en",
+		"*":                       "",
+		"":                        "",
+	}
+	for input, want := range tests {
+		if got := clicks.ParseLanguage(input); got != want {
+			t.Errorf("ParseLanguage(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+// TestRecord tests that clicks update the total and unique counters of a link.
+func TestRecord(t *testing.T) {
+	privacy.Start(models.DATABASE)
+	db := models.DATABASE
+	url := models.URL{OriginalURL: "https://example.com/clicks", ShortURL: "clicks-test"}
+	db.Unscoped().Where("short_url = ?", url.ShortURL).Delete(&models.URL{})
+	if err := db.Create(&url).Error; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	db.Unscoped().Where("url_id = ?", url.ID).Delete(&models.Click{})
+	db.Where("url_id = ?", url.ID).Delete(&models.ClickVisitor{})
+
+	visits := []clicks.Visit{
+		{IP: "10.0.0.1", UserAgent: "agent"},
+		{IP: "10.0.0.1", UserAgent: "agent"},
+		{IP: "10.0.0.2", UserAgent: "agent"},
+	}
+	for _, visit := range visits {
+		click := clicks.NewClick(url, url.OriginalURL, false, visit)
+		if click.IPHash == visit.IP {
+			t.Errorf("Expected IP to be hashed")
+		}
+		if err := clicks.Record(db, &click); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	db.First(&url, url.ID)
+	if url.TotalClicks != 3 || url.UniqueClicks != 2 {
+		t.Errorf("Expected 3 total and 2 unique clicks, got %d and %d", url.TotalClicks, url.UniqueClicks)
+	}
+}
+
+// TestPipeline tests that the pipeline writes every queued click on close
+// and rejects clicks after that.
+func TestPipeline(t *testing.T) {
+	privacy.Start(models.DATABASE)
+	db := models.DATABASE
+	url := models.URL{OriginalURL: "https://example.com/pipeline", ShortURL: "pipeline-test"}
+	db.Unscoped().Where("short_url = ?", url.ShortURL).Delete(&models.URL{})
+	if err := db.Create(&url).Error; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	db.Unscoped().Where("url_id = ?", url.ID).Delete(&models.Click{})
+	db.Where("url_id = ?", url.ID).Delete(&models.ClickVisitor{})
+
+	pipeline := clicks.NewPipeline(db, clicks.PipelineOptions{
+		QueueSize:     100,
+		BatchSize:     7,
+		FlushInterval: time.Hour,
+		DropPolicy:    clicks.POLICY_DROP_NEWEST,
+	})
+	for i := 0; i < 50; i++ {
+		visit := clicks.Visit{IP: fmt.Sprintf("10.0.0.%d", i%10), UserAgent: "agent"}
+		if !pipeline.Enqueue(clicks.NewClick(url, url.OriginalURL, false, visit)) {
+			t.Fatalf("Expected click %d to be queued", i)
+		}
+	}
+
+	if err := pipeline.Close(time.Second * 5); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if pipeline.Enqueue(clicks.NewClick(url, url.OriginalURL, false, clicks.Visit{})) {
+		t.Errorf("Expected click to be rejected after close")
+	}
+
+	stats := pipeline.Stats()
+	if stats.Written != 50 || stats.Dropped != 1 || stats.QueueDepth != 0 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	db.First(&url, url.ID)
+	if url.TotalClicks != 50 || url.UniqueClicks != 10 {
+		t.Errorf("Expected 50 total and 10 unique clicks, got %d and %d", url.TotalClicks, url.UniqueClicks)
+	}
+}
+
+// TestBotDetector tests classification by signature and by request rate.
+func TestBotDetector(t *testing.T) {
+	signatures, err := clicks.ParseBotSignatures(strings.NewReader("# comment\n\npreview TelegramBot\nbot bot\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	detector := clicks.NewBotDetector(signatures, 2)
+	now := time.Date(2023, 8, 21, 10, 0, 0, 0, time.UTC)
+	browser := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) Chrome/115.0.0.0 Safari/537.36"
+
+	tests := []struct {
+		ip        string
+		userAgent string
+		at        time.Time
+		want      string
+	}{
+		{ip: "a", userAgent: "TelegramBot (like TwitterBot)", at: now, want: models.TRAFFIC_PREVIEW},
+		{ip: "b", userAgent: "Googlebot/2.1", at: now, want: models.TRAFFIC_BOT},
+		{ip: "b", userAgent: "", at: now, want: models.TRAFFIC_BOT},
+		{ip: "c", userAgent: browser, at: now, want: models.TRAFFIC_HUMAN},
+		{ip: "c", userAgent: browser, at: now, want: models.TRAFFIC_HUMAN},
+		{ip: "c", userAgent: browser, at: now, want: models.TRAFFIC_BOT},
+		{ip: "c", userAgent: browser, at: now.Add(time.Second), want: models.TRAFFIC_HUMAN},
+	}
+	for i, tt := range tests {
+		if got := detector.Classify(tt.ip, tt.userAgent, tt.at); got != tt.want {
+			t.Errorf("%d: Classify(%q, %q) = %q, want %q", i, tt.ip, tt.userAgent, got, tt.want)
+		}
+	}
+
+	if _, err := clicks.ParseBotSignatures(strings.NewReader("robot Googlebot\n")); err == nil {
+		t.Errorf("Expected an error for an unknown class")
+	}
+}
+
+// TestAnonymousClick tests that opted out visitors and untracked links store no visitor data.
+func TestAnonymousClick(t *testing.T) {
+	visit := clicks.Visit{IP: "10.0.0.1", UserAgent: "agent", Referrer: "https://google.com/", DoNotTrack: true}
+	for _, url := range []models.URL{{}, {NoTracking: true}} {
+		if url.NoTracking {
+			visit.DoNotTrack = false
+		}
+		click := clicks.NewClick(url, "https://example.com/", false, visit)
+		if !click.Anonymous || click.IPHash != "" || click.VisitorHash != "" || click.Referrer != "" || click.UserAgent != "" {
+			t.Errorf("Expected an anonymous click, got %+v", click)
+		}
+	}
+}
+
+// TestAppendClickID tests that the click ID is added without changing the existing query.
+func TestAppendClickID(t *testing.T) {
+	tests := map[string]string{
+		"https://example.com/":                "https://example.com/?click_id=abc",
+		"https://example.com/?b=2&a=x+y#part": "https://example.com/?b=2&a=x+y&click_id=abc#part",
+		"://broken":                           "://broken",
+	}
+	for destination, want := range tests {
+		if got := clicks.AppendClickID(destination, "abc"); got != want {
+			t.Errorf("AppendClickID(%q) = %q, want %q", destination, got, want)
+		}
+	}
+	if got := clicks.AppendClickID("https://example.com/", ""); got != "https://example.com/" {
+		t.Errorf("Expected no parameter without a click ID, got %q", got)
+	}
+
+	click := clicks.NewClick(models.URL{}, "https://example.com/", false, clicks.Visit{IP: "10.0.0.1", UserAgent: "agent"})
+	if len(click.ClickID) != clicks.CLICK_ID_BYTES*2 {
+		t.Errorf("Expected a click ID, got %q", click.ClickID)
+	}
+}
@@ -0,0 +1,225 @@
+package clicks
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
+	"urlshort.ru/m/models"
+)
+
+const (
+	// POLICY_BLOCK waits up to EnqueueTimeout for free space and drops the click after that.
+	POLICY_BLOCK = "block"
+	// POLICY_DROP_NEWEST drops the incoming click when the queue is full.
+	POLICY_DROP_NEWEST = "drop_newest"
+	// POLICY_DROP_OLDEST drops the oldest queued click to make room for the incoming one.
+	POLICY_DROP_OLDEST = "drop_oldest"
+)
+
+var ErrPipelineClosed = errors.New("click pipeline is closed")
+
+// PipelineOptions configures a Pipeline.
+type PipelineOptions struct {
+	QueueSize      int
+	BatchSize      int
+	FlushInterval  time.Duration
+	DropPolicy     string
+	EnqueueTimeout time.Duration
+}
+
+// PipelineStats is a snapshot of the pipeline metrics.
+type PipelineStats struct {
+	QueueDepth    int   `json:"queue_depth"`
+	QueueCapacity int   `json:"queue_capacity"`
+	Enqueued      int64 `json:"enqueued"`
+	Dropped       int64 `json:"dropped"`
+	Written       int64 `json:"written"`
+	Failed        int64 `json:"failed"`
+	Batches       int64 `json:"batches"`
+}
+
+// Pipeline buffers clicks in memory and writes them to the database in batches,
+// so redirects never wait for SQLite.
+//
+// Every process owns its pipeline. Under prefork each child writes its own
+// batches; counters stay correct because WriteBatch only increments them in SQL.
+type Pipeline struct {
+	db      *gorm.DB
+	options PipelineOptions
+	queue   chan models.Click
+
+	mu     sync.RWMutex
+	closed bool
+	done   chan struct{}
+
+	enqueued atomic.Int64
+	dropped  atomic.Int64
+	written  atomic.Int64
+	failed   atomic.Int64
+	batches  atomic.Int64
+}
+
+// NewPipeline creates a pipeline and starts its writer.
+//
+// Parameters:
+// - db: the database to write clicks to.
+// - options: queue size, batching and drop policy.
+//
+// Returns:
+// - *Pipeline: the running pipeline.
+func NewPipeline(db *gorm.DB, options PipelineOptions) *Pipeline {
+	if options.QueueSize < 1 {
+		options.QueueSize = 1
+	}
+	if options.BatchSize < 1 {
+		options.BatchSize = 1
+	}
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = time.Second
+	}
+
+	pipeline := &Pipeline{
+		db:      db,
+		options: options,
+		queue:   make(chan models.Click, options.QueueSize),
+		done:    make(chan struct{}),
+	}
+	go pipeline.run()
+	return pipeline
+}
+
+// Enqueue adds a click to the queue according to the drop policy.
+//
+// Parameters:
+// - click: the click to store.
+//
+// Returns:
+// - bool: false if the click was dropped.
+func (p *Pipeline) Enqueue(click models.Click) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		p.dropped.Add(1)
+		return false
+	}
+
+	select {
+	case p.queue <- click:
+		p.enqueued.Add(1)
+		return true
+	default:
+	}
+
+	switch p.options.DropPolicy {
+	case POLICY_BLOCK:
+		timer := time.NewTimer(p.options.EnqueueTimeout)
+		defer timer.Stop()
+		select {
+		case p.queue <- click:
+			p.enqueued.Add(1)
+			return true
+		case <-timer.C:
+		}
+	case POLICY_DROP_OLDEST:
+		select {
+		case <-p.queue:
+			p.dropped.Add(1)
+		default:
+		}
+		select {
+		case p.queue <- click:
+			p.enqueued.Add(1)
+			return true
+		default:
+		}
+	}
+
+	p.dropped.Add(1)
+	return false
+}
+
+// Close stops accepting clicks and waits until every queued click is written
+// or the timeout expires.
+//
+// Parameters:
+// - timeout: the maximum time to wait for the final flush.
+//
+// Returns:
+// - error: an error if the flush did not finish in time.
+func (p *Pipeline) Close(timeout time.Duration) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-p.done:
+		return nil
+	case <-time.After(timeout):
+		return errors.New("click pipeline flush timed out")
+	}
+}
+
+// Stats returns a snapshot of the pipeline metrics.
+func (p *Pipeline) Stats() PipelineStats {
+	return PipelineStats{
+		QueueDepth:    len(p.queue),
+		QueueCapacity: cap(p.queue),
+		Enqueued:      p.enqueued.Load(),
+		Dropped:       p.dropped.Load(),
+		Written:       p.written.Load(),
+		Failed:        p.failed.Load(),
+		Batches:       p.batches.Load(),
+	}
+}
+
+// run collects clicks into batches and flushes them when a batch is full,
+// on every flush interval and once more when the queue is closed.
+func (p *Pipeline) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.options.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.Click, 0, p.options.BatchSize)
+	for {
+		select {
+		case click, ok := <-p.queue:
+			if !ok {
+				p.flush(batch)
+				return
+			}
+			batch = append(batch, click)
+			if len(batch) >= p.options.BatchSize {
+				p.flush(batch)
+				batch = make([]models.Click, 0, p.options.BatchSize)
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				p.flush(batch)
+				batch = make([]models.Click, 0, p.options.BatchSize)
+			}
+		}
+	}
+}
+
+// flush writes a batch and updates the metrics.
+func (p *Pipeline) flush(batch []models.Click) {
+	if len(batch) == 0 {
+		return
+	}
+	p.batches.Add(1)
+	if err := WriteBatch(p.db, batch); err != nil {
+		p.failed.Add(int64(len(batch)))
+		slog.Error(LOGGER_HANDLER, "batch", len(batch), "error", err)
+		return
+	}
+	p.written.Add(int64(len(batch)))
+	slog.Debug(LOGGER_HANDLER, "batch", len(batch), "queue", len(p.queue))
+}
@@ -0,0 +1,81 @@
+package clicks
+
+import "strings"
+
+const (
+	DEVICE_DESKTOP = "desktop"
+	DEVICE_MOBILE  = "mobile"
+	DEVICE_TABLET  = "tablet"
+
+	UNKNOWN = "Other"
+)
+
+// Agent is the browser, operating system and device parsed from a User-Agent header.
+type Agent struct {
+	Browser string
+	OS      string
+	Device  string
+}
+
+type signature struct {
+	tokens []string
+	name   string
+}
+
+// browsers is checked in order, since most browsers also mention the engines they are based on.
+var browsers = []signature{
+	{tokens: []string{"Edg/", "EdgA/", "EdgiOS/", "Edge/"}, name: "Edge"},
+	{tokens: []string{"OPR/", "Opera"}, name: "Opera"},
+	{tokens: []string{"YaBrowser/"}, name: "Yandex Browser"},
+	{tokens: []string{"SamsungBrowser/"}, name: "Samsung Internet"},
+	{tokens: []string{"Firefox/", "FxiOS/"}, name: "Firefox"},
+	{tokens: []string{"Chrome/", "CriOS/", "Chromium/"}, name: "Chrome"},
+	{tokens: []string{"Safari/"}, name: "Safari"},
+	{tokens: []string{"MSIE ", "Trident/"}, name: "Internet Explorer"},
+}
+
+var systems = []signature{
+	{tokens: []string{"Windows"}, name: "Windows"},
+	{tokens: []string{"iPhone", "iPad", "iPod"}, name: "iOS"},
+	{tokens: []string{"Android"}, name: "Android"},
+	{tokens: []string{"CrOS"}, name: "Chrome OS"},
+	{tokens: []string{"Macintosh", "Mac OS X"}, name: "macOS"},
+	{tokens: []string{"Linux", "X11"}, name: "Linux"},
+}
+
+// ParseUserAgent extracts the browser, operating system and device type from a User-Agent header.
+//
+// Parameters:
+// - userAgent: the User-Agent header value.
+//
+// Returns:
+// - Agent: the parsed values, UNKNOWN for anything not recognized.
+func ParseUserAgent(userAgent string) Agent {
+	agent := Agent{
+		Browser: match(browsers, userAgent),
+		OS:      match(systems, userAgent),
+		Device:  DEVICE_DESKTOP,
+	}
+
+	switch {
+	case strings.Contains(userAgent, "iPad") || strings.Contains(userAgent, "Tablet"):
+		agent.Device = DEVICE_TABLET
+	case strings.Contains(userAgent, "Android") && !strings.Contains(userAgent, "Mobile"):
+		agent.Device = DEVICE_TABLET
+	case strings.Contains(userAgent, "Mobi") || strings.Contains(userAgent, "iPhone") || strings.Contains(userAgent, "iPod"):
+		agent.Device = DEVICE_MOBILE
+	}
+	return agent
+}
+
+// match returns the name of the first signature with a token contained in the header.
+func match(signatures []signature, userAgent string) string {
+	for _, item := range signatures {
+		for _, token := range item.tokens {
+			if strings.Contains(userAgent, token) {
+				return item.name
+			}
+		}
+	}
+	return UNKNOWN
+}
@@ -2,8 +2,12 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	_ "time/tzdata"
+
 	"github.com/joho/godotenv"
 	"golang.org/x/exp/slog"
 	"urlshort.ru/m/logs"
@@ -14,10 +18,114 @@ type Config struct {
 	LOGGER_LEVEL   string `env:"LOGGER_LEVEL"`
 	SECRET_KEY_JWT string `env:"SECRET_KEY_JWT"`
 	TIME_ZONE      string `env:"TIME_ZONE"`
+	LOCATION       *time.Location
+
+	JWT_ISSUER       string        `env:"JWT_ISSUER"`
+	JWT_AUDIENCE     string        `env:"JWT_AUDIENCE"`
+	JWT_LEEWAY       time.Duration `env:"JWT_LEEWAY"`
+	JWT_LEGACY_UNTIL time.Time     `env:"JWT_LEGACY_UNTIL"`
+	JWT_HS256_UNTIL  time.Time     `env:"JWT_HS256_UNTIL"`
+	JWT_KEYS_FILE    string        `env:"JWT_KEYS_FILE"`
+	JWT_KEYS_RELOAD  time.Duration `env:"JWT_KEYS_RELOAD"`
+
+	JWT_REVOCATION_CACHE time.Duration `env:"JWT_REVOCATION_CACHE"`
+	JWT_DENYLIST_PURGE   time.Duration `env:"JWT_DENYLIST_PURGE"`
+
+	PASSWORD_ARGON2_TIME    int `env:"PASSWORD_ARGON2_TIME"`
+	PASSWORD_ARGON2_MEMORY  int `env:"PASSWORD_ARGON2_MEMORY"`
+	PASSWORD_ARGON2_THREADS int `env:"PASSWORD_ARGON2_THREADS"`
+
+	LOGIN_FAILURE_WINDOW      time.Duration `env:"LOGIN_FAILURE_WINDOW"`
+	LOGIN_DELAY_AFTER         int           `env:"LOGIN_DELAY_AFTER"`
+	LOGIN_DELAY_BASE          time.Duration `env:"LOGIN_DELAY_BASE"`
+	LOGIN_DELAY_MAX           time.Duration `env:"LOGIN_DELAY_MAX"`
+	LOGIN_LOCKOUT_FAILURES    int           `env:"LOGIN_LOCKOUT_FAILURES"`
+	LOGIN_IP_LOCKOUT_FAILURES int           `env:"LOGIN_IP_LOCKOUT_FAILURES"`
+	LOGIN_LOCKOUT_DURATION    time.Duration `env:"LOGIN_LOCKOUT_DURATION"`
+
+	EMAIL_VERIFICATION_REQUIRED bool          `env:"EMAIL_VERIFICATION_REQUIRED"`
+	EMAIL_VERIFY_TTL            time.Duration `env:"EMAIL_VERIFY_TTL"`
+	PASSWORD_RESET_TTL          time.Duration `env:"PASSWORD_RESET_TTL"`
+	MAIL_VERIFY_URL             string        `env:"MAIL_VERIFY_URL"`
+	MAIL_RESET_URL              string        `env:"MAIL_RESET_URL"`
+
+	TOTP_ISSUER              string        `env:"TOTP_ISSUER"`
+	TOTP_SKEW                int           `env:"TOTP_SKEW"`
+	TOTP_RECOVERY_CODES      int           `env:"TOTP_RECOVERY_CODES"`
+	TWO_FACTOR_CHALLENGE_TTL time.Duration `env:"TWO_FACTOR_CHALLENGE_TTL"`
+
+	MAIL_DRIVER        string `env:"MAIL_DRIVER"`
+	MAIL_FROM          string `env:"MAIL_FROM"`
+	MAIL_OUTBOX_DIR    string `env:"MAIL_OUTBOX_DIR"`
+	MAIL_TEMPLATES_DIR string `env:"MAIL_TEMPLATES_DIR"`
+	SMTP_HOST          string `env:"SMTP_HOST"`
+	SMTP_PORT          int    `env:"SMTP_PORT"`
+	SMTP_USERNAME      string `env:"SMTP_USERNAME"`
+	SMTP_PASSWORD      string `env:"SMTP_PASSWORD"`
+
+	HEALTH_CHECK_INTERVAL time.Duration `env:"HEALTH_CHECK_INTERVAL"`
+	HEALTH_CHECK_TIMEOUT  time.Duration `env:"HEALTH_CHECK_TIMEOUT"`
+
+	SCREENING_DENY_DOMAINS      []string `env:"SCREENING_DENY_DOMAINS"`
+	SCREENING_ALLOW_DOMAINS     []string `env:"SCREENING_ALLOW_DOMAINS"`
+	SCREENING_PROTECTED_DOMAINS []string `env:"SCREENING_PROTECTED_DOMAINS"`
+	SCREENING_SHORTENERS        []string `env:"SCREENING_SHORTENERS"`
+	THREAT_LIST_PATH            string   `env:"THREAT_LIST_PATH"`
+	THREAT_LIST_FORMAT          string   `env:"THREAT_LIST_FORMAT"`
+
+	SERVICE_DOMAINS       []string      `env:"SERVICE_DOMAINS"`
+	SHORTENER_CHAIN_DEPTH int           `env:"SHORTENER_CHAIN_DEPTH"`
+	SHORTENER_TIMEOUT     time.Duration `env:"SHORTENER_TIMEOUT"`
+
+	CLICK_SALT            string        `env:"CLICK_SALT"`
+	CLICK_QUEUE_SIZE      int           `env:"CLICK_QUEUE_SIZE"`
+	CLICK_BATCH_SIZE      int           `env:"CLICK_BATCH_SIZE"`
+	CLICK_FLUSH_INTERVAL  time.Duration `env:"CLICK_FLUSH_INTERVAL"`
+	CLICK_DROP_POLICY     string        `env:"CLICK_DROP_POLICY"`
+	CLICK_ENQUEUE_TIMEOUT time.Duration `env:"CLICK_ENQUEUE_TIMEOUT"`
+	SHUTDOWN_TIMEOUT      time.Duration `env:"SHUTDOWN_TIMEOUT"`
+	HLL_ERROR_RATE        float64       `env:"HLL_ERROR_RATE"`
+	BOT_SIGNATURES_PATH   string        `env:"BOT_SIGNATURES_PATH"`
+	BOT_HITS_PER_SECOND   int           `env:"BOT_HITS_PER_SECOND"`
+	GEO_DB_PATH           string        `env:"GEO_DB_PATH"`
+	GEO_RELOAD_INTERVAL   time.Duration `env:"GEO_RELOAD_INTERVAL"`
+
+	PRIVACY_IP_MODE          string        `env:"PRIVACY_IP_MODE"`
+	PRIVACY_HONOR_DNT        bool          `env:"PRIVACY_HONOR_DNT"`
+	CLICK_RETENTION_DAYS     int           `env:"CLICK_RETENTION_DAYS"`
+	CLICK_RETENTION_MODE     string        `env:"CLICK_RETENTION_MODE"`
+	CLICK_RETENTION_INTERVAL time.Duration `env:"CLICK_RETENTION_INTERVAL"`
+
+	CLICK_ID_ENABLED bool   `env:"CLICK_ID_ENABLED"`
+	CLICK_ID_PARAM   string `env:"CLICK_ID_PARAM"`
+
+	WEBHOOK_TIMEOUT       time.Duration `env:"WEBHOOK_TIMEOUT"`
+	WEBHOOK_MAX_ATTEMPTS  int           `env:"WEBHOOK_MAX_ATTEMPTS"`
+	WEBHOOK_RETRY_BASE    time.Duration `env:"WEBHOOK_RETRY_BASE"`
+	WEBHOOK_RETRY_MAX     time.Duration `env:"WEBHOOK_RETRY_MAX"`
+	WEBHOOK_POLL_INTERVAL time.Duration `env:"WEBHOOK_POLL_INTERVAL"`
+	WEBHOOK_BATCH_SIZE    int           `env:"WEBHOOK_BATCH_SIZE"`
+
+	LIVE_POLL_INTERVAL time.Duration `env:"LIVE_POLL_INTERVAL"`
+	LIVE_HEARTBEAT     time.Duration `env:"LIVE_HEARTBEAT"`
+	LIVE_REPLAY_LIMIT  int           `env:"LIVE_REPLAY_LIMIT"`
+
+	ANOMALY_INTERVAL          time.Duration `env:"ANOMALY_INTERVAL"`
+	ANOMALY_BASELINE_HOURS    int           `env:"ANOMALY_BASELINE_HOURS"`
+	ANOMALY_MIN_CLICKS        int64         `env:"ANOMALY_MIN_CLICKS"`
+	ANOMALY_FACTOR            float64       `env:"ANOMALY_FACTOR"`
+	ANOMALY_SIGMA             float64       `env:"ANOMALY_SIGMA"`
+	ANOMALY_ACTION            string        `env:"ANOMALY_ACTION"`
+	ANOMALY_THROTTLE_RATE     int           `env:"ANOMALY_THROTTLE_RATE"`
+	ANOMALY_THROTTLE_DURATION time.Duration `env:"ANOMALY_THROTTLE_DURATION"`
+	ANOMALY_ALERT_EMAIL       string        `env:"ANOMALY_ALERT_EMAIL"`
 }
 
 var ERROR_HANDLER string = "config"
 
+// REFRESH_TIME is the lifetime of a refresh token, the longest lived token of api/jwt.
+const REFRESH_TIME = time.Hour * 24 * 31
+
 var ConfigAll *Config
 
 // init is a built-in Go function that is automatically called before the main function.
@@ -44,13 +152,284 @@ func getConfig() *Config {
 	config.SECRET_KEY_JWT = os.Getenv("SECRET_KEY_JWT")
 	config.TIME_ZONE = os.Getenv("TIME_ZONE")
 
+	config.JWT_ISSUER = os.Getenv("JWT_ISSUER")
+	config.JWT_AUDIENCE = os.Getenv("JWT_AUDIENCE")
+	config.JWT_LEEWAY = getEnvDuration("JWT_LEEWAY", time.Second*30)
+	// JWT_LEGACY_UNTIL is required, at least REFRESH_TIME after the upgrade, so every legacy
+	// token issued before it can expire on its own.
+	config.JWT_LEGACY_UNTIL = getEnvTime("JWT_LEGACY_UNTIL", time.Time{})
+	config.JWT_KEYS_FILE = os.Getenv("JWT_KEYS_FILE")
+	// With JWT_KEYS_FILE new tokens are signed with the key set and HS256 tokens issued before
+	// are accepted until JWT_HS256_UNTIL, which is then required. A time in the past rejects
+	// them at once.
+	config.JWT_HS256_UNTIL = getEnvTime("JWT_HS256_UNTIL", time.Time{})
+	config.JWT_KEYS_RELOAD = getEnvDuration("JWT_KEYS_RELOAD", time.Minute)
+	config.JWT_REVOCATION_CACHE = getEnvDuration("JWT_REVOCATION_CACHE", time.Second*10)
+	config.JWT_DENYLIST_PURGE = getEnvDuration("JWT_DENYLIST_PURGE", time.Hour)
+	config.PASSWORD_ARGON2_TIME = getEnvInt("PASSWORD_ARGON2_TIME", 2)
+	config.PASSWORD_ARGON2_MEMORY = getEnvInt("PASSWORD_ARGON2_MEMORY", 19456)
+	config.PASSWORD_ARGON2_THREADS = getEnvInt("PASSWORD_ARGON2_THREADS", 1)
+
+	config.LOGIN_FAILURE_WINDOW = getEnvDuration("LOGIN_FAILURE_WINDOW", time.Hour)
+	config.LOGIN_DELAY_AFTER = getEnvInt("LOGIN_DELAY_AFTER", 3)
+	config.LOGIN_DELAY_BASE = getEnvDuration("LOGIN_DELAY_BASE", time.Second)
+	config.LOGIN_DELAY_MAX = getEnvDuration("LOGIN_DELAY_MAX", time.Minute)
+	config.LOGIN_LOCKOUT_FAILURES = getEnvInt("LOGIN_LOCKOUT_FAILURES", 10)
+	config.LOGIN_IP_LOCKOUT_FAILURES = getEnvInt("LOGIN_IP_LOCKOUT_FAILURES", 50)
+	config.LOGIN_LOCKOUT_DURATION = getEnvDuration("LOGIN_LOCKOUT_DURATION", time.Minute*15)
+
+	config.EMAIL_VERIFICATION_REQUIRED = getEnvBool("EMAIL_VERIFICATION_REQUIRED", false)
+	config.EMAIL_VERIFY_TTL = getEnvDuration("EMAIL_VERIFY_TTL", time.Hour*48)
+	config.PASSWORD_RESET_TTL = getEnvDuration("PASSWORD_RESET_TTL", time.Hour)
+	config.MAIL_VERIFY_URL = os.Getenv("MAIL_VERIFY_URL")
+	config.MAIL_RESET_URL = os.Getenv("MAIL_RESET_URL")
+	config.TOTP_ISSUER = os.Getenv("TOTP_ISSUER")
+	config.TOTP_SKEW = getEnvInt("TOTP_SKEW", 1)
+	config.TOTP_RECOVERY_CODES = getEnvInt("TOTP_RECOVERY_CODES", 10)
+	config.TWO_FACTOR_CHALLENGE_TTL = getEnvDuration("TWO_FACTOR_CHALLENGE_TTL", time.Minute*5)
+	config.MAIL_DRIVER = os.Getenv("MAIL_DRIVER")
+	config.MAIL_FROM = os.Getenv("MAIL_FROM")
+	config.MAIL_OUTBOX_DIR = os.Getenv("MAIL_OUTBOX_DIR")
+	config.MAIL_TEMPLATES_DIR = os.Getenv("MAIL_TEMPLATES_DIR")
+	config.SMTP_HOST = os.Getenv("SMTP_HOST")
+	config.SMTP_PORT = getEnvInt("SMTP_PORT", 587)
+	config.SMTP_USERNAME = os.Getenv("SMTP_USERNAME")
+	config.SMTP_PASSWORD = os.Getenv("SMTP_PASSWORD")
+
+	config.HEALTH_CHECK_INTERVAL = getEnvDuration("HEALTH_CHECK_INTERVAL", time.Minute*5)
+	config.HEALTH_CHECK_TIMEOUT = getEnvDuration("HEALTH_CHECK_TIMEOUT", time.Second*5)
+
+	config.SCREENING_DENY_DOMAINS = getEnvList("SCREENING_DENY_DOMAINS")
+	config.SCREENING_ALLOW_DOMAINS = getEnvList("SCREENING_ALLOW_DOMAINS")
+	config.SCREENING_PROTECTED_DOMAINS = getEnvList("SCREENING_PROTECTED_DOMAINS")
+	config.SCREENING_SHORTENERS = getEnvList("SCREENING_SHORTENERS")
+	config.THREAT_LIST_PATH = os.Getenv("THREAT_LIST_PATH")
+	config.THREAT_LIST_FORMAT = os.Getenv("THREAT_LIST_FORMAT")
+
+	config.SERVICE_DOMAINS = getEnvList("SERVICE_DOMAINS")
+	if len(config.SERVICE_DOMAINS) == 0 {
+		slog.Warn(ERROR_HANDLER, "SERVICE_DOMAINS", "empty, only the request host is treated as this service and rescans cannot detect self-references")
+	}
+	config.SHORTENER_CHAIN_DEPTH = getEnvInt("SHORTENER_CHAIN_DEPTH", 3)
+	config.SHORTENER_TIMEOUT = getEnvDuration("SHORTENER_TIMEOUT", time.Second*5)
+
+	config.CLICK_SALT = os.Getenv("CLICK_SALT")
+	config.CLICK_QUEUE_SIZE = getEnvInt("CLICK_QUEUE_SIZE", 10000)
+	config.CLICK_BATCH_SIZE = getEnvInt("CLICK_BATCH_SIZE", 500)
+	config.CLICK_FLUSH_INTERVAL = getEnvDuration("CLICK_FLUSH_INTERVAL", time.Second)
+	config.CLICK_DROP_POLICY = os.Getenv("CLICK_DROP_POLICY")
+	config.CLICK_ENQUEUE_TIMEOUT = getEnvDuration("CLICK_ENQUEUE_TIMEOUT", time.Millisecond*10)
+	config.SHUTDOWN_TIMEOUT = getEnvDuration("SHUTDOWN_TIMEOUT", time.Second*10)
+	config.HLL_ERROR_RATE = getEnvFloat("HLL_ERROR_RATE", 0.01)
+	config.BOT_SIGNATURES_PATH = os.Getenv("BOT_SIGNATURES_PATH")
+	config.BOT_HITS_PER_SECOND = getEnvInt("BOT_HITS_PER_SECOND", 10)
+	config.GEO_DB_PATH = os.Getenv("GEO_DB_PATH")
+	config.GEO_RELOAD_INTERVAL = getEnvDuration("GEO_RELOAD_INTERVAL", time.Minute)
+	config.PRIVACY_IP_MODE = os.Getenv("PRIVACY_IP_MODE")
+	config.PRIVACY_HONOR_DNT = getEnvBool("PRIVACY_HONOR_DNT", true)
+	config.CLICK_RETENTION_DAYS = getEnvInt("CLICK_RETENTION_DAYS", 0)
+	config.CLICK_RETENTION_MODE = os.Getenv("CLICK_RETENTION_MODE")
+	config.CLICK_RETENTION_INTERVAL = getEnvDuration("CLICK_RETENTION_INTERVAL", time.Hour)
+	config.CLICK_ID_ENABLED = getEnvBool("CLICK_ID_ENABLED", true)
+	config.CLICK_ID_PARAM = os.Getenv("CLICK_ID_PARAM")
+	config.WEBHOOK_TIMEOUT = getEnvDuration("WEBHOOK_TIMEOUT", time.Second*10)
+	config.WEBHOOK_MAX_ATTEMPTS = getEnvInt("WEBHOOK_MAX_ATTEMPTS", 8)
+	config.WEBHOOK_RETRY_BASE = getEnvDuration("WEBHOOK_RETRY_BASE", time.Second*30)
+	config.WEBHOOK_RETRY_MAX = getEnvDuration("WEBHOOK_RETRY_MAX", time.Hour*6)
+	config.WEBHOOK_POLL_INTERVAL = getEnvDuration("WEBHOOK_POLL_INTERVAL", time.Second)
+	config.WEBHOOK_BATCH_SIZE = getEnvInt("WEBHOOK_BATCH_SIZE", 50)
+	config.LIVE_POLL_INTERVAL = getEnvDuration("LIVE_POLL_INTERVAL", time.Second)
+	config.LIVE_HEARTBEAT = getEnvDuration("LIVE_HEARTBEAT", time.Second*15)
+	config.LIVE_REPLAY_LIMIT = getEnvInt("LIVE_REPLAY_LIMIT", 500)
+	config.ANOMALY_INTERVAL = getEnvDuration("ANOMALY_INTERVAL", time.Minute*5)
+	config.ANOMALY_BASELINE_HOURS = getEnvInt("ANOMALY_BASELINE_HOURS", 168)
+	config.ANOMALY_MIN_CLICKS = int64(getEnvInt("ANOMALY_MIN_CLICKS", 100))
+	config.ANOMALY_FACTOR = getEnvFloat("ANOMALY_FACTOR", 10)
+	config.ANOMALY_SIGMA = getEnvFloat("ANOMALY_SIGMA", 6)
+	config.ANOMALY_ACTION = os.Getenv("ANOMALY_ACTION")
+	config.ANOMALY_THROTTLE_RATE = getEnvInt("ANOMALY_THROTTLE_RATE", 10)
+	config.ANOMALY_THROTTLE_DURATION = getEnvDuration("ANOMALY_THROTTLE_DURATION", time.Hour)
+	config.ANOMALY_ALERT_EMAIL = os.Getenv("ANOMALY_ALERT_EMAIL")
+
 	if config.LOGGER_LEVEL == "" {
 		slog.Error(ERROR_HANDLER, "DEBUG")
 	}
 
+	if config.JWT_ISSUER == "" {
+		config.JWT_ISSUER = "urlshort.ru"
+	}
+	if config.JWT_AUDIENCE == "" {
+		config.JWT_AUDIENCE = "urlshort.ru"
+	}
+
+	if config.TOTP_ISSUER == "" {
+		config.TOTP_ISSUER = config.JWT_ISSUER
+	}
+	if config.MAIL_FROM == "" {
+		config.MAIL_FROM = "no-reply@" + config.JWT_ISSUER
+	}
+	if config.MAIL_OUTBOX_DIR == "" {
+		config.MAIL_OUTBOX_DIR = "./tmp/outbox"
+	}
+	if config.MAIL_VERIFY_URL == "" {
+		config.MAIL_VERIFY_URL = "http://localhost:8080/api/jwt/verify?token="
+	}
+	if config.MAIL_RESET_URL == "" {
+		config.MAIL_RESET_URL = "http://localhost:8080/reset-password?token="
+	}
+
 	if config.TIME_ZONE == "" {
 		config.TIME_ZONE = "Europe/Moscow"
 	}
 
+	config.LOCATION, err = time.LoadLocation(config.TIME_ZONE)
+	if err != nil {
+		slog.Error(ERROR_HANDLER, err)
+		config.LOCATION = time.UTC
+	}
+
+	if config.PRIVACY_IP_MODE == "" {
+		config.PRIVACY_IP_MODE = "hash"
+	}
+	if config.CLICK_RETENTION_MODE == "" {
+		config.CLICK_RETENTION_MODE = "aggregate"
+	}
+	if config.CLICK_ID_PARAM == "" {
+		config.CLICK_ID_PARAM = "click_id"
+	}
+	if config.ANOMALY_ACTION == "" {
+		config.ANOMALY_ACTION = "none"
+	}
+	if config.CLICK_DROP_POLICY == "" {
+		config.CLICK_DROP_POLICY = "drop_newest"
+	}
+
+	if config.THREAT_LIST_FORMAT == "" {
+		config.THREAT_LIST_FORMAT = "domain"
+	}
+
 	return config
 }
+
+// getEnvInt reads an integer environment variable.
+//
+// Parameters:
+// - name: the name of the environment variable.
+// - fallback: the value returned when the variable is empty or invalid.
+//
+// Returns:
+// - int: the parsed value or fallback.
+func getEnvInt(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		slog.Error(ERROR_HANDLER, name, err)
+		return fallback
+	}
+	return result
+}
+
+// getEnvBool reads a boolean environment variable such as "true", "false", "1" or "0".
+//
+// Parameters:
+// - name: the name of the environment variable.
+// - fallback: the value returned when the variable is empty or invalid.
+//
+// Returns:
+// - bool: the parsed value or fallback.
+func getEnvBool(name string, fallback bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	result, err := strconv.ParseBool(value)
+	if err != nil {
+		slog.Error(ERROR_HANDLER, name, err)
+		return fallback
+	}
+	return result
+}
+
+// getEnvFloat reads a floating point environment variable.
+//
+// Parameters:
+// - name: the name of the environment variable.
+// - fallback: the value returned when the variable is empty or invalid.
+//
+// Returns:
+// - float64: the parsed value or fallback.
+func getEnvFloat(name string, fallback float64) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	result, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		slog.Error(ERROR_HANDLER, name, err)
+		return fallback
+	}
+	return result
+}
+
+// getEnvDuration reads a duration environment variable such as "5m" or "30s".
+//
+// Parameters:
+// - name: the name of the environment variable.
+// - fallback: the value returned when the variable is empty or invalid.
+//
+// Returns:
+// - time.Duration: the parsed value or fallback.
+func getEnvDuration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	result, err := time.ParseDuration(value)
+	if err != nil {
+		slog.Error(ERROR_HANDLER, name, err)
+		return fallback
+	}
+	return result
+}
+
+// getEnvTime reads an RFC 3339 time environment variable such as "2024-01-31T00:00:00Z".
+//
+// Parameters:
+// - name: the name of the environment variable.
+// - fallback: the value returned when the variable is empty or invalid.
+//
+// Returns:
+// - time.Time: the parsed time or fallback.
+func getEnvTime(name string, fallback time.Time) time.Time {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	result, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		slog.Error(ERROR_HANDLER, name, err)
+		return fallback
+	}
+	return result
+}
+
+// getEnvList reads a comma separated environment variable.
+//
+// Parameters:
+// - name: the name of the environment variable.
+//
+// Returns:
+// - []string: the non-empty trimmed items of the list.
+func getEnvList(name string) []string {
+	result := []string{}
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
@@ -24,35 +24,71 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/api/jwt/check": {
-            "post": {
-                "description": "Checks the validity of a token",
-                "consumes": [
+        "/.well-known/jwks.json": {
+            "get": {
+                "description": "Returns the public keys that verify RS256 and EdDSA tokens, looked up by the kid header.\nKeys scheduled for rotation are published before they sign, replaced keys until their tokens expire.",
+                "produces": [
                     "application/json"
                 ],
+                "tags": [
+                    "JWT"
+                ],
+                "summary": "JSON Web Key Set",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/jwt.JWKS"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/admin/alerts": {
+            "get": {
+                "description": "Returns the newest alerts raised for links whose hourly clicks exceeded their baseline",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "JWT"
+                    "Admin"
                 ],
-                "summary": "Check token",
+                "summary": "List click spike alerts",
                 "parameters": [
                     {
-                        "description": "Token object",
-                        "name": "requestBody",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/jwt.CheckTokenJSON"
-                        }
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "open (default), resolved or all",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of alerts, 100 at most",
+                        "name": "limit",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/admin.AlertResponse"
+                            }
                         }
                     },
                     "400": {
@@ -60,23 +96,32 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/schema.Response"
                         }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
                     }
                 }
             }
         },
-        "/api/jwt/delete": {
-            "delete": {
-                "description": "Deletes a user",
-                "consumes": [
-                    "application/json"
-                ],
+        "/api/admin/alerts/{id}/resolve": {
+            "post": {
+                "description": "Marks an alert handled and lifts the pause or throttle applied to its link",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "JWT"
+                    "Admin"
                 ],
-                "summary": "Delete user",
+                "summary": "Resolve click spike alert",
                 "parameters": [
                     {
                         "type": "string",
@@ -84,17 +129,30 @@ const docTemplate = `{
                         "name": "Authorization",
                         "in": "header",
                         "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Alert ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/admin.AlertResponse"
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
                             "$ref": "#/definitions/schema.Response"
                         }
@@ -108,45 +166,55 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/jwt/login": {
-            "post": {
-                "description": "Logs in a user",
-                "consumes": [
-                    "application/json"
-                ],
+        "/api/admin/audit": {
+            "get": {
+                "description": "Returns the latest audit entries, newest first",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "JWT"
+                    "Admin"
                 ],
-                "summary": "User login",
+                "summary": "List audit entries",
                 "parameters": [
                     {
-                        "description": "User object",
-                        "name": "requestBody",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/jwt.UserJSON"
-                        }
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Action, for example login.lockout or login.unlock",
+                        "name": "action",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of entries, at most 100",
+                        "name": "limit",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/jwt.RefreshAndAccessTokens"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/admin.AuditEntryResponse"
+                            }
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "401": {
+                        "description": "Unauthorized",
                         "schema": {
                             "$ref": "#/definitions/schema.Response"
                         }
                     },
-                    "401": {
-                        "description": "Unauthorized",
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
                             "$ref": "#/definitions/schema.Response"
                         }
@@ -154,19 +222,16 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/jwt/logout": {
+        "/api/admin/clicks/ingest": {
             "get": {
-                "description": "Logs out a user",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Returns the queue depth and counters of the click pipeline of the process that served the request",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "JWT"
+                    "Admin"
                 ],
-                "summary": "User logout",
+                "summary": "Click ingestion metrics",
                 "parameters": [
                     {
                         "type": "string",
@@ -180,17 +245,17 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/jwt.RefreshAndAccessTokens"
+                            "$ref": "#/definitions/admin.ClickIngestResponse"
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "401": {
+                        "description": "Unauthorized",
                         "schema": {
                             "$ref": "#/definitions/schema.Response"
                         }
                     },
-                    "401": {
-                        "description": "Unauthorized",
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
                             "$ref": "#/definitions/schema.Response"
                         }
@@ -198,23 +263,20 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/jwt/refresh": {
+        "/api/admin/lockouts": {
             "get": {
-                "description": "Refreshes the JWT token using the refresh token",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Returns the emails and IPs locked out after too many failed logins",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "JWT"
+                    "Admin"
                 ],
-                "summary": "Refresh JWT token",
+                "summary": "List login lockouts",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Bearer {refresh_token}",
+                        "description": "Bearer token",
                         "name": "Authorization",
                         "in": "header",
                         "required": true
@@ -224,13 +286,10 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/jwt.AccessToken"
-                        }
-                    },
-                    "400": {
-                        "description": "Bad Request",
-                        "schema": {
-                            "$ref": "#/definitions/schema.Response"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/admin.LockoutResponse"
+                            }
                         }
                     },
                     "401": {
@@ -239,8 +298,8 @@ const docTemplate = `{
                             "$ref": "#/definitions/schema.Response"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
                             "$ref": "#/definitions/schema.Response"
                         }
@@ -248,9 +307,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/jwt/register": {
+        "/api/admin/lockouts/unlock": {
             "post": {
-                "description": "Registers a new user",
+                "description": "Clears the failed logins and lockout of an email, an IP or both. Every unlock is audited.",
                 "consumes": [
                     "application/json"
                 ],
@@ -258,17 +317,24 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "JWT"
+                    "Admin"
                 ],
-                "summary": "Register user",
+                "summary": "Unlock login",
                 "parameters": [
                     {
-                        "description": "User object",
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Email and/or IP to unlock",
                         "name": "requestBody",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/jwt.UserJSON"
+                            "$ref": "#/definitions/admin.UnlockBody"
                         }
                     }
                 ],
@@ -276,7 +342,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/jwt.RefreshAndAccessTokens"
+                            "$ref": "#/definitions/admin.UnlockResponse"
                         }
                     },
                     "400": {
@@ -284,43 +350,56 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/schema.Response"
                         }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
                     }
                 }
             }
         },
-        "/api/urls/": {
+        "/api/admin/screening/rescan": {
             "post": {
-                "description": "Создает URL с предоставленным исходным URL.",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Screens every stored link again in the background",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Параметры URL"
+                    "Admin"
                 ],
-                "summary": "Создать URL",
+                "summary": "Rescan links",
                 "parameters": [
                     {
-                        "description": "Тело запроса",
-                        "name": "c",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/urls.CreateURLBody"
-                        }
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/urls.URLResponse"
+                            "$ref": "#/definitions/schema.Response"
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
                             "$ref": "#/definitions/schema.Response"
                         }
@@ -328,25 +407,22 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/urls/{shorturl}": {
+        "/api/admin/screening/rules": {
             "get": {
-                "description": "Обрабатывает HTTP-запрос для получения параметров URL.",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Returns the domain deny and allow rules managed through the API",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Параметры URL"
+                    "Admin"
                 ],
-                "summary": "Получить параметры URL",
+                "summary": "List screening rules",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Короткий URL",
-                        "name": "shorturl",
-                        "in": "path",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
                         "required": true
                     }
                 ],
@@ -354,25 +430,28 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/urls.URLResponse"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/admin.ScreeningRuleResponse"
+                            }
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "401": {
+                        "description": "Unauthorized",
                         "schema": {
                             "$ref": "#/definitions/schema.Response"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
                             "$ref": "#/definitions/schema.Response"
                         }
                     }
                 }
             },
-            "delete": {
-                "description": "Удалить URL с предоставленным коротким URL.",
+            "post": {
+                "description": "Adds a domain to the deny or allow list and rescans existing links",
                 "consumes": [
                     "application/json"
                 ],
@@ -380,9 +459,9 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Параметры URL"
+                    "Admin"
                 ],
-                "summary": "Удалить URL",
+                "summary": "Create screening rule",
                 "parameters": [
                     {
                         "type": "string",
@@ -392,18 +471,20 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "type": "string",
-                        "description": "Короткий URL",
-                        "name": "shorturl",
-                        "in": "path",
-                        "required": true
+                        "description": "Rule: list is deny or allow, match is exact, suffix or regex",
+                        "name": "requestBody",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/admin.ScreeningRuleBody"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/urls.URLResponse"
+                            "$ref": "#/definitions/admin.ScreeningRuleResponse"
                         }
                     },
                     "400": {
@@ -418,26 +499,25 @@ const docTemplate = `{
                             "$ref": "#/definitions/schema.Response"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
                             "$ref": "#/definitions/schema.Response"
                         }
                     }
                 }
-            },
-            "patch": {
-                "description": "Обновить URL с предоставленным коротким и существующим URL.",
-                "consumes": [
-                    "application/json"
-                ],
+            }
+        },
+        "/api/admin/screening/rules/{id}": {
+            "delete": {
+                "description": "Removes a deny or allow rule and rescans existing links",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Параметры URL"
+                    "Admin"
                 ],
-                "summary": "Обновить URL",
+                "summary": "Delete screening rule",
                 "parameters": [
                     {
                         "type": "string",
@@ -447,37 +527,28 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "type": "string",
-                        "description": "Короткий URL",
-                        "name": "shorturl",
+                        "type": "integer",
+                        "description": "Rule ID",
+                        "name": "id",
                         "in": "path",
                         "required": true
-                    },
-                    {
-                        "description": "Original URL",
-                        "name": "bodyJson",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/urls.ShortURLBody"
-                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/urls.URLResponse"
+                            "$ref": "#/definitions/schema.Response"
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "401": {
+                        "description": "Unauthorized",
                         "schema": {
                             "$ref": "#/definitions/schema.Response"
                         }
                     },
-                    "401": {
-                        "description": "Unauthorized",
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
                             "$ref": "#/definitions/schema.Response"
                         }
@@ -490,88 +561,3509 @@ const docTemplate = `{
                     }
                 }
             }
+        },
+        "/api/admin/screening/threats": {
+            "post": {
+                "description": "Replaces an offline threat list with the request body and rescans existing links.\nThe body is a plain text file: one domain per line (format=domain, hosts files are accepted)\nor one hex SHA-256 prefix of \"host/\" per line (format=hash_prefix).",
+                "consumes": [
+                    "text/plain"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Import threat list",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "List name",
+                        "name": "source",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "domain or hash_prefix",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "description": "List contents",
+                        "name": "requestBody",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ThreatImportResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/admin/screening/threats/{source}": {
+            "delete": {
+                "description": "Removes every entry of an imported threat list and rescans existing links",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Delete threat list",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "List name",
+                        "name": "source",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/admin/two-factor": {
+            "get": {
+                "description": "Returns the roles with a two-factor policy and whether two-factor authentication is required for them",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "List two-factor policies",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/admin.TwoFactorPolicyResponse"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/admin/two-factor/{role}": {
+            "put": {
+                "description": "Requires or stops requiring two-factor authentication for a role. Users of the role without it get a challenge\nwith enroll set on login and enroll before the second step. Admins without it are rejected by the admin API\nwith error two_factor_required, so an admin must enable it before requiring it for admins. The change is audited.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Set two-factor policy",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Role: user or admin",
+                        "name": "role",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Whether two-factor authentication is required",
+                        "name": "requestBody",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/admin.TwoFactorPolicyBody"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin.TwoFactorPolicyResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "409": {
+                        "description": "error: two_factor_not_enabled",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/admin/users/{id}/role": {
+            "put": {
+                "description": "Sets the role of a user. Access tokens issued with the old role are revoked, the user's sessions stay active\nand the next refresh returns tokens with the new role.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Change user role",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Role: user or admin",
+                        "name": "requestBody",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/admin.RoleBody"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin.UserResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/clicks/export": {
+            "get": {
+                "description": "Потоково выгружает переходы по ссылке, по ссылкам с меткой или по всем ссылкам пользователя за период.\nПользователи выгружают только свои ссылки, администраторы — любые.",
+                "produces": [
+                    "text/csv",
+                    "application/x-ndjson",
+                    "application/vnd.apache.parquet"
+                ],
+                "tags": [
+                    "Выгрузка"
+                ],
+                "summary": "Выгрузить переходы",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "default": "csv",
+                        "description": "csv, ndjson или parquet",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Короткий URL",
+                        "name": "short_url",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "ID владельца ссылок (только для администраторов)",
+                        "name": "user_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Метка ссылок",
+                        "name": "tag",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Начало периода: RFC3339 или YYYY-MM-DD",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Конец периода (не включительно): RFC3339 или YYYY-MM-DD",
+                        "name": "to",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/conversions": {
+            "post": {
+                "description": "Сохраняет событие конверсии (название, сумма, валюта) для перехода с указанным click_id.\nИдентификатор перехода добавляется к адресу назначения при переходе по короткой ссылке.\nЗаписывать конверсии могут владелец ссылки и администраторы. Переходы сохраняются пакетами,\nпоэтому для только что совершенного перехода может вернуться 404 до ближайшей записи пакета.\nДля перехода сохраняется одна конверсия с каждым названием: повторный запрос возвращает 200\nи уже сохраненную конверсию, поэтому запрос можно безопасно повторять.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Конверсии"
+                ],
+                "summary": "Записать конверсию",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Конверсия",
+                        "name": "bodyJson",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/conversions.ConversionBody"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/conversions.ConversionResponse"
+                        }
+                    },
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/conversions.ConversionResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/jwt/2fa/disable": {
+            "post": {
+                "description": "Disables two-factor authentication with a code or a recovery code and deletes the secret and recovery codes.\nIt cannot be disabled while it is required for the role of the user.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "JWT"
+                ],
+                "summary": "Disable two-factor authentication",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer {access_token}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Code object",
+                        "name": "requestBody",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/jwt.CodeJSON"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "error: invalid_code or two_factor_not_enabled",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "error: invalid_token, invalid_signature, token_expired, wrong_token_type or token_revoked",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "error: two_factor_required",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "429": {
+                        "description": "error: too_many_attempts",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/jwt/2fa/enable": {
+            "post": {
+                "description": "Enables two-factor authentication with a code of the enrolled secret and returns the recovery codes.\nThe recovery codes are shown once, every code can be used once instead of a code of the authenticator app.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "JWT"
+                ],
+                "summary": "Enable two-factor authentication",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer {access_token}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Code object",
+                        "name": "requestBody",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/jwt.CodeJSON"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/jwt.RecoveryCodesResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "error: invalid_code or two_factor_not_enabled if the user did not enroll",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "error: invalid_token, invalid_signature, token_expired, wrong_token_type or token_revoked",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "409": {
+                        "description": "error: two_factor_enabled",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "429": {
+                        "description": "error: too_many_attempts",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/jwt/2fa/enroll": {
+            "post": {
+                "description": "Generates a TOTP secret (RFC 6238, SHA1, 6 digits, 30 seconds) and returns it with its otpauth:// provisioning URI,\nwhich the client shows as a QR code for the authenticator app. The secret is pending until it is enabled.\nAccepts an access token, or the challenge token of a login whose role requires two-factor authentication.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "JWT"
+                ],
+                "summary": "Enroll two-factor authentication",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer {access_token} or Bearer {challenge}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/jwt.TOTPEnrollResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "error: invalid_token, invalid_signature, token_expired, wrong_token_type, token_revoked or token_reused",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "409": {
+                        "description": "error: two_factor_enabled",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/jwt/2fa/recovery-codes": {
+            "post": {
+                "description": "Replaces the recovery codes with new ones after checking a code or a recovery code. The old codes stop working.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "JWT"
+                ],
+                "summary": "Regenerate recovery codes",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer {access_token}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Code object",
+                        "name": "requestBody",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/jwt.CodeJSON"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/jwt.RecoveryCodesResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "error: invalid_code or two_factor_not_enabled",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "error: invalid_token, invalid_signature, token_expired, wrong_token_type or token_revoked",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "429": {
+                        "description": "error: too_many_attempts",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/jwt/check": {
+            "post": {
+                "description": "Checks the validity of a token of the given type, access by default.\nThe error field of a failed check is invalid_token, invalid_signature, token_expired, wrong_token_type or token_revoked.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "JWT"
+                ],
+                "summary": "Check token",
+                "parameters": [
+                    {
+                        "description": "Token object, type is access or refresh",
+                        "name": "requestBody",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/jwt.CheckTokenJSON"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/jwt/delete": {
+            "delete": {
+                "description": "Deletes a user",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "JWT"
+                ],
+                "summary": "Delete user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "error: two_factor_required if the admin has not enabled required two-factor authentication",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/jwt/login": {
+            "post": {
+                "description": "Logs in a user and starts a session on the device named by device_name,\nor by the browser and operating system of the User-Agent header. Other sessions stay active.\nFailed logins are counted per email and per IP: after a few failures every attempt waits longer,\nand after more the email or IP is locked out for a while. Unknown emails are counted the same way.\nIf verification is required, a user with an unverified email gets 403 with error email_not_verified.\nIf the user enabled two-factor authentication or it is required for the role, the response is 202 with a\nchallenge token for /api/jwt/login/2fa instead of the tokens. enroll tells a user without it to enroll first.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "JWT"
+                ],
+                "summary": "User login",
+                "parameters": [
+                    {
+                        "description": "User object",
+                        "name": "requestBody",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/jwt.UserJSON"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/jwt.RefreshAndAccessTokens"
+                        }
+                    },
+                    "202": {
+                        "description": "Two-factor authentication needed",
+                        "schema": {
+                            "$ref": "#/definitions/jwt.ChallengeResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "error: email_not_verified",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "429": {
+                        "description": "error: too_many_attempts, the Retry-After header gives the wait in seconds",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/jwt/login/2fa": {
+            "post": {
+                "description": "Exchanges the challenge token of a login and a code of the authenticator app, or a recovery code, for tokens.\nA user who had to enroll sends a code of the enrolled secret, which enables two-factor authentication, and gets\nthe recovery codes in the response. Every challenge and code is used once. Wrong codes count as failed logins.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "JWT"
+                ],
+                "summary": "Second login step",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer {challenge}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Code object",
+                        "name": "requestBody",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/jwt.TwoFactorLoginJSON"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/jwt.TwoFactorLoginResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "error: invalid_code or two_factor_not_enabled if the user did not enroll",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "error: invalid_token, invalid_signature, token_expired, wrong_token_type or token_reused",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "429": {
+                        "description": "error: too_many_attempts, the Retry-After header gives the wait in seconds",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/jwt/logout": {
+            "get": {
+                "description": "Logs out a user by revoking the session of the refresh token and the access tokens of the session",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "JWT"
+                ],
+                "summary": "User logout",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer {refresh_token}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/jwt.RefreshAndAccessTokens"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "error: invalid_token, invalid_signature, token_expired or wrong_token_type",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/jwt/password/forgot": {
+            "post": {
+                "description": "Mails a password reset link if the email is registered, earlier links stop working.\nThe response is the same for every email, so it does not reveal which emails are registered.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "JWT"
+                ],
+                "summary": "Request password reset",
+                "parameters": [
+                    {
+                        "description": "Email object",
+                        "name": "requestBody",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/jwt.EmailJSON"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/jwt/password/reset": {
+            "post": {
+                "description": "Sets a new password with the token of a password reset link. Every token is used once.\nAll sessions and access tokens of the user are revoked, the user logs in again with the new password.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "JWT"
+                ],
+                "summary": "Reset password",
+                "parameters": [
+                    {
+                        "description": "Token and new password",
+                        "name": "requestBody",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/jwt.PasswordResetJSON"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "error: user_token_invalid if the token is unknown, used or expired",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/jwt/refresh": {
+            "get": {
+                "description": "Exchanges the refresh token for a new refresh and access token. Every refresh token is used once:\npresenting a rotated token again revokes its session, and the error is token_reused.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "JWT"
+                ],
+                "summary": "Refresh JWT token",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer {refresh_token}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/jwt.RefreshAndAccessTokens"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "error: invalid_token, invalid_signature, token_expired, wrong_token_type, session_revoked or token_reused",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "error: two_factor_required if the role requires two-factor authentication and the user has not enabled it",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/jwt/register": {
+            "post": {
+                "description": "Registers a new user and starts a session on the device named by device_name,\nor by the browser and operating system of the User-Agent header.\nA verification link is mailed to the email. If verification is required, no session is started\nand the response is 202 with empty tokens until the email is verified.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "JWT"
+                ],
+                "summary": "Register user",
+                "parameters": [
+                    {
+                        "description": "User object",
+                        "name": "requestBody",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/jwt.UserJSON"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/jwt.RefreshAndAccessTokens"
+                        }
+                    },
+                    "202": {
+                        "description": "Verification required, the tokens are empty",
+                        "schema": {
+                            "$ref": "#/definitions/jwt.RefreshAndAccessTokens"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/jwt/revoke": {
+            "post": {
+                "description": "Revokes the access token of the request until it expires, other tokens of the session stay valid",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "JWT"
+                ],
+                "summary": "Revoke access token",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer {access_token}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "error: invalid_token, invalid_signature, token_expired, wrong_token_type or token_revoked",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/jwt/sessions": {
+            "get": {
+                "description": "Returns the active sessions of the user, most recently used first. current marks the session of the access token.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "JWT"
+                ],
+                "summary": "List sessions",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer {access_token}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/jwt.SessionResponse"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "error: invalid_token, invalid_signature, token_expired, wrong_token_type or token_revoked",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Revokes every session of the user, logging out all devices. With except_current the session of the access token stays active.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "JWT"
+                ],
+                "summary": "Revoke all sessions",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer {access_token}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Keep the current session",
+                        "name": "except_current",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/jwt.RevokeSessionsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "error: invalid_token, invalid_signature, token_expired, wrong_token_type or token_revoked",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/jwt/sessions/{id}": {
+            "delete": {
+                "description": "Revokes a session of the user. Its refresh token no longer rotates.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "JWT"
+                ],
+                "summary": "Revoke session",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer {access_token}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Session ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "error: invalid_token, invalid_signature, token_expired, wrong_token_type or token_revoked",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/jwt/verify": {
+            "get": {
+                "description": "Verifies the email of a user with the token of a verification link. The token is taken from the token\nquery parameter, so the mailed link works in a browser, or from the JSON body. Every token is used once.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "JWT"
+                ],
+                "summary": "Verify email",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Verification token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "Token object",
+                        "name": "requestBody",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/jwt.UserTokenJSON"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "error: user_token_invalid if the token is unknown, used or expired",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Verifies the email of a user with the token of a verification link. The token is taken from the token\nquery parameter, so the mailed link works in a browser, or from the JSON body. Every token is used once.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "JWT"
+                ],
+                "summary": "Verify email",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Verification token",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "description": "Token object",
+                        "name": "requestBody",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/jwt.UserTokenJSON"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "error: user_token_invalid if the token is unknown, used or expired",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/jwt/verify/resend": {
+            "post": {
+                "description": "Mails a new verification link if the email is registered and not verified yet, earlier links stop working.\nThe response is the same for every email, so it does not reveal which emails are registered.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "JWT"
+                ],
+                "summary": "Resend verification",
+                "parameters": [
+                    {
+                        "description": "Email object",
+                        "name": "requestBody",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/jwt.EmailJSON"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/urls/": {
+            "post": {
+                "description": "Создает URL с предоставленным исходным URL. Если передан токен, пользователь становится владельцем ссылки.\nДля уже существующего исходного URL возвращается существующая ссылка без изменения владельца и меток.\nВидимость статистики private и disabled можно задать только с токеном.\nНеобязательный срок действия expires_at (RFC 3339) должен быть в будущем, после него ссылка отвечает 410.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Параметры URL"
+                ],
+                "summary": "Создать URL",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Тело запроса",
+                        "name": "c",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/urls.CreateURLBody"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/urls.URLResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/urls/{shorturl}": {
+            "get": {
+                "description": "Обрабатывает HTTP-запрос для получения параметров URL.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Параметры URL"
+                ],
+                "summary": "Получить параметры URL",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Короткий URL",
+                        "name": "shorturl",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/urls.URLResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Удалить URL с предоставленным коротким URL.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Параметры URL"
+                ],
+                "summary": "Удалить URL",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Короткий URL",
+                        "name": "shorturl",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/urls.URLResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "error: two_factor_required if the admin has not enabled required two-factor authentication",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Обновить URL с предоставленным коротким и существующим URL.\nСрок действия expires_at (RFC 3339) должен быть в будущем, пустая строка снимает его.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Параметры URL"
+                ],
+                "summary": "Обновить URL",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Короткий URL",
+                        "name": "shorturl",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Original URL",
+                        "name": "bodyJson",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/urls.ShortURLBody"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/urls.URLResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "error: two_factor_required if the admin has not enabled required two-factor authentication",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/urls/{shorturl}/live": {
+            "get": {
+                "description": "Передает новые переходы по ссылке как Server-Sent Events (событие click, id — номер перехода)\nили, при запросе на обновление соединения, через WebSocket (сообщения JSON с полями id и data).\nДоступно владельцу ссылки и администраторам. Токен передается в заголовке Authorization или,\nдля EventSource и WebSocket в браузере, в параметре access_token. Раз в LIVE_HEARTBEAT\nотправляется комментарий heartbeat (для WebSocket — ping). При переподключении с заголовком\nLast-Event-ID или параметром last_event_id сначала передаются пропущенные переходы (не более LIVE_REPLAY_LIMIT).",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "Параметры URL"
+                ],
+                "summary": "Поток переходов URL",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Номер последнего полученного перехода",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Короткий URL",
+                        "name": "shorturl",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Токен доступа, если заголовок Authorization недоступен",
+                        "name": "access_token",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Номер последнего полученного перехода",
+                        "name": "last_event_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/live.Event"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/urls/{shorturl}/stats": {
+            "get": {
+                "description": "Возвращает общее и уникальное число переходов, временной ряд и разбивки по источникам,\nстранам, браузерам, ОС, устройствам и языкам. Интервалы считаются в часовом поясе TIME_ZONE.\nПо умолчанию учитываются только переходы людей, боты и сервисы предпросмотра ссылок исключаются.\nДоступно только владельцу ссылки и администраторам независимо от видимости статистики;\nпубличная сводка для всех отдается страницей /{shorturl}/stats.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Параметры URL"
+                ],
+                "summary": "Получить статистику URL",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Короткий URL",
+                        "name": "shorturl",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "default": "day",
+                        "description": "hour, day, week или month",
+                        "name": "interval",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Начало периода: RFC3339 или YYYY-MM-DD",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Конец периода (не включительно): RFC3339 или YYYY-MM-DD",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 10,
+                        "description": "Число значений в каждой разбивке",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "default": false,
+                        "description": "Учитывать ботов и сервисы предпросмотра",
+                        "name": "bots",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/stats.Report"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/urls/{shorturl}/stats/visibility": {
+            "put": {
+                "description": "Устанавливает видимость статистики: public — страница /{shorturl}/stats доступна всем,\nprivate — только владельцу и администраторам, disabled — страница статистики отключена.\nПодробная статистика /api/urls/{shorturl}/stats всегда доступна только владельцу и администраторам.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Параметры URL"
+                ],
+                "summary": "Изменить видимость статистики URL",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Короткий URL",
+                        "name": "shorturl",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Видимость статистики",
+                        "name": "bodyJson",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/urls.StatsVisibilityBody"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/urls.URLResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/urls/{shorturl}/targeting": {
+            "get": {
+                "description": "Возвращает правила в порядке проверки. Доступно владельцу ссылки и администраторам.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Параметры URL"
+                ],
+                "summary": "Получить правила таргетинга URL",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Короткий URL",
+                        "name": "shorturl",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/urls.TargetingResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Заменяет все правила ссылки. Правила проверяются по порядку: посетитель из страны country\n(код ISO 3166-1 alpha-2) и, если задан, региона region перенаправляется на destination.\nАдреса правил проверяются так же, как исходный URL. Пустой список удаляет все правила.\nСтрана и регион определяются по базе GEO_DB_PATH, без нее правила не применяются.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Параметры URL"
+                ],
+                "summary": "Изменить правила таргетинга URL",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Короткий URL",
+                        "name": "shorturl",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Правила таргетинга",
+                        "name": "bodyJson",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/urls.TargetingBody"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/urls.TargetingResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/webhooks/": {
+            "get": {
+                "description": "Возвращает вебхуки, зарегистрированные текущим пользователем. Секреты не возвращаются.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Вебхуки"
+                ],
+                "summary": "Список вебхуков",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/webhooks.WebhookResponse"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Регистрирует адрес, на который отправляются события ссылок текущего пользователя:\nlink.created, link.updated, link.deleted, link.expired, link.spike и click (переходы отправляются пакетами).\nАдрес должен указывать только на публичные IP-адреса, перенаправления не выполняются.\nЗапросы подписываются HMAC-SHA256 в заголовке X-Webhook-Signature вида t=\u003cвремя\u003e,v1=\u003cподпись\u003e,\nгде подпись вычисляется от строки \"\u003cвремя\u003e.\u003cтело\u003e\". Секрет возвращается только в ответе на этот запрос.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Вебхуки"
+                ],
+                "summary": "Создать вебхук",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Вебхук",
+                        "name": "bodyJson",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/webhooks.WebhookBody"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/webhooks.WebhookResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/webhooks/{id}": {
+            "delete": {
+                "description": "Удаляет вебхук. Неотправленные события этого вебхука переносятся в журнал недоставленных.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Вебхуки"
+                ],
+                "summary": "Удалить вебхук",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "ID вебхука",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/webhooks/{id}/deliveries": {
+            "get": {
+                "description": "Возвращает последние отправки вебхука, новые первыми. Отправки, не доставленные\nза WEBHOOK_MAX_ATTEMPTS попыток, имеют статус dead и образуют журнал недоставленных событий.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Вебхуки"
+                ],
+                "summary": "Список отправок вебхука",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "ID вебхука",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "pending, delivered или dead",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Число отправок",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/webhooks.DeliveryResponse"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/webhooks/{id}/deliveries/{delivery}/redeliver": {
+            "post": {
+                "description": "Ставит отправку в очередь на немедленную повторную доставку с новой серией попыток,\nв том числе из журнала недоставленных. Идентификатор события не меняется.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Вебхуки"
+                ],
+                "summary": "Повторить отправку",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "ID вебхука",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "ID отправки",
+                        "name": "delivery",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/webhooks.DeliveryResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/{shorturl}": {
+            "get": {
+                "description": "Перенаправляет на исходный URL или на резервный URL, если исходный недоступен.\nЕсли страна или регион посетителя совпадает с правилом таргетинга ссылки, перенаправляет на адрес из правила.\nК адресу добавляется идентификатор перехода (параметр CLICK_ID_PARAM) для учета конверсий.\nСсылки, приостановленные из-за всплеска переходов, отвечают 403, ограниченные — 429 сверх лимита.\nСсылки с истекшим сроком действия (expires_at) отвечают 410.",
+                "tags": [
+                    "Переход"
+                ],
+                "summary": "Перейти по короткому URL",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Короткий URL",
+                        "name": "shorturl",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "302": {
+                        "description": "Found"
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "410": {
+                        "description": "Gone",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/{shorturl}/stats": {
+            "get": {
+                "description": "Возвращает HTML-страницу или JSON (по заголовку Accept или параметру format=json) с числом переходов\nпо дням и основными источниками. Страница доступна всем для ссылок с видимостью public,\nтолько владельцу и администраторам для private и отключена для disabled.",
+                "produces": [
+                    "text/html",
+                    "application/json"
+                ],
+                "tags": [
+                    "Переход"
+                ],
+                "summary": "Страница статистики URL",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Короткий URL",
+                        "name": "shorturl",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "json для ответа в формате JSON",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/redirect.StatsPageResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/schema.Response"
+                        }
+                    }
+                }
+            }
         }
     },
     "definitions": {
-        "jwt.AccessToken": {
+        "admin.AlertResponse": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
+                "baseline": {
+                    "type": "number"
+                },
+                "bucket": {
+                    "type": "string"
+                },
+                "clicks": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "resolved_at": {
+                    "type": "string"
+                },
+                "short_url": {
+                    "type": "string"
+                },
+                "threshold": {
+                    "type": "number"
+                }
+            }
+        },
+        "admin.AuditEntryResponse": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
+                "actor_id": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "detail": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "ip": {
+                    "type": "string"
+                },
+                "subject": {
+                    "type": "string"
+                }
+            }
+        },
+        "admin.ClickIngestResponse": {
+            "type": "object",
+            "properties": {
+                "pid": {
+                    "type": "integer"
+                },
+                "running": {
+                    "type": "boolean"
+                },
+                "stats": {
+                    "$ref": "#/definitions/clicks.PipelineStats"
+                }
+            }
+        },
+        "admin.LockoutResponse": {
+            "type": "object",
+            "properties": {
+                "failures": {
+                    "type": "integer"
+                },
+                "last_failure_at": {
+                    "type": "string"
+                },
+                "locked_until": {
+                    "type": "string"
+                },
+                "subject": {
+                    "type": "string"
+                }
+            }
+        },
+        "admin.RoleBody": {
+            "type": "object",
+            "properties": {
+                "role": {
+                    "type": "string"
+                }
+            }
+        },
+        "admin.ScreeningRuleBody": {
+            "type": "object",
+            "properties": {
+                "list": {
+                    "type": "string"
+                },
+                "match": {
+                    "type": "string"
+                },
+                "pattern": {
+                    "type": "string"
+                }
+            }
+        },
+        "admin.ScreeningRuleResponse": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "integer"
+                },
+                "list": {
+                    "type": "string"
+                },
+                "match": {
+                    "type": "string"
+                },
+                "pattern": {
+                    "type": "string"
+                }
+            }
+        },
+        "admin.ThreatImportResponse": {
+            "type": "object",
+            "properties": {
+                "format": {
+                    "type": "string"
+                },
+                "imported": {
+                    "type": "integer"
+                },
+                "source": {
+                    "type": "string"
+                }
+            }
+        },
+        "admin.TwoFactorPolicyBody": {
+            "type": "object",
+            "properties": {
+                "required": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "admin.TwoFactorPolicyResponse": {
+            "type": "object",
+            "properties": {
+                "required": {
+                    "type": "boolean"
+                },
+                "role": {
+                    "type": "string"
+                }
+            }
+        },
+        "admin.UnlockBody": {
+            "type": "object",
+            "properties": {
+                "email": {
+                    "type": "string"
+                },
+                "ip": {
+                    "type": "string"
+                }
+            }
+        },
+        "admin.UnlockResponse": {
+            "type": "object",
+            "properties": {
+                "unlocked": {
+                    "type": "integer"
+                }
+            }
+        },
+        "admin.UserResponse": {
+            "type": "object",
+            "properties": {
+                "email": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "role": {
+                    "type": "string"
+                },
+                "two_factor": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "clicks.PipelineStats": {
+            "type": "object",
+            "properties": {
+                "batches": {
+                    "type": "integer"
+                },
+                "dropped": {
+                    "type": "integer"
+                },
+                "enqueued": {
+                    "type": "integer"
+                },
+                "failed": {
+                    "type": "integer"
+                },
+                "queue_capacity": {
+                    "type": "integer"
+                },
+                "queue_depth": {
+                    "type": "integer"
+                },
+                "written": {
+                    "type": "integer"
+                }
+            }
+        },
+        "conversions.ConversionBody": {
+            "type": "object",
+            "properties": {
+                "click_id": {
+                    "type": "string"
+                },
+                "currency": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "value": {
+                    "type": "number"
+                }
+            }
+        },
+        "conversions.ConversionResponse": {
+            "type": "object",
+            "properties": {
+                "click_id": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "currency": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "short_url": {
+                    "type": "string"
+                },
+                "value": {
+                    "type": "number"
+                }
+            }
+        },
+        "jwt.ChallengeResponse": {
+            "type": "object",
+            "properties": {
+                "challenge": {
+                    "type": "string"
+                },
+                "enroll": {
+                    "type": "boolean"
+                },
+                "expires_in": {
+                    "type": "integer"
+                }
+            }
+        },
+        "jwt.CheckTokenJSON": {
+            "type": "object",
+            "properties": {
+                "token": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "jwt.CodeJSON": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string"
+                }
+            }
+        },
+        "jwt.EmailJSON": {
+            "type": "object",
+            "properties": {
+                "email": {
+                    "type": "string"
+                }
+            }
+        },
+        "jwt.JWK": {
+            "type": "object",
+            "properties": {
+                "alg": {
+                    "type": "string"
+                },
+                "crv": {
+                    "type": "string"
+                },
+                "e": {
+                    "type": "string"
+                },
+                "kid": {
+                    "type": "string"
+                },
+                "kty": {
+                    "type": "string"
+                },
+                "n": {
+                    "type": "string"
+                },
+                "use": {
+                    "type": "string"
+                },
+                "x": {
+                    "type": "string"
+                }
+            }
+        },
+        "jwt.JWKS": {
+            "type": "object",
+            "properties": {
+                "keys": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/jwt.JWK"
+                    }
+                }
+            }
+        },
+        "jwt.PasswordResetJSON": {
+            "type": "object",
+            "properties": {
+                "password": {
+                    "type": "string"
+                },
+                "token": {
+                    "type": "string"
+                }
+            }
+        },
+        "jwt.RecoveryCodesResponse": {
+            "type": "object",
+            "properties": {
+                "codes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "jwt.RefreshAndAccessTokens": {
+            "type": "object",
+            "properties": {
+                "access": {
+                    "type": "string"
+                },
+                "refresh": {
+                    "type": "string"
+                }
+            }
+        },
+        "jwt.RevokeSessionsResponse": {
+            "type": "object",
+            "properties": {
+                "revoked": {
+                    "type": "integer"
+                }
+            }
+        },
+        "jwt.SessionResponse": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "current": {
+                    "type": "boolean"
+                },
+                "device_name": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "ip": {
+                    "type": "string"
+                },
+                "last_used_at": {
+                    "type": "string"
+                },
+                "user_agent": {
+                    "type": "string"
+                }
+            }
+        },
+        "jwt.TOTPEnrollResponse": {
+            "type": "object",
+            "properties": {
+                "secret": {
+                    "type": "string"
+                },
+                "uri": {
+                    "type": "string"
+                }
+            }
+        },
+        "jwt.TwoFactorLoginJSON": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string"
+                },
+                "device_name": {
+                    "type": "string"
+                }
+            }
+        },
+        "jwt.TwoFactorLoginResponse": {
+            "type": "object",
+            "properties": {
+                "access": {
+                    "type": "string"
+                },
+                "recovery_codes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "refresh": {
+                    "type": "string"
+                }
+            }
+        },
+        "jwt.UserJSON": {
+            "type": "object",
+            "properties": {
+                "device_name": {
+                    "type": "string"
+                },
+                "email": {
+                    "type": "string"
+                },
+                "password": {
+                    "type": "string"
+                }
+            }
+        },
+        "jwt.UserTokenJSON": {
+            "type": "object",
+            "properties": {
+                "token": {
+                    "type": "string"
+                }
+            }
+        },
+        "live.Event": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "$ref": "#/definitions/webhooks.ClickData"
+                },
+                "id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "redirect.StatsPageResponse": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "from": {
+                    "type": "string"
+                },
+                "original_url": {
+                    "type": "string"
+                },
+                "referrers": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/stats.Item"
+                    }
+                },
+                "series": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/stats.Point"
+                    }
+                },
+                "short_url": {
+                    "type": "string"
+                },
+                "time_zone": {
+                    "type": "string"
+                },
+                "to": {
+                    "type": "string"
+                },
+                "total": {
+                    "type": "integer"
+                },
+                "unique": {
+                    "type": "integer"
+                }
+            }
+        },
+        "schema.Response": {
             "type": "object",
             "properties": {
-                "access": {
+                "code": {
+                    "type": "integer"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "message": {
                     "type": "string"
                 }
             }
         },
-        "jwt.CheckTokenJSON": {
+        "stats.ConversionEvent": {
             "type": "object",
             "properties": {
-                "token": {
+                "name": {
                     "type": "string"
+                },
+                "total": {
+                    "type": "integer"
                 }
             }
         },
-        "jwt.RefreshAndAccessTokens": {
+        "stats.Conversions": {
             "type": "object",
             "properties": {
-                "access": {
-                    "type": "string"
+                "clicks": {
+                    "type": "integer"
                 },
-                "refresh": {
-                    "type": "string"
+                "converted": {
+                    "type": "integer"
+                },
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/stats.ConversionEvent"
+                    }
+                },
+                "rate": {
+                    "type": "number"
+                },
+                "revenue": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/stats.Revenue"
+                    }
+                },
+                "total": {
+                    "type": "integer"
                 }
             }
         },
-        "jwt.UserJSON": {
+        "stats.Item": {
             "type": "object",
             "properties": {
-                "email": {
+                "new_visitors": {
+                    "type": "integer"
+                },
+                "total": {
+                    "type": "integer"
+                },
+                "unique": {
+                    "type": "integer"
+                },
+                "value": {
                     "type": "string"
+                }
+            }
+        },
+        "stats.Point": {
+            "type": "object",
+            "properties": {
+                "new_visitors": {
+                    "type": "integer"
                 },
-                "password": {
+                "time": {
                     "type": "string"
+                },
+                "total": {
+                    "type": "integer"
+                },
+                "unique": {
+                    "type": "integer"
                 }
             }
         },
-        "schema.Response": {
+        "stats.Report": {
             "type": "object",
             "properties": {
-                "code": {
+                "breakdowns": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "array",
+                        "items": {
+                            "$ref": "#/definitions/stats.Item"
+                        }
+                    }
+                },
+                "conversions": {
+                    "$ref": "#/definitions/stats.Conversions"
+                },
+                "from": {
+                    "type": "string"
+                },
+                "interval": {
+                    "type": "string"
+                },
+                "new_visitors": {
                     "type": "integer"
                 },
-                "message": {
+                "series": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/stats.Point"
+                    }
+                },
+                "time_zone": {
+                    "type": "string"
+                },
+                "to": {
+                    "type": "string"
+                },
+                "total": {
+                    "type": "integer"
+                },
+                "unique": {
+                    "type": "integer"
+                },
+                "unique_error": {
+                    "type": "number"
+                }
+            }
+        },
+        "stats.Revenue": {
+            "type": "object",
+            "properties": {
+                "currency": {
                     "type": "string"
+                },
+                "value": {
+                    "type": "number"
                 }
             }
         },
         "urls.CreateURLBody": {
             "type": "object",
             "properties": {
+                "expires_at": {
+                    "type": "string"
+                },
+                "fallback_url": {
+                    "type": "string"
+                },
+                "no_tracking": {
+                    "type": "boolean"
+                },
                 "original_url": {
                     "type": "string"
+                },
+                "stats_visibility": {
+                    "type": "string"
+                },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
                 }
             }
         },
         "urls.ShortURLBody": {
             "type": "object",
             "properties": {
+                "expires_at": {
+                    "type": "string"
+                },
+                "fallback_url": {
+                    "type": "string"
+                },
+                "no_tracking": {
+                    "type": "boolean"
+                },
                 "original_url": {
                     "type": "string"
+                },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "urls.StatsVisibilityBody": {
+            "type": "object",
+            "properties": {
+                "visibility": {
+                    "type": "string"
+                }
+            }
+        },
+        "urls.TargetingBody": {
+            "type": "object",
+            "properties": {
+                "rules": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/urls.TargetingRuleBody"
+                    }
+                }
+            }
+        },
+        "urls.TargetingResponse": {
+            "type": "object",
+            "properties": {
+                "rules": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/urls.TargetingRuleBody"
+                    }
+                }
+            }
+        },
+        "urls.TargetingRuleBody": {
+            "type": "object",
+            "properties": {
+                "country": {
+                    "type": "string"
+                },
+                "destination": {
+                    "type": "string"
+                },
+                "region": {
+                    "type": "string"
+                }
+            }
+        },
+        "urls.URLClicks": {
+            "type": "object",
+            "properties": {
+                "bots": {
+                    "type": "integer"
+                },
+                "total": {
+                    "type": "integer"
+                },
+                "unique": {
+                    "type": "integer"
+                }
+            }
+        },
+        "urls.URLHealth": {
+            "type": "object",
+            "properties": {
+                "checked_at": {
+                    "type": "string"
+                },
+                "failing": {
+                    "type": "boolean"
+                },
+                "status": {
+                    "type": "integer"
                 }
             }
         },
         "urls.URLResponse": {
             "type": "object",
             "properties": {
+                "block_reason": {
+                    "type": "string"
+                },
+                "blocked": {
+                    "type": "boolean"
+                },
+                "clicks": {
+                    "$ref": "#/definitions/urls.URLClicks"
+                },
                 "created_at": {
                     "type": "string"
                 },
+                "expires_at": {
+                    "type": "string"
+                },
+                "fallback_url": {
+                    "type": "string"
+                },
+                "health": {
+                    "$ref": "#/definitions/urls.URLHealth"
+                },
                 "id": {
                     "type": "integer"
                 },
+                "no_tracking": {
+                    "type": "boolean"
+                },
                 "original_url": {
                     "type": "string"
                 },
+                "paused": {
+                    "type": "boolean"
+                },
+                "short_url": {
+                    "type": "string"
+                },
+                "stats_visibility": {
+                    "type": "string"
+                },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "throttled_until": {
+                    "type": "string"
+                }
+            }
+        },
+        "webhooks.ClickData": {
+            "type": "object",
+            "properties": {
+                "anonymous": {
+                    "type": "boolean"
+                },
+                "browser": {
+                    "type": "string"
+                },
+                "city": {
+                    "type": "string"
+                },
+                "click_id": {
+                    "type": "string"
+                },
+                "country": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "device": {
+                    "type": "string"
+                },
+                "fallback": {
+                    "type": "boolean"
+                },
+                "os": {
+                    "type": "string"
+                },
+                "referrer": {
+                    "type": "string"
+                },
+                "region": {
+                    "type": "string"
+                },
                 "short_url": {
                     "type": "string"
+                },
+                "traffic": {
+                    "type": "string"
+                }
+            }
+        },
+        "webhooks.DeliveryResponse": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "delivered_at": {
+                    "type": "string"
+                },
+                "event": {
+                    "type": "string"
+                },
+                "event_id": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "last_error": {
+                    "type": "string"
+                },
+                "next_attempt_at": {
+                    "type": "string"
+                },
+                "payload": {
+                    "type": "object"
+                },
+                "response_status": {
+                    "type": "integer"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "webhooks.WebhookBody": {
+            "type": "object",
+            "properties": {
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "webhooks.WebhookResponse": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "secret": {
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
                 }
             }
         }
@@ -0,0 +1,269 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+	"gorm.io/gorm"
+)
+
+const (
+	FORMAT_CSV     = "csv"
+	FORMAT_NDJSON  = "ndjson"
+	FORMAT_PARQUET = "parquet"
+
+	// PARQUET_ROW_GROUP_SIZE bounds the bytes buffered by the Parquet writer before a row group is written.
+	PARQUET_ROW_GROUP_SIZE = 16 * 1024 * 1024
+)
+
+var ErrInvalidFormat = errors.New("invalid export format")
+
+// Filter selects the exported clicks. Zero fields do not filter.
+// Tag selects the clicks of every link with the tag.
+type Filter struct {
+	URLID  uint
+	UserID uint
+	Tag    string
+	From   time.Time
+	To     time.Time
+}
+
+// Row is one exported click.
+type Row struct {
+	ID          uint      `gorm:"column:id" json:"id"`
+	ClickID     string    `gorm:"column:click_id" json:"click_id"`
+	CreatedAt   time.Time `gorm:"column:created_at" json:"created_at"`
+	ShortURL    string    `gorm:"column:short_url" json:"short_url"`
+	Destination string    `gorm:"column:destination" json:"destination"`
+	Fallback    bool      `gorm:"column:fallback" json:"fallback"`
+	Traffic     string    `gorm:"column:traffic" json:"traffic"`
+	Anonymous   bool      `gorm:"column:anonymous" json:"anonymous"`
+	FirstVisit  bool      `gorm:"column:first_visit" json:"first_visit"`
+	IPHash      string    `gorm:"column:ip_hash" json:"ip_hash"`
+	VisitorHash string    `gorm:"column:visitor_hash" json:"visitor_hash"`
+	Referrer    string    `gorm:"column:referrer" json:"referrer"`
+	UserAgent   string    `gorm:"column:user_agent" json:"user_agent"`
+	Browser     string    `gorm:"column:browser" json:"browser"`
+	OS          string    `gorm:"column:os" json:"os"`
+	Device      string    `gorm:"column:device" json:"device"`
+	Language    string    `gorm:"column:language" json:"language"`
+	Country     string    `gorm:"column:country" json:"country"`
+	Region      string    `gorm:"column:region" json:"region"`
+	City        string    `gorm:"column:city" json:"city"`
+}
+
+// header lists the CSV columns in the order written by csvRecord.
+var header = []string{
+	"id", "click_id", "created_at", "short_url", "destination", "fallback", "traffic", "anonymous", "first_visit",
+	"ip_hash", "visitor_hash", "referrer", "user_agent", "browser", "os", "device", "language",
+	"country", "region", "city",
+}
+
+// csvRecord converts a row to CSV fields.
+func csvRecord(row Row) []string {
+	return []string{
+		strconv.FormatUint(uint64(row.ID), 10), row.ClickID, row.CreatedAt.UTC().Format(time.RFC3339Nano), row.ShortURL,
+		row.Destination, strconv.FormatBool(row.Fallback), row.Traffic, strconv.FormatBool(row.Anonymous),
+		strconv.FormatBool(row.FirstVisit), row.IPHash, row.VisitorHash, row.Referrer, row.UserAgent,
+		row.Browser, row.OS, row.Device, row.Language, row.Country, row.Region, row.City,
+	}
+}
+
+// IsFormat reports whether the value is a known export format.
+func IsFormat(format string) bool {
+	switch format {
+	case FORMAT_CSV, FORMAT_NDJSON, FORMAT_PARQUET:
+		return true
+	}
+	return false
+}
+
+// ContentType returns the MIME type of an export format.
+func ContentType(format string) string {
+	switch format {
+	case FORMAT_CSV:
+		return "text/csv; charset=utf-8"
+	case FORMAT_NDJSON:
+		return "application/x-ndjson"
+	}
+	return "application/vnd.apache.parquet"
+}
+
+// encoder writes rows in one format.
+type encoder interface {
+	Write(row Row) error
+	Close() error
+}
+
+type csvEncoder struct{ writer *csv.Writer }
+
+func (e *csvEncoder) Write(row Row) error {
+	return e.writer.Write(csvRecord(row))
+}
+
+func (e *csvEncoder) Close() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+type ndjsonEncoder struct{ encoder *json.Encoder }
+
+func (e *ndjsonEncoder) Write(row Row) error {
+	return e.encoder.Encode(row)
+}
+
+func (e *ndjsonEncoder) Close() error {
+	return nil
+}
+
+// parquetRow is the Parquet schema of Row.
+type parquetRow struct {
+	ID          int64  `parquet:"name=id, type=INT64"`
+	ClickID     string `parquet:"name=click_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	CreatedAt   int64  `parquet:"name=created_at, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	ShortURL    string `parquet:"name=short_url, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Destination string `parquet:"name=destination, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Fallback    bool   `parquet:"name=fallback, type=BOOLEAN"`
+	Traffic     string `parquet:"name=traffic, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Anonymous   bool   `parquet:"name=anonymous, type=BOOLEAN"`
+	FirstVisit  bool   `parquet:"name=first_visit, type=BOOLEAN"`
+	IPHash      string `parquet:"name=ip_hash, type=BYTE_ARRAY, convertedtype=UTF8"`
+	VisitorHash string `parquet:"name=visitor_hash, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Referrer    string `parquet:"name=referrer, type=BYTE_ARRAY, convertedtype=UTF8"`
+	UserAgent   string `parquet:"name=user_agent, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Browser     string `parquet:"name=browser, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	OS          string `parquet:"name=os, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Device      string `parquet:"name=device, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Language    string `parquet:"name=language, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Country     string `parquet:"name=country, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Region      string `parquet:"name=region, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	City        string `parquet:"name=city, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+}
+
+type parquetEncoder struct{ writer *writer.ParquetWriter }
+
+func (e *parquetEncoder) Write(row Row) error {
+	return e.writer.Write(parquetRow{
+		ID:          int64(row.ID),
+		ClickID:     row.ClickID,
+		CreatedAt:   row.CreatedAt.UnixMilli(),
+		ShortURL:    row.ShortURL,
+		Destination: row.Destination,
+		Fallback:    row.Fallback,
+		Traffic:     row.Traffic,
+		Anonymous:   row.Anonymous,
+		FirstVisit:  row.FirstVisit,
+		IPHash:      row.IPHash,
+		VisitorHash: row.VisitorHash,
+		Referrer:    row.Referrer,
+		UserAgent:   row.UserAgent,
+		Browser:     row.Browser,
+		OS:          row.OS,
+		Device:      row.Device,
+		Language:    row.Language,
+		Country:     row.Country,
+		Region:      row.Region,
+		City:        row.City,
+	})
+}
+
+func (e *parquetEncoder) Close() error {
+	return e.writer.WriteStop()
+}
+
+// newEncoder creates the encoder of a format.
+func newEncoder(w io.Writer, format string) (encoder, error) {
+	switch format {
+	case FORMAT_CSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(header); err != nil {
+			return nil, err
+		}
+		return &csvEncoder{writer: writer}, nil
+	case FORMAT_NDJSON:
+		return &ndjsonEncoder{encoder: json.NewEncoder(w)}, nil
+	case FORMAT_PARQUET:
+		pw, err := writer.NewParquetWriterFromWriter(w, new(parquetRow), 1)
+		if err != nil {
+			return nil, err
+		}
+		pw.RowGroupSize = PARQUET_ROW_GROUP_SIZE
+		pw.CompressionType = parquet.CompressionCodec_SNAPPY
+		return &parquetEncoder{writer: pw}, nil
+	}
+	return nil, ErrInvalidFormat
+}
+
+// Query builds the query selecting the clicks of a filter in ID order.
+func Query(db *gorm.DB, filter Filter) *gorm.DB {
+	query := db.Table("clicks").
+		Select("clicks.*, urls.short_url").
+		Joins("JOIN urls ON urls.id = clicks.url_id").
+		Where("clicks.deleted_at IS NULL")
+	if filter.URLID != 0 {
+		query = query.Where("clicks.url_id = ?", filter.URLID)
+	}
+	if filter.UserID != 0 {
+		query = query.Where("urls.user_id = ?", filter.UserID)
+	}
+	if filter.Tag != "" {
+		query = query.Where("clicks.url_id IN (?)", db.Table("url_tags").Select("url_id").Where("tag = ?", filter.Tag))
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("clicks.created_at >= ?", filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("clicks.created_at < ?", filter.To.UTC())
+	}
+	return query.Order("clicks.id")
+}
+
+// Write streams the clicks of a filter to w.
+//
+// Rows are read with a database cursor and encoded one at a time, so memory use does
+// not depend on the number of clicks. Parquet output buffers one row group of at most PARQUET_ROW_GROUP_SIZE bytes.
+//
+// Parameters:
+// - db: the database holding the clicks.
+// - w: the output.
+// - format: FORMAT_CSV, FORMAT_NDJSON or FORMAT_PARQUET.
+// - filter: the clicks to export.
+//
+// Returns:
+// - int64: the number of exported clicks.
+// - error: ErrInvalidFormat, a database or a write error.
+func Write(db *gorm.DB, w io.Writer, format string, filter Filter) (int64, error) {
+	enc, err := newEncoder(w, format)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := Query(db, filter).Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var count int64
+	for rows.Next() {
+		var row Row
+		if err := db.ScanRows(rows, &row); err != nil {
+			return count, err
+		}
+		row.CreatedAt = row.CreatedAt.UTC()
+		if err := enc.Write(row); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+	return count, enc.Close()
+}
@@ -0,0 +1,126 @@
+package export_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
+	"urlshort.ru/m/export"
+	"urlshort.ru/m/models"
+	"urlshort.ru/m/tags"
+)
+
+// createClicks creates a link with one click per hour starting at from.
+func createClicks(t *testing.T, shortURL string, from time.Time, count int) models.URL {
+	db := models.DATABASE
+	url := models.URL{OriginalURL: "https://example.com/" + shortURL, ShortURL: shortURL}
+	db.Unscoped().Where("short_url = ?", url.ShortURL).Delete(&models.URL{})
+	if err := db.Create(&url).Error; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	db.Unscoped().Where("url_id = ?", url.ID).Delete(&models.Click{})
+
+	for i := 0; i < count; i++ {
+		click := models.Click{
+			URLID:       url.ID,
+			Destination: url.OriginalURL,
+			Traffic:     models.TRAFFIC_HUMAN,
+			Browser:     "Chrome",
+			Country:     "RU",
+		}
+		click.CreatedAt = from.Add(time.Duration(i) * time.Hour)
+		if err := db.Create(&click).Error; err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	return url
+}
+
+// TestWrite tests that every format exports the filtered clicks.
+func TestWrite(t *testing.T) {
+	from := time.Date(2023, 8, 21, 0, 0, 0, 0, time.UTC)
+	url := createClicks(t, "export-test", from, 5)
+	createClicks(t, "export-other", from, 2)
+	filter := export.Filter{URLID: url.ID, From: from.Add(time.Hour), To: from.Add(4 * time.Hour)}
+
+	var out bytes.Buffer
+	count, err := export.Write(models.DATABASE, &out, export.FORMAT_CSV, filter)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	records, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if count != 3 || len(records) != 4 || records[0][0] != "id" || records[1][3] != url.ShortURL {
+		t.Errorf("Unexpected CSV export of %d clicks: %v", count, records)
+	}
+
+	out.Reset()
+	count, err = export.Write(models.DATABASE, &out, export.FORMAT_NDJSON, filter)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var rows []export.Row
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var row export.Row
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		rows = append(rows, row)
+	}
+	if count != 3 || len(rows) != 3 || !rows[0].CreatedAt.Equal(from.Add(time.Hour)) || rows[2].Country != "RU" {
+		t.Errorf("Unexpected NDJSON export of %d clicks: %+v", count, rows)
+	}
+
+	out.Reset()
+	count, err = export.Write(models.DATABASE, &out, export.FORMAT_PARQUET, export.Filter{URLID: url.ID})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	file, err := buffer.NewBufferFile(out.Bytes())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	pr, err := reader.NewParquetReader(file, nil, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer pr.ReadStop()
+	if count != 5 || pr.GetNumRows() != 5 {
+		t.Errorf("Expected 5 Parquet rows, got %d and %d", count, pr.GetNumRows())
+	}
+
+	if _, err := export.Write(models.DATABASE, &out, "xml", filter); err != export.ErrInvalidFormat {
+		t.Errorf("Expected ErrInvalidFormat, got %v", err)
+	}
+}
+
+// TestWriteTag tests that a tag filter exports the clicks of every tagged link.
+func TestWriteTag(t *testing.T) {
+	from := time.Date(2023, 8, 21, 0, 0, 0, 0, time.UTC)
+	first := createClicks(t, "export-tag-first", from, 2)
+	second := createClicks(t, "export-tag-second", from, 3)
+	createClicks(t, "export-tag-other", from, 4)
+	if err := tags.Set(models.DATABASE, first.ID, []string{"campaign"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := tags.Set(models.DATABASE, second.ID, []string{"campaign", "spring"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var out bytes.Buffer
+	count, err := export.Write(models.DATABASE, &out, export.FORMAT_NDJSON, export.Filter{Tag: "campaign"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if count != 5 {
+		t.Errorf("Expected 5 clicks of tagged links, got %d", count)
+	}
+}
@@ -0,0 +1,190 @@
+package geo
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+	"golang.org/x/exp/slog"
+)
+
+const LOGGER_HANDLER = "geo"
+
+// Location is the place an IP address is registered in. Empty fields are unknown.
+type Location struct {
+	Country string `json:"country"`
+	Region  string `json:"region"`
+	City    string `json:"city"`
+}
+
+// record is the part of a GeoIP2 or GeoLite2 City/Country record that is decoded.
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+// Reader resolves IP addresses with a MaxMind-format database file and reloads
+// the file when it is replaced. A nil *Reader resolves every address to an empty Location.
+type Reader struct {
+	path string
+
+	mu      sync.RWMutex
+	db      *maxminddb.Reader
+	modTime time.Time
+	size    int64
+
+	stop chan struct{}
+}
+
+// Open opens a database file.
+//
+// Parameters:
+// - path: the path of the .mmdb file.
+//
+// Returns:
+// - *Reader: the reader.
+// - error: an error if the file could not be opened or is not a MaxMind database.
+func Open(path string) (*Reader, error) {
+	reader := &Reader{path: path}
+	if err := reader.Reload(); err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+// Reload opens the database file again and swaps it in. On error the previous database stays in use.
+//
+// Returns:
+// - error: an error if the file could not be opened.
+func (r *Reader) Reload() error {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return err
+	}
+	db, err := maxminddb.Open(r.path)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	previous := r.db
+	r.db, r.modTime, r.size = db, info.ModTime(), info.Size()
+	r.mu.Unlock()
+
+	// Lookups hold the read lock, so no lookup uses the previous mapping any more.
+	if previous != nil {
+		previous.Close()
+	}
+	return nil
+}
+
+// Watch checks the database file for changes every interval and reloads it when its
+// modification time or size changed. Replacing the file with a rename is safe.
+//
+// Parameters:
+// - interval: the time between checks, 0 disables watching.
+func (r *Reader) Watch(interval time.Duration) {
+	if r == nil || interval <= 0 || r.stop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	r.stop = stop
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if r.changed() {
+					if err := r.Reload(); err != nil {
+						slog.Error(LOGGER_HANDLER, r.path, err)
+					} else {
+						slog.Info(LOGGER_HANDLER, "reloaded", r.path)
+					}
+				}
+			}
+		}
+	}()
+}
+
+// changed reports whether the database file differs from the loaded one.
+func (r *Reader) changed() bool {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return !info.ModTime().Equal(r.modTime) || info.Size() != r.size
+}
+
+// Close stops watching and closes the database.
+func (r *Reader) Close() error {
+	if r == nil {
+		return nil
+	}
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.db == nil {
+		return nil
+	}
+	err := r.db.Close()
+	r.db = nil
+	return err
+}
+
+// Lookup resolves an IP address.
+//
+// Parameters:
+// - ip: the IP address in text form.
+//
+// Returns:
+// - Location: the location, empty if the address is invalid, not in the database or no database is loaded.
+func (r *Reader) Lookup(ip string) Location {
+	parsed := net.ParseIP(ip)
+	if r == nil || parsed == nil {
+		return Location{}
+	}
+
+	var result record
+	r.mu.RLock()
+	if r.db != nil {
+		if err := r.db.Lookup(parsed, &result); err != nil {
+			slog.Debug(LOGGER_HANDLER, ip, err)
+		}
+	}
+	r.mu.RUnlock()
+
+	location := Location{
+		Country: result.Country.ISOCode,
+		City:    name(result.City.Names),
+	}
+	if len(result.Subdivisions) > 0 {
+		location.Region = name(result.Subdivisions[0].Names)
+		if location.Region == "" {
+			location.Region = result.Subdivisions[0].ISOCode
+		}
+	}
+	return location
+}
+
+// name returns the English name of a record, the database's names are keyed by language.
+func name(names map[string]string) string {
+	return names["en"]
+}
@@ -0,0 +1,121 @@
+package geo_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"urlshort.ru/m/geo"
+)
+
+// encodeString encodes a MaxMind DB UTF-8 string shorter than 29 bytes.
+func encodeString(value string) []byte {
+	return append([]byte{2<<5 | byte(len(value))}, value...)
+}
+
+// encodeMap encodes a MaxMind DB map with fewer than 29 already encoded pairs.
+func encodeMap(pairs ...[]byte) []byte {
+	result := []byte{7<<5 | byte(len(pairs)/2)}
+	for _, pair := range pairs {
+		result = append(result, pair...)
+	}
+	return result
+}
+
+// encodeUint encodes a MaxMind DB uint16 or uint32.
+func encodeUint(kind byte, value uint32) []byte {
+	data := binary.BigEndian.AppendUint32(nil, value)
+	data = bytes.TrimLeft(data, "\x00")
+	return append([]byte{kind<<5 | byte(len(data))}, data...)
+}
+
+// writeDatabase writes an IPv4 database where every address in 0.0.0.0/1 has one location.
+func writeDatabase(t *testing.T, path string, city string) {
+	t.Helper()
+	// One node: the left record points to the first data item, the right one is empty.
+	tree := []byte{0, 0, 1 + 16, 0, 0, 1}
+	data := encodeMap(
+		encodeString("country"), encodeMap(encodeString("iso_code"), encodeString("RU")),
+		encodeString("subdivisions"), append([]byte{1, 4}, encodeMap(encodeString("iso_code"), encodeString("MOW"))...),
+		encodeString("city"), encodeMap(encodeString("names"), encodeMap(encodeString("en"), encodeString(city))),
+	)
+	metadata := encodeMap(
+		encodeString("node_count"), encodeUint(6, 1),
+		encodeString("record_size"), encodeUint(5, 24),
+		encodeString("ip_version"), encodeUint(5, 4),
+		encodeString("database_type"), encodeString("Test-City"),
+		encodeString("binary_format_major_version"), encodeUint(5, 2),
+		encodeString("binary_format_minor_version"), encodeUint(5, 0),
+	)
+
+	var file bytes.Buffer
+	file.Write(tree)
+	file.Write(make([]byte, 16))
+	file.Write(data)
+	file.WriteString("\xab\xcd\xefMaxMind.com")
+	file.Write(metadata)
+
+	// Replace the file with a rename, like database updaters do.
+	temporary := path + ".tmp"
+	if err := os.WriteFile(temporary, file.Bytes(), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := os.Rename(temporary, path); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+// TestLookup tests resolving addresses and degrading to empty locations.
+func TestLookup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	writeDatabase(t, path, "Moscow")
+
+	reader, err := geo.Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer reader.Close()
+
+	want := geo.Location{Country: "RU", Region: "MOW", City: "Moscow"}
+	if got := reader.Lookup("10.1.2.3"); got != want {
+		t.Errorf("Lookup() = %+v, want %+v", got, want)
+	}
+	for _, ip := range []string{"200.1.2.3", "not an ip"} {
+		if got := reader.Lookup(ip); got != (geo.Location{}) {
+			t.Errorf("Lookup(%q) = %+v, want an empty location", ip, got)
+		}
+	}
+
+	var missing *geo.Reader
+	if got := missing.Lookup("10.1.2.3"); got != (geo.Location{}) {
+		t.Errorf("Expected a nil reader to return an empty location, got %+v", got)
+	}
+	if _, err := geo.Open(filepath.Join(t.TempDir(), "missing.mmdb")); err == nil {
+		t.Errorf("Expected an error for a missing file")
+	}
+}
+
+// TestWatch tests that a replaced database file is reloaded.
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	writeDatabase(t, path, "Moscow")
+
+	reader, err := geo.Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer reader.Close()
+	reader.Watch(time.Millisecond * 10)
+
+	writeDatabase(t, path, "Kazan")
+	deadline := time.Now().Add(time.Second * 5)
+	for reader.Lookup("10.1.2.3").City != "Kazan" {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the database to be reloaded")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
@@ -0,0 +1,137 @@
+package health
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/models"
+	"urlshort.ru/m/outbound"
+)
+
+const LOGGER_HANDLER = "health"
+
+// Prober checks whether a destination URL is reachable.
+type Prober interface {
+	Probe(rawURL string) (int, error)
+}
+
+// HTTPProber probes destinations with a HEAD request, falling back to GET
+// for servers that do not allow HEAD.
+type HTTPProber struct {
+	Client *http.Client
+}
+
+// Probe requests the given URL and returns the response status code.
+//
+// Parameters:
+// - rawURL: the destination to check.
+//
+// Returns:
+// - int: the HTTP status code.
+// - error: an error if the request could not be made.
+func (p *HTTPProber) Probe(rawURL string) (int, error) {
+	response, err := p.Client.Head(rawURL)
+	if err != nil {
+		return 0, err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusMethodNotAllowed {
+		return response.StatusCode, nil
+	}
+
+	response, err = p.Client.Get(rawURL)
+	if err != nil {
+		return 0, err
+	}
+	response.Body.Close()
+	return response.StatusCode, nil
+}
+
+// DefaultProber only reaches public addresses, so a link cannot be used to make
+// the service probe internal hosts.
+var DefaultProber Prober = &HTTPProber{
+	Client: outbound.NewClient(config.ConfigAll.HEALTH_CHECK_TIMEOUT),
+}
+
+var inFlight sync.Map
+
+// IsFailure reports whether a probe result means the destination is down.
+//
+// Parameters:
+// - status: the HTTP status code returned by the probe.
+// - err: the error returned by the probe.
+//
+// Returns:
+// - bool: true for transport errors, server errors and missing pages.
+func IsFailure(status int, err error) bool {
+	if err != nil {
+		return true
+	}
+	return status >= 500 || status == http.StatusNotFound || status == http.StatusGone
+}
+
+// Destination chooses where a click on the given link should be sent.
+//
+// The fallback URL is used when the primary destination was last seen failing.
+//
+// Parameters:
+// - url: the link being followed.
+//
+// Returns:
+// - string: the destination URL.
+// - bool: true if the fallback URL was chosen.
+func Destination(url models.URL) (string, bool) {
+	if url.FallbackURL == "" {
+		return url.OriginalURL, false
+	}
+	if url.HealthFailing {
+		return url.FallbackURL, true
+	}
+	return url.OriginalURL, false
+}
+
+// Check probes the primary destination of the link and stores the result.
+//
+// Parameters:
+// - db: the database to store the result in.
+// - url: the link to check.
+func Check(db *gorm.DB, url models.URL) {
+	status, err := DefaultProber.Probe(url.OriginalURL)
+	failing := IsFailure(status, err)
+	if err != nil {
+		slog.Debug(LOGGER_HANDLER, "url", url.OriginalURL, "error", err)
+	}
+
+	checkedAt := time.Now()
+	result := db.Model(&models.URL{}).Where("id = ?", url.ID).Updates(map[string]any{
+		"health_status":     status,
+		"health_failing":    failing,
+		"health_checked_at": &checkedAt,
+	})
+	if result.Error != nil {
+		slog.Error(LOGGER_HANDLER, result.Error)
+	}
+}
+
+// CheckIfStale starts a background check of the link when its health data
+// is older than HEALTH_CHECK_INTERVAL. Only one check per link runs at a time.
+//
+// Parameters:
+// - db: the database to store the result in.
+// - url: the link to check.
+func CheckIfStale(db *gorm.DB, url models.URL) {
+	if url.HealthCheckedAt != nil && time.Since(*url.HealthCheckedAt) < config.ConfigAll.HEALTH_CHECK_INTERVAL {
+		return
+	}
+	if _, loaded := inFlight.LoadOrStore(url.ID, struct{}{}); loaded {
+		return
+	}
+	go func() {
+		defer inFlight.Delete(url.ID)
+		Check(db, url)
+	}()
+}
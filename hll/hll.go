@@ -0,0 +1,258 @@
+package hll
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// HyperLogLog estimates the number of distinct items with a fixed amount of memory.
+//
+// A sketch with precision p has m = 2^p one-byte registers. The relative
+// standard error of the estimate is about 1.04 / sqrt(m):
+//
+//	precision  registers  dense size  standard error
+//	10         1024       1 KiB       3.25%
+//	12         4096       4 KiB       1.63%
+//	14         16384      16 KiB      0.81%
+//	16         65536      64 KiB      0.41%
+//
+// Roughly 68% of estimates fall within one standard error and 95% within two.
+// Sketches with few visitors are stored in a sparse encoding that is much
+// smaller than the dense size.
+
+const (
+	MIN_PRECISION = 4
+	MAX_PRECISION = 16
+
+	encodingDense  = 1
+	encodingSparse = 2
+)
+
+var ErrPrecisionMismatch = errors.New("sketches have different precision")
+
+var ErrInvalidEncoding = errors.New("invalid sketch encoding")
+
+// Sketch is a HyperLogLog sketch.
+type Sketch struct {
+	precision uint8
+	registers []uint8
+}
+
+// New creates an empty sketch.
+//
+// Parameters:
+// - precision: the number of index bits, clamped to MIN_PRECISION..MAX_PRECISION.
+//
+// Returns:
+// - *Sketch: the empty sketch.
+func New(precision int) *Sketch {
+	if precision < MIN_PRECISION {
+		precision = MIN_PRECISION
+	}
+	if precision > MAX_PRECISION {
+		precision = MAX_PRECISION
+	}
+	return &Sketch{
+		precision: uint8(precision),
+		registers: make([]uint8, 1<<precision),
+	}
+}
+
+// PrecisionForError returns the smallest precision whose standard error does not exceed the given rate.
+//
+// Parameters:
+// - rate: the relative standard error, for example 0.01 for 1%.
+//
+// Returns:
+// - int: the precision, clamped to MIN_PRECISION..MAX_PRECISION.
+func PrecisionForError(rate float64) int {
+	if rate <= 0 {
+		return MAX_PRECISION
+	}
+	precision := int(math.Ceil(math.Log2(math.Pow(1.04/rate, 2))))
+	if precision < MIN_PRECISION {
+		return MIN_PRECISION
+	}
+	if precision > MAX_PRECISION {
+		return MAX_PRECISION
+	}
+	return precision
+}
+
+// StandardError returns the relative standard error of sketches with the given precision.
+func StandardError(precision int) float64 {
+	return 1.04 / math.Sqrt(float64(uint(1)<<precision))
+}
+
+// Precision returns the precision of the sketch.
+func (s *Sketch) Precision() int {
+	return int(s.precision)
+}
+
+// Add adds a 64-bit hash of an item to the sketch.
+func (s *Sketch) Add(hash uint64) {
+	index := hash >> (64 - s.precision)
+	rest := hash<<s.precision | 1<<(s.precision-1)
+	rank := uint8(bits.LeadingZeros64(rest)) + 1
+	if rank > s.registers[index] {
+		s.registers[index] = rank
+	}
+}
+
+// AddString hashes an item and adds it to the sketch.
+func (s *Sketch) AddString(item string) {
+	s.Add(Hash(item))
+}
+
+// Hash returns a well mixed 64-bit hash of a string.
+func Hash(item string) uint64 {
+	hasher := fnv.New64a()
+	hasher.Write([]byte(item))
+	hash := hasher.Sum64()
+	// splitmix64 finalizer, FNV alone leaves the high bits poorly mixed for short inputs.
+	hash ^= hash >> 30
+	hash *= 0xbf58476d1ce4e5b9
+	hash ^= hash >> 27
+	hash *= 0x94d049bb133111eb
+	hash ^= hash >> 31
+	return hash
+}
+
+// Estimate returns the estimated number of distinct items.
+func (s *Sketch) Estimate() uint64 {
+	m := float64(len(s.registers))
+	sum := 0.0
+	zeros := 0
+	for _, register := range s.registers {
+		sum += 1 / float64(uint64(1)<<register)
+		if register == 0 {
+			zeros++
+		}
+	}
+
+	estimate := alpha(len(s.registers)) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// Merge adds every item of other to the sketch. A sketch with a higher
+// precision is reduced to the precision of the receiver first.
+//
+// Parameters:
+// - other: the sketch to merge.
+//
+// Returns:
+// - error: ErrPrecisionMismatch if other has a lower precision than the receiver.
+func (s *Sketch) Merge(other *Sketch) error {
+	if other.precision < s.precision {
+		return ErrPrecisionMismatch
+	}
+	if other.precision > s.precision {
+		other = other.Reduce(int(s.precision))
+	}
+	for i, register := range other.registers {
+		if register > s.registers[i] {
+			s.registers[i] = register
+		}
+	}
+	return nil
+}
+
+// Reduce returns a copy of the sketch with a lower precision, as if every item
+// had been added to a sketch of that precision.
+//
+// Parameters:
+// - precision: the new precision, not higher than the current one.
+//
+// Returns:
+// - *Sketch: the reduced sketch.
+func (s *Sketch) Reduce(precision int) *Sketch {
+	reduced := New(precision)
+	shift := s.precision - reduced.precision
+	for index, register := range s.registers {
+		if register == 0 {
+			continue
+		}
+		dropped := uint64(index) & (1<<shift - 1)
+		rank := register + shift
+		if dropped != 0 {
+			rank = shift - uint8(bits.Len64(dropped)) + 1
+		}
+		newIndex := index >> shift
+		if rank > reduced.registers[newIndex] {
+			reduced.registers[newIndex] = rank
+		}
+	}
+	return reduced
+}
+
+// MarshalBinary encodes the sketch in the smaller of the dense and sparse encodings.
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	sparse := []byte{encodingSparse, s.precision}
+	for index, register := range s.registers {
+		if register == 0 {
+			continue
+		}
+		sparse = binary.AppendUvarint(sparse, uint64(index))
+		sparse = append(sparse, register)
+		if len(sparse) >= len(s.registers)+2 {
+			break
+		}
+	}
+	if len(sparse) < len(s.registers)+2 {
+		return sparse, nil
+	}
+
+	dense := make([]byte, 0, len(s.registers)+2)
+	dense = append(dense, encodingDense, s.precision)
+	return append(dense, s.registers...), nil
+}
+
+// UnmarshalBinary decodes a sketch encoded by MarshalBinary.
+func (s *Sketch) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 || data[1] < MIN_PRECISION || data[1] > MAX_PRECISION {
+		return ErrInvalidEncoding
+	}
+	decoded := New(int(data[1]))
+
+	switch data[0] {
+	case encodingDense:
+		if len(data)-2 != len(decoded.registers) {
+			return ErrInvalidEncoding
+		}
+		copy(decoded.registers, data[2:])
+	case encodingSparse:
+		rest := data[2:]
+		for len(rest) > 0 {
+			index, n := binary.Uvarint(rest)
+			if n <= 0 || n >= len(rest) || index >= uint64(len(decoded.registers)) {
+				return ErrInvalidEncoding
+			}
+			decoded.registers[index] = rest[n]
+			rest = rest[n+1:]
+		}
+	default:
+		return ErrInvalidEncoding
+	}
+
+	*s = *decoded
+	return nil
+}
+
+// alpha returns the bias correction constant for m registers.
+func alpha(m int) float64 {
+	switch m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	}
+	return 0.7213 / (1 + 1.079/float64(m))
+}
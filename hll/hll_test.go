@@ -0,0 +1,99 @@
+package hll_test
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"urlshort.ru/m/hll"
+)
+
+// TestEstimate tests that estimates stay within a few standard errors of the real cardinality.
+func TestEstimate(t *testing.T) {
+	for _, count := range []int{0, 1, 100, 10000, 200000} {
+		sketch := hll.New(14)
+		for i := 0; i < count; i++ {
+			sketch.AddString(fmt.Sprintf("visitor-%d", i))
+			sketch.AddString(fmt.Sprintf("visitor-%d", i))
+		}
+		got := float64(sketch.Estimate())
+		bound := 3 * hll.StandardError(14) * float64(count)
+		if math.Abs(got-float64(count)) > math.Max(bound, 1) {
+			t.Errorf("Estimate() = %v, want %d ± %v", got, count, bound)
+		}
+	}
+}
+
+// TestMerge tests that merging sketches estimates the union and that precision is reduced as needed.
+func TestMerge(t *testing.T) {
+	first := hll.New(14)
+	second := hll.New(12)
+	for i := 0; i < 20000; i++ {
+		first.AddString(fmt.Sprintf("visitor-%d", i))
+		second.AddString(fmt.Sprintf("visitor-%d", i+10000))
+	}
+
+	if err := first.Merge(second); err != hll.ErrPrecisionMismatch {
+		t.Errorf("Expected ErrPrecisionMismatch, got %v", err)
+	}
+
+	union := hll.New(12)
+	if err := union.Merge(first); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := union.Merge(second); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got := float64(union.Estimate())
+	if bound := 3 * hll.StandardError(12) * 30000; math.Abs(got-30000) > bound {
+		t.Errorf("Estimate() = %v, want 30000 ± %v", got, bound)
+	}
+
+	// Reducing must match adding the same items to a lower precision sketch directly.
+	direct := hll.New(12)
+	for i := 0; i < 20000; i++ {
+		direct.AddString(fmt.Sprintf("visitor-%d", i))
+	}
+	if first.Reduce(12).Estimate() != direct.Estimate() {
+		t.Errorf("Reduce(12) estimate = %d, want %d", first.Reduce(12).Estimate(), direct.Estimate())
+	}
+}
+
+// TestMarshalBinary tests the sparse and dense encodings.
+func TestMarshalBinary(t *testing.T) {
+	for _, count := range []int{3, 50000} {
+		sketch := hll.New(10)
+		for i := 0; i < count; i++ {
+			sketch.AddString(fmt.Sprintf("visitor-%d", i))
+		}
+		data, err := sketch.MarshalBinary()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(data) > 1024+2 {
+			t.Errorf("Encoded size %d is larger than the dense encoding", len(data))
+		}
+
+		decoded := &hll.Sketch{}
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if decoded.Precision() != 10 || decoded.Estimate() != sketch.Estimate() {
+			t.Errorf("Decoded sketch estimates %d, want %d", decoded.Estimate(), sketch.Estimate())
+		}
+	}
+
+	if err := (&hll.Sketch{}).UnmarshalBinary([]byte{9, 10}); err == nil {
+		t.Errorf("Expected an error for an unknown encoding")
+	}
+}
+
+// TestPrecisionForError tests deriving the precision from the error rate.
+func TestPrecisionForError(t *testing.T) {
+	tests := map[float64]int{0.01: 14, 0.02: 12, 0.5: 4, 0: 16}
+	for rate, want := range tests {
+		if got := hll.PrecisionForError(rate); got != want {
+			t.Errorf("PrecisionForError(%v) = %d, want %d", rate, got, want)
+		}
+	}
+}
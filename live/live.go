@@ -0,0 +1,238 @@
+package live
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/models"
+	"urlshort.ru/m/webhooks"
+)
+
+const LOGGER_HANDLER = "live"
+
+// SUBSCRIBER_BUFFER is the number of events queued for a subscriber. A subscriber that
+// falls further behind is dropped and reconnects with Last-Event-ID.
+const SUBSCRIBER_BUFFER = 256
+
+// Event is one click pushed to live subscribers. ID is the click row ID, it increases
+// with every stored click and is used as the SSE event ID.
+type Event struct {
+	ID   uint               `json:"id"`
+	Data webhooks.ClickData `json:"data"`
+}
+
+// Subscriber receives the clicks of one link. Events is closed when the subscriber is
+// dropped for being slow or when the hub closes.
+type Subscriber struct {
+	URLID  uint
+	Events chan Event
+
+	shortURL string
+}
+
+// Hub pushes stored clicks to the subscribers of their links.
+//
+// Clicks are written by every prefork child, so instead of in-process notifications the
+// hub polls the shared clicks table for rows with an ID above the last one it has seen.
+// Each process runs one hub and one query per poll, however many subscribers it serves.
+type Hub struct {
+	db       *gorm.DB
+	interval time.Duration
+
+	mu          sync.Mutex
+	subscribers map[uint]map[*Subscriber]struct{}
+	lastID      uint
+	done        chan struct{}
+	closed      bool
+}
+
+// NewHub creates a hub that starts after the clicks already stored and polls every interval.
+//
+// Parameters:
+// - db: the database the clicks are written to.
+// - interval: the poll interval.
+//
+// Returns:
+// - *Hub: the running hub.
+func NewHub(db *gorm.DB, interval time.Duration) *Hub {
+	hub := &Hub{
+		db:          db,
+		interval:    interval,
+		subscribers: map[uint]map[*Subscriber]struct{}{},
+		done:        make(chan struct{}),
+	}
+	hub.lastID = hub.maxID()
+	go hub.run()
+	return hub
+}
+
+// maxID returns the ID of the newest stored click.
+func (h *Hub) maxID() uint {
+	var id uint
+	if err := h.db.Model(&models.Click{}).Select("COALESCE(MAX(id), 0)").Scan(&id).Error; err != nil {
+		slog.Error(LOGGER_HANDLER, err)
+	}
+	return id
+}
+
+// run polls until the hub is closed.
+func (h *Hub) run() {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-ticker.C:
+			h.Poll()
+		}
+	}
+}
+
+// Poll sends the clicks stored since the previous poll to the subscribers of their links.
+func (h *Hub) Poll() {
+	h.mu.Lock()
+	urlIDs := make([]uint, 0, len(h.subscribers))
+	for urlID := range h.subscribers {
+		urlIDs = append(urlIDs, urlID)
+	}
+	from := h.lastID
+	h.mu.Unlock()
+
+	to := h.maxID()
+	if to <= from {
+		return
+	}
+
+	var rows []models.Click
+	if len(urlIDs) > 0 {
+		err := h.db.Where("id > ? AND id <= ? AND url_id IN ?", from, to, urlIDs).Order("id").Find(&rows).Error
+		if err != nil {
+			slog.Error(LOGGER_HANDLER, err)
+			return
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastID = to
+	for _, row := range rows {
+		for subscriber := range h.subscribers[row.URLID] {
+			select {
+			case subscriber.Events <- Event{ID: row.ID, Data: webhooks.NewClickData(row, subscriber.shortURL)}:
+			default:
+				h.remove(subscriber)
+			}
+		}
+	}
+}
+
+// Subscribe registers a subscriber for the clicks of a link stored from now on.
+//
+// Parameters:
+// - url: the link.
+//
+// Returns:
+// - *Subscriber: the subscriber, already closed if the hub is closed.
+func (h *Hub) Subscribe(url models.URL) *Subscriber {
+	subscriber := &Subscriber{URLID: url.ID, Events: make(chan Event, SUBSCRIBER_BUFFER), shortURL: url.ShortURL}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(subscriber.Events)
+		return subscriber
+	}
+	if h.subscribers[url.ID] == nil {
+		h.subscribers[url.ID] = map[*Subscriber]struct{}{}
+	}
+	h.subscribers[url.ID][subscriber] = struct{}{}
+	return subscriber
+}
+
+// Unsubscribe removes a subscriber. It is safe to call more than once.
+func (h *Hub) Unsubscribe(subscriber *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(subscriber)
+}
+
+// remove deletes a subscriber and closes its channel. The caller holds the lock.
+func (h *Hub) remove(subscriber *Subscriber) {
+	subscribers, ok := h.subscribers[subscriber.URLID]
+	if !ok {
+		return
+	}
+	if _, ok := subscribers[subscriber]; !ok {
+		return
+	}
+	delete(subscribers, subscriber)
+	close(subscriber.Events)
+	if len(subscribers) == 0 {
+		delete(h.subscribers, subscriber.URLID)
+	}
+}
+
+// Close stops polling and closes every subscriber, which ends the open streams.
+func (h *Hub) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil
+	}
+	h.closed = true
+	close(h.done)
+	for _, subscribers := range h.subscribers {
+		for subscriber := range subscribers {
+			h.remove(subscriber)
+		}
+	}
+	return nil
+}
+
+// Since returns the clicks of a link stored after a click ID, used to resume a stream
+// from the Last-Event-ID a client reconnects with.
+//
+// Parameters:
+// - db: the database.
+// - url: the link.
+// - afterID: the ID of the last event the client received.
+// - limit: the maximum number of returned events. When more were missed, the newest are
+// returned, so the replay joins the live events without a gap.
+//
+// Returns:
+// - []Event: the missed events in ID order.
+// - error: a database error.
+func Since(db *gorm.DB, url models.URL, afterID uint, limit int) ([]Event, error) {
+	var rows []models.Click
+	err := db.Where("url_id = ? AND id > ?", url.ID, afterID).Order("id DESC").Limit(limit).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	events := make([]Event, len(rows))
+	for i, row := range rows {
+		events[len(rows)-1-i] = Event{ID: row.ID, Data: webhooks.NewClickData(row, url.ShortURL)}
+	}
+	return events, nil
+}
+
+// Default is the hub of this process, nil until Start is called.
+var Default *Hub
+
+// Start creates the Default hub polling every LIVE_POLL_INTERVAL.
+//
+// Parameters:
+// - db: the database the clicks are written to.
+func Start(db *gorm.DB) {
+	Default = NewHub(db, config.ConfigAll.LIVE_POLL_INTERVAL)
+}
+
+// Stop closes the Default hub.
+func Stop() error {
+	if Default == nil {
+		return nil
+	}
+	return Default.Close()
+}
@@ -0,0 +1,98 @@
+package live_test
+
+import (
+	"testing"
+	"time"
+
+	"urlshort.ru/m/clicks"
+	"urlshort.ru/m/live"
+	"urlshort.ru/m/models"
+)
+
+// createURL creates a link without clicks.
+func createURL(t *testing.T, shortURL string) models.URL {
+	db := models.DATABASE
+	url := models.URL{OriginalURL: "https://example.com/" + shortURL, ShortURL: shortURL}
+	db.Unscoped().Where("short_url = ?", url.ShortURL).Delete(&models.URL{})
+	if err := db.Create(&url).Error; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return url
+}
+
+// record stores a click on a link and returns its ID.
+func record(t *testing.T, url models.URL) uint {
+	click := clicks.NewClick(url, url.OriginalURL, false, clicks.Visit{IP: "10.0.0.1", UserAgent: "agent"})
+	if err := clicks.Record(models.DATABASE, &click); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return click.ID
+}
+
+// TestHub tests that subscribers receive new clicks of their link only.
+func TestHub(t *testing.T) {
+	db := models.DATABASE
+	url := createURL(t, "live-test")
+	other := createURL(t, "live-other")
+	before := record(t, url)
+
+	hub := live.NewHub(db, time.Hour)
+	subscriber := hub.Subscribe(url)
+	first := record(t, url)
+	record(t, other)
+	second := record(t, url)
+	hub.Poll()
+
+	for _, want := range []uint{first, second} {
+		select {
+		case event := <-subscriber.Events:
+			if event.ID != want || event.Data.ShortURL != url.ShortURL {
+				t.Errorf("Expected click %d, got %+v", want, event)
+			}
+		default:
+			t.Fatalf("Expected click %d", want)
+		}
+	}
+	if len(subscriber.Events) != 0 {
+		t.Errorf("Expected no more events, got %d", len(subscriber.Events))
+	}
+
+	missed, err := live.Since(db, url, before, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(missed) != 1 || missed[0].ID != second {
+		t.Errorf("Expected the newest missed click %d, got %+v", second, missed)
+	}
+
+	hub.Close()
+	if _, ok := <-subscriber.Events; ok {
+		t.Errorf("Expected the subscriber to be closed")
+	}
+	hub.Unsubscribe(subscriber)
+}
+
+// TestSlowSubscriber tests that a subscriber with a full buffer is dropped.
+func TestSlowSubscriber(t *testing.T) {
+	url := createURL(t, "live-slow")
+	hub := live.NewHub(models.DATABASE, time.Hour)
+	defer hub.Close()
+	subscriber := hub.Subscribe(url)
+
+	batch := make([]models.Click, live.SUBSCRIBER_BUFFER+1)
+	for i := range batch {
+		batch[i] = clicks.NewClick(url, url.OriginalURL, false, clicks.Visit{})
+	}
+	if err := clicks.WriteBatch(models.DATABASE, batch); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	hub.Poll()
+
+	received := 0
+	for range subscriber.Events {
+		received++
+	}
+	if received != live.SUBSCRIBER_BUFFER {
+		t.Errorf("Expected %d events before the drop, got %d", live.SUBSCRIBER_BUFFER, received)
+	}
+}
@@ -0,0 +1,221 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+	"urlshort.ru/m/config"
+)
+
+const LOGGER_HANDLER = "mailer"
+
+// Drivers of MAIL_DRIVER.
+const (
+	DRIVER_SMTP = "smtp"
+	DRIVER_FILE = "file"
+	DRIVER_LOG  = "log"
+)
+
+var (
+	ErrAddress  = errors.New("invalid email address")
+	ErrNoDriver = errors.New("MAIL_DRIVER is not set, emails are not sent")
+)
+
+// Message is a plain text email.
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Body    string
+}
+
+// Bytes encodes the message in the Internet Message Format with UTF-8 text. The addresses
+// are checked, so a header cannot be injected through them.
+//
+// Returns:
+// - []byte: the encoded message.
+// - error: ErrAddress if From or To is not a single address.
+func (m Message) Bytes() ([]byte, error) {
+	for _, address := range []string{m.From, m.To} {
+		if _, err := mail.ParseAddress(address); err != nil || strings.ContainsAny(address, "\r\n") {
+			return nil, ErrAddress
+		}
+	}
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "From: %s\r\n", m.From)
+	fmt.Fprintf(&buffer, "To: %s\r\n", m.To)
+	fmt.Fprintf(&buffer, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&buffer, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buffer.WriteString("MIME-Version: 1.0\r\n")
+	buffer.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buffer.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	buffer.WriteString(strings.ReplaceAll(strings.ReplaceAll(m.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return buffer.Bytes(), nil
+}
+
+// Mailer sends emails.
+type Mailer interface {
+	Send(message Message) error
+}
+
+// SMTPMailer sends emails through an SMTP server. The connection is upgraded with STARTTLS
+// when the server supports it, and PLAIN authentication is used when Username is set.
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+}
+
+// Send sends a message.
+//
+// Parameters:
+// - message: the message.
+//
+// Returns:
+// - error: an encoding or SMTP error.
+func (m *SMTPMailer) Send(message Message) error {
+	data, err := message.Bytes()
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	address := net.JoinHostPort(m.Host, strconv.Itoa(m.Port))
+	return smtp.SendMail(address, auth, message.From, []string{message.To}, data)
+}
+
+// FileMailer writes every email to its own .eml file in an outbox directory, for development
+// and tests without a mail server.
+type FileMailer struct {
+	Dir string
+}
+
+// Send writes a message to a new file named by the time and a random suffix.
+//
+// Parameters:
+// - message: the message.
+//
+// Returns:
+// - error: an encoding or file error.
+func (m *FileMailer) Send(message Message) error {
+	data, err := message.Bytes()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+	return os.WriteFile(filepath.Join(m.Dir, name), data, 0o600)
+}
+
+// LogMailer logs emails instead of sending them. The body is logged in full, links and
+// tokens included, so it is meant for development only and is never chosen by default.
+type LogMailer struct{}
+
+// Send logs a message.
+//
+// Parameters:
+// - message: the message.
+//
+// Returns:
+// - error: ErrAddress if an address is invalid.
+func (LogMailer) Send(message Message) error {
+	if _, err := message.Bytes(); err != nil {
+		return err
+	}
+	slog.Info(LOGGER_HANDLER, "from", message.From, "to", message.To, "subject", message.Subject, "body", message.Body)
+	return nil
+}
+
+// DisabledMailer refuses every email. It is used when MAIL_DRIVER is not set, so links and
+// tokens are never written anywhere unless a driver is chosen.
+type DisabledMailer struct{}
+
+// Send returns ErrNoDriver.
+func (DisabledMailer) Send(message Message) error {
+	return ErrNoDriver
+}
+
+// IsDriver reports whether the value is a known MAIL_DRIVER.
+func IsDriver(driver string) bool {
+	return driver == DRIVER_SMTP || driver == DRIVER_FILE || driver == DRIVER_LOG
+}
+
+// CheckConfig reports an error if MAIL_DRIVER is set to an unknown driver. It is called on
+// start, so a typo does not silently disable or redirect the emails.
+func CheckConfig() error {
+	if driver := config.ConfigAll.MAIL_DRIVER; driver != "" && !IsDriver(driver) {
+		return fmt.Errorf("unknown MAIL_DRIVER %q", driver)
+	}
+	return nil
+}
+
+// FromConfig returns the mailer of MAIL_DRIVER: smtp with the SMTP_ settings, file with
+// MAIL_OUTBOX_DIR or log. Without a driver, or with an unknown one, emails are not sent.
+//
+// Returns:
+// - Mailer: the mailer.
+func FromConfig() Mailer {
+	switch config.ConfigAll.MAIL_DRIVER {
+	case DRIVER_SMTP:
+		return &SMTPMailer{
+			Host:     config.ConfigAll.SMTP_HOST,
+			Port:     config.ConfigAll.SMTP_PORT,
+			Username: config.ConfigAll.SMTP_USERNAME,
+			Password: config.ConfigAll.SMTP_PASSWORD,
+		}
+	case DRIVER_FILE:
+		return &FileMailer{Dir: config.ConfigAll.MAIL_OUTBOX_DIR}
+	case DRIVER_LOG:
+		slog.Warn(LOGGER_HANDLER, "driver", DRIVER_LOG, "detail", "emails are logged with their links and tokens, use for development only")
+		return LogMailer{}
+	case "":
+		slog.Warn(LOGGER_HANDLER, "driver", "empty, emails are not sent")
+	default:
+		slog.Error(LOGGER_HANDLER, "unknown driver", config.ConfigAll.MAIL_DRIVER)
+	}
+	return DisabledMailer{}
+}
+
+// Default sends the emails of the app.
+var Default Mailer = FromConfig()
+
+// Send renders a template with Render and sends it from MAIL_FROM with Default.
+//
+// Parameters:
+// - to: the recipient.
+// - name: the template name.
+// - data: the template data.
+//
+// Returns:
+// - error: a template, encoding or sending error.
+func Send(to string, name string, data any) error {
+	message, err := Render(name, data)
+	if err != nil {
+		return err
+	}
+	message.From = config.ConfigAll.MAIL_FROM
+	message.To = to
+	return Default.Send(message)
+}
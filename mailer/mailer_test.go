@@ -0,0 +1,101 @@
+package mailer_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/mailer"
+)
+
+// TestRender tests the default templates and the override of a template by a directory.
+func TestRender(t *testing.T) {
+	data := map[string]string{"Email": "user@example.com", "Link": "https://example.com/verify?token=abc", "ExpiresIn": "2 days"}
+	message, err := mailer.Render(mailer.TEMPLATE_VERIFY_EMAIL, data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if message.Subject != "Confirm your email" || !strings.Contains(message.Body, data["Link"]) {
+		t.Errorf("Unexpected message: %+v", message)
+	}
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, mailer.TEMPLATE_VERIFY_EMAIL), []byte("Subject: Bitte bestätigen\n\n{{.Link}}\n"), 0o600)
+	os.WriteFile(filepath.Join(dir, "broken.tmpl"), []byte("no subject\n\nbody"), 0o600)
+	templates, err := mailer.LoadTemplates(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	original := mailer.Templates
+	mailer.Templates = templates
+	defer func() { mailer.Templates = original }()
+
+	if message, _ := mailer.Render(mailer.TEMPLATE_VERIFY_EMAIL, data); message.Subject != "Bitte bestätigen" || message.Body != data["Link"]+"\n" {
+		t.Errorf("Expected the template to be replaced, got %+v", message)
+	}
+	if message, _ := mailer.Render(mailer.TEMPLATE_PASSWORD_RESET, data); message.Subject != "Reset your password" {
+		t.Errorf("Expected the other default template to be kept, got %+v", message)
+	}
+	if _, err := mailer.Render("broken.tmpl", data); !errors.Is(err, mailer.ErrTemplate) {
+		t.Errorf("Expected a template without subject to fail, got %v", err)
+	}
+}
+
+// TestFileMailer tests that messages are written to the outbox and that header injection
+// through an address is rejected.
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	m := &mailer.FileMailer{Dir: dir}
+	message := mailer.Message{From: "no-reply@example.com", To: "user@example.com", Subject: "Привет", Body: "line 1\nline 2"}
+	if err := m.Send(message); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("Expected one file, got %v", files)
+	}
+	data, _ := os.ReadFile(files[0])
+	text := string(data)
+	for _, expected := range []string{"To: user@example.com\r\n", "Subject: =?utf-8?q?", "\r\n\r\nline 1\r\nline 2"} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("Expected %q in %q", expected, text)
+		}
+	}
+
+	message.To = "user@example.com\r\nBcc: other@example.com"
+	if err := m.Send(message); !errors.Is(err, mailer.ErrAddress) {
+		t.Errorf("Expected an injected header to be rejected, got %v", err)
+	}
+}
+
+// TestFromConfig tests that emails are not sent or logged unless a driver is chosen, and
+// that an unknown driver fails the start.
+func TestFromConfig(t *testing.T) {
+	driver := config.ConfigAll.MAIL_DRIVER
+	defer func() { config.ConfigAll.MAIL_DRIVER = driver }()
+
+	config.ConfigAll.MAIL_DRIVER = ""
+	if err := mailer.CheckConfig(); err != nil {
+		t.Errorf("Expected an empty driver to be allowed, got %v", err)
+	}
+	message := mailer.Message{From: "no-reply@example.com", To: "user@example.com", Subject: "Reset", Body: "token"}
+	if err := mailer.FromConfig().Send(message); !errors.Is(err, mailer.ErrNoDriver) {
+		t.Errorf("Expected no email to be sent without a driver, got %v", err)
+	}
+
+	config.ConfigAll.MAIL_DRIVER = "lgo"
+	if err := mailer.CheckConfig(); err == nil {
+		t.Errorf("Expected an unknown driver to be rejected")
+	}
+	if err := mailer.FromConfig().Send(message); !errors.Is(err, mailer.ErrNoDriver) {
+		t.Errorf("Expected no email to be sent with an unknown driver, got %v", err)
+	}
+
+	config.ConfigAll.MAIL_DRIVER = mailer.DRIVER_LOG
+	if _, ok := mailer.FromConfig().(mailer.LogMailer); !ok || mailer.CheckConfig() != nil {
+		t.Errorf("Expected the log driver to be chosen explicitly")
+	}
+}
@@ -0,0 +1,67 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// Templates of the emails sent by the app.
+const (
+	TEMPLATE_VERIFY_EMAIL   = "verify_email.tmpl"
+	TEMPLATE_PASSWORD_RESET = "password_reset.tmpl"
+	TEMPLATE_SPIKE_ALERT    = "spike_alert.tmpl"
+)
+
+var ErrTemplate = errors.New("template has no subject line")
+
+//go:embed templates
+var defaultTemplates embed.FS
+
+// Templates renders the emails. A template is the text of an email: a "Subject: " line, an
+// empty line and the body.
+var Templates = template.Must(template.ParseFS(defaultTemplates, "templates/*.tmpl"))
+
+// LoadTemplates parses the default templates and then the .tmpl files of a directory, so a
+// file named like a default template replaces it and other defaults are kept.
+//
+// Parameters:
+// - dir: the directory, MAIL_TEMPLATES_DIR.
+//
+// Returns:
+// - *template.Template: the templates.
+// - error: an error if a file could not be read or parsed.
+func LoadTemplates(dir string) (*template.Template, error) {
+	templates, err := template.ParseFS(defaultTemplates, "templates/*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+	return templates.ParseFS(os.DirFS(dir), "*.tmpl")
+}
+
+// Render executes a template of Templates into a message without addresses.
+//
+// Parameters:
+// - name: the template name, for example TEMPLATE_VERIFY_EMAIL.
+// - data: the template data.
+//
+// Returns:
+// - Message: the message with Subject and Body set.
+// - error: an execution error or ErrTemplate.
+func Render(name string, data any) (Message, error) {
+	var buffer bytes.Buffer
+	if err := Templates.ExecuteTemplate(&buffer, name, data); err != nil {
+		return Message{}, err
+	}
+	text := strings.ReplaceAll(buffer.String(), "\r\n", "\n")
+	header, body, _ := strings.Cut(strings.TrimLeft(text, "\n"), "\n\n")
+	subject, ok := strings.CutPrefix(header, "Subject: ")
+	if !ok || strings.Contains(subject, "\n") {
+		return Message{}, fmt.Errorf("%s: %w", name, ErrTemplate)
+	}
+	return Message{Subject: strings.TrimSpace(subject), Body: body}, nil
+}
@@ -1,14 +1,27 @@
 package main
 
 import (
+	"os"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/swagger"
 	"golang.org/x/exp/slog"
+	"urlshort.ru/m/anomaly"
 	"urlshort.ru/m/api"
+	"urlshort.ru/m/api/jwt"
+	"urlshort.ru/m/cli"
+	"urlshort.ru/m/clicks"
 	"urlshort.ru/m/config"
 	"urlshort.ru/m/docs"
-	_ "urlshort.ru/m/models"
+	"urlshort.ru/m/geo"
+	"urlshort.ru/m/live"
+	"urlshort.ru/m/mailer"
+	"urlshort.ru/m/models"
+	"urlshort.ru/m/privacy"
+	"urlshort.ru/m/screening"
+	"urlshort.ru/m/shutdown"
+	"urlshort.ru/m/webhooks"
 )
 
 // @title Fiber Example API
@@ -22,8 +35,24 @@ import (
 // @host localhost:8080
 // @BasePath /
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		os.Exit(cli.Export(os.Args[2:]))
+	}
+
 	config := config.ConfigAll
 	slog.Debug("config", config)
+	if err := privacy.CheckConfig(); err != nil {
+		slog.Error("config", err)
+		os.Exit(1)
+	}
+	if err := mailer.CheckConfig(); err != nil {
+		slog.Error("config", err)
+		os.Exit(1)
+	}
+	if err := jwt.CheckConfig(); err != nil {
+		slog.Error("config", err)
+		os.Exit(1)
+	}
 
 	docs.SwaggerInfo.Title = "Swagger Example API"
 	docs.SwaggerInfo.Description = "This is a sample swagger for Fiber"
@@ -31,20 +60,80 @@ func main() {
 	docs.SwaggerInfo.BasePath = "/"
 	docs.SwaggerInfo.Schemes = []string{"http", "https"}
 
+	privacy.Start(models.DATABASE)
+	if !fiber.IsChild() {
+		privacy.StartRetention(models.DATABASE)
+		webhooks.Start(models.DATABASE)
+		anomaly.Start(models.DATABASE)
+		jwt.StartPurge(models.DATABASE)
+	}
+
+	if config.THREAT_LIST_PATH != "" && !fiber.IsChild() {
+		imported, err := screening.ImportThreatFile(models.DATABASE, config.THREAT_LIST_PATH, config.THREAT_LIST_FORMAT)
+		if err != nil {
+			slog.Error("Error", err)
+		} else {
+			slog.Info("threat list imported", imported)
+			screening.RescanAsync(models.DATABASE)
+		}
+	}
+
 	// TODO init start fiber
 	app := fiber.New(fiber.Config{
 		Prefork:      true,
 		ServerHeader: "Fiber",
 	})
 	app.Use(cors.New())
-	api.Register(app)
+
+	if !app.Config().Prefork || fiber.IsChild() {
+		if err := clicks.LoadBots(); err != nil {
+			slog.Error("Error", err)
+		}
+		if config.GEO_DB_PATH != "" {
+			locator, err := geo.Open(config.GEO_DB_PATH)
+			if err != nil {
+				slog.Error("Error", err)
+			} else {
+				locator.Watch(config.GEO_RELOAD_INTERVAL)
+				clicks.Geo = locator
+			}
+		}
+		if config.JWT_KEYS_FILE != "" {
+			keys, err := jwt.OpenKeySet(config.JWT_KEYS_FILE)
+			if err != nil {
+				slog.Error("Error", err)
+			} else {
+				keys.Watch(config.JWT_KEYS_RELOAD)
+				jwt.Keys = keys
+			}
+		}
+		if config.MAIL_TEMPLATES_DIR != "" {
+			templates, err := mailer.LoadTemplates(config.MAIL_TEMPLATES_DIR)
+			if err != nil {
+				slog.Error("Error", err)
+			} else {
+				mailer.Templates = templates
+			}
+		}
+		clicks.Start(models.DATABASE)
+		app.Hooks().OnShutdown(clicks.Stop)
+		live.Start(models.DATABASE)
+		go func() {
+			<-shutdown.Stopping()
+			live.Stop()
+		}()
+	}
+	shutdown.Handle(app, config.SHUTDOWN_TIMEOUT)
 
 	app.Get("/docs/*", swagger.New(swagger.Config{
 		Title:        "Swagger Example API",
 		DocExpansion: "list",
 	}))
 
+	api.Register(app)
+
 	slog.Error("Error", app.Listen(":8080"))
+	shutdown.Wait()
 
 	// TODO init routes
 
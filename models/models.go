@@ -11,17 +11,250 @@ const (
 	ROLE_ADMIN = "admin"
 )
 
+const (
+	LIST_DENY  = "deny"
+	LIST_ALLOW = "allow"
+
+	MATCH_EXACT  = "exact"
+	MATCH_SUFFIX = "suffix"
+	MATCH_REGEX  = "regex"
+
+	THREAT_DOMAIN      = "domain"
+	THREAT_HASH_PREFIX = "hash_prefix"
+)
+
+const (
+	STATS_PUBLIC   = "public"
+	STATS_PRIVATE  = "private"
+	STATS_DISABLED = "disabled"
+)
+
+const (
+	TRAFFIC_HUMAN   = "human"
+	TRAFFIC_BOT     = "bot"
+	TRAFFIC_PREVIEW = "preview"
+)
+
 type URL struct {
 	gorm.Model
-	OriginalURL string    `gorm:"uniqueIndex"`
-	ShortURL    string    `gorm:"uniqueIndex"`
-	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at,omitempty"`
+	OriginalURL     string     `gorm:"uniqueIndex"`
+	ShortURL        string     `gorm:"uniqueIndex"`
+	FallbackURL     string     `json:"fallback_url,omitempty"`
+	UserID          *uint      `gorm:"index" json:"user_id,omitempty"`
+	StatsVisibility string     `gorm:"not null; default:public" json:"stats_visibility"`
+	NoTracking      bool       `gorm:"default:false" json:"no_tracking"`
+	ExpiresAt       *time.Time `gorm:"index" json:"expires_at,omitempty"`
+	ExpiryNotified  bool       `gorm:"default:false" json:"-"`
+	CreatedAt       time.Time  `gorm:"autoCreateTime" json:"created_at,omitempty"`
+	HealthStatus    int        `json:"health_status,omitempty"`
+	HealthFailing   bool       `gorm:"default:false" json:"health_failing"`
+	HealthCheckedAt *time.Time `json:"health_checked_at,omitempty"`
+	Blocked         bool       `gorm:"default:false; index" json:"blocked"`
+	BlockReason     string     `json:"block_reason,omitempty"`
+	Paused          bool       `gorm:"default:false" json:"paused"`
+	ThrottledUntil  *time.Time `json:"throttled_until,omitempty"`
+	TotalClicks     int64      `gorm:"default:0" json:"total_clicks"`
+	UniqueClicks    int64      `gorm:"default:0" json:"unique_clicks"`
+	BotClicks       int64      `gorm:"default:0" json:"bot_clicks"`
 }
 
 type User struct {
 	gorm.Model
-	Email        string `gorm:"uniqueIndex; not null"`
-	Password     string `gorm:"not null"`
-	RefreshToken string `gorm:"index"`
-	Role         string `gorm:"default:'user'"`
+	Email           string `gorm:"uniqueIndex; not null"`
+	Password        string `gorm:"not null"`
+	RefreshToken    string `gorm:"index"`
+	Role            string `gorm:"default:'user'"`
+	TokenVersion    int    `gorm:"default:0"`
+	EmailVerifiedAt *time.Time
+	TOTPSecret      string
+	TOTPEnabledAt   *time.Time
+	TOTPLastStep    int64
+}
+
+type RecoveryCode struct {
+	gorm.Model
+	UserID   uint   `gorm:"not null; index"`
+	CodeHash string `gorm:"not null; index"`
+	UsedAt   *time.Time
+}
+
+type TwoFactorPolicy struct {
+	gorm.Model
+	Role     string `gorm:"uniqueIndex; not null"`
+	Required bool
+}
+
+type UserToken struct {
+	gorm.Model
+	UserID    uint      `gorm:"not null; index"`
+	Purpose   string    `gorm:"not null; index"`
+	TokenHash string    `gorm:"uniqueIndex; not null"`
+	Email     string    `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+}
+
+type Session struct {
+	gorm.Model
+	UserID           uint       `gorm:"not null; index" json:"user_id"`
+	DeviceName       string     `json:"device_name"`
+	UserAgent        string     `json:"user_agent"`
+	IP               string     `json:"ip"`
+	LastUsedAt       time.Time  `json:"last_used_at"`
+	RefreshTokenHash string     `gorm:"index" json:"-"`
+	ExpiresAt        time.Time  `gorm:"index" json:"expires_at"`
+	RevokedAt        *time.Time `gorm:"index" json:"revoked_at,omitempty"`
+}
+
+type Click struct {
+	gorm.Model
+	URLID       uint `gorm:"index; index:idx_click_url_visitor,priority:1; not null"`
+	URL         URL
+	Destination string `gorm:"not null"`
+	Fallback    bool   `gorm:"default:false"`
+	VisitorHash string `gorm:"index:idx_click_url_visitor,priority:2"`
+	IPHash      string
+	Referrer    string
+	UserAgent   string
+	Browser     string
+	OS          string
+	Device      string
+	Language    string
+	Country     string
+	Region      string
+	City        string
+	FirstVisit  bool   `gorm:"default:false"`
+	Traffic     string `gorm:"not null; default:human; index"`
+	Anonymous   bool   `gorm:"default:false"`
+	ClickID     string `gorm:"index"`
+}
+
+type Conversion struct {
+	gorm.Model
+	URLID     uint      `gorm:"not null; index" json:"url_id"`
+	ClickID   string    `gorm:"not null; uniqueIndex:idx_conversion_click_name,priority:1" json:"click_id"`
+	Name      string    `gorm:"not null; uniqueIndex:idx_conversion_click_name,priority:2" json:"name"`
+	Value     float64   `gorm:"not null; default:0" json:"value"`
+	Currency  string    `json:"currency,omitempty"`
+	ClickedAt time.Time `gorm:"not null; index" json:"clicked_at"`
+}
+
+type ClickVisitor struct {
+	URLID       uint   `gorm:"primaryKey; autoIncrement:false"`
+	VisitorHash string `gorm:"primaryKey"`
+}
+
+type ClickRollup struct {
+	ID        uint      `gorm:"primarykey"`
+	URLID     uint      `gorm:"not null; uniqueIndex:idx_rollup_key,priority:1"`
+	Bucket    time.Time `gorm:"not null; uniqueIndex:idx_rollup_key,priority:2"`
+	Dimension string    `gorm:"not null; uniqueIndex:idx_rollup_key,priority:3"`
+	Value     string    `gorm:"not null; uniqueIndex:idx_rollup_key,priority:4"`
+	Traffic   string    `gorm:"not null; default:human; uniqueIndex:idx_rollup_key,priority:5"`
+	Clicks    int64     `gorm:"not null; default:0"`
+	Unique    int64     `gorm:"column:unique_clicks; not null; default:0"`
+	Tracked   int64     `gorm:"column:tracked_clicks; not null; default:0"`
+}
+
+type VisitorSketch struct {
+	ID        uint      `gorm:"primarykey"`
+	URLID     uint      `gorm:"not null; uniqueIndex:idx_sketch_key,priority:1"`
+	Day       time.Time `gorm:"not null; uniqueIndex:idx_sketch_key,priority:2"`
+	Traffic   string    `gorm:"not null; default:human; uniqueIndex:idx_sketch_key,priority:3"`
+	Dimension string    `gorm:"not null; default:total; uniqueIndex:idx_sketch_key,priority:4"`
+	Value     string    `gorm:"not null; default:''; uniqueIndex:idx_sketch_key,priority:5"`
+	Registers []byte    `gorm:"not null"`
+}
+
+type Webhook struct {
+	gorm.Model
+	UserID uint   `gorm:"not null; index" json:"user_id"`
+	URL    string `gorm:"not null" json:"url"`
+	Secret string `gorm:"not null" json:"-"`
+	Events string `gorm:"not null" json:"events"`
+}
+
+type WebhookDelivery struct {
+	gorm.Model
+	WebhookID      uint       `gorm:"not null; index" json:"webhook_id"`
+	EventID        string     `gorm:"not null; index" json:"event_id"`
+	Event          string     `gorm:"not null" json:"event"`
+	Payload        string     `gorm:"not null" json:"payload"`
+	Status         string     `gorm:"not null; default:pending; index:idx_delivery_due,priority:1" json:"status"`
+	NextAttemptAt  time.Time  `gorm:"index:idx_delivery_due,priority:2" json:"next_attempt_at"`
+	Attempts       int        `gorm:"not null; default:0" json:"attempts"`
+	ResponseStatus int        `json:"response_status,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
+
+type Alert struct {
+	gorm.Model
+	URLID      uint       `gorm:"not null; uniqueIndex:idx_alert_url_bucket,priority:1" json:"url_id"`
+	URL        URL        `json:"-"`
+	Bucket     time.Time  `gorm:"not null; uniqueIndex:idx_alert_url_bucket,priority:2" json:"bucket"`
+	Clicks     int64      `gorm:"not null" json:"clicks"`
+	Baseline   float64    `gorm:"not null" json:"baseline"`
+	Threshold  float64    `gorm:"not null" json:"threshold"`
+	Action     string     `gorm:"not null; default:none" json:"action"`
+	ResolvedAt *time.Time `gorm:"index" json:"resolved_at,omitempty"`
+}
+
+type LoginThrottle struct {
+	gorm.Model
+	Subject       string     `gorm:"uniqueIndex; not null" json:"subject"`
+	Failures      int        `gorm:"default:0" json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `gorm:"index" json:"locked_until,omitempty"`
+}
+
+type AuditEntry struct {
+	gorm.Model
+	Action  string `gorm:"not null; index" json:"action"`
+	Subject string `gorm:"index" json:"subject"`
+	ActorID *uint  `json:"actor_id,omitempty"`
+	IP      string `json:"ip"`
+	Detail  string `json:"detail"`
+}
+
+type DeniedToken struct {
+	JTI       string    `gorm:"primaryKey"`
+	ExpiresAt time.Time `gorm:"not null; index"`
+}
+
+type DailySalt struct {
+	Day  string `gorm:"primaryKey"`
+	Salt string `gorm:"not null"`
+}
+
+type URLTag struct {
+	URLID uint   `gorm:"primaryKey; autoIncrement:false"`
+	Tag   string `gorm:"primaryKey; index"`
+}
+
+type TargetingRule struct {
+	gorm.Model
+	URLID       uint   `gorm:"not null; index" json:"-"`
+	Country     string `gorm:"not null" json:"country"`
+	Region      string `gorm:"not null; default:''" json:"region,omitempty"`
+	Destination string `gorm:"not null" json:"destination"`
+}
+
+type ClickSalt struct {
+	ID   uint   `gorm:"primaryKey"`
+	Salt string `gorm:"not null"`
+}
+
+type ScreeningRule struct {
+	gorm.Model
+	List    string `gorm:"not null; index" json:"list"`
+	Match   string `gorm:"not null" json:"match"`
+	Pattern string `gorm:"not null" json:"pattern"`
+}
+
+type ThreatEntry struct {
+	ID     uint   `gorm:"primarykey"`
+	Source string `gorm:"not null; index"`
+	Kind   string `gorm:"not null; index:idx_threat_kind_value"`
+	Value  string `gorm:"not null; index:idx_threat_kind_value"`
 }
@@ -3,6 +3,7 @@ package models
 import (
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"golang.org/x/exp/slog"
@@ -45,6 +46,13 @@ func InitDB(DB_NAME string) *gorm.DB {
 		},
 	)
 
+	// Prefork children and the click writers share the database file,
+	// so writers wait for the lock instead of failing with SQLITE_BUSY.
+	// An empty name keeps the private temporary database used by tests.
+	if DB_NAME != "" && !strings.Contains(DB_NAME, "?") {
+		DB_NAME += "?_busy_timeout=5000&_journal_mode=WAL"
+	}
+
 	db, err := gorm.Open(sqlite.Open(DB_NAME), &gorm.Config{
 		Logger: newLogger,
 	})
@@ -63,5 +71,5 @@ func InitDB(DB_NAME string) *gorm.DB {
 //
 // There is no return type for this function.
 func Migrate(db *gorm.DB) {
-	db.AutoMigrate(&URL{}, &User{})
+	db.AutoMigrate(&URL{}, &URLTag{}, &TargetingRule{}, &User{}, &UserToken{}, &RecoveryCode{}, &TwoFactorPolicy{}, &Session{}, &DeniedToken{}, &LoginThrottle{}, &AuditEntry{}, &Click{}, &ClickVisitor{}, &ClickRollup{}, &VisitorSketch{}, &Conversion{}, &Webhook{}, &WebhookDelivery{}, &Alert{}, &DailySalt{}, &ClickSalt{}, &ScreeningRule{}, &ThreatEntry{})
 }
@@ -0,0 +1,128 @@
+package outbound
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"time"
+)
+
+var (
+	ErrForbiddenAddress = errors.New("destination resolves to a non-public address")
+	ErrNoAddress        = errors.New("destination has no address")
+)
+
+// nonPublic lists the ranges that are not reachable on the public internet and
+// are not covered by the netip.Addr predicates.
+var nonPublic = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// IsPublic reports whether the address belongs to the public internet.
+// Loopback, private, link-local (including cloud metadata endpoints), multicast,
+// unspecified and reserved addresses are not public.
+func IsPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range nonPublic {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// Resolve looks up the host and returns its addresses if every one of them is public.
+//
+// Parameters:
+// - ctx: the context bounding the lookup.
+// - host: a host name or an IP literal.
+//
+// Returns:
+// - []netip.Addr: the public addresses of the host.
+// - error: ErrForbiddenAddress if any address is not public, or the lookup error.
+func Resolve(ctx context.Context, host string) ([]netip.Addr, error) {
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, ErrNoAddress
+	}
+	for _, addr := range addrs {
+		if !IsPublic(addr) {
+			return nil, ErrForbiddenAddress
+		}
+	}
+	return addrs, nil
+}
+
+// CheckHost reports an error if the host does not resolve to public addresses only.
+// It is used when a destination is registered; DialContext repeats the check on
+// every connection, so a host that is later pointed at an internal address is still refused.
+func CheckHost(ctx context.Context, host string) error {
+	_, err := Resolve(ctx, host)
+	return err
+}
+
+// DialContext connects only to public addresses.
+//
+// The host is resolved once and the connection is made to the checked address
+// itself, so the name cannot be rebound to an internal address between the check
+// and the dial.
+func DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := Resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{}
+	for _, addr := range addrs {
+		var conn net.Conn
+		conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(addr.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// NewClient returns an HTTP client for requests to user supplied URLs.
+//
+// The client dials public addresses only, ignores proxy settings from the
+// environment and never follows redirects: a redirect response is returned to
+// the caller as is.
+//
+// Parameters:
+// - timeout: the limit for the whole request.
+//
+// Returns:
+// - *http.Client: the restricted client.
+func NewClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(request *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
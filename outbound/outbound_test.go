@@ -0,0 +1,51 @@
+package outbound_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"urlshort.ru/m/outbound"
+)
+
+func TestIsPublic(t *testing.T) {
+	tests := map[string]bool{
+		"93.184.216.34":    true,
+		"2606:4700::1111":  true,
+		"127.0.0.1":        false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"::1":              false,
+		"fd00::1":          false,
+		"fe80::1":          false,
+		"::ffff:127.0.0.1": false,
+	}
+	for raw, want := range tests {
+		if got := outbound.IsPublic(netip.MustParseAddr(raw)); got != want {
+			t.Errorf("IsPublic(%s) = %v, want %v", raw, got, want)
+		}
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	_, err := outbound.NewClient(time.Second).Get(server.URL)
+	if !errors.Is(err, outbound.ErrForbiddenAddress) {
+		t.Fatalf("expected a loopback server to be refused, got %v", err)
+	}
+	if err := outbound.CheckHost(context.Background(), "localhost"); !errors.Is(err, outbound.ErrForbiddenAddress) {
+		t.Fatalf("expected localhost to be refused, got %v", err)
+	}
+}
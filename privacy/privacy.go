@@ -0,0 +1,117 @@
+package privacy
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/utils"
+)
+
+const LOGGER_HANDLER = "privacy"
+
+const (
+	// IP_MODE_HASH stores a SHA-256 hash of the IP salted with CLICK_SALT, or with a random
+	// salt stored in the database if CLICK_SALT is not set.
+	IP_MODE_HASH = "hash"
+	// IP_MODE_DAILY_HASH stores a SHA-256 hash of the IP salted with a random salt that is
+	// replaced every day and deleted afterwards, so hashes cannot be linked across days.
+	IP_MODE_DAILY_HASH = "daily_hash"
+	// IP_MODE_TRUNCATE stores the IP with the host part zeroed: /24 for IPv4 and /48 for IPv6.
+	IP_MODE_TRUNCATE = "truncate"
+)
+
+// IsIPMode reports whether the value is a known IP mode.
+func IsIPMode(mode string) bool {
+	switch mode {
+	case IP_MODE_HASH, IP_MODE_DAILY_HASH, IP_MODE_TRUNCATE:
+		return true
+	}
+	return false
+}
+
+// CheckConfig validates PRIVACY_IP_MODE and CLICK_RETENTION_MODE. An unknown value
+// would silently fall back to another mode, so the service refuses to start instead.
+//
+// Returns:
+// - error: an error naming the invalid setting.
+func CheckConfig() error {
+	if !IsIPMode(config.ConfigAll.PRIVACY_IP_MODE) {
+		return fmt.Errorf("unknown PRIVACY_IP_MODE %q", config.ConfigAll.PRIVACY_IP_MODE)
+	}
+	if !IsRetentionMode(config.ConfigAll.CLICK_RETENTION_MODE) {
+		return fmt.Errorf("unknown CLICK_RETENTION_MODE %q", config.ConfigAll.CLICK_RETENTION_MODE)
+	}
+	return nil
+}
+
+// TruncateIP zeroes the host part of an IP address, keeping a /24 of IPv4 and a /48 of IPv6 addresses.
+//
+// Parameters:
+// - ip: the IP address in text form.
+//
+// Returns:
+// - string: the truncated address, empty if ip is not an IP address.
+func TruncateIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// HashIP hashes an IP address with a salt.
+func HashIP(ip string, salt string) string {
+	return utils.GenerateShortHashSHA256(salt + ip)
+}
+
+// AnonymizeIP converts an IP address to the value stored with clicks according to PRIVACY_IP_MODE.
+//
+// In IP_MODE_DAILY_HASH the salt of the day the click happened on is used. If a salt cannot be
+// loaded the IP is truncated instead, so a raw or unsalted address is never stored.
+//
+// Parameters:
+// - ip: the IP address of the visitor.
+// - at: the time of the click.
+//
+// Returns:
+// - string: the hash or truncated address.
+func AnonymizeIP(ip string, at time.Time) string {
+	switch config.ConfigAll.PRIVACY_IP_MODE {
+	case IP_MODE_TRUNCATE:
+		return TruncateIP(ip)
+	case IP_MODE_DAILY_HASH:
+		salt, err := Salts.Salt(at)
+		if err != nil {
+			slog.Error(LOGGER_HANDLER, err)
+			return TruncateIP(ip)
+		}
+		return HashIP(ip, salt)
+	}
+	if config.ConfigAll.CLICK_SALT == "" {
+		return TruncateIP(ip)
+	}
+	return HashIP(ip, config.ConfigAll.CLICK_SALT)
+}
+
+// OptedOut reports whether a visitor asked not to be tracked with the DNT or Sec-GPC
+// header. It is always false when PRIVACY_HONOR_DNT is disabled.
+//
+// Parameters:
+// - doNotTrack: the DNT header value.
+// - globalPrivacyControl: the Sec-GPC header value.
+//
+// Returns:
+// - bool: true if the visitor opted out.
+func OptedOut(doNotTrack string, globalPrivacyControl string) bool {
+	if !config.ConfigAll.PRIVACY_HONOR_DNT {
+		return false
+	}
+	return strings.TrimSpace(doNotTrack) == "1" || strings.TrimSpace(globalPrivacyControl) == "1"
+}
@@ -0,0 +1,186 @@
+package privacy_test
+
+import (
+	"testing"
+	"time"
+
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/models"
+	"urlshort.ru/m/privacy"
+)
+
+// TestTruncateIP tests zeroing the host part of IPv4 and IPv6 addresses.
+func TestTruncateIP(t *testing.T) {
+	tests := map[string]string{
+		"203.0.113.57":            "203.0.113.0",
+		"2001:db8:85a3:1:2:3:4:5": "2001:db8:85a3::",
+		"::ffff:198.51.100.7":     "198.51.100.0",
+		"garbage":                 "",
+	}
+	for input, want := range tests {
+		if got := privacy.TruncateIP(input); got != want {
+			t.Errorf("TruncateIP(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+// TestOptedOut tests the DNT and Sec-GPC headers.
+func TestOptedOut(t *testing.T) {
+	config.ConfigAll.PRIVACY_HONOR_DNT = true
+	if !privacy.OptedOut("1", "") || !privacy.OptedOut("", "1") {
+		t.Errorf("Expected DNT: 1 and Sec-GPC: 1 to opt out")
+	}
+	if privacy.OptedOut("0", "") || privacy.OptedOut("", "") {
+		t.Errorf("Expected visitors without headers to be tracked")
+	}
+	config.ConfigAll.PRIVACY_HONOR_DNT = false
+	defer func() { config.ConfigAll.PRIVACY_HONOR_DNT = true }()
+	if privacy.OptedOut("1", "1") {
+		t.Errorf("Expected headers to be ignored when PRIVACY_HONOR_DNT is disabled")
+	}
+}
+
+// TestAnonymizeIP tests the IP modes and the rotation of daily salts.
+func TestAnonymizeIP(t *testing.T) {
+	config.ConfigAll.LOCATION = time.UTC
+	defer func() { config.ConfigAll.PRIVACY_IP_MODE = privacy.IP_MODE_HASH }()
+	day := time.Date(2023, 8, 21, 10, 0, 0, 0, time.UTC)
+	models.DATABASE.Where("day IN ?", []string{"2023-08-21", "2023-08-22"}).Delete(&models.DailySalt{})
+
+	config.ConfigAll.PRIVACY_IP_MODE = privacy.IP_MODE_TRUNCATE
+	if got := privacy.AnonymizeIP("203.0.113.57", day); got != "203.0.113.0" {
+		t.Errorf("AnonymizeIP() = %q in truncate mode", got)
+	}
+
+	config.ConfigAll.PRIVACY_IP_MODE = privacy.IP_MODE_HASH
+	if privacy.AnonymizeIP("203.0.113.57", day) != privacy.AnonymizeIP("203.0.113.57", day.AddDate(0, 0, 1)) {
+		t.Errorf("Expected static hashes to be equal across days")
+	}
+
+	config.ConfigAll.PRIVACY_IP_MODE = privacy.IP_MODE_DAILY_HASH
+	privacy.Start(models.DATABASE)
+	first := privacy.AnonymizeIP("203.0.113.57", day)
+	if first != privacy.AnonymizeIP("203.0.113.57", day.Add(time.Hour)) {
+		t.Errorf("Expected daily hashes to be equal within a day")
+	}
+	// A second store, like another prefork child, must use the same salt.
+	other := privacy.NewDailySalts(models.DATABASE)
+	salt, err := other.Salt(day)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if privacy.HashIP("203.0.113.57", salt) != first {
+		t.Errorf("Expected every salt store to share the salt of a day")
+	}
+	if first == privacy.AnonymizeIP("203.0.113.57", day.AddDate(0, 0, 1)) {
+		t.Errorf("Expected daily hashes to differ across days")
+	}
+
+	result, err := privacy.Purge(models.DATABASE, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var count int64
+	models.DATABASE.Model(&models.DailySalt{}).Where("day = ?", "2023-08-21").Count(&count)
+	if result.Salts == 0 || count != 0 {
+		t.Errorf("Expected the salt of a past day to be deleted, got %+v and %d rows", result, count)
+	}
+}
+
+// TestPurge tests that expired clicks are deleted and rollups kept or deleted by mode.
+func TestPurge(t *testing.T) {
+	config.ConfigAll.LOCATION = time.UTC
+	defer func() { config.ConfigAll.CLICK_RETENTION_DAYS = 0 }()
+	db := models.DATABASE
+
+	url := models.URL{OriginalURL: "https://example.com/retention", ShortURL: "retention-test"}
+	db.Unscoped().Where("short_url = ?", url.ShortURL).Delete(&models.URL{})
+	if err := db.Create(&url).Error; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	db.Unscoped().Where("url_id = ?", url.ID).Delete(&models.Click{})
+	db.Where("url_id = ?", url.ID).Delete(&models.ClickRollup{})
+
+	now := time.Date(2023, 8, 21, 10, 0, 0, 0, time.UTC)
+	for _, at := range []time.Time{now.AddDate(0, 0, -40), now.AddDate(0, 0, -1)} {
+		click := models.Click{URLID: url.ID, Destination: url.OriginalURL}
+		click.CreatedAt = at
+		rollup := models.ClickRollup{URLID: url.ID, Bucket: at.Truncate(time.Hour), Dimension: "total", Clicks: 1}
+		if err := db.Create(&click).Error; err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := db.Create(&rollup).Error; err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	countRows := func() (clicks int64, rollups int64) {
+		db.Unscoped().Model(&models.Click{}).Where("url_id = ?", url.ID).Count(&clicks)
+		db.Model(&models.ClickRollup{}).Where("url_id = ?", url.ID).Count(&rollups)
+		return clicks, rollups
+	}
+
+	config.ConfigAll.CLICK_RETENTION_DAYS = 0
+	if _, err := privacy.Purge(db, now); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if clicks, _ := countRows(); clicks != 2 {
+		t.Errorf("Expected clicks to be kept without a retention period, got %d", clicks)
+	}
+
+	config.ConfigAll.CLICK_RETENTION_DAYS = 30
+	config.ConfigAll.CLICK_RETENTION_MODE = privacy.RETENTION_AGGREGATE
+	if _, err := privacy.Purge(db, now); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if clicks, rollups := countRows(); clicks != 1 || rollups != 2 {
+		t.Errorf("Expected 1 click and 2 rollups after aggregation, got %d and %d", clicks, rollups)
+	}
+
+	config.ConfigAll.CLICK_RETENTION_MODE = privacy.RETENTION_DELETE
+	if _, err := privacy.Purge(db, now); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if clicks, rollups := countRows(); clicks != 1 || rollups != 1 {
+		t.Errorf("Expected 1 click and 1 rollup after deletion, got %d and %d", clicks, rollups)
+	}
+}
+
+// TestLoadClickSalt tests that the generated click salt is stored once and shared.
+func TestLoadClickSalt(t *testing.T) {
+	first, err := privacy.LoadClickSalt(models.DATABASE)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	second, err := privacy.LoadClickSalt(models.DATABASE)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if first == "" || first != second {
+		t.Errorf("Expected one stored salt, got %q and %q", first, second)
+	}
+	if first == config.ConfigAll.SECRET_KEY_JWT {
+		t.Errorf("Expected the click salt not to reuse the JWT secret")
+	}
+}
+
+// TestCheckConfig tests that unknown privacy modes are rejected.
+func TestCheckConfig(t *testing.T) {
+	ipMode, retentionMode := config.ConfigAll.PRIVACY_IP_MODE, config.ConfigAll.CLICK_RETENTION_MODE
+	defer func() {
+		config.ConfigAll.PRIVACY_IP_MODE, config.ConfigAll.CLICK_RETENTION_MODE = ipMode, retentionMode
+	}()
+
+	config.ConfigAll.PRIVACY_IP_MODE, config.ConfigAll.CLICK_RETENTION_MODE = privacy.IP_MODE_TRUNCATE, privacy.RETENTION_DELETE
+	if err := privacy.CheckConfig(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	config.ConfigAll.PRIVACY_IP_MODE = "hashed"
+	if err := privacy.CheckConfig(); err == nil {
+		t.Errorf("Expected an unknown IP mode to be rejected")
+	}
+	config.ConfigAll.PRIVACY_IP_MODE, config.ConfigAll.CLICK_RETENTION_MODE = privacy.IP_MODE_HASH, "keep"
+	if err := privacy.CheckConfig(); err == nil {
+		t.Errorf("Expected an unknown retention mode to be rejected")
+	}
+}
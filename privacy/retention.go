@@ -0,0 +1,130 @@
+package privacy
+
+import (
+	"time"
+
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/models"
+)
+
+const (
+	// RETENTION_AGGREGATE deletes expired raw clicks and keeps the hourly rollups and daily sketches.
+	RETENTION_AGGREGATE = "aggregate"
+	// RETENTION_DELETE deletes expired raw clicks together with their rollups and sketches.
+	RETENTION_DELETE = "delete"
+
+	PURGE_BATCH_SIZE = 1000
+)
+
+// IsRetentionMode reports whether the value is a known retention mode.
+func IsRetentionMode(mode string) bool {
+	return mode == RETENTION_AGGREGATE || mode == RETENTION_DELETE
+}
+
+// PurgeResult counts the rows removed by Purge.
+type PurgeResult struct {
+	Clicks   int64 `json:"clicks"`
+	Rollups  int64 `json:"rollups"`
+	Sketches int64 `json:"sketches"`
+	Salts    int64 `json:"salts"`
+}
+
+// Purge applies the retention policy.
+//
+// Raw clicks older than CLICK_RETENTION_DAYS whole days are deleted; with RETENTION_DELETE
+// the rollups and sketches of those days are deleted too. Daily salts of past days are
+// always deleted, which makes their hashes unlinkable. CLICK_RETENTION_DAYS of 0 keeps clicks forever.
+//
+// Parameters:
+// - db: the database.
+// - now: the current time.
+//
+// Returns:
+// - PurgeResult: the number of deleted rows.
+// - error: a database error.
+func Purge(db *gorm.DB, now time.Time) (PurgeResult, error) {
+	var result PurgeResult
+
+	deleted := db.Where("day < ?", Day(now)).Delete(&models.DailySalt{})
+	if deleted.Error != nil {
+		return result, deleted.Error
+	}
+	result.Salts = deleted.RowsAffected
+
+	days := config.ConfigAll.CLICK_RETENTION_DAYS
+	if days <= 0 {
+		return result, nil
+	}
+	local := now.In(config.ConfigAll.LOCATION)
+	cutoff := time.Date(local.Year(), local.Month(), local.Day()-days, 0, 0, 0, 0, local.Location()).UTC()
+
+	// Deleting in batches keeps every write transaction short, so click writers are not blocked.
+	for {
+		var ids []uint
+		err := db.Unscoped().Model(&models.Click{}).Where("created_at < ?", cutoff).Limit(PURGE_BATCH_SIZE).Pluck("id", &ids).Error
+		if err != nil {
+			return result, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+		deleted := db.Unscoped().Where("id IN ?", ids).Delete(&models.Click{})
+		if deleted.Error != nil {
+			return result, deleted.Error
+		}
+		result.Clicks += deleted.RowsAffected
+	}
+
+	if config.ConfigAll.CLICK_RETENTION_MODE == RETENTION_DELETE {
+		deleted := db.Where("bucket < ?", cutoff).Delete(&models.ClickRollup{})
+		if deleted.Error != nil {
+			return result, deleted.Error
+		}
+		result.Rollups = deleted.RowsAffected
+
+		deleted = db.Where("day < ?", cutoff).Delete(&models.VisitorSketch{})
+		if deleted.Error != nil {
+			return result, deleted.Error
+		}
+		result.Sketches = deleted.RowsAffected
+	}
+	return result, nil
+}
+
+// Start creates the daily salt store used by AnonymizeIP and loads the stored
+// click salt if CLICK_SALT is not set.
+//
+// Parameters:
+// - db: the database the salts are stored in.
+func Start(db *gorm.DB) {
+	Salts = NewDailySalts(db)
+	if config.ConfigAll.CLICK_SALT == "" {
+		salt, err := LoadClickSalt(db)
+		if err != nil {
+			slog.Error(LOGGER_HANDLER, err)
+			return
+		}
+		config.ConfigAll.CLICK_SALT = salt
+	}
+}
+
+// StartRetention runs Purge now and then every CLICK_RETENTION_INTERVAL in the background.
+// With prefork it runs in the master process only.
+//
+// Parameters:
+// - db: the database.
+func StartRetention(db *gorm.DB) {
+	go func() {
+		for {
+			result, err := Purge(db, time.Now())
+			if err != nil {
+				slog.Error(LOGGER_HANDLER, err)
+			} else if result != (PurgeResult{}) {
+				slog.Info(LOGGER_HANDLER, "purged", result)
+			}
+			time.Sleep(config.ConfigAll.CLICK_RETENTION_INTERVAL)
+		}
+	}()
+}
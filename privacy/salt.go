@@ -0,0 +1,115 @@
+package privacy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/models"
+)
+
+var ErrNoSalts = errors.New("daily salts are not configured")
+
+// DailySalts hands out one random salt per day in the configured time zone.
+//
+// Salts are stored in the database so that all prefork children hash with the same
+// salt, and deleted by Purge once their day is over.
+type DailySalts struct {
+	db *gorm.DB
+
+	mu   sync.Mutex
+	day  string
+	salt string
+}
+
+// Salts is the salt store used by AnonymizeIP. It is nil until Start is called.
+var Salts *DailySalts
+
+// NewDailySalts creates a salt store.
+func NewDailySalts(db *gorm.DB) *DailySalts {
+	return &DailySalts{db: db}
+}
+
+// Salt returns the salt of the day a time falls in, creating it on first use.
+//
+// Parameters:
+// - at: the time.
+//
+// Returns:
+// - string: the salt.
+// - error: ErrNoSalts for a nil store or a database error.
+func (s *DailySalts) Salt(at time.Time) (string, error) {
+	if s == nil {
+		return "", ErrNoSalts
+	}
+	day := Day(at)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.day == day {
+		return s.salt, nil
+	}
+
+	random, err := newSalt()
+	if err != nil {
+		return "", err
+	}
+	// The first writer wins, everybody else reads its salt.
+	row := models.DailySalt{Day: day, Salt: random}
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&row).Error; err != nil {
+		return "", err
+	}
+	if err := s.db.First(&row, "day = ?", day).Error; err != nil {
+		return "", err
+	}
+
+	s.day, s.salt = day, row.Salt
+	return s.salt, nil
+}
+
+// Day returns the date a time falls on in the configured time zone as YYYY-MM-DD.
+func Day(at time.Time) string {
+	return at.In(config.ConfigAll.LOCATION).Format("2006-01-02")
+}
+
+// LoadClickSalt returns the salt used by IP_MODE_HASH when CLICK_SALT is not set,
+// creating it on first use.
+//
+// The salt is random and stored in the database, so it is shared by all prefork
+// children and survives restarts without reusing another secret.
+//
+// Parameters:
+// - db: the database the salt is stored in.
+//
+// Returns:
+// - string: the salt.
+// - error: a database error.
+func LoadClickSalt(db *gorm.DB) (string, error) {
+	random, err := newSalt()
+	if err != nil {
+		return "", err
+	}
+	// The first writer wins, everybody else reads its salt.
+	row := models.ClickSalt{ID: 1, Salt: random}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&row).Error; err != nil {
+		return "", err
+	}
+	if err := db.First(&row, 1).Error; err != nil {
+		return "", err
+	}
+	return row.Salt, nil
+}
+
+// newSalt returns 32 random bytes in hex.
+func newSalt() (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(random), nil
+}
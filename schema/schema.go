@@ -3,6 +3,7 @@ package schema
 type Response struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
+	Error   string `json:"error,omitempty"`
 }
 
 // GetSuccess200Response returns an ErrorResponse with a code of 200 and a message of "OK".
@@ -39,6 +40,17 @@ func GetError401Response() Response {
 	}
 }
 
+// GetError403Response returns a Response object with a 403 status code and a "Forbidden" message.
+//
+// No parameters.
+// Returns a Response object.
+func GetError403Response() Response {
+	return Response{
+		Code:    403,
+		Message: "Forbidden",
+	}
+}
+
 // GetError404Response returns a Response object with a 404 status code and a "Not Found" message.
 //
 // No parameters.
@@ -50,6 +62,39 @@ func GetError404Response() Response {
 	}
 }
 
+// GetError409Response returns a Response object with a 409 status code and a "Conflict" message.
+//
+// No parameters.
+// Returns a Response object.
+func GetError409Response() Response {
+	return Response{
+		Code:    409,
+		Message: "Conflict",
+	}
+}
+
+// GetError410Response returns a Response object with a 410 status code and a "Gone" message.
+//
+// No parameters.
+// Returns a Response object.
+func GetError410Response() Response {
+	return Response{
+		Code:    410,
+		Message: "Gone",
+	}
+}
+
+// GetError429Response returns a Response object with a 429 status code and a "Too Many Requests" message.
+//
+// No parameters.
+// Returns a Response object.
+func GetError429Response() Response {
+	return Response{
+		Code:    429,
+		Message: "Too Many Requests",
+	}
+}
+
 // GetError500Response returns a Response with a code of 500 and a message of "Internal Server Error".
 //
 // No parameters.
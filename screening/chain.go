@@ -0,0 +1,118 @@
+package screening
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"gorm.io/gorm"
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/outbound"
+)
+
+const (
+	REASON_SELF_REFERENCE = "destination points back at this service"
+	REASON_CHAIN_TOO_LONG = "shortener chain is longer than allowed"
+	REASON_UNVERIFIED     = "shortener chain could not be followed"
+)
+
+// ErrUnverified is returned when a shortener of a chain does not answer, so the final
+// destination is unknown. It is not a verdict: Rescan keeps the previous state of the link.
+var ErrUnverified = errors.New("shortener chain could not be followed")
+
+// HTTPClient sends the requests used to follow shortener chains.
+// Tests replace Client with a stub.
+type HTTPClient interface {
+	Do(request *http.Request) (*http.Response, error)
+}
+
+// Client only reaches public addresses and never follows redirects itself.
+var Client HTTPClient = outbound.NewClient(config.ConfigAll.SHORTENER_TIMEOUT)
+
+// NextHop asks a shortener where the given URL redirects to without following the redirect.
+//
+// Parameters:
+// - ctx: the context bounding the request.
+// - current: the URL to request.
+//
+// Returns:
+// - *url.URL: the redirect target, or nil if the response is not a redirect.
+// - error: an error if the request failed or the Location header is invalid.
+func NextHop(ctx context.Context, current *url.URL) (*url.URL, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodHead, current.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := Client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	response.Body.Close()
+
+	if response.StatusCode < 300 || response.StatusCode >= 400 {
+		return nil, nil
+	}
+	location := response.Header.Get("Location")
+	if location == "" {
+		return nil, nil
+	}
+	next, err := current.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+// checkServiceDomain blocks links that point back at this service, which would
+// otherwise redirect to themselves or to another short link forever.
+func checkServiceDomain(db *gorm.DB, rules Rules, target Target) (Verdict, error) {
+	if rules.IsServiceHost(target.Host) {
+		return Block(REASON_SELF_REFERENCE), nil
+	}
+	return Verdict{}, nil
+}
+
+// checkShortenerChain follows links through known shorteners up to SHORTENER_CHAIN_DEPTH hops.
+//
+// Every hop is screened with the offline checks, so a shortener cannot hide a
+// denied host or a link back to this service. A chain that is still on a
+// shortener after the allowed number of hops is blocked. A shortener that does not
+// answer returns ErrUnverified, so the chain is neither passed nor blocked.
+// SHORTENER_TIMEOUT bounds the whole chain, not every hop, so a slow chain cannot
+// hold a request for depth times the timeout.
+func checkShortenerChain(db *gorm.DB, rules Rules, target Target) (Verdict, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.ConfigAll.SHORTENER_TIMEOUT)
+	defer cancel()
+
+	current := target
+	for hop := 0; IsShortener(current.Host); hop++ {
+		if hop >= config.ConfigAll.SHORTENER_CHAIN_DEPTH {
+			return Block(REASON_CHAIN_TOO_LONG), nil
+		}
+
+		next, err := NextHop(ctx, current.URL)
+		if err != nil {
+			return Verdict{}, fmt.Errorf("%w: %v", ErrUnverified, err)
+		}
+		if next == nil {
+			return Verdict{}, nil
+		}
+		current, err = ParseTarget(next.String())
+		if err != nil {
+			return Block(REASON_INVALID), nil
+		}
+		if rules.Allowed(current.Host) {
+			return Verdict{}, nil
+		}
+
+		for _, check := range hopChecks {
+			verdict, err := check(db, rules, current)
+			if err != nil || verdict.Blocked {
+				return verdict, err
+			}
+		}
+	}
+	return Verdict{}, nil
+}
@@ -0,0 +1,112 @@
+package screening
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+	"urlshort.ru/m/config"
+)
+
+// DEFAULT_SHORTENERS lists well known URL shorteners. Links to them hide the
+// real destination behind a second redirect.
+var DEFAULT_SHORTENERS = []string{
+	"bit.ly", "bitly.com", "t.co", "tinyurl.com", "goo.gl", "ow.ly", "is.gd",
+	"buff.ly", "cutt.ly", "rebrand.ly", "t.ly", "shorturl.at", "rb.gy", "tiny.cc",
+	"v.gd", "s.id", "clck.ru", "lnkd.in", "bl.ink", "short.io",
+}
+
+// confusables maps characters that look like ASCII letters to those letters.
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p',
+	'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'і': 'i', 'ј': 'j', 'ѕ': 's', 'ԁ': 'd',
+	'ӏ': 'l', 'ԛ': 'q', 'ԝ': 'w', 'ɡ': 'g',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p',
+	'τ': 't', 'υ': 'u', 'χ': 'x',
+	// Digits
+	'0': 'o', '1': 'l', '3': 'e', '5': 's',
+}
+
+// multiConfusables maps ASCII sequences that look like a single letter.
+var multiConfusables = strings.NewReplacer("rn", "m", "vv", "w", "cl", "d")
+
+// Skeleton reduces a host to the ASCII characters it visually resembles, so
+// that "раураl.com" (Cyrillic) and "paypa1.com" both become "paypal.com".
+func Skeleton(host string) string {
+	var builder strings.Builder
+	for _, r := range strings.ToLower(host) {
+		if mapped, ok := confusables[r]; ok {
+			r = mapped
+		}
+		builder.WriteRune(r)
+	}
+	return multiConfusables.Replace(builder.String())
+}
+
+// IsMixedScript reports whether a single label mixes letters from different scripts,
+// which legitimate internationalized domains almost never do.
+func IsMixedScript(label string) bool {
+	scripts := map[string]bool{}
+	for _, r := range label {
+		switch {
+		case r < unicode.MaxASCII:
+			if unicode.IsLetter(r) {
+				scripts["Latin"] = true
+			}
+		case unicode.Is(unicode.Latin, r):
+			scripts["Latin"] = true
+		case unicode.Is(unicode.Cyrillic, r):
+			scripts["Cyrillic"] = true
+		case unicode.Is(unicode.Greek, r):
+			scripts["Greek"] = true
+		case unicode.IsLetter(r):
+			scripts["Other"] = true
+		}
+	}
+	return len(scripts) > 1
+}
+
+// IsLookalike reports whether the host looks like a homograph of a protected domain
+// or mixes scripts inside one label.
+//
+// Parameters:
+// - host: the normalized ASCII host, punycode labels are decoded before the check.
+//
+// Returns:
+// - bool: true if the host looks like a spoofing attempt.
+func IsLookalike(host string) bool {
+	unicodeHost, err := idna.ToUnicode(host)
+	if err != nil {
+		unicodeHost = host
+	}
+
+	for _, label := range strings.Split(unicodeHost, ".") {
+		if IsMixedScript(label) {
+			return true
+		}
+	}
+
+	skeleton := Skeleton(unicodeHost)
+	for _, protected := range config.ConfigAll.SCREENING_PROTECTED_DOMAINS {
+		protected = NormalizeHost(protected)
+		if MatchSuffix(host, protected) {
+			continue
+		}
+		if MatchSuffix(skeleton, Skeleton(protected)) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsShortener reports whether the host belongs to a known URL shortener.
+func IsShortener(host string) bool {
+	for _, shortener := range append(DEFAULT_SHORTENERS, config.ConfigAll.SCREENING_SHORTENERS...) {
+		if MatchSuffix(host, NormalizeHost(shortener)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package screening
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/models"
+)
+
+// Rule is a compiled deny or allow list entry.
+type Rule struct {
+	List    string
+	Match   string
+	Pattern string
+	regex   *regexp.Regexp
+}
+
+// Rules holds the deny and allow lists used by the screening pipeline and the
+// hosts this service runs on.
+type Rules struct {
+	Deny         []Rule
+	Allow        []Rule
+	ServiceHosts []string
+}
+
+// NewRule validates and compiles a list entry.
+//
+// Parameters:
+// - list: models.LIST_DENY or models.LIST_ALLOW.
+// - match: models.MATCH_EXACT, models.MATCH_SUFFIX or models.MATCH_REGEX.
+// - pattern: the domain or regular expression to match hosts against.
+//
+// Returns:
+// - Rule: the compiled rule.
+// - error: an error if any argument is invalid.
+func NewRule(list string, match string, pattern string) (Rule, error) {
+	if list != models.LIST_DENY && list != models.LIST_ALLOW {
+		return Rule{}, errors.New("invalid list")
+	}
+
+	rule := Rule{List: list, Match: match}
+	switch match {
+	case models.MATCH_EXACT, models.MATCH_SUFFIX:
+		rule.Pattern = NormalizeHost(pattern)
+		if rule.Pattern == "" {
+			return Rule{}, errors.New("empty pattern")
+		}
+	case models.MATCH_REGEX:
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return Rule{}, err
+		}
+		rule.Pattern = pattern
+		rule.regex = regex
+	default:
+		return Rule{}, errors.New("invalid match")
+	}
+	return rule, nil
+}
+
+// ParseRule parses a config list entry such as "regex:^login\\.", "exact:example.com"
+// or "example.com". Entries without a prefix are suffix matches.
+//
+// Parameters:
+// - list: models.LIST_DENY or models.LIST_ALLOW.
+// - value: the config entry.
+//
+// Returns:
+// - Rule: the compiled rule.
+// - error: an error if the entry is invalid.
+func ParseRule(list string, value string) (Rule, error) {
+	for _, match := range []string{models.MATCH_EXACT, models.MATCH_SUFFIX, models.MATCH_REGEX} {
+		if strings.HasPrefix(value, match+":") {
+			return NewRule(list, match, strings.TrimPrefix(value, match+":"))
+		}
+	}
+	return NewRule(list, models.MATCH_SUFFIX, value)
+}
+
+// Matches reports whether the rule matches the given normalized host.
+func (r Rule) Matches(host string) bool {
+	switch r.Match {
+	case models.MATCH_EXACT:
+		return host == r.Pattern
+	case models.MATCH_SUFFIX:
+		return MatchSuffix(host, r.Pattern)
+	case models.MATCH_REGEX:
+		return r.regex != nil && r.regex.MatchString(host)
+	}
+	return false
+}
+
+// Denied returns the first deny rule matching the host.
+func (r Rules) Denied(host string) (Rule, bool) {
+	return firstMatch(r.Deny, host)
+}
+
+// Allowed reports whether an allow rule matches the host.
+func (r Rules) Allowed(host string) bool {
+	_, ok := firstMatch(r.Allow, host)
+	return ok
+}
+
+// IsServiceHost reports whether the host is one of the hosts this service runs on.
+func (r Rules) IsServiceHost(host string) bool {
+	for _, domain := range r.ServiceHosts {
+		if MatchSuffix(host, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddServiceHost treats the host as one this service runs on, skipping invalid hosts.
+func (r *Rules) AddServiceHost(host string) {
+	if host = NormalizeHost(host); host != "" {
+		r.ServiceHosts = append(r.ServiceHosts, host)
+	}
+}
+
+// LoadRules builds the deny and allow lists from the config and the database.
+// SERVICE_DOMAINS become the service hosts.
+//
+// Parameters:
+// - db: the database holding the rules managed through the admin API.
+//
+// Returns:
+// - Rules: the compiled lists.
+// - error: an error if the rules could not be loaded.
+func LoadRules(db *gorm.DB) (Rules, error) {
+	rules := Rules{}
+	for _, domain := range config.ConfigAll.SERVICE_DOMAINS {
+		rules.AddServiceHost(domain)
+	}
+	for _, value := range config.ConfigAll.SCREENING_DENY_DOMAINS {
+		rules.add(ParseRule(models.LIST_DENY, value))
+	}
+	for _, value := range config.ConfigAll.SCREENING_ALLOW_DOMAINS {
+		rules.add(ParseRule(models.LIST_ALLOW, value))
+	}
+
+	var stored []models.ScreeningRule
+	if err := db.Find(&stored).Error; err != nil {
+		return Rules{}, err
+	}
+	for _, item := range stored {
+		rules.add(NewRule(item.List, item.Match, item.Pattern))
+	}
+	return rules, nil
+}
+
+// add appends a compiled rule to the matching list, skipping invalid rules.
+func (r *Rules) add(rule Rule, err error) {
+	if err != nil {
+		return
+	}
+	if rule.List == models.LIST_ALLOW {
+		r.Allow = append(r.Allow, rule)
+		return
+	}
+	r.Deny = append(r.Deny, rule)
+}
+
+// firstMatch returns the first rule in the list that matches the host.
+func firstMatch(rules []Rule, host string) (Rule, bool) {
+	for _, rule := range rules {
+		if rule.Matches(host) {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// MatchSuffix reports whether host equals domain or is a subdomain of it.
+func MatchSuffix(host string, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
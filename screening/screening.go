@@ -0,0 +1,272 @@
+package screening
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/exp/slog"
+	"golang.org/x/net/idna"
+	"gorm.io/gorm"
+	"urlshort.ru/m/models"
+)
+
+const LOGGER_HANDLER = "screening"
+
+const (
+	REASON_INVALID    = "invalid url"
+	REASON_DENY_LIST  = "domain is on the deny list"
+	REASON_THREAT     = "domain is on a threat list"
+	REASON_LOOKALIKE  = "host looks like a homograph of a protected domain"
+	RESCAN_BATCH_SIZE = 100
+)
+
+// Verdict is the result of screening a destination URL.
+type Verdict struct {
+	Blocked bool   `json:"blocked"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// Target is a parsed destination with its normalized host.
+type Target struct {
+	URL  *url.URL
+	Host string
+}
+
+// Check is a single step of the screening pipeline.
+type Check func(db *gorm.DB, rules Rules, target Target) (Verdict, error)
+
+// Checks are run on every screened URL in order.
+var Checks = []Check{
+	checkServiceDomain,
+	checkDenyList,
+	checkThreatList,
+	checkLookalike,
+	checkShortenerChain,
+}
+
+// hopChecks are run on every destination reached through a shortener chain.
+var hopChecks = []Check{
+	checkServiceDomain,
+	checkDenyList,
+	checkThreatList,
+	checkLookalike,
+}
+
+var rescanning atomic.Bool
+
+// Block returns a blocking verdict with the given reason.
+func Block(reason string) Verdict {
+	return Verdict{Blocked: true, Reason: reason}
+}
+
+// NormalizeHost lowercases a host, strips the port and trailing dot and converts it to punycode.
+//
+// Parameters:
+// - host: the host to normalize.
+//
+// Returns:
+// - string: the normalized host or an empty string if it is invalid.
+func NormalizeHost(host string) string {
+	host = strings.TrimSpace(strings.ToLower(host))
+	if splitHost, _, err := net.SplitHostPort(host); err == nil {
+		host = splitHost
+	}
+	host = strings.Trim(host, ".[]")
+	if host == "" {
+		return ""
+	}
+	asciiHost, err := idna.ToASCII(host)
+	if err != nil {
+		return ""
+	}
+	return asciiHost
+}
+
+// ParseTarget parses a destination URL. Only absolute http and https URLs are accepted.
+//
+// Parameters:
+// - rawURL: the destination to parse.
+//
+// Returns:
+// - Target: the parsed destination.
+// - error: an error if the URL is not a valid web address.
+func ParseTarget(rawURL string) (Target, error) {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return Target{}, err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return Target{}, errors.New("unsupported scheme")
+	}
+	host := NormalizeHost(parsed.Host)
+	if host == "" {
+		return Target{}, errors.New("invalid host")
+	}
+	return Target{URL: parsed, Host: host}, nil
+}
+
+// Screen runs the screening pipeline for a destination URL.
+//
+// Hosts on the allow list skip every other check.
+//
+// Parameters:
+// - db: the database holding the lists.
+// - rawURL: the destination to screen.
+// - serviceHosts: hosts this service was reached at in addition to SERVICE_DOMAINS,
+// usually the Host of the current request.
+//
+// Returns:
+// - Verdict: whether the destination must be blocked and why.
+// - error: an error if a list could not be read.
+func Screen(db *gorm.DB, rawURL string, serviceHosts ...string) (Verdict, error) {
+	rules, err := LoadRules(db)
+	if err != nil {
+		return Verdict{}, err
+	}
+	for _, host := range serviceHosts {
+		rules.AddServiceHost(host)
+	}
+	return screenWithRules(db, rules, rawURL, Checks)
+}
+
+// screenWithRules parses the URL and runs the given checks against already loaded
+// lists until one of them blocks it.
+func screenWithRules(db *gorm.DB, rules Rules, rawURL string, checks []Check) (Verdict, error) {
+	target, err := ParseTarget(rawURL)
+	if err != nil {
+		return Block(REASON_INVALID), nil
+	}
+	if rules.Allowed(target.Host) {
+		return Verdict{}, nil
+	}
+
+	for _, check := range checks {
+		verdict, err := check(db, rules, target)
+		if err != nil {
+			return Verdict{}, err
+		}
+		if verdict.Blocked {
+			return verdict, nil
+		}
+	}
+	return Verdict{}, nil
+}
+
+// Rescan screens every destination of every stored link again and updates its blocked state.
+// Links with a shortener chain that could not be followed keep their previous state.
+// The lists are loaded once for the whole rescan.
+// Only one rescan runs at a time in a process; concurrent calls return immediately.
+//
+// Parameters:
+// - db: the database holding the links and lists.
+//
+// Returns:
+// - int: the number of links whose state changed.
+// - error: an error if the links could not be read or updated.
+func Rescan(db *gorm.DB) (int, error) {
+	if !rescanning.CompareAndSwap(false, true) {
+		return 0, nil
+	}
+	defer rescanning.Store(false)
+
+	rules, err := LoadRules(db)
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	var batch []models.URL
+	result := db.FindInBatches(&batch, RESCAN_BATCH_SIZE, func(tx *gorm.DB, _ int) error {
+		for _, link := range batch {
+			verdict, err := screenLink(db, rules, link)
+			if errors.Is(err, ErrUnverified) {
+				slog.Warn(LOGGER_HANDLER, "link", link.ID, "error", err)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if verdict.Blocked == link.Blocked && verdict.Reason == link.BlockReason {
+				continue
+			}
+			err = db.Model(&models.URL{}).Where("id = ?", link.ID).Updates(map[string]any{
+				"blocked":      verdict.Blocked,
+				"block_reason": verdict.Reason,
+			}).Error
+			if err != nil {
+				return err
+			}
+			changed++
+		}
+		return nil
+	})
+	return changed, result.Error
+}
+
+// screenLink screens the original URL, the fallback URL and the destinations of the
+// targeting rules of a link, and returns the first blocking verdict. If no destination
+// blocks the link but a shortener chain could not be followed, it returns ErrUnverified.
+func screenLink(db *gorm.DB, rules Rules, link models.URL) (Verdict, error) {
+	var destinations []string
+	err := db.Model(&models.TargetingRule{}).Where("url_id = ?", link.ID).Order("id").Pluck("destination", &destinations).Error
+	if err != nil {
+		return Verdict{}, err
+	}
+	destinations = append([]string{link.OriginalURL, link.FallbackURL}, destinations...)
+
+	var unverified error
+	for _, destination := range destinations {
+		if destination == "" {
+			continue
+		}
+		verdict, err := screenWithRules(db, rules, destination, Checks)
+		if errors.Is(err, ErrUnverified) {
+			unverified = err
+			continue
+		}
+		if err != nil || verdict.Blocked {
+			return verdict, err
+		}
+	}
+	return Verdict{}, unverified
+}
+
+// RescanAsync runs Rescan in the background and logs the result.
+func RescanAsync(db *gorm.DB) {
+	go func() {
+		changed, err := Rescan(db)
+		if err != nil {
+			slog.Error(LOGGER_HANDLER, err)
+			return
+		}
+		slog.Info(LOGGER_HANDLER, "rescan changed", changed)
+	}()
+}
+
+// checkDenyList blocks hosts matching a deny rule.
+func checkDenyList(db *gorm.DB, rules Rules, target Target) (Verdict, error) {
+	if _, ok := rules.Denied(target.Host); ok {
+		return Block(REASON_DENY_LIST), nil
+	}
+	return Verdict{}, nil
+}
+
+// checkThreatList blocks hosts found on an imported threat list.
+func checkThreatList(db *gorm.DB, rules Rules, target Target) (Verdict, error) {
+	threat, err := IsThreat(db, target.Host)
+	if err != nil || !threat {
+		return Verdict{}, err
+	}
+	return Block(REASON_THREAT), nil
+}
+
+// checkLookalike blocks homograph hosts.
+func checkLookalike(db *gorm.DB, rules Rules, target Target) (Verdict, error) {
+	if IsLookalike(target.Host) {
+		return Block(REASON_LOOKALIKE), nil
+	}
+	return Verdict{}, nil
+}
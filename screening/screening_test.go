@@ -0,0 +1,268 @@
+package screening_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/models"
+	"urlshort.ru/m/screening"
+)
+
+// TestRuleMatches tests exact, suffix and regex matching of list rules.
+func TestRuleMatches(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		host  string
+		want  bool
+	}{
+		{name: "Suffix same host", value: "example.com", host: "example.com", want: true},
+		{name: "Suffix subdomain", value: "example.com", host: "login.example.com", want: true},
+		{name: "Suffix other domain", value: "example.com", host: "badexample.com", want: false},
+		{name: "Exact host", value: "exact:example.com", host: "example.com", want: true},
+		{name: "Exact subdomain", value: "exact:example.com", host: "www.example.com", want: false},
+		{name: "Regex match", value: `regex:^login\.`, host: "login.bank.test", want: true},
+		{name: "Regex no match", value: `regex:^login\.`, host: "bank.test", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := screening.ParseRule(models.LIST_DENY, tt.value)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := rule.Matches(tt.host); got != tt.want {
+				t.Errorf("Matches(%s) = %v, want %v", tt.host, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := screening.NewRule(models.LIST_DENY, models.MATCH_REGEX, "("); err == nil {
+		t.Errorf("Expected an error for an invalid regex")
+	}
+	if _, err := screening.NewRule("other", models.MATCH_EXACT, "example.com"); err == nil {
+		t.Errorf("Expected an error for an invalid list")
+	}
+}
+
+// TestParseThreatList tests reading plain domain, hosts file and hash-prefix lists.
+func TestParseThreatList(t *testing.T) {
+	domains := "# comment\nBad.Example.\n\n0.0.0.0 phish.test\n127.0.0.1 localhost\n"
+	entries, err := screening.ParseThreatList(strings.NewReader(domains), models.THREAT_DOMAIN)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Join(entries, ",") != "bad.example,phish.test" {
+		t.Errorf("Unexpected entries: %v", entries)
+	}
+
+	prefixes := "ABCDEF01\n0123456789abcdef\n"
+	entries, err = screening.ParseThreatList(strings.NewReader(prefixes), models.THREAT_HASH_PREFIX)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Join(entries, ",") != "abcdef01,0123456789abcdef" {
+		t.Errorf("Unexpected entries: %v", entries)
+	}
+
+	if _, err := screening.ParseThreatList(strings.NewReader("abc\n"), models.THREAT_HASH_PREFIX); err == nil {
+		t.Errorf("Expected an error for a short hash prefix")
+	}
+}
+
+// TestIsLookalike tests the homograph heuristics.
+func TestIsLookalike(t *testing.T) {
+	config.ConfigAll.SCREENING_PROTECTED_DOMAINS = []string{"paypal.com"}
+
+	tests := []struct {
+		name string
+		host string
+		want bool
+	}{
+		{name: "Protected domain", host: "paypal.com", want: false},
+		{name: "Protected subdomain", host: "www.paypal.com", want: false},
+		{name: "Digit substitution", host: "paypa1.com", want: true},
+		{name: "Cyrillic punycode", host: screening.NormalizeHost("раураl.com"), want: true},
+		{name: "Mixed script label", host: screening.NormalizeHost("gооgle.com"), want: true},
+		{name: "Unrelated domain", host: "example.com", want: false},
+		{name: "Cyrillic domain", host: screening.NormalizeHost("пример.рф"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := screening.IsLookalike(tt.host); got != tt.want {
+				t.Errorf("IsLookalike(%s) = %v, want %v", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestScreen tests the screening pipeline end to end.
+func TestScreen(t *testing.T) {
+	db := models.DATABASE
+	config.ConfigAll.SCREENING_DENY_DOMAINS = []string{"evil.test"}
+	config.ConfigAll.SCREENING_ALLOW_DOMAINS = []string{"exact:bit.ly"}
+
+	_, err := screening.ImportThreats(db, "test", models.THREAT_HASH_PREFIX,
+		strings.NewReader(screening.HashPrefixExpression("malware.test")[:8]))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		url    string
+		reason string
+	}{
+		{url: "https://example.com/page", reason: ""},
+		{url: "ftp://example.com", reason: screening.REASON_INVALID},
+		{url: "not a url", reason: screening.REASON_INVALID},
+		{url: "https://www.evil.test/login", reason: screening.REASON_DENY_LIST},
+		{url: "http://cdn.malware.test/file", reason: screening.REASON_THREAT},
+		{url: "https://bit.ly/abc", reason: ""},
+	}
+
+	for _, tt := range tests {
+		verdict, err := screening.Screen(db, tt.url)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if verdict.Reason != tt.reason || verdict.Blocked != (tt.reason != "") {
+			t.Errorf("Screen(%s) = %+v, want reason %q", tt.url, verdict, tt.reason)
+		}
+	}
+}
+
+// stubClient answers HEAD requests with redirects from a fixed map.
+type stubClient map[string]string
+
+// Do returns a redirect to the mapped location, an error for an empty location or a 200
+// response for unknown URLs.
+func (s stubClient) Do(request *http.Request) (*http.Response, error) {
+	location, ok := s[request.URL.String()]
+	if ok && location == "" {
+		return nil, errors.New("connection refused")
+	}
+	if !ok {
+		return &http.Response{StatusCode: 200, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(""))}, nil
+	}
+	return &http.Response{StatusCode: 301, Header: http.Header{"Location": {location}}, Body: http.NoBody}, nil
+}
+
+// TestShortenerChain tests self-reference detection and following shortener chains.
+func TestShortenerChain(t *testing.T) {
+	db := models.DATABASE
+	config.ConfigAll.SERVICE_DOMAINS = []string{"sho.rt:8080"}
+	config.ConfigAll.SHORTENER_CHAIN_DEPTH = 2
+	config.ConfigAll.SCREENING_DENY_DOMAINS = []string{"evil.test"}
+	config.ConfigAll.SCREENING_ALLOW_DOMAINS = []string{}
+
+	client := screening.Client
+	defer func() { screening.Client = client }()
+	screening.Client = stubClient{
+		"https://tinyurl.com/ok":       "https://example.com/page",
+		"https://tinyurl.com/self":     "/redirect",
+		"https://tinyurl.com/redirect": "https://sho.rt/abc",
+		"https://tinyurl.com/long":     "https://bit.ly/1",
+		"https://bit.ly/1":             "https://t.co/2",
+		"https://t.co/2":               "https://example.com",
+		"https://tinyurl.com/evil":     "https://www.evil.test/login",
+		"https://tinyurl.com/down":     "",
+	}
+
+	tests := []struct {
+		url    string
+		reason string
+	}{
+		{url: "https://sho.rt/abc", reason: screening.REASON_SELF_REFERENCE},
+		{url: "https://SHO.RT:8080/abc", reason: screening.REASON_SELF_REFERENCE},
+		{url: "https://tinyurl.com/ok", reason: ""},
+		{url: "https://tinyurl.com/self", reason: screening.REASON_SELF_REFERENCE},
+		{url: "https://tinyurl.com/long", reason: screening.REASON_CHAIN_TOO_LONG},
+		{url: "https://tinyurl.com/evil", reason: screening.REASON_DENY_LIST},
+		{url: "https://tinyurl.com/unknown", reason: ""},
+	}
+
+	for _, tt := range tests {
+		verdict, err := screening.Screen(db, tt.url)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if verdict.Reason != tt.reason || verdict.Blocked != (tt.reason != "") {
+			t.Errorf("Screen(%s) = %+v, want reason %q", tt.url, verdict, tt.reason)
+		}
+	}
+
+	if verdict, err := screening.Screen(db, "https://tinyurl.com/down"); !errors.Is(err, screening.ErrUnverified) || verdict.Blocked {
+		t.Errorf("Expected a shortener that does not answer to leave the chain unverified, got %+v, %v", verdict, err)
+	}
+}
+
+// TestRequestServiceHost tests that the request host is treated as this service without SERVICE_DOMAINS.
+func TestRequestServiceHost(t *testing.T) {
+	db := models.DATABASE
+	config.ConfigAll.SERVICE_DOMAINS = []string{}
+	config.ConfigAll.SCREENING_DENY_DOMAINS = []string{}
+	config.ConfigAll.SCREENING_ALLOW_DOMAINS = []string{}
+
+	verdict, err := screening.Screen(db, "https://go.example.org/abc", "GO.example.org:443")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if verdict.Reason != screening.REASON_SELF_REFERENCE {
+		t.Errorf("Expected a self-reference, got %+v", verdict)
+	}
+
+	verdict, err = screening.Screen(db, "https://go.example.org/abc")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if verdict.Blocked {
+		t.Errorf("Expected no block without a service host, got %+v", verdict)
+	}
+}
+
+// TestRescan tests that a rescan blocks links by their fallback and targeting destinations too
+// and keeps the state of links whose shortener chain could not be followed.
+func TestRescan(t *testing.T) {
+	db := models.DATABASE
+	config.ConfigAll.SERVICE_DOMAINS = []string{}
+	config.ConfigAll.SCREENING_DENY_DOMAINS = []string{"evil.test"}
+	config.ConfigAll.SCREENING_ALLOW_DOMAINS = []string{}
+	client := screening.Client
+	defer func() { screening.Client = client }()
+	screening.Client = stubClient{"https://tinyurl.com/rescan-down": ""}
+
+	fallback := models.URL{OriginalURL: "https://example.com/rescan-fallback", ShortURL: "rescan-fallback", FallbackURL: "https://www.evil.test/fallback"}
+	targeted := models.URL{OriginalURL: "https://example.com/rescan-targeting", ShortURL: "rescan-targeting"}
+	unverified := models.URL{OriginalURL: "https://tinyurl.com/rescan-down", ShortURL: "rescan-down", Blocked: true, BlockReason: screening.REASON_THREAT}
+	for _, link := range []*models.URL{&fallback, &targeted, &unverified} {
+		db.Unscoped().Where("short_url = ?", link.ShortURL).Delete(&models.URL{})
+		if err := db.Create(link).Error; err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	defer db.Unscoped().Delete(&models.URL{}, []uint{fallback.ID, targeted.ID, unverified.ID})
+	rule := models.TargetingRule{URLID: targeted.ID, Country: "DE", Destination: "https://evil.test/de"}
+	if err := db.Create(&rule).Error; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer db.Unscoped().Delete(&rule)
+
+	if _, err := screening.Rescan(db); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, link := range []models.URL{fallback, targeted} {
+		db.First(&link, link.ID)
+		if !link.Blocked || link.BlockReason != screening.REASON_DENY_LIST {
+			t.Errorf("Expected %s to be blocked by its destinations, got %v %q", link.ShortURL, link.Blocked, link.BlockReason)
+		}
+	}
+	db.First(&unverified, unverified.ID)
+	if !unverified.Blocked || unverified.BlockReason != screening.REASON_THREAT {
+		t.Errorf("Expected an unverified link to keep its state, got %v %q", unverified.Blocked, unverified.BlockReason)
+	}
+}
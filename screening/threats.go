@@ -0,0 +1,184 @@
+package screening
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gorm.io/gorm"
+	"urlshort.ru/m/models"
+)
+
+// MIN_HASH_PREFIX is the shortest accepted hash prefix in hex characters (4 bytes).
+const MIN_HASH_PREFIX = 8
+
+// ParseThreatList reads an offline threat list.
+//
+// Two formats are supported:
+//   - models.THREAT_DOMAIN: one domain per line, hosts file lines such as
+//     "0.0.0.0 bad.example" are accepted as well.
+//   - models.THREAT_HASH_PREFIX: one hex encoded SHA-256 prefix per line, computed
+//     over a host expression with a trailing slash ("bad.example/") like the
+//     Safe Browsing hash-prefix lists.
+//
+// Empty lines and lines starting with "#" are skipped.
+//
+// Parameters:
+// - reader: the list contents.
+// - format: the list format.
+//
+// Returns:
+// - []string: the normalized entries.
+// - error: an error if the list could not be read or has an invalid line.
+func ParseThreatList(reader io.Reader, format string) ([]string, error) {
+	if format != models.THREAT_DOMAIN && format != models.THREAT_HASH_PREFIX {
+		return nil, errors.New("invalid threat list format")
+	}
+
+	entries := []string{}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		value := fields[0]
+
+		if format == models.THREAT_HASH_PREFIX {
+			value = strings.ToLower(value)
+			if _, err := hex.DecodeString(value); err != nil || len(value) < MIN_HASH_PREFIX {
+				return nil, errors.New("invalid hash prefix: " + line)
+			}
+			entries = append(entries, value)
+			continue
+		}
+
+		if len(fields) > 1 && net.ParseIP(fields[0]) != nil {
+			value = fields[1]
+		}
+		value = NormalizeHost(value)
+		if value == "" || value == "localhost" {
+			continue
+		}
+		entries = append(entries, value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ImportThreats replaces all threat entries of the given source with the contents of the list.
+//
+// Parameters:
+// - db: the database to store the entries in.
+// - source: the name of the list, used to replace it on the next import.
+// - format: the list format.
+// - reader: the list contents.
+//
+// Returns:
+// - int: the number of imported entries.
+// - error: an error if the list could not be parsed or stored.
+func ImportThreats(db *gorm.DB, source string, format string, reader io.Reader) (int, error) {
+	if source == "" {
+		return 0, errors.New("empty source")
+	}
+	values, err := ParseThreatList(reader, format)
+	if err != nil {
+		return 0, err
+	}
+
+	entries := make([]models.ThreatEntry, 0, len(values))
+	for _, value := range values {
+		entries = append(entries, models.ThreatEntry{Source: source, Kind: format, Value: value})
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("source = ?", source).Delete(&models.ThreatEntry{}).Error; err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(entries, 500).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
+
+// ImportThreatFile imports a threat list file using its base name as the source.
+//
+// Parameters:
+// - db: the database to store the entries in.
+// - path: the path of the list file.
+// - format: the list format.
+//
+// Returns:
+// - int: the number of imported entries.
+// - error: an error if the file could not be read or imported.
+func ImportThreatFile(db *gorm.DB, path string, format string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return ImportThreats(db, filepath.Base(path), format, file)
+}
+
+// HashPrefixExpression returns the hex SHA-256 of a host expression as stored in hash-prefix lists.
+func HashPrefixExpression(host string) string {
+	sum := sha256.Sum256([]byte(host + "/"))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsThreat reports whether the host or one of its parent domains is on an imported threat list.
+//
+// Parameters:
+// - db: the database holding the threat entries.
+// - host: the normalized host.
+//
+// Returns:
+// - bool: true if a threat entry matches.
+// - error: an error if the lookup failed.
+func IsThreat(db *gorm.DB, host string) (bool, error) {
+	candidates := ParentDomains(host)
+
+	var count int64
+	err := db.Model(&models.ThreatEntry{}).
+		Where("kind = ? AND value IN ?", models.THREAT_DOMAIN, candidates).
+		Count(&count).Error
+	if err != nil || count > 0 {
+		return count > 0, err
+	}
+
+	for _, candidate := range candidates {
+		err := db.Model(&models.ThreatEntry{}).
+			Where("kind = ? AND ? LIKE value || '%'", models.THREAT_HASH_PREFIX, HashPrefixExpression(candidate)).
+			Count(&count).Error
+		if err != nil || count > 0 {
+			return count > 0, err
+		}
+	}
+	return false, nil
+}
+
+// ParentDomains returns the host and its parent domains without the bare top level domain.
+//
+// For "a.b.example.com" it returns "a.b.example.com", "b.example.com" and "example.com".
+func ParentDomains(host string) []string {
+	result := []string{host}
+	labels := strings.Split(host, ".")
+	for i := 1; i < len(labels)-1; i++ {
+		result = append(result, strings.Join(labels[i:], "."))
+	}
+	return result
+}
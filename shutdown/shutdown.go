@@ -0,0 +1,78 @@
+package shutdown
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/exp/slog"
+)
+
+const LOGGER_HANDLER = "shutdown"
+
+var started atomic.Bool
+
+var finished = make(chan struct{})
+
+var stopping = make(chan struct{})
+
+var once sync.Once
+
+// Handle installs the signal handling for a graceful shutdown of the app.
+//
+// A worker (the only process without prefork, or a prefork child) stops the
+// server on SIGINT or SIGTERM, which runs the OnShutdown hooks such as the
+// final click flush. The prefork master forwards the signal to its children
+// and exits only after they have finished or the timeout expires, because a
+// child that exits early makes Fiber kill its siblings mid-flush.
+//
+// Parameters:
+// - app: the Fiber app.
+// - timeout: the maximum time a shutdown may take.
+func Handle(app *fiber.App, timeout time.Duration) {
+	if app.Config().Prefork && !fiber.IsChild() {
+		handleMaster(app, timeout)
+		return
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		once.Do(func() {
+			started.Store(true)
+			close(stopping)
+			if err := app.ShutdownWithTimeout(timeout); err != nil {
+				slog.Error(LOGGER_HANDLER, err)
+			}
+			if fiber.IsChild() {
+				notifyMaster()
+				return
+			}
+			close(finished)
+		})
+	}()
+}
+
+// Stopping returns a channel that is closed when a shutdown starts, before the server
+// waits for open connections. Long-lived responses such as event streams end on it,
+// otherwise they would hold the shutdown until its timeout.
+func Stopping() <-chan struct{} {
+	return stopping
+}
+
+// Wait blocks until a shutdown started by a signal has finished. It returns
+// immediately if the server stopped for another reason.
+//
+// A prefork child never returns from Wait after a signal: it stays alive until
+// the master exits, so that Fiber does not kill the other children.
+func Wait() {
+	if !started.Load() {
+		return
+	}
+	<-finished
+}
@@ -0,0 +1,63 @@
+//go:build !windows
+
+package shutdown
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/exp/slog"
+)
+
+// handleMaster forwards SIGINT and SIGTERM to the prefork children and exits
+// once every child has reported a finished shutdown with SIGUSR1.
+func handleMaster(app *fiber.App, timeout time.Duration) {
+	var mu sync.Mutex
+	pids := []int{}
+	app.Hooks().OnFork(func(pid int) error {
+		mu.Lock()
+		defer mu.Unlock()
+		pids = append(pids, pid)
+		return nil
+	})
+
+	signals := make(chan os.Signal, 1)
+	done := make(chan os.Signal, 64)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(done, syscall.SIGUSR1)
+
+	go func() {
+		<-signals
+		mu.Lock()
+		children := append([]int{}, pids...)
+		mu.Unlock()
+
+		for _, pid := range children {
+			if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+				slog.Error(LOGGER_HANDLER, "pid", pid, "error", err)
+			}
+		}
+
+		deadline := time.After(timeout)
+		for finished := 0; finished < len(children); finished++ {
+			select {
+			case <-done:
+			case <-deadline:
+				slog.Error(LOGGER_HANDLER, "children did not finish", len(children)-finished)
+				os.Exit(1)
+			}
+		}
+		os.Exit(0)
+	}()
+}
+
+// notifyMaster tells the prefork master that this child has finished its shutdown.
+func notifyMaster() {
+	if err := syscall.Kill(os.Getppid(), syscall.SIGUSR1); err != nil {
+		slog.Error(LOGGER_HANDLER, err)
+	}
+}
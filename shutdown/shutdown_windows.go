@@ -0,0 +1,27 @@
+//go:build windows
+
+package shutdown
+
+import (
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// handleMaster waits for the timeout after an interrupt before exiting. The
+// console delivers the interrupt to every child itself, and Windows has no
+// signal the children could use to report back.
+func handleMaster(app *fiber.App, timeout time.Duration) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		<-signals
+		time.Sleep(timeout)
+		os.Exit(0)
+	}()
+}
+
+// notifyMaster is a no-op on Windows, see handleMaster.
+func notifyMaster() {}
@@ -0,0 +1,81 @@
+package stats
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"urlshort.ru/m/models"
+)
+
+// Revenue is the summed conversion value in one currency.
+type Revenue struct {
+	Currency string  `json:"currency"`
+	Value    float64 `json:"value"`
+}
+
+// ConversionEvent is the number of conversions with one name.
+type ConversionEvent struct {
+	Name  string `json:"name"`
+	Total int64  `json:"total"`
+}
+
+// Conversions is the conversion summary of the clicks on a link in a range.
+//
+// Conversions belong to the range their click falls in, not the range they were
+// reported in, so the rate compares the same clicks. Clicks counts the clicks that
+// were given a click ID, only they can convert. Converted counts clicks with at least
+// one conversion and Rate is Converted divided by Clicks. Values in different
+// currencies are never added up.
+//
+// Conversions are reported per link. Links have no A/B variants, so there is no
+// per-variant breakdown yet.
+type Conversions struct {
+	Clicks    int64             `json:"clicks"`
+	Total     int64             `json:"total"`
+	Converted int64             `json:"converted"`
+	Rate      float64           `json:"rate"`
+	Revenue   []Revenue         `json:"revenue"`
+	Events    []ConversionEvent `json:"events"`
+}
+
+// QueryConversions aggregates the conversions of the clicks on a link in a range.
+//
+// Parameters:
+// - db: the database holding the conversions.
+// - urlID: the link ID.
+// - from: the start of the range.
+// - to: the exclusive end of the range.
+// - clicks: the number of clicks with a click ID in the range, used for the conversion rate.
+//
+// Returns:
+// - Conversions: the conversion summary.
+// - error: a database error.
+func QueryConversions(db *gorm.DB, urlID uint, from time.Time, to time.Time, clicks int64) (Conversions, error) {
+	result := Conversions{Clicks: clicks, Revenue: []Revenue{}, Events: []ConversionEvent{}}
+	scope := func() *gorm.DB {
+		return db.Model(&models.Conversion{}).Where("url_id = ? AND clicked_at >= ? AND clicked_at < ?", urlID, from.UTC(), to.UTC())
+	}
+
+	var totals struct {
+		Total     int64
+		Converted int64
+	}
+	if err := scope().Select("COUNT(*) AS total, COUNT(DISTINCT click_id) AS converted").Scan(&totals).Error; err != nil {
+		return Conversions{}, err
+	}
+	result.Total, result.Converted = totals.Total, totals.Converted
+	if clicks > 0 {
+		result.Rate = float64(result.Converted) / float64(clicks)
+	}
+
+	err := scope().Select("currency, SUM(value) AS value").Where("currency <> ''").
+		Group("currency").Order("currency").Scan(&result.Revenue).Error
+	if err != nil {
+		return Conversions{}, err
+	}
+	err = scope().Select("name, COUNT(*) AS total").Group("name").Order("total DESC, name").Scan(&result.Events).Error
+	if err != nil {
+		return Conversions{}, err
+	}
+	return result, nil
+}
@@ -0,0 +1,299 @@
+package stats
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/hll"
+	"urlshort.ru/m/models"
+)
+
+const (
+	INTERVAL_HOUR  = "hour"
+	INTERVAL_DAY   = "day"
+	INTERVAL_WEEK  = "week"
+	INTERVAL_MONTH = "month"
+
+	MAX_BUCKETS = 2000
+)
+
+var ErrInvalidInterval = errors.New("invalid interval")
+
+var ErrInvalidRange = errors.New("invalid range")
+
+// Point is one bucket of the time series.
+//
+// Unique is estimated from the daily sketches for day, week and month buckets. Hourly
+// buckets are smaller than a sketch, so for them Unique equals NewVisitors.
+type Point struct {
+	Time        time.Time `json:"time"`
+	Total       int64     `json:"total"`
+	Unique      int64     `json:"unique"`
+	NewVisitors int64     `json:"new_visitors"`
+}
+
+// Item is one value of a breakdown.
+//
+// Unique is estimated from the daily sketches of the value, NewVisitors counts visitors
+// whose first click on the link falls in the range and came with this value.
+type Item struct {
+	Value       string `json:"value"`
+	Total       int64  `json:"total"`
+	Unique      int64  `json:"unique"`
+	NewVisitors int64  `json:"new_visitors"`
+}
+
+// Report is the aggregated statistics of a link over a range.
+//
+// Unique is the distinct visitor estimate merged from the daily sketches of every day
+// overlapping the range, with a relative standard error of UniqueError. NewVisitors
+// counts visitors whose first click on the link falls in the bucket or range.
+// Conversions summarizes the conversions recorded in the range.
+type Report struct {
+	Interval    string            `json:"interval"`
+	From        time.Time         `json:"from"`
+	To          time.Time         `json:"to"`
+	TimeZone    string            `json:"time_zone"`
+	Total       int64             `json:"total"`
+	Unique      int64             `json:"unique"`
+	UniqueError float64           `json:"unique_error"`
+	NewVisitors int64             `json:"new_visitors"`
+	Series      []Point           `json:"series"`
+	Breakdowns  map[string][]Item `json:"breakdowns"`
+	Conversions *Conversions      `json:"conversions,omitempty"`
+}
+
+// BucketStart returns the start of the interval bucket the time falls in, in the configured time zone.
+// Weeks start on Monday.
+//
+// Parameters:
+// - t: the time.
+// - interval: INTERVAL_HOUR, INTERVAL_DAY, INTERVAL_WEEK or INTERVAL_MONTH.
+//
+// Returns:
+// - time.Time: the bucket start.
+// - error: ErrInvalidInterval for an unknown interval.
+func BucketStart(t time.Time, interval string) (time.Time, error) {
+	local := t.In(config.ConfigAll.LOCATION)
+	year, month, day := local.Date()
+	switch interval {
+	case INTERVAL_HOUR:
+		return time.Date(year, month, day, local.Hour(), 0, 0, 0, local.Location()), nil
+	case INTERVAL_DAY:
+		return time.Date(year, month, day, 0, 0, 0, 0, local.Location()), nil
+	case INTERVAL_WEEK:
+		offset := (int(local.Weekday()) + 6) % 7
+		return time.Date(year, month, day-offset, 0, 0, 0, 0, local.Location()), nil
+	case INTERVAL_MONTH:
+		return time.Date(year, month, 1, 0, 0, 0, 0, local.Location()), nil
+	}
+	return time.Time{}, ErrInvalidInterval
+}
+
+// NextBucket returns the start of the bucket following the given bucket start.
+func NextBucket(start time.Time, interval string) time.Time {
+	switch interval {
+	case INTERVAL_HOUR:
+		return start.Add(time.Hour)
+	case INTERVAL_WEEK:
+		return start.AddDate(0, 0, 7)
+	case INTERVAL_MONTH:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// Query aggregates the hourly rollups, daily sketches and conversions of a link into a report.
+//
+// Parameters:
+// - db: the database holding the rollups.
+// - urlID: the link ID.
+// - interval: the bucket size of the time series.
+// - from: the start of the range, rounded down to its bucket.
+// - to: the exclusive end of the range.
+// - limit: the maximum number of values per breakdown.
+// - traffic: the traffic classes to include, all classes if empty.
+//
+// Returns:
+// - Report: the aggregated statistics.
+// - error: ErrInvalidInterval, ErrInvalidRange or a database error.
+func Query(db *gorm.DB, urlID uint, interval string, from time.Time, to time.Time, limit int, traffic []string) (Report, error) {
+	start, err := BucketStart(from, interval)
+	if err != nil {
+		return Report{}, err
+	}
+	if !to.After(start) {
+		return Report{}, ErrInvalidRange
+	}
+
+	report := Report{
+		Interval:   interval,
+		From:       start,
+		To:         to.In(config.ConfigAll.LOCATION),
+		TimeZone:   config.ConfigAll.LOCATION.String(),
+		Series:     []Point{},
+		Breakdowns: map[string][]Item{},
+	}
+
+	index := map[time.Time]int{}
+	for bucket := start; bucket.Before(to); bucket = NextBucket(bucket, interval) {
+		if len(report.Series) >= MAX_BUCKETS {
+			return Report{}, ErrInvalidRange
+		}
+		index[bucket] = len(report.Series)
+		report.Series = append(report.Series, Point{Time: bucket})
+	}
+
+	var rows []models.ClickRollup
+	query := db.Where("url_id = ? AND bucket >= ? AND bucket < ?", urlID, start.UTC(), to.UTC())
+	if len(traffic) > 0 {
+		query = query.Where("traffic IN ?", traffic)
+	}
+	if err := query.Find(&rows).Error; err != nil {
+		return Report{}, err
+	}
+
+	breakdowns := map[string]map[string]*Item{DIMENSION_TRAFFIC: {}}
+	for _, dimension := range Dimensions {
+		breakdowns[dimension] = map[string]*Item{}
+	}
+
+	var tracked int64
+	for _, row := range rows {
+		if row.Dimension == DIMENSION_TOTAL {
+			// The traffic breakdown is built from the total rows, which exist once per class.
+			row.Dimension, row.Value = DIMENSION_TRAFFIC, row.Traffic
+			bucket, _ := BucketStart(row.Bucket, interval)
+			if i, ok := index[bucket]; ok {
+				report.Series[i].Total += row.Clicks
+				report.Series[i].NewVisitors += row.Unique
+			}
+			report.Total += row.Clicks
+			report.NewVisitors += row.Unique
+			tracked += row.Tracked
+		}
+
+		values, ok := breakdowns[row.Dimension]
+		if !ok {
+			continue
+		}
+		item, ok := values[row.Value]
+		if !ok {
+			item = &Item{Value: row.Value}
+			values[row.Value] = item
+		}
+		item.Total += row.Clicks
+		item.NewVisitors += row.Unique
+	}
+
+	for dimension, values := range breakdowns {
+		report.Breakdowns[dimension] = TopItems(values, limit)
+	}
+
+	if err := estimateUnique(db, urlID, interval, index, traffic, &report); err != nil {
+		return Report{}, err
+	}
+	conversions, err := QueryConversions(db, urlID, start, to, tracked)
+	if err != nil {
+		return Report{}, err
+	}
+	report.Conversions = &conversions
+	return report, nil
+}
+
+// estimateUnique fills the unique visitor estimates of a report and its breakdowns from the daily sketches.
+func estimateUnique(db *gorm.DB, urlID uint, interval string, index map[time.Time]int, traffic []string, report *Report) error {
+	days, err := DaySketches(db, urlID, report.From, report.To, traffic)
+	if err != nil {
+		return err
+	}
+
+	total := hll.New(Precision())
+	buckets := map[int]*hll.Sketch{}
+	for day, sketch := range days {
+		total = mergeSketch(total, sketch)
+		if interval == INTERVAL_HOUR {
+			continue
+		}
+		bucket, _ := BucketStart(day, interval)
+		i, ok := index[bucket]
+		if !ok {
+			continue
+		}
+		if _, ok := buckets[i]; !ok {
+			buckets[i] = hll.New(Precision())
+		}
+		buckets[i] = mergeSketch(buckets[i], sketch)
+	}
+
+	report.Unique = int64(total.Estimate())
+	report.UniqueError = hll.StandardError(total.Precision())
+	for i := range report.Series {
+		if interval == INTERVAL_HOUR {
+			report.Series[i].Unique = report.Series[i].NewVisitors
+		} else if sketch, ok := buckets[i]; ok {
+			report.Series[i].Unique = int64(sketch.Estimate())
+		}
+	}
+
+	// Only the values kept in the breakdowns are estimated.
+	for dimension, items := range report.Breakdowns {
+		if len(items) == 0 {
+			continue
+		}
+		values := make([]string, len(items))
+		for i, item := range items {
+			values[i] = item.Value
+		}
+		sketches, err := BreakdownSketches(db, urlID, report.From, report.To, traffic, dimension, values)
+		if err != nil {
+			return err
+		}
+		for i := range items {
+			if sketch, ok := sketches[items[i].Value]; ok {
+				items[i].Unique = int64(sketch.Estimate())
+			}
+		}
+	}
+	return nil
+}
+
+// ParseTime parses a range bound given as RFC3339 or as a date in the configured time zone.
+//
+// Parameters:
+// - value: the query value, empty for the default.
+// - fallback: the value used when the query value is empty.
+//
+// Returns:
+// - time.Time: the parsed time.
+// - error: an error if the value has an unknown format.
+func ParseTime(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, config.ConfigAll.LOCATION)
+}
+
+// TopItems sorts breakdown values by total clicks and keeps the first limit values.
+func TopItems(values map[string]*Item, limit int) []Item {
+	items := make([]Item, 0, len(values))
+	for _, item := range values {
+		items = append(items, *item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Total != items[j].Total {
+			return items[i].Total > items[j].Total
+		}
+		return items[i].Value < items[j].Value
+	})
+	if limit > 0 && len(items) > limit {
+		items = items[:limit]
+	}
+	return items
+}
@@ -0,0 +1,150 @@
+package stats
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/models"
+)
+
+const (
+	DIMENSION_TOTAL    = "total"
+	DIMENSION_REFERRER = "referrer"
+	DIMENSION_COUNTRY  = "country"
+	DIMENSION_REGION   = "region"
+	DIMENSION_CITY     = "city"
+	DIMENSION_BROWSER  = "browser"
+	DIMENSION_OS       = "os"
+	DIMENSION_DEVICE   = "device"
+	DIMENSION_LANGUAGE = "language"
+	DIMENSION_TRAFFIC  = "traffic"
+
+	VALUE_DIRECT  = "direct"
+	VALUE_UNKNOWN = "unknown"
+)
+
+// Dimensions lists the breakdowns maintained in the rollup table.
+var Dimensions = []string{
+	DIMENSION_REFERRER,
+	DIMENSION_COUNTRY,
+	DIMENSION_REGION,
+	DIMENSION_CITY,
+	DIMENSION_BROWSER,
+	DIMENSION_OS,
+	DIMENSION_DEVICE,
+	DIMENSION_LANGUAGE,
+}
+
+// ReferrerDomain reduces a Referer header to its host without "www.".
+//
+// Parameters:
+// - referrer: the Referer header value.
+//
+// Returns:
+// - string: the domain, VALUE_DIRECT for an empty referrer or VALUE_UNKNOWN if it cannot be parsed.
+func ReferrerDomain(referrer string) string {
+	if referrer == "" {
+		return VALUE_DIRECT
+	}
+	parsed, err := url.Parse(referrer)
+	if err != nil || parsed.Hostname() == "" {
+		return VALUE_UNKNOWN
+	}
+	return strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+}
+
+// HourBucket returns the start of the hour the given time falls in, in the configured time zone.
+func HourBucket(t time.Time) time.Time {
+	local := t.In(config.ConfigAll.LOCATION)
+	return time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), 0, 0, 0, local.Location())
+}
+
+// DimensionValues returns the rollup value of every dimension for a click.
+// Anonymous clicks have VALUE_UNKNOWN in every breakdown.
+func DimensionValues(click models.Click) map[string]string {
+	values := map[string]string{
+		DIMENSION_TOTAL:    "",
+		DIMENSION_REFERRER: ReferrerDomain(click.Referrer),
+		DIMENSION_COUNTRY:  click.Country,
+		DIMENSION_REGION:   click.Region,
+		DIMENSION_CITY:     click.City,
+		DIMENSION_BROWSER:  click.Browser,
+		DIMENSION_OS:       click.OS,
+		DIMENSION_DEVICE:   click.Device,
+		DIMENSION_LANGUAGE: click.Language,
+	}
+	for dimension, value := range values {
+		if (value == "" || click.Anonymous) && dimension != DIMENSION_TOTAL {
+			values[dimension] = VALUE_UNKNOWN
+		}
+	}
+	return values
+}
+
+// TrafficClass returns the traffic class of a click, clicks stored without one are human.
+func TrafficClass(click models.Click) string {
+	if click.Traffic == "" {
+		return models.TRAFFIC_HUMAN
+	}
+	return click.Traffic
+}
+
+// Rollup adds a batch of stored clicks to the hourly rollup table, keyed by traffic class.
+//
+// Rows are upserted with relative increments, so concurrent writers never lose counts.
+//
+// Parameters:
+// - tx: the transaction the clicks were written in.
+// - batch: the clicks, with CreatedAt and FirstVisit set.
+//
+// Returns:
+// - error: an error if the rollups could not be updated.
+func Rollup(tx *gorm.DB, batch []models.Click) error {
+	type key struct {
+		urlID     uint
+		bucket    time.Time
+		dimension string
+		value     string
+		traffic   string
+	}
+	rows := map[key]*models.ClickRollup{}
+
+	for _, click := range batch {
+		bucket := HourBucket(click.CreatedAt).UTC()
+		traffic := TrafficClass(click)
+		for dimension, value := range DimensionValues(click) {
+			k := key{urlID: click.URLID, bucket: bucket, dimension: dimension, value: value, traffic: traffic}
+			row, ok := rows[k]
+			if !ok {
+				row = &models.ClickRollup{URLID: click.URLID, Bucket: bucket, Dimension: dimension, Value: value, Traffic: traffic}
+				rows[k] = row
+			}
+			row.Clicks++
+			if click.FirstVisit {
+				row.Unique++
+			}
+			if click.ClickID != "" {
+				row.Tracked++
+			}
+		}
+	}
+
+	for _, row := range rows {
+		err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "url_id"}, {Name: "bucket"}, {Name: "dimension"}, {Name: "value"}, {Name: "traffic"}},
+			DoUpdates: clause.Assignments(map[string]any{
+				"clicks":         gorm.Expr("clicks + excluded.clicks"),
+				"unique_clicks":  gorm.Expr("unique_clicks + excluded.unique_clicks"),
+				"tracked_clicks": gorm.Expr("tracked_clicks + excluded.tracked_clicks"),
+			}),
+		}).Create(row).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
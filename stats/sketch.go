@@ -0,0 +1,190 @@
+package stats
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/hll"
+	"urlshort.ru/m/models"
+)
+
+// Precision returns the sketch precision derived from HLL_ERROR_RATE.
+func Precision() int {
+	return hll.PrecisionForError(config.ConfigAll.HLL_ERROR_RATE)
+}
+
+// DayBucket returns the start of the day the given time falls in, in the configured time zone.
+func DayBucket(t time.Time) time.Time {
+	local := t.In(config.ConfigAll.LOCATION)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+}
+
+// UpdateSketches adds the visitors of a batch to the daily HyperLogLog sketches of their links,
+// one sketch per traffic class and breakdown value, so breakdowns get distinct visitor
+// estimates as well.
+//
+// Sketches are read and written inside the batch transaction, which already holds the
+// database write lock, so concurrent writers never lose registers. A stored sketch with a
+// higher precision than configured is reduced; a lower one keeps its precision.
+//
+// Parameters:
+// - tx: the transaction the clicks were written in.
+// - batch: the clicks, with CreatedAt and VisitorHash set.
+//
+// Returns:
+// - error: an error if the sketches could not be updated.
+func UpdateSketches(tx *gorm.DB, batch []models.Click) error {
+	type key struct {
+		urlID     uint
+		day       time.Time
+		traffic   string
+		dimension string
+		value     string
+	}
+	visitors := map[key][]string{}
+	for _, click := range batch {
+		if click.VisitorHash == "" {
+			continue
+		}
+		day, traffic := DayBucket(click.CreatedAt).UTC(), TrafficClass(click)
+		for dimension, value := range DimensionValues(click) {
+			k := key{urlID: click.URLID, day: day, traffic: traffic, dimension: dimension, value: value}
+			visitors[k] = append(visitors[k], click.VisitorHash)
+		}
+	}
+
+	for k, hashes := range visitors {
+		row := models.VisitorSketch{URLID: k.urlID, Day: k.day, Traffic: k.traffic, Dimension: k.dimension, Value: k.value}
+		err := tx.Where("url_id = ? AND day = ? AND traffic = ? AND dimension = ? AND value = ?",
+			k.urlID, k.day, k.traffic, k.dimension, k.value).Limit(1).Find(&row).Error
+		if err != nil {
+			return err
+		}
+
+		sketch := hll.New(Precision())
+		if len(row.Registers) > 0 {
+			stored := &hll.Sketch{}
+			if err := stored.UnmarshalBinary(row.Registers); err != nil {
+				return err
+			}
+			sketch = mergeSketch(sketch, stored)
+		}
+		for _, hash := range hashes {
+			sketch.AddString(hash)
+		}
+
+		row.Registers, err = sketch.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		err = tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "url_id"}, {Name: "day"}, {Name: "traffic"}, {Name: "dimension"}, {Name: "value"}},
+			DoUpdates: clause.AssignmentColumns([]string{"registers"}),
+		}).Create(&row).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DaySketches loads the daily total sketches of a link for every day overlapping a range
+// and merges the sketches of the requested traffic classes.
+//
+// Parameters:
+// - db: the database holding the sketches.
+// - urlID: the link ID.
+// - from: the start of the range, rounded down to its day.
+// - to: the exclusive end of the range.
+// - traffic: the traffic classes to include, all classes if empty.
+//
+// Returns:
+// - map[time.Time]*hll.Sketch: the sketch of every day with visitors, keyed by the day start in the configured time zone.
+// - error: a database or decoding error.
+func DaySketches(db *gorm.DB, urlID uint, from time.Time, to time.Time, traffic []string) (map[time.Time]*hll.Sketch, error) {
+	var rows []models.VisitorSketch
+	if err := loadSketches(db, urlID, from, to, traffic).Where("dimension = ?", DIMENSION_TOTAL).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	days := map[time.Time]*hll.Sketch{}
+	for _, row := range rows {
+		sketch := &hll.Sketch{}
+		if err := sketch.UnmarshalBinary(row.Registers); err != nil {
+			return nil, err
+		}
+		day := row.Day.In(config.ConfigAll.LOCATION)
+		if merged, ok := days[day]; ok {
+			sketch = mergeSketch(merged, sketch)
+		}
+		days[day] = sketch
+	}
+	return days, nil
+}
+
+// BreakdownSketches merges the daily sketches of the given breakdown values over a range.
+//
+// The traffic breakdown has no sketches of its own, it is built from the total
+// sketches of every traffic class.
+//
+// Parameters:
+// - db: the database holding the sketches.
+// - urlID: the link ID.
+// - from: the start of the range, rounded down to its day.
+// - to: the exclusive end of the range.
+// - traffic: the traffic classes to include, all classes if empty.
+// - dimension: the breakdown.
+// - values: the breakdown values to load.
+//
+// Returns:
+// - map[string]*hll.Sketch: the merged sketch of every value with visitors.
+// - error: a database or decoding error.
+func BreakdownSketches(db *gorm.DB, urlID uint, from time.Time, to time.Time, traffic []string, dimension string, values []string) (map[string]*hll.Sketch, error) {
+	query := loadSketches(db, urlID, from, to, traffic)
+	if dimension == DIMENSION_TRAFFIC {
+		query = query.Where("dimension = ? AND traffic IN ?", DIMENSION_TOTAL, values)
+	} else {
+		query = query.Where("dimension = ? AND value IN ?", dimension, values)
+	}
+	var rows []models.VisitorSketch
+	if err := query.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	merged := map[string]*hll.Sketch{}
+	for _, row := range rows {
+		sketch := &hll.Sketch{}
+		if err := sketch.UnmarshalBinary(row.Registers); err != nil {
+			return nil, err
+		}
+		value := row.Value
+		if dimension == DIMENSION_TRAFFIC {
+			value = row.Traffic
+		}
+		if into, ok := merged[value]; ok {
+			sketch = mergeSketch(into, sketch)
+		}
+		merged[value] = sketch
+	}
+	return merged, nil
+}
+
+// loadSketches selects the sketches of a link for every day overlapping a range.
+func loadSketches(db *gorm.DB, urlID uint, from time.Time, to time.Time, traffic []string) *gorm.DB {
+	query := db.Model(&models.VisitorSketch{}).Where("url_id = ? AND day >= ? AND day < ?", urlID, DayBucket(from).UTC(), to.UTC())
+	if len(traffic) > 0 {
+		query = query.Where("traffic IN ?", traffic)
+	}
+	return query
+}
+
+// mergeSketch merges two sketches, reducing the result to the lower of their precisions.
+func mergeSketch(into *hll.Sketch, other *hll.Sketch) *hll.Sketch {
+	if other.Precision() < into.Precision() {
+		into = into.Reduce(other.Precision())
+	}
+	into.Merge(other)
+	return into
+}
@@ -0,0 +1,221 @@
+package stats_test
+
+import (
+	"testing"
+	"time"
+
+	"urlshort.ru/m/clicks"
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/models"
+	"urlshort.ru/m/privacy"
+	"urlshort.ru/m/stats"
+)
+
+// TestBucketStart tests bucketing in the configured time zone.
+func TestBucketStart(t *testing.T) {
+	location, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	config.ConfigAll.LOCATION = location
+
+	// 2023-08-20 22:30 UTC is Monday 2023-08-21 01:30 in Moscow.
+	moment := time.Date(2023, 8, 20, 22, 30, 0, 0, time.UTC)
+	tests := []struct {
+		interval string
+		want     time.Time
+	}{
+		{interval: stats.INTERVAL_HOUR, want: time.Date(2023, 8, 21, 1, 0, 0, 0, location)},
+		{interval: stats.INTERVAL_DAY, want: time.Date(2023, 8, 21, 0, 0, 0, 0, location)},
+		{interval: stats.INTERVAL_WEEK, want: time.Date(2023, 8, 21, 0, 0, 0, 0, location)},
+		{interval: stats.INTERVAL_MONTH, want: time.Date(2023, 8, 1, 0, 0, 0, 0, location)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.interval, func(t *testing.T) {
+			got, err := stats.BucketStart(moment, tt.interval)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("BucketStart() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := stats.BucketStart(moment, "year"); err == nil {
+		t.Errorf("Expected an error for an unknown interval")
+	}
+}
+
+// TestReferrerDomain tests reducing referrers to domains.
+func TestReferrerDomain(t *testing.T) {
+	tests := map[string]string{
+		"":                              stats.VALUE_DIRECT,
+		"https://www.Google.com/search": "google.com",
+		"android-app://org.telegram":    "org.telegram",
+		"::":                            stats.VALUE_UNKNOWN,
+	}
+	for input, want := range tests {
+		if got := stats.ReferrerDomain(input); got != want {
+			t.Errorf("ReferrerDomain(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+// TestQuery tests that written clicks are rolled up and aggregated into a report.
+func TestQuery(t *testing.T) {
+	privacy.Start(models.DATABASE)
+	config.ConfigAll.LOCATION = time.UTC
+	db := models.DATABASE
+	url := models.URL{OriginalURL: "https://example.com/stats", ShortURL: "stats-test"}
+	db.Unscoped().Where("short_url = ?", url.ShortURL).Delete(&models.URL{})
+	if err := db.Create(&url).Error; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	db.Where("url_id = ?", url.ID).Delete(&models.ClickRollup{})
+	db.Where("url_id = ?", url.ID).Delete(&models.ClickVisitor{})
+	db.Where("url_id = ?", url.ID).Delete(&models.VisitorSketch{})
+
+	day := time.Date(2023, 8, 21, 10, 0, 0, 0, time.UTC)
+	visits := []struct {
+		at    time.Time
+		visit clicks.Visit
+	}{
+		{at: day, visit: clicks.Visit{IP: "1", Referrer: "https://google.com/", UserAgent: "browser"}},
+		{at: day.Add(time.Hour), visit: clicks.Visit{IP: "1", Referrer: "https://google.com/", UserAgent: "browser"}},
+		{at: day.Add(time.Hour * 24), visit: clicks.Visit{IP: "2", UserAgent: "browser"}},
+		{at: day.Add(time.Hour * 24), visit: clicks.Visit{IP: "3", UserAgent: "TelegramBot (like TwitterBot)"}},
+	}
+	batch := []models.Click{}
+	for _, item := range visits {
+		click := clicks.NewClick(url, url.OriginalURL, false, item.visit)
+		click.CreatedAt = item.at
+		batch = append(batch, click)
+	}
+	if err := clicks.WriteBatch(db, batch); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	start := time.Date(2023, 8, 21, 0, 0, 0, 0, time.UTC)
+	report, err := stats.Query(db, url.ID, stats.INTERVAL_DAY, start, start.AddDate(0, 0, 3), 10, []string{models.TRAFFIC_HUMAN})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if report.Total != 3 || report.Unique != 2 || report.NewVisitors != 2 {
+		t.Errorf("Expected 3 total, 2 unique and 2 new visitors, got %d, %d and %d", report.Total, report.Unique, report.NewVisitors)
+	}
+	if report.Series[0].Unique != 1 || report.Series[1].Unique != 1 {
+		t.Errorf("Expected 1 unique visitor per day, got %+v", report.Series)
+	}
+	if len(report.Series) != 3 {
+		t.Fatalf("Expected 3 buckets, got %d", len(report.Series))
+	}
+	if report.Series[0].Total != 2 || report.Series[1].Total != 1 || report.Series[2].Total != 0 {
+		t.Errorf("Unexpected series: %+v", report.Series)
+	}
+	referrers := report.Breakdowns[stats.DIMENSION_REFERRER]
+	if len(referrers) != 2 || referrers[0].Value != "google.com" || referrers[0].Total != 2 {
+		t.Errorf("Unexpected referrers: %+v", referrers)
+	}
+	if len(referrers) == 2 && (referrers[0].Unique != 1 || referrers[0].NewVisitors != 1) {
+		t.Errorf("Expected 1 unique visitor and 1 new visitor from google.com, got %+v", referrers[0])
+	}
+
+	all, err := stats.Query(db, url.ID, stats.INTERVAL_DAY, start, start.AddDate(0, 0, 3), 10, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if all.Total != 4 || all.Unique != 3 {
+		t.Errorf("Expected 4 total and 3 unique clicks with bots, got %d and %d", all.Total, all.Unique)
+	}
+	traffic := all.Breakdowns[stats.DIMENSION_TRAFFIC]
+	if len(traffic) != 2 || traffic[0].Value != models.TRAFFIC_HUMAN || traffic[1].Value != models.TRAFFIC_PREVIEW {
+		t.Errorf("Unexpected traffic breakdown: %+v", traffic)
+	}
+	if len(traffic) == 2 && (traffic[0].Unique != 2 || traffic[1].Unique != 1) {
+		t.Errorf("Expected 2 unique human and 1 unique preview visitors, got %+v", traffic)
+	}
+}
+
+// TestCanView tests the stats visibility rules for owners, admins and anonymous viewers.
+func TestCanView(t *testing.T) {
+	ownerID := uint(7)
+	owner := &models.User{Role: models.ROLE_USER}
+	owner.ID = ownerID
+	other := &models.User{Role: models.ROLE_USER}
+	other.ID = 8
+	admin := &models.User{Role: models.ROLE_ADMIN}
+	admin.ID = 9
+
+	for _, visibility := range []string{models.STATS_PUBLIC, models.STATS_PRIVATE, models.STATS_DISABLED} {
+		url := models.URL{UserID: &ownerID, StatsVisibility: visibility}
+		public := visibility == models.STATS_PUBLIC
+		if got := stats.CanView(url, nil); got != public {
+			t.Errorf("%s: CanView(anonymous) = %v, want %v", visibility, got, public)
+		}
+		if got := stats.CanView(url, other); got != public {
+			t.Errorf("%s: CanView(other) = %v, want %v", visibility, got, public)
+		}
+		if !stats.CanView(url, owner) || !stats.CanView(url, admin) {
+			t.Errorf("%s: expected owner and admin to see the statistics", visibility)
+		}
+		if got := stats.PageEnabled(url); got != (visibility != models.STATS_DISABLED) {
+			t.Errorf("%s: PageEnabled() = %v", visibility, got)
+		}
+	}
+
+	if stats.CanManage(models.URL{}, owner) {
+		t.Errorf("Expected links without owner to be managed by admins only")
+	}
+}
+
+// TestQueryConversions tests the conversion rate, the revenue per currency and that
+// conversions are counted in the range of their click.
+func TestQueryConversions(t *testing.T) {
+	db := models.DATABASE
+	url := models.URL{OriginalURL: "https://example.com/conversions", ShortURL: "conversions-test"}
+	db.Unscoped().Where("short_url = ?", url.ShortURL).Delete(&models.URL{})
+	if err := db.Create(&url).Error; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	db.Unscoped().Where("click_id IN ?", []string{"conv-a", "conv-b", "conv-c"}).Delete(&models.Conversion{})
+
+	start := time.Date(2023, 8, 21, 0, 0, 0, 0, time.UTC)
+	conversions := []models.Conversion{
+		{URLID: url.ID, ClickID: "conv-a", Name: "signup"},
+		{URLID: url.ID, ClickID: "conv-a", Name: "purchase", Value: 10.5, Currency: "EUR"},
+		{URLID: url.ID, ClickID: "conv-b", Name: "purchase", Value: 100, Currency: "RUB"},
+		{URLID: url.ID, ClickID: "conv-c", Name: "purchase", Value: 200, Currency: "RUB"},
+	}
+	for i := range conversions {
+		conversions[i].ClickedAt = start.Add(time.Hour)
+		conversions[i].CreatedAt = start.Add(time.Hour * 2)
+	}
+	// Reported days after its click, still counted with the click.
+	conversions[2].CreatedAt = start.AddDate(0, 0, 5)
+	// Reported in the range for a click before it.
+	conversions[3].ClickedAt = start.Add(-time.Hour)
+	if err := db.Create(&conversions).Error; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	duplicate := models.Conversion{URLID: url.ID, ClickID: "conv-a", Name: "signup", ClickedAt: start}
+	if err := db.Create(&duplicate).Error; err == nil {
+		t.Errorf("Expected a second conversion with the same click and name to be rejected")
+	}
+
+	got, err := stats.QueryConversions(db, url.ID, start, start.AddDate(0, 0, 1), 4)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got.Clicks != 4 || got.Total != 3 || got.Converted != 2 || got.Rate != 0.5 {
+		t.Errorf("Expected 3 conversions of 2 out of 4 clicks at rate 0.5, got %+v", got)
+	}
+	want := []stats.Revenue{{Currency: "EUR", Value: 10.5}, {Currency: "RUB", Value: 100}}
+	if len(got.Revenue) != 2 || got.Revenue[0] != want[0] || got.Revenue[1] != want[1] {
+		t.Errorf("Unexpected revenue: %+v", got.Revenue)
+	}
+	if len(got.Events) != 2 || got.Events[0] != (stats.ConversionEvent{Name: "purchase", Total: 2}) {
+		t.Errorf("Unexpected events: %+v", got.Events)
+	}
+}
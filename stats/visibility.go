@@ -0,0 +1,51 @@
+package stats
+
+import "urlshort.ru/m/models"
+
+// IsVisibility reports whether the value is a known stats visibility.
+func IsVisibility(value string) bool {
+	switch value {
+	case models.STATS_PUBLIC, models.STATS_PRIVATE, models.STATS_DISABLED:
+		return true
+	}
+	return false
+}
+
+// CanManage reports whether a user owns a link or is an admin.
+//
+// Parameters:
+// - url: the link.
+// - user: the authenticated user, nil for anonymous requests.
+//
+// Returns:
+// - bool: true if the user may change the link settings and always see its statistics.
+func CanManage(url models.URL, user *models.User) bool {
+	if user == nil {
+		return false
+	}
+	if user.Role == models.ROLE_ADMIN {
+		return true
+	}
+	return url.UserID != nil && *url.UserID == user.ID
+}
+
+// CanView reports whether the statistics of a link can be shown to a user.
+//
+// Public statistics are shown to everyone, private and disabled statistics only to
+// the owner and admins. The public stats page additionally hides disabled statistics
+// from everyone, see PageEnabled.
+//
+// Parameters:
+// - url: the link.
+// - user: the authenticated user, nil for anonymous requests.
+//
+// Returns:
+// - bool: true if the statistics can be shown.
+func CanView(url models.URL, user *models.User) bool {
+	return url.StatsVisibility == models.STATS_PUBLIC || url.StatsVisibility == "" || CanManage(url, user)
+}
+
+// PageEnabled reports whether the /{shorturl}/stats page of a link exists at all.
+func PageEnabled(url models.URL) bool {
+	return url.StatsVisibility != models.STATS_DISABLED
+}
@@ -0,0 +1,104 @@
+package tags
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+	"urlshort.ru/m/models"
+)
+
+const (
+	// MAX_TAGS limits the number of tags of a link.
+	MAX_TAGS = 20
+	// MAX_TAG_LENGTH limits the length of a tag in characters.
+	MAX_TAG_LENGTH = 64
+)
+
+var (
+	ErrInvalidTag  = errors.New("tags may contain letters, digits, '-', '_' and '.' only")
+	ErrTooManyTags = errors.New("too many tags")
+)
+
+// NormalizeTag trims and lowercases a tag and checks its characters.
+//
+// Parameters:
+// - tag: the tag as sent by the client.
+//
+// Returns:
+// - string: the normalized tag.
+// - error: ErrInvalidTag if the tag is empty, too long or has other characters.
+func NormalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" || len([]rune(tag)) > MAX_TAG_LENGTH {
+		return "", ErrInvalidTag
+	}
+	for _, r := range tag {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' && r != '.' {
+			return "", ErrInvalidTag
+		}
+	}
+	return tag, nil
+}
+
+// Normalize normalizes a list of tags, dropping duplicates and sorting the result.
+//
+// Parameters:
+// - values: the tags as sent by the client.
+//
+// Returns:
+// - []string: the normalized tags.
+// - error: ErrInvalidTag or ErrTooManyTags.
+func Normalize(values []string) ([]string, error) {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, value := range values {
+		tag, err := NormalizeTag(value)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			result = append(result, tag)
+		}
+	}
+	if len(result) > MAX_TAGS {
+		return nil, ErrTooManyTags
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// Get returns the tags of a link in alphabetical order.
+func Get(db *gorm.DB, urlID uint) ([]string, error) {
+	result := []string{}
+	err := db.Model(&models.URLTag{}).Where("url_id = ?", urlID).Order("tag").Pluck("tag", &result).Error
+	return result, err
+}
+
+// Set replaces the tags of a link.
+//
+// Parameters:
+// - db: the database holding the tags.
+// - urlID: the link ID.
+// - values: the normalized tags.
+//
+// Returns:
+// - error: a database error.
+func Set(db *gorm.DB, urlID uint, values []string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("url_id = ?", urlID).Delete(&models.URLTag{}).Error; err != nil {
+			return err
+		}
+		if len(values) == 0 {
+			return nil
+		}
+		rows := make([]models.URLTag, len(values))
+		for i, tag := range values {
+			rows[i] = models.URLTag{URLID: urlID, Tag: tag}
+		}
+		return tx.Create(&rows).Error
+	})
+}
@@ -0,0 +1,33 @@
+package tags_test
+
+import (
+	"strings"
+	"testing"
+
+	"urlshort.ru/m/tags"
+)
+
+// TestNormalize tests trimming, lowercasing, deduplication and the limits of tags.
+func TestNormalize(t *testing.T) {
+	got, err := tags.Normalize([]string{" Spring ", "campaign", "spring", "утро_2023"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Join(got, ",") != "campaign,spring,утро_2023" {
+		t.Errorf("Unexpected tags: %v", got)
+	}
+
+	for _, value := range []string{"", "two words", "a/b", strings.Repeat("a", tags.MAX_TAG_LENGTH+1)} {
+		if _, err := tags.Normalize([]string{value}); err != tags.ErrInvalidTag {
+			t.Errorf("Expected %q to be rejected, got %v", value, err)
+		}
+	}
+
+	many := make([]string, tags.MAX_TAGS+1)
+	for i := range many {
+		many[i] = strings.Repeat("t", i+1)
+	}
+	if _, err := tags.Normalize(many); err != tags.ErrTooManyTags {
+		t.Errorf("Expected ErrTooManyTags, got %v", err)
+	}
+}
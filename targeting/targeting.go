@@ -0,0 +1,128 @@
+package targeting
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+	"urlshort.ru/m/geo"
+	"urlshort.ru/m/models"
+)
+
+// MAX_RULES limits the number of targeting rules of a link.
+const MAX_RULES = 50
+
+var (
+	ErrInvalidCountry = errors.New("country must be an ISO 3166-1 alpha-2 code")
+	ErrTooManyRules   = errors.New("too many targeting rules")
+)
+
+// Normalize checks a rule and brings its country code to upper case.
+//
+// Parameters:
+// - rule: the rule as sent by the client.
+//
+// Returns:
+// - models.TargetingRule: the normalized rule.
+// - error: ErrInvalidCountry if the country is not a two letter code.
+func Normalize(rule models.TargetingRule) (models.TargetingRule, error) {
+	rule.Country = strings.ToUpper(strings.TrimSpace(rule.Country))
+	rule.Region = strings.TrimSpace(rule.Region)
+	rule.Destination = strings.TrimSpace(rule.Destination)
+	if len(rule.Country) != 2 || rule.Country[0] < 'A' || rule.Country[0] > 'Z' || rule.Country[1] < 'A' || rule.Country[1] > 'Z' {
+		return rule, ErrInvalidCountry
+	}
+	return rule, nil
+}
+
+// Match returns the destination of the first rule matching a location.
+//
+// A rule matches when its country equals the country of the location and, if the
+// rule has a region, the region matches too. Regions are compared without case.
+//
+// Parameters:
+// - rules: the rules of a link in order.
+// - location: the location of the visitor.
+//
+// Returns:
+// - string: the destination of the matching rule.
+// - bool: false if no rule matches or the location is unknown.
+func Match(rules []models.TargetingRule, location geo.Location) (string, bool) {
+	if location.Country == "" {
+		return "", false
+	}
+	for _, rule := range rules {
+		if !strings.EqualFold(rule.Country, location.Country) {
+			continue
+		}
+		if rule.Region != "" && !strings.EqualFold(rule.Region, location.Region) {
+			continue
+		}
+		return rule.Destination, true
+	}
+	return "", false
+}
+
+// Rules returns the targeting rules of a link in the order they are checked.
+func Rules(db *gorm.DB, urlID uint) ([]models.TargetingRule, error) {
+	var rules []models.TargetingRule
+	err := db.Where("url_id = ?", urlID).Order("id").Find(&rules).Error
+	return rules, err
+}
+
+// Destination chooses the destination of a link for a visitor by its targeting rules.
+// Without a geo database every location is empty and no rule matches.
+//
+// Parameters:
+// - db: the database holding the rules.
+// - urlID: the link ID.
+// - location: the location of the visitor.
+//
+// Returns:
+// - string: the destination of the matching rule.
+// - bool: false if no rule matches.
+// - error: a database error.
+func Destination(db *gorm.DB, urlID uint, location geo.Location) (string, bool, error) {
+	if location.Country == "" {
+		return "", false, nil
+	}
+	rules, err := Rules(db, urlID)
+	if err != nil {
+		return "", false, err
+	}
+	destination, ok := Match(rules, location)
+	return destination, ok, nil
+}
+
+// Replace replaces the targeting rules of a link. The rules are checked in the given order.
+//
+// Parameters:
+// - db: the database holding the rules.
+// - urlID: the link ID.
+// - rules: the normalized rules.
+//
+// Returns:
+// - []models.TargetingRule: the stored rules.
+// - error: ErrTooManyRules or a database error.
+func Replace(db *gorm.DB, urlID uint, rules []models.TargetingRule) ([]models.TargetingRule, error) {
+	if len(rules) > MAX_RULES {
+		return nil, ErrTooManyRules
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("url_id = ?", urlID).Delete(&models.TargetingRule{}).Error; err != nil {
+			return err
+		}
+		for i := range rules {
+			rules[i].ID = 0
+			rules[i].URLID = urlID
+			if err := tx.Create(&rules[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
@@ -0,0 +1,67 @@
+package targeting_test
+
+import (
+	"testing"
+
+	"urlshort.ru/m/geo"
+	"urlshort.ru/m/models"
+	"urlshort.ru/m/targeting"
+)
+
+// TestNormalize tests the validation of country codes.
+func TestNormalize(t *testing.T) {
+	rule, err := targeting.Normalize(models.TargetingRule{Country: " de ", Destination: "https://example.de"})
+	if err != nil || rule.Country != "DE" {
+		t.Errorf("Expected DE, got %q and %v", rule.Country, err)
+	}
+	for _, country := range []string{"", "D", "DEU", "1A"} {
+		if _, err := targeting.Normalize(models.TargetingRule{Country: country}); err != targeting.ErrInvalidCountry {
+			t.Errorf("Expected %q to be rejected, got %v", country, err)
+		}
+	}
+}
+
+// TestDestination tests that stored rules are matched in order by country and region.
+func TestDestination(t *testing.T) {
+	db := models.DATABASE
+	url := models.URL{OriginalURL: "https://example.com/targeting", ShortURL: "targeting-test"}
+	db.Unscoped().Where("short_url = ?", url.ShortURL).Delete(&models.URL{})
+	if err := db.Create(&url).Error; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, err := targeting.Replace(db, url.ID, []models.TargetingRule{
+		{Country: "DE", Region: "Bavaria", Destination: "https://example.de/bayern"},
+		{Country: "DE", Destination: "https://example.de"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		location geo.Location
+		want     string
+	}{
+		{location: geo.Location{Country: "DE", Region: "bavaria"}, want: "https://example.de/bayern"},
+		{location: geo.Location{Country: "DE", Region: "Berlin"}, want: "https://example.de"},
+		{location: geo.Location{Country: "FR"}, want: ""},
+		{location: geo.Location{}, want: ""},
+	}
+	for _, tt := range tests {
+		destination, ok, err := targeting.Destination(db, url.ID, tt.location)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if destination != tt.want || ok != (tt.want != "") {
+			t.Errorf("Destination(%+v) = %q, want %q", tt.location, destination, tt.want)
+		}
+	}
+
+	// Replacing with an empty list removes every rule.
+	if _, err := targeting.Replace(db, url.ID, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok, _ := targeting.Destination(db, url.ID, geo.Location{Country: "DE"}); ok {
+		t.Errorf("Expected no rules after an empty replace")
+	}
+}
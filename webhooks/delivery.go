@@ -0,0 +1,243 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/models"
+	"urlshort.ru/m/outbound"
+)
+
+const (
+	HEADER_EVENT     = "X-Webhook-Event"
+	HEADER_ID        = "X-Webhook-Id"
+	HEADER_SIGNATURE = "X-Webhook-Signature"
+
+	// MAX_ERROR_LENGTH limits the stored error of a failed attempt.
+	MAX_ERROR_LENGTH = 512
+)
+
+var ErrWebhookDeleted = errors.New("webhook deleted")
+
+// Client sends the deliveries.
+var Client = NewClient()
+
+// NewClient returns the client for deliveries. It connects to public addresses only and
+// does not follow redirects, so a webhook cannot be used to reach internal services.
+func NewClient() *http.Client {
+	return outbound.NewClient(config.ConfigAll.WEBHOOK_TIMEOUT)
+}
+
+// Sign computes the signature of a delivery body.
+//
+// The signed message is the Unix timestamp, a dot and the body, so a captured request
+// cannot be replayed with a different timestamp. The X-Webhook-Signature header is
+// "t=<timestamp>,v1=<signature>".
+//
+// Parameters:
+// - secret: the webhook secret.
+// - timestamp: the Unix time of the attempt.
+// - body: the request body.
+//
+// Returns:
+// - string: the hex encoded HMAC-SHA256.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff returns the delay before the next attempt after the given number of failed attempts.
+// The delay starts at WEBHOOK_RETRY_BASE, doubles with every attempt and is capped at WEBHOOK_RETRY_MAX.
+func Backoff(attempts int) time.Duration {
+	delay := config.ConfigAll.WEBHOOK_RETRY_BASE
+	for i := 1; i < attempts && delay < config.ConfigAll.WEBHOOK_RETRY_MAX; i++ {
+		delay *= 2
+	}
+	if delay > config.ConfigAll.WEBHOOK_RETRY_MAX {
+		delay = config.ConfigAll.WEBHOOK_RETRY_MAX
+	}
+	return delay
+}
+
+// send posts a delivery to its webhook.
+//
+// Returns:
+// - int: the response status, 0 if no response was received.
+// - error: an error for transport failures and non-2xx responses. The response body is
+// never part of the error, so it cannot be read back through the delivery log.
+func send(webhook models.Webhook, delivery models.WebhookDelivery, now time.Time) (int, error) {
+	body := []byte(delivery.Payload)
+	request, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := now.Unix()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(HEADER_EVENT, delivery.Event)
+	request.Header.Set(HEADER_ID, delivery.EventID)
+	request.Header.Set(HEADER_SIGNATURE, fmt.Sprintf("t=%d,v1=%s", timestamp, Sign(webhook.Secret, timestamp, body)))
+
+	response, err := Client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("unexpected response status %s", response.Status)
+	}
+	return response.StatusCode, nil
+}
+
+// attempt sends a delivery once and returns it with the outcome applied.
+//
+// A successful attempt marks the delivery delivered. A failed attempt schedules the next
+// one after Backoff, or moves the delivery to the dead-letter log once WEBHOOK_MAX_ATTEMPTS
+// attempts failed. Deliveries of deleted webhooks, passed as nil, are moved there directly.
+func attempt(webhook *models.Webhook, delivery models.WebhookDelivery, now time.Time) models.WebhookDelivery {
+	var err error
+	if webhook == nil {
+		err = ErrWebhookDeleted
+		delivery.Attempts = config.ConfigAll.WEBHOOK_MAX_ATTEMPTS
+	} else {
+		delivery.ResponseStatus, err = send(*webhook, delivery, now)
+		delivery.Attempts++
+	}
+
+	switch {
+	case err == nil:
+		delivery.Status = STATUS_DELIVERED
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= config.ConfigAll.WEBHOOK_MAX_ATTEMPTS:
+		delivery.Status = STATUS_DEAD
+		delivery.LastError = errorText(err)
+		slog.Warn(LOGGER_HANDLER, "delivery", delivery.ID, "error", err)
+	default:
+		delivery.Status = STATUS_PENDING
+		delivery.LastError = errorText(err)
+		delivery.NextAttemptAt = now.Add(Backoff(delivery.Attempts))
+	}
+	return delivery
+}
+
+// errorText returns the error of a failed attempt cut to MAX_ERROR_LENGTH bytes.
+func errorText(err error) string {
+	text := err.Error()
+	if len(text) > MAX_ERROR_LENGTH {
+		text = text[:MAX_ERROR_LENGTH]
+	}
+	return text
+}
+
+// saveAttempt stores the outcome of an attempt.
+func saveAttempt(db *gorm.DB, delivery models.WebhookDelivery) error {
+	return db.Model(&delivery).
+		Select("status", "attempts", "response_status", "last_error", "delivered_at", "next_attempt_at").
+		Updates(&delivery).Error
+}
+
+// ProcessDue attempts the pending deliveries whose next attempt is due, at most
+// WEBHOOK_BATCH_SIZE of them.
+//
+// Requests are sent concurrently, database reads and writes happen before and after
+// them on the calling goroutine. A successful attempt marks the delivery delivered.
+// A failed attempt schedules the next one after Backoff, or moves the delivery to the
+// dead-letter log once WEBHOOK_MAX_ATTEMPTS attempts failed. Deliveries of deleted
+// webhooks are moved there directly.
+//
+// Parameters:
+// - db: the database.
+// - now: the current time.
+//
+// Returns:
+// - int: the number of attempted deliveries.
+// - error: a database error.
+func ProcessDue(db *gorm.DB, now time.Time) (int, error) {
+	var due []models.WebhookDelivery
+	err := db.Where("status = ? AND next_attempt_at <= ?", STATUS_PENDING, now).
+		Order("next_attempt_at").Limit(config.ConfigAll.WEBHOOK_BATCH_SIZE).Find(&due).Error
+	if err != nil || len(due) == 0 {
+		return 0, err
+	}
+
+	ids := make([]uint, 0, len(due))
+	for _, delivery := range due {
+		ids = append(ids, delivery.WebhookID)
+	}
+	var hooks []models.Webhook
+	if err := db.Where("id IN ?", ids).Find(&hooks).Error; err != nil {
+		return 0, err
+	}
+	byID := map[uint]*models.Webhook{}
+	for i := range hooks {
+		byID[hooks[i].ID] = &hooks[i]
+	}
+
+	var wg sync.WaitGroup
+	for i := range due {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			due[i] = attempt(byID[due[i].WebhookID], due[i], now)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, delivery := range due {
+		if err := saveAttempt(db, delivery); err != nil {
+			return len(due), err
+		}
+	}
+	return len(due), nil
+}
+
+// Redeliver schedules a delivery for an immediate new series of attempts, whatever its status.
+//
+// Parameters:
+// - db: the database.
+// - delivery: the delivery to send again.
+//
+// Returns:
+// - models.WebhookDelivery: the updated delivery.
+// - error: a database error.
+func Redeliver(db *gorm.DB, delivery models.WebhookDelivery) (models.WebhookDelivery, error) {
+	delivery.Status = STATUS_PENDING
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now()
+	result := db.Model(&delivery).Select("status", "attempts", "next_attempt_at").Updates(&delivery)
+	return delivery, result.Error
+}
+
+// Start raises link.expired events and delivers due webhooks every WEBHOOK_POLL_INTERVAL
+// in the background.
+// With prefork it runs in the master process only, so every delivery is sent by one process.
+//
+// Parameters:
+// - db: the database.
+func Start(db *gorm.DB) {
+	go func() {
+		for {
+			if _, err := NotifyExpired(db, time.Now()); err != nil {
+				slog.Error(LOGGER_HANDLER, err)
+			}
+			if _, err := ProcessDue(db, time.Now()); err != nil {
+				slog.Error(LOGGER_HANDLER, err)
+			}
+			time.Sleep(config.ConfigAll.WEBHOOK_POLL_INTERVAL)
+		}
+	}()
+}
@@ -0,0 +1,309 @@
+package webhooks
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/models"
+	"urlshort.ru/m/stats"
+)
+
+const LOGGER_HANDLER = "webhooks"
+
+const (
+	EVENT_LINK_CREATED = "link.created"
+	EVENT_LINK_UPDATED = "link.updated"
+	EVENT_LINK_DELETED = "link.deleted"
+	EVENT_LINK_EXPIRED = "link.expired"
+	EVENT_LINK_SPIKE   = "link.spike"
+	EVENT_CLICK        = "click"
+)
+
+const (
+	STATUS_PENDING   = "pending"
+	STATUS_DELIVERED = "delivered"
+	// STATUS_DEAD marks deliveries that failed WEBHOOK_MAX_ATTEMPTS times. They form the
+	// dead-letter log and are only sent again on an explicit redelivery.
+	STATUS_DEAD = "dead"
+)
+
+// Events lists the events a webhook can subscribe to.
+var Events = []string{EVENT_LINK_CREATED, EVENT_LINK_UPDATED, EVENT_LINK_DELETED, EVENT_LINK_EXPIRED, EVENT_LINK_SPIKE, EVENT_CLICK}
+
+// Envelope is the JSON body of every delivery. ID is the same for all attempts and
+// redeliveries of an event, so receivers can drop duplicates.
+type Envelope struct {
+	ID        string    `json:"id"`
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// LinkData is the data of the link events.
+type LinkData struct {
+	ID              uint       `json:"id"`
+	ShortURL        string     `json:"short_url"`
+	OriginalURL     string     `json:"original_url"`
+	FallbackURL     string     `json:"fallback_url,omitempty"`
+	StatsVisibility string     `json:"stats_visibility"`
+	NoTracking      bool       `json:"no_tracking"`
+	Blocked         bool       `json:"blocked"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// SpikeData is the data of a link.spike event, raised when the clicks of a link in an hour
+// exceed its baseline. Action is the protection applied to the link: none, throttle or pause.
+type SpikeData struct {
+	ShortURL  string    `json:"short_url"`
+	Bucket    time.Time `json:"bucket"`
+	Clicks    int64     `json:"clicks"`
+	Baseline  float64   `json:"baseline"`
+	Threshold float64   `json:"threshold"`
+	Action    string    `json:"action"`
+}
+
+// ClickData is one click of a click event.
+type ClickData struct {
+	ClickID   string    `json:"click_id,omitempty"`
+	ShortURL  string    `json:"short_url"`
+	CreatedAt time.Time `json:"created_at"`
+	Traffic   string    `json:"traffic"`
+	Anonymous bool      `json:"anonymous"`
+	Fallback  bool      `json:"fallback"`
+	Referrer  string    `json:"referrer,omitempty"`
+	Browser   string    `json:"browser,omitempty"`
+	OS        string    `json:"os,omitempty"`
+	Device    string    `json:"device,omitempty"`
+	Country   string    `json:"country,omitempty"`
+	Region    string    `json:"region,omitempty"`
+	City      string    `json:"city,omitempty"`
+}
+
+// ClickBatch is the data of a click event. Clicks are written in batches, so one event
+// carries every click of a batch that belongs to links of the webhook owner.
+type ClickBatch struct {
+	Clicks []ClickData `json:"clicks"`
+}
+
+// IsEvent reports whether the value is a known event.
+func IsEvent(event string) bool {
+	for _, known := range Events {
+		if event == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscribed reports whether a webhook receives an event.
+func Subscribed(webhook models.Webhook, event string) bool {
+	for _, item := range strings.Split(webhook.Events, ",") {
+		if item == event {
+			return true
+		}
+	}
+	return false
+}
+
+// NewSecret returns a random signing secret for a webhook.
+func NewSecret() (string, error) {
+	return randomHex(32)
+}
+
+// randomHex returns size random bytes encoded as hex.
+func randomHex(size int) (string, error) {
+	value := make([]byte, size)
+	if _, err := rand.Read(value); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(value), nil
+}
+
+// NewLinkData returns the event data of a link.
+func NewLinkData(url models.URL) LinkData {
+	return LinkData{
+		ID:              url.ID,
+		ShortURL:        url.ShortURL,
+		OriginalURL:     url.OriginalURL,
+		FallbackURL:     url.FallbackURL,
+		StatsVisibility: url.StatsVisibility,
+		NoTracking:      url.NoTracking,
+		Blocked:         url.Blocked,
+		ExpiresAt:       url.ExpiresAt,
+		CreatedAt:       url.CreatedAt,
+	}
+}
+
+// NewClickData returns the event data of a click. Referrers are reduced to their domain.
+func NewClickData(click models.Click, shortURL string) ClickData {
+	data := ClickData{
+		ClickID:   click.ClickID,
+		ShortURL:  shortURL,
+		CreatedAt: click.CreatedAt,
+		Traffic:   click.Traffic,
+		Anonymous: click.Anonymous,
+		Fallback:  click.Fallback,
+		Browser:   click.Browser,
+		OS:        click.OS,
+		Device:    click.Device,
+		Country:   click.Country,
+		Region:    click.Region,
+		City:      click.City,
+	}
+	if !click.Anonymous {
+		data.Referrer = stats.ReferrerDomain(click.Referrer)
+	}
+	return data
+}
+
+// Enqueue stores a pending delivery of an event for every webhook of a user subscribed to it.
+//
+// Parameters:
+// - db: the database.
+// - userID: the owner of the link the event is about, nil for links without owner.
+// - event: the event name.
+// - data: the event data, encoded as JSON.
+//
+// Returns:
+// - int: the number of stored deliveries.
+// - error: a database or encoding error.
+func Enqueue(db *gorm.DB, userID *uint, event string, data any) (int, error) {
+	if userID == nil {
+		return 0, nil
+	}
+	var hooks []models.Webhook
+	if err := db.Where("user_id = ?", *userID).Find(&hooks).Error; err != nil {
+		return 0, err
+	}
+
+	var deliveries []models.WebhookDelivery
+	for _, hook := range hooks {
+		if !Subscribed(hook, event) {
+			continue
+		}
+		id, err := randomHex(16)
+		if err != nil {
+			return 0, err
+		}
+		now := time.Now()
+		payload, err := json.Marshal(Envelope{ID: id, Event: event, CreatedAt: now, Data: data})
+		if err != nil {
+			return 0, err
+		}
+		deliveries = append(deliveries, models.WebhookDelivery{
+			WebhookID:     hook.ID,
+			EventID:       id,
+			Event:         event,
+			Payload:       string(payload),
+			Status:        STATUS_PENDING,
+			NextAttemptAt: now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return 0, nil
+	}
+	return len(deliveries), db.Create(&deliveries).Error
+}
+
+// NotifyLink enqueues a link event. Errors are logged, they never fail the request that changed the link.
+//
+// Parameters:
+// - db: the database.
+// - event: EVENT_LINK_CREATED, EVENT_LINK_UPDATED or EVENT_LINK_DELETED.
+// - url: the link.
+func NotifyLink(db *gorm.DB, event string, url models.URL) {
+	if _, err := Enqueue(db, url.UserID, event, NewLinkData(url)); err != nil {
+		slog.Error(LOGGER_HANDLER, err)
+	}
+}
+
+// NotifyClicks enqueues one click event per link owner for a written batch of clicks.
+// Errors are logged, the clicks are already stored.
+//
+// Parameters:
+// - db: the database.
+// - batch: the written clicks.
+func NotifyClicks(db *gorm.DB, batch []models.Click) {
+	ids := map[uint]bool{}
+	for _, click := range batch {
+		ids[click.URLID] = true
+	}
+	urlIDs := make([]uint, 0, len(ids))
+	for id := range ids {
+		urlIDs = append(urlIDs, id)
+	}
+
+	var urls []models.URL
+	err := db.Select("id", "short_url", "user_id").Where("id IN ? AND user_id IS NOT NULL", urlIDs).Find(&urls).Error
+	if err != nil {
+		slog.Error(LOGGER_HANDLER, err)
+		return
+	}
+	links := map[uint]models.URL{}
+	for _, url := range urls {
+		links[url.ID] = url
+	}
+
+	perOwner := map[uint]*ClickBatch{}
+	for _, click := range batch {
+		url, ok := links[click.URLID]
+		if !ok {
+			continue
+		}
+		data, ok := perOwner[*url.UserID]
+		if !ok {
+			data = &ClickBatch{}
+			perOwner[*url.UserID] = data
+		}
+		data.Clicks = append(data.Clicks, NewClickData(click, url.ShortURL))
+	}
+
+	for owner, data := range perOwner {
+		owner := owner
+		if _, err := Enqueue(db, &owner, EVENT_CLICK, data); err != nil {
+			slog.Error(LOGGER_HANDLER, err)
+		}
+	}
+}
+
+// NotifyExpired enqueues a link.expired event for every link whose expiry has passed,
+// at most WEBHOOK_BATCH_SIZE links per call. Each link is marked before its event is
+// enqueued, so the event is raised once even if several processes sweep at the same time.
+//
+// Parameters:
+// - db: the database.
+// - now: the current time.
+//
+// Returns:
+// - int: the number of expired links.
+// - error: a database error.
+func NotifyExpired(db *gorm.DB, now time.Time) (int, error) {
+	var expired []models.URL
+	err := db.Where("expires_at <= ? AND expiry_notified = ?", now, false).
+		Order("expires_at").Limit(config.ConfigAll.WEBHOOK_BATCH_SIZE).Find(&expired).Error
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, url := range expired {
+		result := db.Model(&models.URL{}).Where("id = ? AND expiry_notified = ?", url.ID, false).
+			UpdateColumn("expiry_notified", true)
+		if result.Error != nil {
+			return count, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		NotifyLink(db, EVENT_LINK_EXPIRED, url)
+		count++
+	}
+	return count, nil
+}
@@ -0,0 +1,260 @@
+package webhooks_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"urlshort.ru/m/config"
+	"urlshort.ru/m/models"
+	"urlshort.ru/m/outbound"
+	"urlshort.ru/m/webhooks"
+)
+
+// receiver is a local webhook endpoint that checks signatures and records requests.
+type receiver struct {
+	mu       sync.Mutex
+	secret   string
+	status   int
+	requests []webhooks.Envelope
+	invalid  int
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, request *http.Request) {
+	body, _ := io.ReadAll(request.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var timestamp int64
+	var signature string
+	fmt.Sscanf(request.Header.Get(webhooks.HEADER_SIGNATURE), "t=%d,v1=%s", &timestamp, &signature)
+	if signature != webhooks.Sign(r.secret, timestamp, body) {
+		r.invalid++
+	}
+	var envelope webhooks.Envelope
+	json.Unmarshal(body, &envelope)
+	if request.Header.Get(webhooks.HEADER_EVENT) != envelope.Event || request.Header.Get(webhooks.HEADER_ID) != envelope.ID {
+		r.invalid++
+	}
+	r.requests = append(r.requests, envelope)
+	w.WriteHeader(r.status)
+	w.Write([]byte("receiver response"))
+}
+
+// setup registers a webhook of a user for the given events on a new local receiver.
+func setup(t *testing.T, userID uint, events string) (*receiver, models.Webhook) {
+	db := models.DATABASE
+	var old []models.Webhook
+	db.Unscoped().Where("user_id = ?", userID).Find(&old)
+	for _, hook := range old {
+		db.Unscoped().Where("webhook_id = ?", hook.ID).Delete(&models.WebhookDelivery{})
+		db.Unscoped().Delete(&hook)
+	}
+
+	target := &receiver{secret: "secret", status: http.StatusOK}
+	server := httptest.NewServer(target)
+	t.Cleanup(server.Close)
+
+	// The receiver listens on loopback, which the default client refuses.
+	client := webhooks.Client
+	webhooks.Client = server.Client()
+	t.Cleanup(func() { webhooks.Client = client })
+
+	hook := models.Webhook{UserID: userID, URL: server.URL, Secret: target.secret, Events: events}
+	if err := db.Create(&hook).Error; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return target, hook
+}
+
+// deliveries returns the deliveries of a webhook.
+func deliveries(t *testing.T, hook models.Webhook) []models.WebhookDelivery {
+	var result []models.WebhookDelivery
+	if err := models.DATABASE.Where("webhook_id = ?", hook.ID).Order("id").Find(&result).Error; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return result
+}
+
+// TestDeliver tests that subscribed events are signed and delivered once.
+func TestDeliver(t *testing.T) {
+	db := models.DATABASE
+	userID := uint(9001)
+	target, hook := setup(t, userID, webhooks.EVENT_LINK_CREATED+","+webhooks.EVENT_LINK_DELETED)
+
+	url := models.URL{ShortURL: "hook", OriginalURL: "https://example.com/hook", UserID: &userID}
+	webhooks.NotifyLink(db, webhooks.EVENT_LINK_CREATED, url)
+	webhooks.NotifyLink(db, webhooks.EVENT_LINK_UPDATED, url)
+	webhooks.NotifyLink(db, webhooks.EVENT_LINK_CREATED, models.URL{ShortURL: "anonymous"})
+
+	now := time.Now()
+	if _, err := webhooks.ProcessDue(db, now); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := webhooks.ProcessDue(db, now); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(target.requests) != 1 || target.invalid != 0 {
+		t.Fatalf("Expected one valid request, got %d with %d invalid", len(target.requests), target.invalid)
+	}
+	data := target.requests[0].Data.(map[string]any)
+	if target.requests[0].Event != webhooks.EVENT_LINK_CREATED || data["short_url"] != "hook" {
+		t.Errorf("Unexpected request: %+v", target.requests[0])
+	}
+	stored := deliveries(t, hook)
+	if len(stored) != 1 || stored[0].Status != webhooks.STATUS_DELIVERED || stored[0].Attempts != 1 || stored[0].DeliveredAt == nil {
+		t.Errorf("Unexpected deliveries: %+v", stored)
+	}
+}
+
+// TestRetry tests exponential backoff, the dead-letter log and redelivery.
+func TestRetry(t *testing.T) {
+	db := models.DATABASE
+	config.ConfigAll.WEBHOOK_MAX_ATTEMPTS = 3
+	config.ConfigAll.WEBHOOK_RETRY_BASE = time.Minute
+	config.ConfigAll.WEBHOOK_RETRY_MAX = time.Hour
+	userID := uint(9002)
+	target, hook := setup(t, userID, webhooks.EVENT_LINK_UPDATED)
+	target.status = http.StatusInternalServerError
+
+	webhooks.NotifyLink(db, webhooks.EVENT_LINK_UPDATED, models.URL{ShortURL: "retry", UserID: &userID})
+
+	now := time.Now()
+	schedule := []time.Duration{0, time.Minute, 3 * time.Minute}
+	for i, offset := range schedule {
+		// An attempt just before the scheduled time must not send anything.
+		if offset > 0 {
+			webhooks.ProcessDue(db, now.Add(offset-time.Second))
+		}
+		if _, err := webhooks.ProcessDue(db, now.Add(offset)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(target.requests) != i+1 {
+			t.Fatalf("Expected %d requests after %v, got %d", i+1, offset, len(target.requests))
+		}
+	}
+
+	stored := deliveries(t, hook)
+	if len(stored) != 1 || stored[0].Status != webhooks.STATUS_DEAD || stored[0].Attempts != 3 || stored[0].ResponseStatus != 500 {
+		t.Fatalf("Expected a dead delivery, got %+v", stored)
+	}
+	if strings.Contains(stored[0].LastError, "receiver response") {
+		t.Errorf("Expected the response body to stay out of the error, got %q", stored[0].LastError)
+	}
+	if got := webhooks.Backoff(10); got != time.Hour {
+		t.Errorf("Expected backoff to be capped, got %v", got)
+	}
+
+	target.status = http.StatusNoContent
+	if _, err := webhooks.Redeliver(db, stored[0]); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := webhooks.ProcessDue(db, time.Now()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	stored = deliveries(t, hook)
+	if stored[0].Status != webhooks.STATUS_DELIVERED || target.requests[3].ID != target.requests[0].ID {
+		t.Errorf("Expected the same event to be delivered again, got %+v", stored[0])
+	}
+}
+
+// TestNotifyClicks tests that a batch of clicks is sent as one event per owner.
+func TestNotifyClicks(t *testing.T) {
+	db := models.DATABASE
+	userID := uint(9003)
+	target, hook := setup(t, userID, webhooks.EVENT_CLICK)
+
+	urls := []models.URL{
+		{OriginalURL: "https://example.com/hook-a", ShortURL: "hook-a", UserID: &userID},
+		{OriginalURL: "https://example.com/hook-b", ShortURL: "hook-b", UserID: &userID},
+		{OriginalURL: "https://example.com/hook-c", ShortURL: "hook-c"},
+	}
+	batch := []models.Click{}
+	for i := range urls {
+		db.Unscoped().Where("short_url = ?", urls[i].ShortURL).Delete(&models.URL{})
+		if err := db.Create(&urls[i]).Error; err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		batch = append(batch, models.Click{URLID: urls[i].ID, Traffic: models.TRAFFIC_HUMAN, Referrer: "https://www.google.com/search"})
+	}
+	batch = append(batch, models.Click{URLID: urls[0].ID, Traffic: models.TRAFFIC_BOT})
+
+	webhooks.NotifyClicks(db, batch)
+	if _, err := webhooks.ProcessDue(db, time.Now()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(target.requests) != 1 || len(deliveries(t, hook)) != 1 {
+		t.Fatalf("Expected one event, got %d", len(target.requests))
+	}
+	clicks := target.requests[0].Data.(map[string]any)["clicks"].([]any)
+	first := clicks[0].(map[string]any)
+	if len(clicks) != 3 || first["short_url"] != "hook-a" || first["referrer"] != "google.com" {
+		t.Errorf("Unexpected clicks: %+v", clicks)
+	}
+}
+
+// TestRefuseLocal tests that the default client does not deliver to internal addresses.
+func TestRefuseLocal(t *testing.T) {
+	db := models.DATABASE
+	userID := uint(9004)
+	target, hook := setup(t, userID, webhooks.EVENT_LINK_UPDATED)
+	webhooks.Client = webhooks.NewClient()
+
+	webhooks.NotifyLink(db, webhooks.EVENT_LINK_UPDATED, models.URL{ShortURL: "local", UserID: &userID})
+	if _, err := webhooks.ProcessDue(db, time.Now()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	stored := deliveries(t, hook)
+	if len(target.requests) != 0 || len(stored) != 1 || stored[0].Status != webhooks.STATUS_PENDING || stored[0].ResponseStatus != 0 {
+		t.Fatalf("Expected the loopback receiver to be refused, got %d requests and %+v", len(target.requests), stored)
+	}
+	if !strings.Contains(stored[0].LastError, outbound.ErrForbiddenAddress.Error()) {
+		t.Errorf("Unexpected error: %q", stored[0].LastError)
+	}
+}
+
+// TestNotifyExpired tests that link.expired is raised once per expired link.
+func TestNotifyExpired(t *testing.T) {
+	db := models.DATABASE
+	userID := uint(9005)
+	target, hook := setup(t, userID, webhooks.EVENT_LINK_EXPIRED)
+
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+	urls := []models.URL{
+		{OriginalURL: "https://example.com/expired", ShortURL: "hook-expired", UserID: &userID, ExpiresAt: &past},
+		{OriginalURL: "https://example.com/expiring", ShortURL: "hook-expiring", UserID: &userID, ExpiresAt: &future},
+	}
+	for i := range urls {
+		db.Unscoped().Where("short_url = ?", urls[i].ShortURL).Delete(&models.URL{})
+		if err := db.Create(&urls[i]).Error; err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := webhooks.NotifyExpired(db, now); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if _, err := webhooks.ProcessDue(db, time.Now()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(target.requests) != 1 || len(deliveries(t, hook)) != 1 {
+		t.Fatalf("Expected one event, got %d", len(target.requests))
+	}
+	data := target.requests[0].Data.(map[string]any)
+	if target.requests[0].Event != webhooks.EVENT_LINK_EXPIRED || data["short_url"] != "hook-expired" || data["expires_at"] == nil {
+		t.Errorf("Unexpected request: %+v", target.requests[0])
+	}
+}